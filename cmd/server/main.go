@@ -14,20 +14,29 @@ import (
 
 	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/api/handlers"
+	"double-take-go-reborn/internal/api/middleware"
 	"double-take-go-reborn/internal/core/processor"
 	"double-take-go-reborn/internal/db"
 	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/commands"
 	"double-take-go-reborn/internal/integrations/compreface"
 	"double-take-go-reborn/internal/integrations/frigate"
 	"double-take-go-reborn/internal/integrations/homeassistant"
 	"double-take-go-reborn/internal/integrations/mqtt"
 	"double-take-go-reborn/internal/integrations/provider"
 	"double-take-go-reborn/internal/server/sse"
+	"double-take-go-reborn/internal/services/audit"
+	"double-take-go-reborn/internal/services/auth"
 	"double-take-go-reborn/internal/services/cleanup"
+	"double-take-go-reborn/internal/services/clustering"
+	"double-take-go-reborn/internal/services/presence"
+	"double-take-go-reborn/internal/services/similarity"
 	"double-take-go-reborn/internal/services/sync"
 	"double-take-go-reborn/internal/util/timezone"
 
 	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"io"
@@ -98,11 +107,15 @@ func main() {
 	
 	// 5.1 Provider-Manager für Gesichtserkennung initialisieren
 	log.Info("Initializing face recognition provider manager...")
-	providerManager, err := provider.CreateManager(cfg)
+	providerManager, err := provider.CreateManager(cfg, db.DB)
 	if err != nil {
 		log.Warnf("Error initializing face recognition provider manager: %v", err)
 	}
 	log.Infof("Face recognition provider manager initialized with active provider: %s", providerManager.GetActiveProviderName())
+	
+	// Zustandsüberwachung für automatisches Failover starten
+	providerManager.StartHealthChecks()
+	defer providerManager.StopHealthChecks()
 
 	// 6. SSE-Hub für Echtzeit-Updates initialisieren
 	log.Info("Initializing SSE hub...")
@@ -149,6 +162,8 @@ func main() {
 
 	// 8. MQTT-Client erstellen, falls aktiviert
 	var mqttClient *mqtt.Client
+	var haPublisher *homeassistant.Publisher
+	var commandHandler *commands.Handler
 	if cfg.MQTT.Enabled {
 		log.Info("MQTT integration enabled, initializing client...")
 		mqttClient = mqtt.NewClient(cfg.MQTT)
@@ -157,6 +172,15 @@ func main() {
 		mqttHandler := NewMQTTHandler(imageProcessor, cfg)
 		mqttClient.RegisterHandler(mqttHandler)
 		
+		// Befehle aus Home Assistant und anderen Clients annehmen
+		if cfg.MQTT.Commands.Enabled {
+			commandHandler = commands.NewHandler(db.DB, cfg, mqttClient, imageProcessor, compreFaceClient, frigateClient)
+			mqttHandler.SetCommandHandler(commandHandler)
+			if err := commandHandler.Subscribe(); err != nil {
+				log.Errorf("Failed to subscribe to MQTT commands: %v", err)
+			}
+		}
+		
 		// MQTT-Client starten
 		if err := mqttClient.Start(); err != nil {
 			log.Fatalf("Failed to start MQTT client: %v", err)
@@ -165,32 +189,28 @@ func main() {
 		// Home Assistant Integration (falls aktiviert)
 		if cfg.MQTT.HomeAssistant.Enabled {
 			// Discovery-Manager initialisieren
-			discoveryManager := homeassistant.NewDiscoveryManager(mqttClient, cfg)
+			discoveryManager := homeassistant.NewDiscoveryManager(mqttClient, cfg, db.DB)
 			
 			// Publisher initialisieren
-			haPublisher := homeassistant.NewPublisher(mqttClient, cfg)
-			
-			// Timer für das Zurücksetzen von Personenzählern starten
-			haPublisher.StartResetTimers()
+			haPublisher = homeassistant.NewPublisher(mqttClient, cfg)
+			haPublisher.SetDiscoveryManager(discoveryManager)
+			if commandHandler != nil {
+				discoveryManager.SetCommandState(commandHandler)
+			}
 			
 			// Status als "online" veröffentlichen
 			if err := discoveryManager.PublishAvailability(true); err != nil {
 				log.Errorf("Failed to publish Home Assistant availability: %v", err)
 			}
 			
-			// Alle bekannten Identitäten aus der Datenbank laden
-			var identities []models.Identity
-			if err := db.DB.Find(&identities).Error; err != nil {
-				log.Errorf("Failed to load identities for Home Assistant discovery: %v", err)
-			} else {
-				// Discovery-Konfigurationen für alle Identitäten veröffentlichen
-				if err := discoveryManager.RegisterIdentities(identities); err != nil {
-					log.Errorf("Failed to register Home Assistant sensors: %v", err)
-				} else {
-					log.Infof("Successfully registered %d identities with Home Assistant", len(identities))
-				}
+			// Discovery-Konfigurationen für alle Identitäten und Kameras veröffentlichen
+			if err := discoveryManager.Sync(); err != nil {
+				log.Errorf("Failed to register Home Assistant sensors: %v", err)
 			}
 			
+			// Entitäten bei Änderungen an Identitäten und neuen Kameras aktualisieren
+			go discoveryManager.Start(context.Background())
+			
 			// ImageProcessor mit dem Publisher verbinden
 			imageProcessor.SetHomeAssistantPublisher(haPublisher)
 			
@@ -202,6 +222,18 @@ func main() {
 			}()
 		}
 		
+		// Erkennungsergebnisse auf den Topics matches und cameras veröffentlichen
+		if cfg.MQTT.Results.Enabled {
+			resultPublisher := haPublisher
+			if resultPublisher == nil {
+				resultPublisher = homeassistant.NewPublisher(mqttClient, cfg)
+			}
+			
+			// Timer für das Zurücksetzen von Personenzählern starten
+			resultPublisher.StartResetTimers()
+			imageProcessor.SetResultPublisher(resultPublisher)
+		}
+		
 		// Sicherstellen, dass der MQTT-Client beim Beenden gestoppt wird
 		defer func() {
 			if mqttClient != nil {
@@ -212,14 +244,56 @@ func main() {
 		log.Info("MQTT integration is disabled")
 	}
 
+	// 8.1 Frigate-Events über die API abfragen (Ergänzung zu MQTT und für Backfills)
+	var frigatePoller *frigate.EventPoller
+	if frigateClient != nil {
+		frigatePoller = frigate.NewEventPoller(frigateClient, db.DB, cfg.Frigate, imageProcessor)
+	}
+
 	// 8. Cleanup-Service initialisieren
 	log.Info("Initializing cleanup service...")
 	cleanupService := cleanup.NewCleanupService(db.DB, cfg.Cleanup, cfg.Server.SnapshotDir)
 	go cleanupService.Start(context.Background())
+	if commandHandler != nil {
+		commandHandler.SetCleanupService(cleanupService)
+	}
+
+	// 8.1. Unbekannte Gesichter anhand ihrer Embeddings gruppieren
+	clusterService := clustering.NewService(db.DB, cfg.Clustering)
+	imageProcessor.SetFaceClusterer(clusterService)
+	go clusterService.Start(context.Background())
+
+	// 8.2. Erkennungen zu Aufenthalten zusammenfassen, Ankunft und Verlassen über SSE und MQTT melden
+	presenceService := presence.NewService(db.DB, cfg.Presence)
+	presenceService.AddListener(sseHub.BroadcastPresence)
+	if mqttClient != nil {
+		presencePublisher := haPublisher
+		if presencePublisher == nil {
+			presencePublisher = homeassistant.NewPublisher(mqttClient, cfg)
+		}
+		presenceService.AddListener(func(event models.PresenceEvent) {
+			if err := presencePublisher.PublishPresence(event); err != nil {
+				log.Errorf("Failed to publish presence event: %v", err)
+			}
+		})
+	}
+	imageProcessor.SetPresenceTracker(presenceService)
+	go presenceService.Start(context.Background())
 	
 	// 9. Sync-Service für ausstehende Operationen initialisieren
 	log.Info("Initializing sync service for pending operations...")
 	syncService := sync.NewService(db.DB, cfg, compreFaceClient)
+	
+	// Bilder mit fehlgeschlagener Erkennung über den SyncService erneut verarbeiten
+	syncService.SetImageReprocessor(imageProcessor)
+	imageProcessor.SetPendingQueue(syncService)
+
+	// Worker und Frigate-Poller erst starten, wenn der ImageProcessor vollständig
+	// verdrahtet ist, damit auch fortgesetzte Aufträge alle Schritte durchlaufen
+	workerPool.Start()
+	if frigatePoller != nil {
+		frigatePoller.Start()
+	}
 	go syncService.Start()
 
 	// 9.1. CompreFace-Synchronisations-Timer starten, falls konfiguriert
@@ -255,6 +329,33 @@ func main() {
 	// 10. Web-Server initialisieren
 	router := setupRouter(cfg)
 
+	// Anmeldung und Rollen, muss vor allen Routen registriert werden
+	var authService *auth.Service
+	if cfg.Auth.Enabled {
+		log.Info("Authentication enabled, setting up sessions and access control...")
+		authService = auth.NewService(db.DB, cfg.Auth)
+		if err := authService.EnsureAdmin(); err != nil {
+			log.Fatalf("Failed to create initial admin user: %v", err)
+		}
+		sessionKey, err := authService.SessionSecret(cfg.Server.DataDir)
+		if err != nil {
+			log.Fatalf("Failed to load session secret: %v", err)
+		}
+
+		store := cookie.NewStore(sessionKey)
+		store.Options(sessions.Options{
+			Path:     "/",
+			MaxAge:   authService.SessionMaxAge(),
+			HttpOnly: true,
+			Secure:   authService.SecureCookie(),
+			SameSite: http.SameSiteLaxMode,
+		})
+		router.Use(sessions.Sessions("double_take_session", store))
+		router.Use(middleware.Auth(authService))
+	} else {
+		log.Warn("Authentication is disabled - web UI and API are accessible without login")
+	}
+
 	// 11. Web- und API-Handler erstellen und Routen registrieren
 	log.Info("Setting up web and API handlers...")
 	
@@ -264,12 +365,36 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize WebHandler: %v", err)
 	}
+	webHandler.SetProviderManager(providerManager)
+	webHandler.SetImageProcessor(imageProcessor)
+	webHandler.SetClusterService(clusterService)
 	webHandler.RegisterRoutes(router)
 
+	// Anmeldung, Benutzer und API-Tokens
+	if authService != nil {
+		authHandler := handlers.NewAuthHandler(authService, webHandler)
+		authHandler.RegisterRoutes(router)
+	}
+
 	// API-Routes
 	apiGroup := router.Group("/api")
 	apiHandler := handlers.NewAPIHandler(db.DB, cfg, compreFaceClient, imageProcessor, syncService)
+	apiHandler.SetFrigatePoller(frigatePoller)
+	apiHandler.SetClusterService(clusterService)
+	apiHandler.SetSimilarityService(similarity.NewService(db.DB))
+	apiHandler.SetPresenceService(presenceService)
 	apiHandler.RegisterRoutes(apiGroup)
+
+	// Audit-Log für Korrekturen an Identitäten, Treffern und Trainingsdaten
+	auditHandler := handlers.NewAuditHandler(audit.NewService(db.DB))
+	auditHandler.RegisterRoutes(apiGroup)
+
+	// Webhook-Endpunkt für andere Kameras, Türklingeln und Skripte
+	if cfg.Webhook.Enabled {
+		log.Info("Webhook integration enabled, registering /api/webhook/:source...")
+		webhookHandler := handlers.NewWebhookHandler(imageProcessor, cfg)
+		webhookHandler.RegisterRoutes(apiGroup)
+	}
 	
 	// Event-Handler
 	log.Info("Initializing event handler...")
@@ -306,6 +431,12 @@ func main() {
 	log.Infof("Received signal %v, shutting down gracefully...", sig)
 	
 	// Signal zum Aufräumen und Schließen der Ressourcen
+	// Keine neuen Frigate-Events mehr abfragen
+	if frigatePoller != nil {
+		log.Info("Stopping Frigate event polling...")
+		frigatePoller.Stop()
+	}
+
 	// Zuerst den Worker-Pool beenden
 	log.Info("Shutting down worker pool...")
 	workerPool.Shutdown()
@@ -326,6 +457,7 @@ func main() {
 type MQTTHandler struct {
 	processor *processor.ImageProcessor
 	cfg       *config.Config
+	commands  *commands.Handler // Führt Befehle unter <topic_prefix>/cmd/... aus (optional)
 }
 
 // NewMQTTHandler erstellt einen neuen MQTT-Handler
@@ -336,11 +468,21 @@ func NewMQTTHandler(processor *processor.ImageProcessor, cfg *config.Config) *MQ
 	}
 }
 
+// SetCommandHandler setzt den Handler für MQTT-Befehle
+func (h *MQTTHandler) SetCommandHandler(handler *commands.Handler) {
+	h.commands = handler
+}
+
 // HandleMessage verarbeitet eine MQTT-Nachricht
 func (h *MQTTHandler) HandleMessage(topic string, payload []byte) {
 	ctx := context.Background()
 	log.Debugf("Received MQTT message on topic: %s", topic)
 	
+	if h.commands != nil && h.commands.Matches(topic) {
+		h.commands.HandleCommand(topic, payload)
+		return
+	}
+	
 	// Überprüfen, ob das Topic zu den relevanten Frigate-Topics gehört
 	configTopic := h.cfg.MQTT.Topic
 
@@ -371,6 +513,10 @@ func (h *MQTTHandler) processPersonSnapshot(ctx context.Context, topic string, p
 	}
 	
 	cameraName := parts[1]
+	if !h.processor.CameraActive(cameraName) {
+		log.Debugf("Ignoring person snapshot: processing for camera %s is not active", cameraName)
+		return
+	}
 	
 	// Snapshot-Datei generieren
 	timestamp := timezone.Now().Format("20060102-150405")
@@ -402,9 +548,11 @@ func (h *MQTTHandler) processPersonSnapshot(ctx context.Context, topic string, p
 	log.Infof("Saved person snapshot to: %s", fullPath)
 	
 	// Bild zur Verarbeitung weiterleiten
-	_, err = h.processor.ProcessImage(ctx, fullPath, "frigate", processor.ProcessingOptions{})
+	err = h.processor.EnqueueImage(fullPath, "frigate", processor.ProcessingOptions{
+		Priority: processor.PriorityNew,
+	})
 	if err != nil {
-		log.Errorf("Failed to process snapshot image: %v", err)
+		log.Errorf("Failed to queue snapshot image: %v", err)
 		return
 	}
 }
@@ -506,15 +654,24 @@ func setupRouter(cfg *config.Config) *gin.Engine {
 	router.Use(gin.Recovery())
 	router.Use(loggerMiddleware())
 	
-	// CORS konfigurieren
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// CORS konfigurieren: Mit Anmeldedaten nur für explizit erlaubte Origins.
+	// Ohne Liste bleibt die API bei deaktivierter Anmeldung für alle Origins
+	// lesbar, bei aktivierter Anmeldung sind nur Anfragen vom selben Origin möglich.
+	corsConfig := cors.Config{
+		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"},
+		ExposeHeaders: []string{"Content-Length"},
+		MaxAge:        12 * time.Hour,
+	}
+	switch {
+	case len(cfg.Server.CORSOrigins) > 0:
+		corsConfig.AllowOrigins = cfg.Server.CORSOrigins
+		corsConfig.AllowCredentials = true
+		router.Use(cors.New(corsConfig))
+	case !cfg.Auth.Enabled:
+		corsConfig.AllowAllOrigins = true
+		router.Use(cors.New(corsConfig))
+	}
 	
 	// Hinweis: Die Sprachauswahl wird jetzt direkt in den Handlern implementiert
 	
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	log "github.com/sirupsen/logrus"
@@ -25,6 +28,138 @@ type Config struct {
 	Sync       SyncConfig       `mapstructure:"sync"`
 	// FaceRecognitionProvider bestimmt, welcher Gesichtserkennungsanbieter verwendet wird ("compreface" oder "insightface")
 	FaceRecognitionProvider string `mapstructure:"face_recognition_provider"`
+	// Ensemble kombiniert die Ergebnisse aller aktivierten Gesichtserkennungsanbieter
+	Ensemble   EnsembleConfig   `mapstructure:"ensemble"`
+	// ProviderHealth steuert Zustandsüberwachung und Failover der Gesichtserkennungsanbieter
+	ProviderHealth ProviderHealthConfig `mapstructure:"provider_health"`
+	// Processor steuert den Worker-Pool und die persistente Verarbeitungs-Queue
+	Processor  ProcessorConfig  `mapstructure:"processor"`
+	// Webhook nimmt Bilder anderer Kameras und Skripte über /api/webhook/:source entgegen
+	Webhook    WebhookConfig    `mapstructure:"webhook"`
+	// Auth steuert Anmeldung und Rollen für Weboberfläche und REST-API
+	Auth       AuthConfig       `mapstructure:"auth"`
+	// Training steuert den Zuschnitt der Gesichter, die als Trainingsbeispiele verwendet werden
+	Training   TrainingConfig   `mapstructure:"training"`
+	// Clustering gruppiert unbekannte Gesichter anhand ihrer Embeddings
+	Clustering ClusteringConfig `mapstructure:"clustering"`
+	// Presence fasst Erkennungen zu Aufenthalten zusammen und meldet Ankunft und Verlassen
+	Presence   PresenceConfig   `mapstructure:"presence"`
+	// Cameras enthält abweichende Verarbeitungsregeln je Kamera (Namen in Kleinbuchstaben)
+	Cameras    map[string]CameraConfig `mapstructure:"cameras"`
+}
+
+// CameraConfig enthält die Verarbeitungsregeln einer Kamera. Nicht gesetzte Werte
+// übernehmen die globalen Einstellungen.
+type CameraConfig struct {
+	Enabled           *bool    `mapstructure:"enabled"`             // false = Kamera wird nicht verarbeitet
+	ProcessPersonOnly *bool    `mapstructure:"process_person_only"` // Überschreibt frigate.process_person_only
+	Zones             []string `mapstructure:"zones"`               // Nur Events in einer dieser Frigate-Zonen (leer = alle)
+	IgnoreZones       []string `mapstructure:"ignore_zones"`        // Events, die nur in diesen Zonen liegen, ignorieren
+	Schedule          []string `mapstructure:"schedule"`            // Aktive Zeitfenster "HH:MM-HH:MM" (leer = immer)
+	MinScore          float64  `mapstructure:"min_score"`           // Minimaler Frigate-Score (0-1)
+	MinFaceSize       int      `mapstructure:"min_face_size"`       // Minimale Kantenlänge eines Gesichts in Pixeln
+	Threshold         float64  `mapstructure:"threshold"`           // Eigener Schwellwert für Treffer (0-1)
+}
+
+// IsEnabled gibt zurück, ob die Kamera verarbeitet wird (Standard true)
+func (c CameraConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// ScheduleActive prüft, ob der Zeitpunkt in einem der Zeitfenster liegt. Ohne
+// Zeitfenster ist die Kamera immer aktiv.
+func (c CameraConfig) ScheduleActive(t time.Time) bool {
+	if len(c.Schedule) == 0 {
+		return true
+	}
+	for _, value := range c.Schedule {
+		// Die Zeitfenster wurden beim Laden geprüft
+		if window, err := ParseTimeWindow(value); err == nil && window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeWindow ist ein tägliches Zeitfenster in Minuten seit Mitternacht. Liegt das Ende
+// vor dem Beginn, reicht das Fenster über Mitternacht (z.B. 19:00-07:00). Sind Beginn
+// und Ende gleich, umfasst das Fenster den ganzen Tag (z.B. 00:00-00:00).
+type TimeWindow struct {
+	Start int
+	End   int
+}
+
+// ParseTimeWindow liest ein Zeitfenster im Format "HH:MM-HH:MM"
+func ParseTimeWindow(value string) (TimeWindow, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 2 {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", value)
+	}
+
+	var window TimeWindow
+	for i, part := range parts {
+		clock, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return TimeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", value)
+		}
+		minutes := clock.Hour()*60 + clock.Minute()
+		if i == 0 {
+			window.Start = minutes
+		} else {
+			window.End = minutes
+		}
+	}
+	return window, nil
+}
+
+// Contains prüft, ob die Uhrzeit des Zeitpunkts im Zeitfenster liegt (Ende ausgeschlossen)
+func (w TimeWindow) Contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	if w.Start == w.End {
+		return true
+	}
+	if w.Start < w.End {
+		return minutes >= w.Start && minutes < w.End
+	}
+	return minutes >= w.Start || minutes < w.End
+}
+
+// TrainingConfig enthält die Einstellungen für Trainingsbeispiele. Trainiert wird nur
+// mit dem Ausschnitt um das Gesicht, nicht mit dem gesamten Schnappschuss.
+type TrainingConfig struct {
+	CropPadding float64 `mapstructure:"crop_padding"`  // Rand um die Bounding Box als Anteil ihrer Breite/Höhe je Seite
+	MinFaceSize int     `mapstructure:"min_face_size"` // Minimale Kantenlänge des Gesichts in Pixeln
+}
+
+// ClusteringConfig enthält die Einstellungen für das Clustering unbekannter Gesichter.
+// Gruppiert wird per DBSCAN auf der Kosinus-Distanz der Embeddings.
+type ClusteringConfig struct {
+	Enabled    bool    `mapstructure:"enabled"`
+	Eps        float64 `mapstructure:"eps"`         // Maximale Kosinus-Distanz zwischen Nachbarn (0-2)
+	MinSamples int     `mapstructure:"min_samples"` // Mindestanzahl Gesichter in der Nachbarschaft eines Kernpunkts (inkl. selbst)
+	WindowDays int     `mapstructure:"window_days"` // Nur Gesichter der letzten N Tage berücksichtigen (0 = alle)
+	TrainFaces int     `mapstructure:"train_faces"` // Anzahl der besten Ausschnitte, mit denen beim Benennen trainiert wird
+}
+
+// PresenceConfig enthält die Einstellungen für die Anwesenheitserkennung. Erkennungen
+// einer Identität werden je Kamera und Zone zu Aufenthalten zusammengefasst, die nach
+// einer Zeit ohne Erkennung enden.
+type PresenceConfig struct {
+	Enabled        bool           `mapstructure:"enabled"`
+	Timeout        int            `mapstructure:"timeout"`         // in Sekunden ohne Erkennung, nach denen ein Aufenthalt endet
+	Zones          bool           `mapstructure:"zones"`           // Aufenthalte zusätzlich je Zone verfolgen
+	CameraTimeouts map[string]int `mapstructure:"camera_timeouts"` // Abweichende Timeouts je Kamera in Sekunden
+	ZoneTimeouts   map[string]int `mapstructure:"zone_timeouts"`   // Abweichende Timeouts je Zone in Sekunden
+}
+
+// AuthConfig enthält die Einstellungen für Anmeldung und Zugriffsrechte
+type AuthConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	SessionSecret string `mapstructure:"session_secret"`  // Schlüssel für Session-Cookies, leer = zufällig (in <data_dir>/session.key gespeichert)
+	SessionMaxAge int    `mapstructure:"session_max_age"` // in Stunden
+	SecureCookie  bool   `mapstructure:"secure_cookie"`   // Session-Cookie nur über HTTPS senden
+	AdminUsername string `mapstructure:"admin_username"`  // Initialer Administrator, falls noch kein Benutzer existiert
+	AdminPassword string `mapstructure:"admin_password"`  // leer = zufälliges Passwort, das beim Anlegen einmalig protokolliert wird
 }
 
 // ServerConfig enthält Server-bezogene Einstellungen
@@ -36,6 +171,7 @@ type ServerConfig struct {
 	SnapshotURL string `mapstructure:"snapshot_url"`
 	TemplateDir string `mapstructure:"template_dir"`
 	Timezone    string `mapstructure:"timezone"`
+	CORSOrigins []string `mapstructure:"cors_origins"` // Erlaubte Origins für Cross-Origin-Anfragen (leer = nur ohne Anmeldung alle)
 }
 
 // LogConfig enthält Log-Einstellungen
@@ -77,19 +213,147 @@ type InsightFaceConfig struct {
 	Timeout            int     `mapstructure:"timeout"`
 }
 
+// EnsembleConfig enthält Einstellungen für den Ensemble-Modus mit mehreren Gesichtserkennungsanbietern
+type EnsembleConfig struct {
+	Enabled       bool               `mapstructure:"enabled"`
+	Strategy      string             `mapstructure:"strategy"`       // "max", "weighted_average" oder "majority_vote"
+	Weights       map[string]float64 `mapstructure:"weights"`        // Gewichtung je Provider für "weighted_average"
+	MinIoU        float64            `mapstructure:"min_iou"`        // Minimale Überlappung, um Gesichter verschiedener Provider zusammenzuführen
+	MinConfidence float64            `mapstructure:"min_confidence"` // Minimale kombinierte Ähnlichkeit (0-1) für einen Treffer
+}
+
+// ProviderHealthConfig enthält Einstellungen für Circuit Breaker und Failover der Gesichtserkennungsanbieter
+type ProviderHealthConfig struct {
+	FailureThreshold   int     `mapstructure:"failure_threshold"`    // Fehler in Folge bis zum Umschalten
+	ErrorRateThreshold float64 `mapstructure:"error_rate_threshold"` // Fehlerquote (0-1) bis zum Umschalten
+	WindowSize         int     `mapstructure:"window_size"`          // Anzahl der letzten Anfragen für die Fehlerquote
+	OpenTimeout        int     `mapstructure:"open_timeout"`         // in Sekunden, bis ein ausgefallener Provider erneut versucht wird
+	CheckInterval      int     `mapstructure:"check_interval"`       // in Sekunden, Intervall der Verfügbarkeitsprüfung
+}
+
+// ProcessorConfig enthält Einstellungen für den Worker-Pool der Bildverarbeitung
+type ProcessorConfig struct {
+	MaxWorkers        int `mapstructure:"max_workers"`         // Anzahl der Worker, 0 = automatisch (75% der CPUs, mindestens 2)
+	MaxProcessingTime int `mapstructure:"max_processing_time"` // in Sekunden, maximale Dauer eines Auftrags (0 = unbegrenzt)
+	PollInterval      int `mapstructure:"poll_interval"`       // in Sekunden, Intervall für die Abfrage der Queue in der Datenbank
+	DrainTimeout      int `mapstructure:"drain_timeout"`       // in Sekunden, Wartezeit zum Abarbeiten der Queue beim Herunterfahren
+}
+
+// WebhookConfig enthält die Einstellungen für den Webhook-Endpunkt. Anfragen müssen
+// entweder den Token enthalten oder mit dem Secret per HMAC-SHA256 signiert sein.
+type WebhookConfig struct {
+	Enabled      bool                           `mapstructure:"enabled"`
+	Token        string                         `mapstructure:"token"`          // Gemeinsamer Token (Header "Authorization: Bearer" oder "X-Webhook-Token")
+	Secret       string                         `mapstructure:"secret"`         // Schlüssel für die Signatur im Header "X-Webhook-Signature"
+	Sources      map[string]WebhookSourceConfig `mapstructure:"sources"`        // Abweichende Zugangsdaten je Quelle
+	MaxImageSize int64                          `mapstructure:"max_image_size"` // in Bytes, maximale Größe eines Bildes
+	FetchTimeout int                            `mapstructure:"fetch_timeout"`  // in Sekunden, Zeitlimit für das Laden von image_url
+}
+
+// WebhookSourceConfig enthält die Zugangsdaten einer einzelnen Webhook-Quelle
+type WebhookSourceConfig struct {
+	Token  string `mapstructure:"token"`
+	Secret string `mapstructure:"secret"`
+}
+
 // MQTTConfig enthält die Konfiguration für den MQTT-Client
 type MQTTConfig struct {
 	Enabled     bool   `mapstructure:"enabled"`
-	Broker      string `mapstructure:"broker"`
+	Broker      string `mapstructure:"broker"` // Hostname oder URL mit Schema (tcp://, ssl://, ws://, wss://)
 	Port        int    `mapstructure:"port"`
 	Username    string `mapstructure:"username"`
 	Password    string `mapstructure:"password"`
 	ClientID    string `mapstructure:"client_id"`
+	StableClientID  bool `mapstructure:"stable_client_id"` // Client-ID unverändert verwenden (ohne Zeitstempel)
+	CleanSession    bool `mapstructure:"clean_session"`    // false = Sitzung und Abonnements beim Broker behalten
+	SessionExpiry   int  `mapstructure:"session_expiry"`   // Lebensdauer der Sitzung in Sekunden (nur MQTT 5)
+	ProtocolVersion int  `mapstructure:"protocol_version"` // 3 = 3.1, 4 = 3.1.1, 5 = MQTT 5 (0 = 3.1.1 mit Rückfall auf 3.1)
+	TLS         MQTTTLSConfig     `mapstructure:"tls"`
+	Publish     MQTTPublishConfig `mapstructure:"publish"`
 	Topic       string `mapstructure:"topic"`
 	TopicPrefix string `mapstructure:"topic_prefix"`  // Für Home Assistant und andere Integrationen
+	Commands    MQTTCommandsConfig `mapstructure:"commands"` // Befehle unter <topic_prefix>/cmd/...
+	Topics      MQTTTopicsConfig  `mapstructure:"topics"`
+	Results     MQTTResultsConfig `mapstructure:"results"`
 	HomeAssistant HomeAssistantConfig `mapstructure:"homeassistant"`
 }
 
+// MQTTTLSConfig enthält die TLS-Einstellungen der Verbindung zum Broker. TLS wird bei
+// den Schemata ssl://, tls://, mqtts:// und wss:// oder mit enabled verwendet.
+type MQTTTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`              // ssl:// bzw. wss:// statt tcp:// und ws:// verwenden
+	CAFile             string `mapstructure:"ca_file"`              // Zusätzliche CA-Zertifikate (PEM)
+	CertFile           string `mapstructure:"cert_file"`            // Client-Zertifikat (PEM)
+	KeyFile            string `mapstructure:"key_file"`             // Schlüssel des Client-Zertifikats (PEM)
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Zertifikat des Brokers nicht prüfen (nur zum Testen)
+}
+
+// MQTTCommandsConfig steuert die Befehle unter <topic_prefix>/cmd/.... Ein einfacher
+// Schalter (commands: true) wird aus älteren Konfigurationen als enabled übernommen.
+type MQTTCommandsConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`         // Befehle annehmen
+	AllowPurgeAll bool     `mapstructure:"allow_purge_all"` // purge mit "all" erlauben (löscht alle Bilder)
+	AllowedHosts  []string `mapstructure:"allowed_hosts"`   // Hosts, von denen recognize neben Frigate Bilder laden darf
+}
+
+// MQTTPublishConfig enthält QoS und Retain-Flag je Art der Veröffentlichung
+type MQTTPublishConfig struct {
+	Results   MQTTPublishClassConfig `mapstructure:"results"`   // Erkennungsergebnisse, Personenzähler und Fehler
+	State     MQTTPublishClassConfig `mapstructure:"state"`     // Zustände und Attribute von Sensoren und Schaltern
+	Discovery MQTTPublishClassConfig `mapstructure:"discovery"` // Home-Assistant-Discovery
+	Events    MQTTPublishClassConfig `mapstructure:"events"`    // Ereignisse wie Ankunft und Verlassen
+	Responses MQTTPublishClassConfig `mapstructure:"responses"` // Antworten auf MQTT-Befehle
+	Status    MQTTPublishClassConfig `mapstructure:"status"`    // Verfügbarkeit (online/offline)
+}
+
+// MQTTPublishClassConfig enthält QoS (0-2) und Retain-Flag einer Art der Veröffentlichung
+type MQTTPublishClassConfig struct {
+	QoS    int  `mapstructure:"qos"`
+	Retain bool `mapstructure:"retain"`
+}
+
+// MQTTTopicsConfig enthält die Vorlagen der Ergebnis-Topics. Platzhalter sind {prefix}
+// (mqtt.topic_prefix), {name} (erkannte Person) und {camera}.
+type MQTTTopicsConfig struct {
+	Matches      string `mapstructure:"matches"`       // Ergebnis je Person
+	Cameras      string `mapstructure:"cameras"`       // Alle Ergebnisse eines Bildes je Kamera
+	CameraPerson string `mapstructure:"camera_person"` // Anzahl der Personen je Kamera
+	Errors       string `mapstructure:"errors"`        // Fehlermeldungen
+}
+
+// MQTTResultsConfig steuert die Veröffentlichung der Erkennungsergebnisse und deren
+// Einteilung in Treffer (match), Fehltreffer (miss) und Unbekannte (unknown)
+type MQTTResultsConfig struct {
+	Enabled           bool    `mapstructure:"enabled"`
+	Compatibility     bool    `mapstructure:"compatibility"`      // Nutzlasten exakt wie im ursprünglichen Double Take
+	MatchConfidence   float64 `mapstructure:"match_confidence"`   // Ab dieser Übereinstimmung ein Treffer (0-1)
+	UnknownConfidence float64 `mapstructure:"unknown_confidence"` // Darunter ein Unbekannter statt Fehltreffer (0-1)
+	MatchMinArea      int     `mapstructure:"match_min_area"`     // Minimale Fläche eines Treffers in Pixeln
+}
+
+// topicPlaceholder findet die Platzhalter einer Topic-Vorlage
+var topicPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// validateTopicTemplate prüft, ob eine Topic-Vorlage nur bekannte Platzhalter enthält
+func validateTopicTemplate(name, template string, allowed ...string) error {
+	if template == "" {
+		return fmt.Errorf("topic %s must not be empty", name)
+	}
+	for _, placeholder := range topicPlaceholder.FindAllString(template, -1) {
+		known := false
+		for _, value := range allowed {
+			if placeholder == value {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown placeholder %s in topic %s (allowed: %s)", placeholder, name, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
 // HomeAssistantConfig enthält die Konfiguration für die Home Assistant Integration
 type HomeAssistantConfig struct {
 	Enabled        bool   `mapstructure:"enabled"`
@@ -105,6 +369,26 @@ type FrigateConfig struct {
 	ProcessPersonOnly bool   `mapstructure:"process_person_only"`
 	APIURL           string `mapstructure:"api_url"` // Legacy-Feld
 	URL              string `mapstructure:"url"`     // Legacy-Feld
+	BestFaces        int    `mapstructure:"best_faces"`           // Anzahl der besten Gesichter je Event, die in das Ergebnis eingehen
+	MaxImagesPerEvent int   `mapstructure:"max_images_per_event"` // Maximale Anzahl gespeicherter Bilder je Event
+	SubLabel         FrigateSubLabelConfig `mapstructure:"sub_label"`
+	Polling          FrigatePollingConfig  `mapstructure:"polling"`
+}
+
+// FrigatePollingConfig steuert die Abfrage von Events über die Frigate-API als
+// Alternative oder Ergänzung zum MQTT-Empfang
+type FrigatePollingConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	Interval        int  `mapstructure:"interval"`         // Sekunden zwischen zwei Abfragen
+	PageSize        int  `mapstructure:"page_size"`        // Events pro Seite
+	InitialLookback int  `mapstructure:"initial_lookback"` // Sekunden, die beim ersten Start rückwirkend übernommen werden
+}
+
+// FrigateSubLabelConfig steuert das Zurückschreiben erkannter Personen als Sub-Label in Frigate
+type FrigateSubLabelConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	MinConfidence float64 `mapstructure:"min_confidence"` // Mindestübereinstimmung (0-1) für das Setzen des Sub-Labels
+	Overwrite     string  `mapstructure:"overwrite"`      // Umgang mit fremden Sub-Labels: "never", "if_higher" oder "always"
 }
 
 // CleanupConfig enthält Bereinigungseinstellungen
@@ -182,12 +466,68 @@ func Load(configPath string) (*Config, error) {
 	v.SetEnvPrefix("DOUBLE_TAKE")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	
+	// mqtt.commands war früher ein einfacher Schalter
+	switch commands := v.Get("mqtt.commands").(type) {
+	case bool:
+		v.Set("mqtt.commands", map[string]interface{}{"enabled": commands})
+	case string:
+		enabled, err := strconv.ParseBool(commands)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for mqtt.commands", commands)
+		}
+		v.Set("mqtt.commands", map[string]interface{}{"enabled": enabled})
+	}
+
 	// Konfiguration in Struct umwandeln
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 	
+	// MQTT-Protokoll und QoS prüfen
+	switch cfg.MQTT.ProtocolVersion {
+	case 0, 3, 4, 5:
+	default:
+		return nil, fmt.Errorf("invalid MQTT protocol_version %d (allowed: 3, 4, 5)", cfg.MQTT.ProtocolVersion)
+	}
+	publish := cfg.MQTT.Publish
+	for name, class := range map[string]MQTTPublishClassConfig{
+		"results": publish.Results, "state": publish.State, "discovery": publish.Discovery,
+		"events": publish.Events, "responses": publish.Responses, "status": publish.Status,
+	} {
+		if class.QoS < 0 || class.QoS > 2 {
+			return nil, fmt.Errorf("invalid MQTT qos %d for publish.%s (allowed: 0-2)", class.QoS, name)
+		}
+	}
+	if (cfg.MQTT.TLS.CertFile == "") != (cfg.MQTT.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("mqtt.tls.cert_file and mqtt.tls.key_file must be set together")
+	}
+
+	// Topic-Vorlagen prüfen, damit Tippfehler nicht zu festen Topics werden
+	topics := cfg.MQTT.Topics
+	for _, check := range []struct {
+		name, template string
+		allowed        []string
+	}{
+		{"matches", topics.Matches, []string{"{prefix}", "{name}", "{camera}"}},
+		{"cameras", topics.Cameras, []string{"{prefix}", "{camera}"}},
+		{"camera_person", topics.CameraPerson, []string{"{prefix}", "{camera}"}},
+		{"errors", topics.Errors, []string{"{prefix}"}},
+	} {
+		if err := validateTopicTemplate(check.name, check.template, check.allowed...); err != nil {
+			return nil, fmt.Errorf("invalid MQTT topic configuration: %w", err)
+		}
+	}
+
+	// Zeitfenster der Kameras prüfen, damit Tippfehler nicht unbemerkt bleiben
+	for camera, cameraCfg := range cfg.Cameras {
+		for _, value := range cameraCfg.Schedule {
+			if _, err := ParseTimeWindow(value); err != nil {
+				return nil, fmt.Errorf("invalid schedule of camera %s: %w", camera, err)
+			}
+		}
+	}
+	
 	// Sicherstellen, dass erforderliche Verzeichnisse existieren
 	if err := ensureDirectories(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to create required directories: %w", err)
@@ -233,6 +573,52 @@ func setDefaults(v *viper.Viper) {
 	// Standard-Gesichtserkennungsanbieter
 	v.SetDefault("face_recognition_provider", "") // Leerer String bedeutet Auto-Wahl basierend auf enabled-Flags
 	
+	// Ensemble-Standardwerte
+	v.SetDefault("ensemble.enabled", false)
+	v.SetDefault("ensemble.strategy", "max")
+	v.SetDefault("ensemble.min_iou", 0.3)
+	v.SetDefault("ensemble.min_confidence", 0.0)
+	
+	// Standardwerte für Zustandsüberwachung und Failover der Provider
+	v.SetDefault("provider_health.failure_threshold", 3)
+	v.SetDefault("provider_health.error_rate_threshold", 0.5)
+	v.SetDefault("provider_health.window_size", 10)
+	v.SetDefault("provider_health.open_timeout", 60)   // 60 Sekunden
+	v.SetDefault("provider_health.check_interval", 30) // 30 Sekunden
+	
+	// Worker-Pool-Standardwerte
+	v.SetDefault("processor.max_workers", 0)         // Automatisch anhand der CPUs
+	v.SetDefault("processor.max_processing_time", 120) // 120 Sekunden
+	v.SetDefault("processor.poll_interval", 5)       // 5 Sekunden
+	v.SetDefault("processor.drain_timeout", 30)      // 30 Sekunden
+
+	// Auth-Standardwerte
+	v.SetDefault("auth.enabled", false)
+	v.SetDefault("auth.session_max_age", 168) // 7 Tage
+	v.SetDefault("auth.secure_cookie", false)
+	v.SetDefault("auth.admin_username", "admin")
+
+	// Training-Standardwerte
+	v.SetDefault("training.crop_padding", 0.25)
+	v.SetDefault("training.min_face_size", 64)
+
+	// Clustering-Standardwerte
+	v.SetDefault("clustering.enabled", true)
+	v.SetDefault("clustering.eps", 0.4)
+	v.SetDefault("clustering.min_samples", 3)
+	v.SetDefault("clustering.window_days", 30)
+	v.SetDefault("clustering.train_faces", 5)
+
+	// Anwesenheits-Standardwerte
+	v.SetDefault("presence.enabled", true)
+	v.SetDefault("presence.timeout", 300) // 5 Minuten
+	v.SetDefault("presence.zones", true)
+
+	// Webhook-Standardwerte
+	v.SetDefault("webhook.enabled", false)
+	v.SetDefault("webhook.max_image_size", 10*1024*1024) // 10 MB
+	v.SetDefault("webhook.fetch_timeout", 10)            // 10 Sekunden
+	
 	// OpenCV-Standardwerte
 	v.SetDefault("opencv.enabled", true)
 	v.SetDefault("opencv.use_gpu", false)
@@ -260,6 +646,35 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("mqtt.client_id", "double-take-go")
 	v.SetDefault("mqtt.topic", "frigate/events")
 	v.SetDefault("mqtt.topic_prefix", "double-take")
+	v.SetDefault("mqtt.commands.enabled", false)
+	v.SetDefault("mqtt.commands.allow_purge_all", false)
+	v.SetDefault("mqtt.stable_client_id", false)
+	v.SetDefault("mqtt.clean_session", false)
+	v.SetDefault("mqtt.session_expiry", 3600)
+	v.SetDefault("mqtt.protocol_version", 0)
+	v.SetDefault("mqtt.tls.enabled", false)
+	v.SetDefault("mqtt.tls.insecure_skip_verify", false)
+	v.SetDefault("mqtt.publish.results.qos", 1)
+	v.SetDefault("mqtt.publish.results.retain", false)
+	v.SetDefault("mqtt.publish.state.qos", 1)
+	v.SetDefault("mqtt.publish.state.retain", true)
+	v.SetDefault("mqtt.publish.discovery.qos", 1)
+	v.SetDefault("mqtt.publish.discovery.retain", true)
+	v.SetDefault("mqtt.publish.events.qos", 1)
+	v.SetDefault("mqtt.publish.events.retain", false)
+	v.SetDefault("mqtt.publish.responses.qos", 1)
+	v.SetDefault("mqtt.publish.responses.retain", false)
+	v.SetDefault("mqtt.publish.status.qos", 1)
+	v.SetDefault("mqtt.publish.status.retain", true)
+	v.SetDefault("mqtt.topics.matches", "{prefix}/matches/{name}")
+	v.SetDefault("mqtt.topics.cameras", "{prefix}/cameras/{camera}")
+	v.SetDefault("mqtt.topics.camera_person", "{prefix}/cameras/{camera}/person")
+	v.SetDefault("mqtt.topics.errors", "{prefix}/error")
+	v.SetDefault("mqtt.results.enabled", true)
+	v.SetDefault("mqtt.results.compatibility", false)
+	v.SetDefault("mqtt.results.match_confidence", 0.6)
+	v.SetDefault("mqtt.results.unknown_confidence", 0.4)
+	v.SetDefault("mqtt.results.match_min_area", 0)
 	v.SetDefault("mqtt.homeassistant.enabled", false)
 	v.SetDefault("mqtt.homeassistant.discovery_prefix", "homeassistant")
 	v.SetDefault("mqtt.homeassistant.publish_results", true)
@@ -268,6 +683,15 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("frigate.enabled", false)
 	v.SetDefault("frigate.event_topic", "frigate/events")
 	v.SetDefault("frigate.process_person_only", true)
+	v.SetDefault("frigate.best_faces", 3)
+	v.SetDefault("frigate.max_images_per_event", 5)
+	v.SetDefault("frigate.sub_label.enabled", false)
+	v.SetDefault("frigate.sub_label.min_confidence", 0.8)
+	v.SetDefault("frigate.sub_label.overwrite", "if_higher")
+	v.SetDefault("frigate.polling.enabled", false)
+	v.SetDefault("frigate.polling.interval", 30)
+	v.SetDefault("frigate.polling.page_size", 50)
+	v.SetDefault("frigate.polling.initial_lookback", 3600)
 	
 	// Cleanup-Standardwerte
 	v.SetDefault("cleanup.retention_days", 30)
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TimeWindow
+		wantErr bool
+	}{
+		{value: "08:00-17:30", want: TimeWindow{Start: 480, End: 1050}},
+		{value: " 19:00 - 07:00 ", want: TimeWindow{Start: 1140, End: 420}},
+		{value: "00:00-00:00", want: TimeWindow{Start: 0, End: 0}},
+		{value: "23:59-00:00", want: TimeWindow{Start: 1439, End: 0}},
+		{value: "08:00", wantErr: true},
+		{value: "08:00-17:00-18:00", wantErr: true},
+		{value: "24:00-07:00", wantErr: true},
+		{value: "8-17", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimeWindow(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window string
+		time   time.Time
+		want   bool
+	}{
+		{"day window start is included", "08:00-17:00", at(8, 0), true},
+		{"day window inside", "08:00-17:00", at(12, 30), true},
+		{"day window end is excluded", "08:00-17:00", at(17, 0), false},
+		{"day window before", "08:00-17:00", at(7, 59), false},
+
+		{"night window evening", "19:00-07:00", at(22, 0), true},
+		{"night window midnight", "19:00-07:00", at(0, 0), true},
+		{"night window early morning", "19:00-07:00", at(6, 59), true},
+		{"night window end is excluded", "19:00-07:00", at(7, 0), false},
+		{"night window midday", "19:00-07:00", at(12, 0), false},
+
+		{"whole day at midnight", "00:00-00:00", at(0, 0), true},
+		{"whole day at noon", "00:00-00:00", at(12, 0), true},
+		{"whole day before midnight", "00:00-00:00", at(23, 59), true},
+		{"equal start and end is a whole day", "06:00-06:00", at(5, 59), true},
+
+		{"last minute of the day", "23:59-00:00", at(23, 59), true},
+		{"last minute window at midnight", "23:59-00:00", at(0, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := ParseTimeWindow(tt.window)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := window.Contains(tt.time); got != tt.want {
+				t.Fatalf("%s at %s: got %v, want %v", tt.window, tt.time.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if !(CameraConfig{}).ScheduleActive(noon) {
+		t.Fatal("camera without schedule should always be active")
+	}
+	if (CameraConfig{Schedule: []string{"19:00-07:00"}}).ScheduleActive(noon) {
+		t.Fatal("camera should be inactive outside its night window")
+	}
+	if !(CameraConfig{Schedule: []string{"19:00-07:00", "11:00-13:00"}}).ScheduleActive(noon) {
+		t.Fatal("camera should be active in any of its windows")
+	}
+}
+
+// loadTestConfig lädt eine Konfiguration mit dem angegebenen mqtt-Abschnitt, alle
+// Verzeichnisse liegen im temporären Verzeichnis des Tests
+func loadTestConfig(t *testing.T, mqtt string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	content := fmt.Sprintf("server:\n  data_dir: %[1]s\n  snapshot_dir: %[1]s/snapshots\n"+
+		"log:\n  file: %[1]s/logs/double-take.log\ndb:\n  file: %[1]s/double-take.db\nmqtt:\n%[2]s", dir, mqtt)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoadMQTTCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		mqtt    string
+		want    MQTTCommandsConfig
+		wantErr bool
+	}{
+		{name: "disabled by default", mqtt: "  enabled: true\n"},
+		{name: "legacy switch on", mqtt: "  commands: true\n", want: MQTTCommandsConfig{Enabled: true}},
+		{name: "legacy switch off", mqtt: "  commands: false\n"},
+		{
+			name: "nested settings",
+			mqtt: "  commands:\n    enabled: true\n    allow_purge_all: true\n    allowed_hosts: [camera.local, \"10.0.0.5:8080\"]\n",
+			want: MQTTCommandsConfig{Enabled: true, AllowPurgeAll: true, AllowedHosts: []string{"camera.local", "10.0.0.5:8080"}},
+		},
+		{name: "nested settings keep purge all off", mqtt: "  commands:\n    enabled: true\n", want: MQTTCommandsConfig{Enabled: true}},
+		{name: "invalid legacy switch", mqtt: "  commands: maybe\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.mqtt)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(cfg.MQTT.Commands) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %+v, want %+v", cfg.MQTT.Commands, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,9 @@
 module double-take-go-reborn
 
-go 1.24 // Entspricht der Projektkonfiguration
+go 1.24.0 // Entspricht der Projektkonfiguration
 
 require (
+	github.com/eclipse/paho.golang v0.23.0 // MQTT 5
 	github.com/eclipse/paho.mqtt.golang v1.4.3 // Added MQTT client library
 	github.com/gin-contrib/cors v1.4.0
 	// github.com/gin-contrib/sessions v0.0.3 // temporär auskommentiert wegen Build-Problemen
@@ -13,7 +14,7 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.20.1
 	gocv.io/x/gocv v0.36.0 // Added für OpenCV-Integration
-	golang.org/x/text v0.24.0 // Added für Sprachunterstützung
+	golang.org/x/text v0.28.0 // Added für Sprachunterstützung
 	gorm.io/datatypes v1.2.5
 	gorm.io/gorm v1.26.0
 )
@@ -21,6 +22,7 @@ require (
 require (
 	github.com/gin-contrib/sessions v1.0.3
 	github.com/nicksnyder/go-i18n/v2 v2.6.0
+	golang.org/x/crypto v0.41.0
 )
 
 require (
@@ -44,7 +46,7 @@ require (
 	github.com/gorilla/context v1.1.2 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/gorilla/sessions v1.4.0 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
@@ -72,10 +74,9 @@ require (
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
 	golang.org/x/arch v0.16.0 // indirect
-	golang.org/x/crypto v0.37.0 // indirect
-	golang.org/x/net v0.38.0 // indirect
-	golang.org/x/sync v0.13.0 // indirect
-	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gorm.io/driver/mysql v1.5.6 // indirect
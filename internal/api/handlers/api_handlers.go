@@ -4,11 +4,17 @@ import (
 	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/core/models"
 	"double-take-go-reborn/internal/core/processor"
+	"double-take-go-reborn/internal/db/repository"
 	"double-take-go-reborn/internal/integrations/compreface"
+	"double-take-go-reborn/internal/integrations/frigate"
+	"double-take-go-reborn/internal/services/audit"
+	"double-take-go-reborn/internal/services/clustering"
+	"double-take-go-reborn/internal/services/presence"
+	"double-take-go-reborn/internal/services/similarity"
 	"double-take-go-reborn/internal/services/sync"
 
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,6 +37,11 @@ type APIHandler struct {
 	compreface    *compreface.APIClient
 	imageProcessor *processor.ImageProcessor
 	syncService   *sync.Service
+	frigatePoller *frigate.EventPoller
+	clusterService *clustering.Service
+	similarityService *similarity.Service
+	presenceService *presence.Service
+	repo          repository.Repository
 }
 
 // NewAPIHandler erstellt einen neuen API-Handler
@@ -41,9 +52,30 @@ func NewAPIHandler(db *gorm.DB, cfg *config.Config, compreface *compreface.APICl
 		compreface:    compreface,
 		imageProcessor: imageProcessor,
 		syncService:   syncService,
+		repo:          repository.NewSQLiteRepository(db),
 	}
 }
 
+// SetFrigatePoller setzt den Poller für Frigate-Events (für Backfills)
+func (h *APIHandler) SetFrigatePoller(poller *frigate.EventPoller) {
+	h.frigatePoller = poller
+}
+
+// SetClusterService setzt den Dienst für das Clustering unbekannter Gesichter
+func (h *APIHandler) SetClusterService(service *clustering.Service) {
+	h.clusterService = service
+}
+
+// SetSimilarityService setzt den Dienst für die Ähnlichkeitssuche über alle Gesichter
+func (h *APIHandler) SetSimilarityService(service *similarity.Service) {
+	h.similarityService = service
+}
+
+// SetPresenceService setzt den Dienst für die Anwesenheitserkennung
+func (h *APIHandler) SetPresenceService(service *presence.Service) {
+	h.presenceService = service
+}
+
 // RegisterRoutes registriert alle API-Routen
 func (h *APIHandler) RegisterRoutes(router *gin.RouterGroup) {
 	// Verarbeitungs-Endpunkte
@@ -66,20 +98,40 @@ func (h *APIHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.POST("/identities/:id/train", h.TrainIdentityWithImage)
 	router.POST("/identities/:id/examples", h.AddIdentityExample)
 	router.GET("/identities/:id/examples", h.GetIdentityExamples)
+	router.GET("/identities/:id/timeline", h.GetIdentityTimeline)
+	router.GET("/identities/:id/statistics", h.GetIdentityStatistics)
 	router.DELETE("/identities/:id/examples/:exampleId", h.DeleteIdentityExample)
 	router.POST("/identities/:id/rename", h.RenameIdentity)
 
 	// Match-Endpunkte (Treffer)
 	router.PUT("/matches/:id", h.UpdateMatch)
+	router.POST("/audit/:id/revert", h.RevertAuditEntry)
 
 	// Gesichter-Endpunkte
 	router.POST("/faces/:id/train-compreface", h.TrainCompreFaceWithFace)
+	router.GET("/faces/:id/crop", h.GetFaceCrop)
+	router.GET("/faces/:id/similar", h.FindSimilarFaces)
+	router.POST("/faces/search", h.SearchFacesByImage)
+
+	// Cluster unbekannter Gesichter
+	router.GET("/clusters", h.ListClusters)
+	router.POST("/clusters/rebuild", h.RebuildClusters)
+	router.GET("/clusters/:id", h.GetCluster)
+	router.POST("/clusters/:id/name", h.NameCluster)
+
+	// Anwesenheit
+	router.GET("/presence", h.GetPresence)
+	router.GET("/presence/sessions", h.ListPresenceSessions)
 
 	// System-Endpunkte
 	router.GET("/status", h.GetStatus)
 	router.POST("/sync/compreface", h.SyncCompreFace)
 	router.DELETE("/training/all", h.DeleteAllTraining)
 	router.POST("/system/restart", h.RestartContainer)
+
+	// Frigate-Endpunkte
+	router.POST("/frigate/backfill", h.StartFrigateBackfill)
+	router.GET("/frigate/backfill", h.GetFrigateBackfill)
 }
 
 // ProcessImage verarbeitet ein hochgeladenes Bild
@@ -122,7 +174,9 @@ func (h *APIHandler) ProcessImage(c *gin.Context) {
 
 	// Bild verarbeiten
 	ctx := c.Request.Context()
-	image, err := h.imageProcessor.ProcessImage(ctx, filePath, source, processor.ProcessingOptions{})
+	image, err := h.imageProcessor.ProcessImage(ctx, filePath, source, processor.ProcessingOptions{
+		Priority: processor.PriorityManual,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Image processing failed: %v", err)})
 		return
@@ -245,6 +299,7 @@ func (h *APIHandler) DeleteImage(c *gin.Context) {
 			// Weiter mit Löschen des DB-Eintrags
 		}
 	}
+	processor.RemoveFaceCrops(h.cfg.Server.SnapshotDir, &image)
 
 	// Datenbankeintrag löschen (cascaded zu Faces und Matches)
 	if err := h.db.Delete(&image).Error; err != nil {
@@ -276,6 +331,7 @@ func (h *APIHandler) DeleteAllImages(c *gin.Context) {
 				// Fehler beim Löschen von Dateien werden nur geloggt, nicht blockierend
 			}
 		}
+		processor.RemoveFaceCrops(h.cfg.Server.SnapshotDir, &image)
 		deleted++
 	}
 
@@ -440,8 +496,8 @@ func (h *APIHandler) DeleteIdentity(c *gin.Context) {
 		}
 	}
 
-	// Identität in der lokalen Datenbank löschen
-	if err := h.db.Delete(&identity).Error; err != nil {
+	// Identität in der lokalen Datenbank löschen und die Löschung protokollieren
+	if err := deleteIdentityAudited(h.db, c, identity); err != nil {
 		log.WithError(err).Error("Fehler beim Löschen der Identität aus der Datenbank")
 		deleteErrors = append(deleteErrors, fmt.Sprintf("Database: %v", err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -512,14 +568,29 @@ func (h *APIHandler) AddIdentityExample(c *gin.Context) {
 	log.Infof("CompreFace config: URL=%s, Recognition API Key=%s (length: %d chars)", 
 		h.cfg.CompreFace.URL, "[hidden]", len(h.cfg.CompreFace.RecognitionAPIKey))
 
-	// Beispiel zu CompreFace hinzufügen
+	// Nur das erkannte Gesicht mit Rand trainieren; das Bild muss genau ein Gesicht enthalten
 	ctx := c.Request.Context()
-	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, imageData, header.Filename)
+	cropData, cropPath, err := uploadedFaceCrop(ctx, h.imageProcessor, identity, imageData)
+	if err != nil {
+		log.Warnf("Rejected example for identity '%s': %v", identity.Name, err)
+		c.JSON(trainingCropStatus(err), gin.H{"error": fmt.Sprintf("Cannot train with this image: %v", err)})
+		return
+	}
+
+	// Beispiel zu CompreFace hinzufügen
+	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, cropData, filepath.Base(cropPath))
 	if err != nil {
 		log.Errorf("CompreFace error details: %v", err)
+		removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to add example to CompreFace: %v", err)})
 		return
 	}
+	recordTrainingExample(h.db, models.TrainingExample{
+		ExampleID:  result.ImageID,
+		Subject:    identity.Name,
+		IdentityID: identity.ID,
+		CropPath:   cropPath,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Example added successfully",
@@ -547,6 +618,17 @@ func (h *APIHandler) GetStatus(c *gin.Context) {
 		}
 	}
 
+	// Zustand der Gesichtserkennungsanbieter (Circuit Breaker, Failover)
+	if h.imageProcessor != nil {
+		if manager := h.imageProcessor.GetProviderManager(); manager != nil {
+			status["face_recognition"] = gin.H{
+				"primary_provider": manager.GetActiveProviderName(),
+				"current_provider": manager.GetCurrentProviderName(),
+				"providers":        manager.GetHealthStatus(),
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, status)
 }
 
@@ -624,8 +706,9 @@ func (h *APIHandler) RecognizeImage(c *gin.Context) {
 		log.Infof("Matches gelöscht: %d", result.RowsAffected)
 	}
 
-	// Lösche alle Gesichter für dieses Bild
+	// Lösche alle Gesichter für dieses Bild samt Ausschnitten
 	log.Info("Lösche alle Gesichter für dieses Bild")
+	processor.RemoveFaceCrops(h.cfg.Server.SnapshotDir, &image)
 	result := h.db.Where("image_id = ?", image.ID).Delete(&models.Face{})
 	if result.Error != nil {
 		log.Errorf("Fehler beim Löschen von Gesichtern: %v", result.Error)
@@ -641,6 +724,7 @@ func (h *APIHandler) RecognizeImage(c *gin.Context) {
 		DetectFaces:    true,
 		RecognizeFaces: true,
 		ExistingImageID: image.ID, // Verwende die vorhandene Bild-ID für die Neuverarbeitung
+		Priority:       processor.PriorityManual,
 	}
 	
 	log.Infof("Rufe ProcessImage für %s mit Quelle %s auf", imagePath, image.Source)
@@ -706,6 +790,9 @@ func (h *APIHandler) DeleteIdentityExample(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete example from CompreFace: %v", err)})
 		return
 	}
+	if err := markTrainingExamplesRemoved(h.db, compreFaceProvider, exampleId); err != nil {
+		log.WithError(err).Warnf("Failed to mark training example %s as removed", exampleId)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Example deleted successfully"})
 }
@@ -753,10 +840,19 @@ func (h *APIHandler) RenameIdentity(c *gin.Context) {
 
 	// Lokale Identität umbenennen
 	oldName := identity.Name
+	before := audit.IdentityState(identity)
 	identity.Name = req.NewName
 	identity.ExternalID = req.NewName // Auch die ExternalID anpassen
 
-	if err := h.db.Save(&identity).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&identity).Error; err != nil {
+			return err
+		}
+		_, err := audit.Record(tx, auditActor(c), audit.ActionIdentityRename, audit.EntityIdentity, identity.ID,
+			before, audit.IdentityState(identity))
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update identity: %v", err)})
 		return
 	}
@@ -775,14 +871,26 @@ func (h *APIHandler) DeleteAllTraining(c *gin.Context) {
 		return
 	}
 
-	// Alle Subjekte in CompreFace löschen
+	// Vorhandene Subjekte für das Audit-Log festhalten
 	ctx := c.Request.Context()
+	subjects, err := h.compreface.GetAllSubjects(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to list subjects before deleting all training data")
+	}
+
+	// Alle Subjekte in CompreFace löschen
 	result, err := h.compreface.DeleteAllSubjects(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete all subjects from CompreFace: %v", err)})
 		return
 	}
 
+	// Löschung protokollieren, die gelöschten Subjekte bleiben im Eintrag erhalten
+	if _, err := audit.Record(h.db, auditActor(c), audit.ActionTrainingDeleteAll, audit.EntityTraining, 0,
+		gin.H{"subjects": subjects}, gin.H{"deleted": result.Deleted}); err != nil {
+		log.WithError(err).Error("Failed to write audit entry for deleting all training data")
+	}
+
 	// Synchronisierung mit der lokalen Datenbank durchführen
 	if err := h.compreface.SyncIdentities(ctx, h.db); err != nil {
 		log.WithError(err).Warn("Failed to sync identities after deleting all subjects")
@@ -834,46 +942,63 @@ func (h *APIHandler) UpdateMatch(c *gin.Context) {
 	// Wir synchronisieren die Identitätszuweisung auch mit CompreFace
 	log.Infof("Synchronizing identity assignment with CompreFace: Face ID %d to identity %s", match.Face.ID, newIdentity.Name)
 	
-	// 1. Aktualisieren des Matches in der lokalen Datenbank
+	// 1. Aktualisieren des Matches in der lokalen Datenbank, zusammen mit dem Audit-Eintrag
+	before := audit.MatchState(match, oldIdentityName)
 	match.IdentityID = req.IdentityID
 	match.Identity = newIdentity
-	if err := h.db.Save(&match).Error; err != nil {
+	var entry *models.AuditEntry
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&match).Error; err != nil {
+			return err
+		}
+		var err error
+		entry, err = audit.Record(tx, auditActor(c), audit.ActionMatchUpdate, audit.EntityMatch, match.ID,
+			before, audit.MatchState(match, newIdentity.Name))
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update match: %v", err)})
 		return
 	}
 	
-	// 2. Gesichtsbild aus der Datenbank laden
+	// 2. Gesichtsausschnitt aus dem Schnappschuss erstellen
 	if match.Face.Image.FilePath == "" {
 		log.Warnf("Cannot synchronize with CompreFace: No image found for face ID %d", match.Face.ID)
 		// Wir geben keinen Fehler an den Client zurück, da die DB-Aktualisierung erfolgreich war
 	} else {
-		// 3. Bildpfad generieren
-		imageFilePath := filepath.Join(h.cfg.Server.SnapshotDir, match.Face.Image.FilePath)
-		log.Debugf("Loading image from: %s", imageFilePath)
-		
-		// 4. Bilddaten lesen
-		imageData, err := os.ReadFile(imageFilePath)
+		// 3. Nur das Gesicht mit Rand trainieren, damit in Bildern mit mehreren Personen
+		// nicht die falsche Person gelernt wird
+		ctx := c.Request.Context()
+		cropData, cropPath, err := storedFaceCrop(ctx, h.imageProcessor, h.cfg.Server.SnapshotDir, match.Face)
 		if err != nil {
-			log.Errorf("Failed to read image file: %v", err)
+			log.Warnf("Skipping CompreFace training for face ID %d: %v", match.Face.ID, err)
 			// Wir geben keinen Fehler an den Client zurück, da die DB-Aktualisierung erfolgreich war
 		} else {
-			// 5. Das Bild als Beispiel für die neue Identität zu CompreFace hinzufügen
-			ctx := c.Request.Context()
-			filename := filepath.Base(imageFilePath)
-			
-			// Zuerst prüfen, ob die Identität in CompreFace existiert, und ggf. erstellen
+			// 4. Zuerst prüfen, ob die Identität in CompreFace existiert, und ggf. erstellen
 			_, err := h.compreface.CreateSubject(ctx, newIdentity.Name)
 			if err != nil {
 				log.Warnf("Failed to create subject in CompreFace (might already exist): %v", err)
 			}
 			
-			// Bild als Beispiel hinzufügen
-			result, err := h.compreface.AddSubjectExample(ctx, newIdentity.Name, imageData, filename)
+			// 5. Den Ausschnitt als Beispiel für die neue Identität zu CompreFace hinzufügen
+			result, err := h.compreface.AddSubjectExample(ctx, newIdentity.Name, cropData, filepath.Base(cropPath))
 			if err != nil {
 				log.Errorf("Failed to add example to CompreFace: %v", err)
+				removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
 				// Wir geben keinen Fehler an den Client zurück, da die DB-Aktualisierung erfolgreich war
 			} else {
 				log.Infof("Successfully added example to CompreFace: %s (ID: %s)", newIdentity.Name, result.ImageID)
+
+				// Beispiel-ID festhalten, damit die Korrektur rückgängig gemacht werden kann
+				recordTrainingExample(h.db, models.TrainingExample{
+					ExampleID:    result.ImageID,
+					Subject:      newIdentity.Name,
+					IdentityID:   newIdentity.ID,
+					FaceID:       &match.FaceID,
+					ImageID:      &match.Face.ImageID,
+					AuditEntryID: &entry.ID,
+					CropPath:     cropPath,
+				})
 			}
 		}
 	}
@@ -930,88 +1055,83 @@ func (h *APIHandler) TrainCompreFaceWithFace(c *gin.Context) {
 	log.Infof("Training CompreFace with face ID %d from image ID %d for identity %s", face.ID, req.ImageID, identity.Name)
 	
 	// Face-Bounding-Box validieren
-	var boundingBox struct {
-		XMin int `json:"x_min"`
-		YMin int `json:"y_min"`
-		XMax int `json:"x_max"`
-		YMax int `json:"y_max"`
-	}
-	
-	if err := json.Unmarshal(face.BoundingBox, &boundingBox); err != nil {
-		log.WithError(err).Error("Failed to unmarshal face bounding box")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid face bounding box format"})
-		return
-	}
-	
-	// Prüfen, ob die Bounding-Box gültig ist
-	if boundingBox.XMin <= 0 || boundingBox.YMin <= 0 || boundingBox.XMax <= boundingBox.XMin || boundingBox.YMax <= boundingBox.YMin {
+	if _, err := face.Box(); err != nil {
+		log.WithError(err).Error("Invalid face bounding box")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid face coordinates"})
 		return
 	}
 
-	// Bildpfad generieren
-	imageFilePath := filepath.Join(h.cfg.Server.SnapshotDir, face.Image.FilePath)
-	log.Debugf("Loading image from: %s", imageFilePath)
-	
-	// Bilddaten lesen
-	imageData, err := os.ReadFile(imageFilePath)
+	// Nur das Gesicht mit Rand trainieren; der Ausschnitt muss genau ein Gesicht enthalten
+	ctx := c.Request.Context()
+	cropData, cropPath, err := storedFaceCrop(ctx, h.imageProcessor, h.cfg.Server.SnapshotDir, face)
 	if err != nil {
-		log.WithError(err).Error("Failed to read image file")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image file"})
+		log.WithError(err).Warnf("Cannot train with face %d", face.ID)
+		c.JSON(trainingCropStatus(err), gin.H{"error": fmt.Sprintf("Cannot train with this face: %v", err)})
 		return
 	}
 
 	// 1. Zuerst prüfen, ob die Identität in CompreFace existiert, und ggf. erstellen
-	ctx := c.Request.Context()
 	_, err = h.compreface.CreateSubject(ctx, identity.Name)
 	if err != nil {
 		log.WithError(err).Warn("Failed to create subject in CompreFace (might already exist)")
 		// Wir fahren trotzdem fort, da das Subjekt möglicherweise bereits existiert
 	}
 
-	// 2. Dateiname für CompreFace generieren (muss einzigartig sein)
-	timestamp := timezone.Now().UnixNano() / int64(time.Millisecond)
-	filename := fmt.Sprintf("face_%d_%d_%s.jpg", face.ID, timestamp, filepath.Base(imageFilePath))
-
-	// 3. Bild als Beispiel für die neue Identität zu CompreFace hinzufügen
-	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, imageData, filename)
+	// 2. Den Ausschnitt als Beispiel für die neue Identität zu CompreFace hinzufügen
+	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, cropData, filepath.Base(cropPath))
 	if err != nil {
 		log.WithError(err).Error("Failed to add example to CompreFace")
+		removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add example to CompreFace"})
 		return
 	}
 
 	log.Infof("Successfully added face %d as example to CompreFace identity '%s' (ID: %s)", face.ID, identity.Name, result.ImageID)
 	
-	// 4. Auch in der lokalen Datenbank einen Match erstellen oder aktualisieren
-	var existingMatch models.Match
-	result404 := h.db.Where("face_id = ?", face.ID).First(&existingMatch).Error
-
-	if result404 == nil {
-		// Match existiert bereits, aktualisieren
-		existingMatch.IdentityID = identity.ID
-		existingMatch.Confidence = 1.0 // 100% Konfidenz, da manuell gesetzt
-		
-		if err := h.db.Save(&existingMatch).Error; err != nil {
-			log.WithError(err).Error("Failed to update existing match")
-			// Wir geben trotzdem einen Erfolg zurück, da CompreFace erfolgreich aktualisiert wurde
-		} else {
-			log.Infof("Updated existing match %d to identity %s", existingMatch.ID, identity.Name)
+	// 3. Auch in der lokalen Datenbank einen Match erstellen oder aktualisieren und
+	// das Training zusammen damit protokollieren
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var before interface{}
+		match := models.Match{FaceID: face.ID}
+		if err := tx.Preload("Identity").Where("face_id = ?", face.ID).First(&match).Error; err == nil {
+			match.Face = face
+			before = audit.MatchState(match, match.Identity.Name)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
 		}
-	} else {
-		// Neuen Match erstellen
-		newMatch := models.Match{
-			FaceID:     face.ID,
-			IdentityID: identity.ID,
-			Confidence: 1.0, // 100% Konfidenz, da manuell gesetzt
+
+		// 100% Konfidenz, da manuell gesetzt
+		match.IdentityID = identity.ID
+		match.Identity = identity
+		match.Confidence = 1.0
+		if err := tx.Omit("Face", "Identity").Save(&match).Error; err != nil {
+			return err
 		}
-		
-		if err := h.db.Create(&newMatch).Error; err != nil {
-			log.WithError(err).Error("Failed to create new match")
-			// Wir geben trotzdem einen Erfolg zurück, da CompreFace erfolgreich aktualisiert wurde
-		} else {
-			log.Infof("Created new match %d for face %d to identity %s", newMatch.ID, face.ID, identity.Name)
+		match.Face = face
+
+		after := audit.MatchState(match, identity.Name)
+		after["compreface_image_id"] = result.ImageID
+		entry, err := audit.Record(tx, auditActor(c), audit.ActionTrainingAddFace, audit.EntityFace, face.ID, before, after)
+		if err != nil {
+			return err
 		}
+
+		// Beispiel-ID festhalten, damit das Training rückgängig gemacht werden kann
+		return createTrainingExample(tx, models.TrainingExample{
+			ExampleID:    result.ImageID,
+			Subject:      identity.Name,
+			IdentityID:   identity.ID,
+			FaceID:       &face.ID,
+			ImageID:      &face.ImageID,
+			AuditEntryID: &entry.ID,
+			CropPath:     cropPath,
+		})
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to save match for trained face")
+		// Wir geben trotzdem einen Erfolg zurück, da CompreFace erfolgreich aktualisiert wurde
+	} else {
+		log.Infof("Assigned face %d to identity %s", face.ID, identity.Name)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1022,3 +1142,20 @@ func (h *APIHandler) TrainCompreFaceWithFace(c *gin.Context) {
 		"compreface_image_id": result.ImageID,
 	})
 }
+
+// deleteIdentityAudited löscht eine Identität und schreibt den Audit-Eintrag in
+// derselben Transaktion
+func deleteIdentityAudited(db *gorm.DB, c *gin.Context, identity models.Identity) error {
+	var matchCount int64
+	db.Model(&models.Match{}).Where("identity_id = ?", identity.ID).Count(&matchCount)
+
+	before := audit.IdentityState(identity)
+	before["match_count"] = matchCount
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+		_, err := audit.Record(tx, auditActor(c), audit.ActionIdentityDelete, audit.EntityIdentity, identity.ID, before, nil)
+		return err
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"double-take-go-reborn/internal/api/middleware"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/services/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler stellt das Audit-Log über die API bereit
+type AuditHandler struct {
+	service *audit.Service
+}
+
+// NewAuditHandler erstellt einen neuen Audit-Handler
+func NewAuditHandler(service *audit.Service) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// RegisterRoutes registriert die Audit-Routen
+func (h *AuditHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/audit", h.ListAuditEntries)
+	router.GET("/audit/:id", h.GetAuditEntry)
+}
+
+// ListAuditEntries liefert die Einträge des Audit-Logs, gefiltert nach Aktion,
+// Objekt, Benutzer und Zeitraum
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	filter := audit.Filter{
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		Actor:      c.Query("actor"),
+	}
+	if entityID, err := strconv.ParseUint(c.Query("entity_id"), 10, 32); err == nil {
+		filter.EntityID = uint(entityID)
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		filter.UserID = uint(userID)
+	}
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected RFC3339"})
+			return
+		}
+		*target = parsed
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	entries, total, err := h.service.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit entries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total})
+}
+
+// GetAuditEntry liefert einen einzelnen Eintrag des Audit-Logs
+func (h *AuditHandler) GetAuditEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audit entry ID"})
+		return
+	}
+
+	entry, err := h.service.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit entry not found"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// auditActor ermittelt aus der Anfrage, wer eine Änderung auslöst
+func auditActor(c *gin.Context) audit.Actor {
+	actor := audit.Actor{ClientIP: c.ClientIP()}
+	if user := middleware.CurrentUser(c); user != nil {
+		actor.UserID = &user.ID
+		actor.Username = user.Username
+	}
+	if value, ok := c.Get(middleware.ContextTokenKey); ok {
+		if token, ok := value.(*models.APIToken); ok {
+			actor.TokenID = &token.ID
+			actor.TokenName = token.Name
+		}
+	}
+	return actor
+}
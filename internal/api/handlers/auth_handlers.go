@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/internal/api/middleware"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/services/auth"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AuthHandler behandelt Anmeldung, Benutzer und API-Tokens
+type AuthHandler struct {
+	service    *auth.Service
+	webHandler *WebHandler
+}
+
+// NewAuthHandler erstellt einen neuen Auth-Handler
+func NewAuthHandler(service *auth.Service, webHandler *WebHandler) *AuthHandler {
+	return &AuthHandler{
+		service:    service,
+		webHandler: webHandler,
+	}
+}
+
+// RegisterRoutes registriert die Anmelde- und Verwaltungsrouten
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+	// Web-Routen
+	router.GET("/login", h.handleLoginPage)
+	router.POST("/login", h.handleLogin)
+	router.POST("/logout", h.handleLogout)
+
+	api := router.Group("/api/auth")
+	{
+		api.GET("/me", h.GetCurrentUser)
+		api.POST("/password", h.ChangePassword)
+
+		// Benutzerverwaltung (nur Administratoren)
+		api.GET("/users", h.ListUsers)
+		api.POST("/users", h.CreateUser)
+		api.PUT("/users/:id", h.UpdateUser)
+		api.DELETE("/users/:id", h.DeleteUser)
+
+		// API-Tokens (nur Administratoren)
+		api.GET("/tokens", h.ListTokens)
+		api.POST("/tokens", h.CreateToken)
+		api.DELETE("/tokens/:id", h.DeleteToken)
+
+		// Protokoll ändernder Anfragen (nur Administratoren)
+		api.GET("/requests", h.ListRequestLogs)
+	}
+}
+
+// handleLoginPage zeigt die Anmeldeseite
+func (h *AuthHandler) handleLoginPage(c *gin.Context) {
+	h.webHandler.renderTemplate(c, "login.html", gin.H{
+		"Title": "Double-Take - Login",
+		"Next":  safeRedirect(c.Query("next")),
+	})
+}
+
+// handleLogin prüft die Anmeldedaten und startet eine Session
+func (h *AuthHandler) handleLogin(c *gin.Context) {
+	username := c.PostForm("username")
+	next := safeRedirect(c.PostForm("next"))
+
+	user, err := h.service.Authenticate(username, c.PostForm("password"))
+	if err != nil {
+		log.Warnf("Fehlgeschlagene Anmeldung für %q von %s", username, c.ClientIP())
+		c.Status(http.StatusUnauthorized)
+		h.webHandler.renderTemplate(c, "login.html", gin.H{
+			"Title":    "Double-Take - Login",
+			"Next":     next,
+			"Username": username,
+			"Error":    true,
+		})
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set(middleware.SessionUserKey, user.ID)
+	if err := session.Save(); err != nil {
+		log.Errorf("Fehler beim Speichern der Session: %v", err)
+		c.String(http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	log.Infof("Benutzer %s hat sich angemeldet", user.Username)
+	c.Redirect(http.StatusFound, next)
+}
+
+// handleLogout beendet die Session. Nur per POST erreichbar, damit fremde Seiten
+// Benutzer nicht über einen einfachen Link abmelden können.
+func (h *AuthHandler) handleLogout(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	session.Save()
+	c.Redirect(http.StatusFound, "/login")
+}
+
+// GetCurrentUser liefert den angemeldeten Benutzer
+func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Anmeldung erforderlich"})
+		return
+	}
+	role, _ := c.Get(middleware.ContextRoleKey)
+	scopes, _ := c.Get(middleware.ContextScopesKey)
+	response := gin.H{"user": userResponse(*user), "role": role, "scopes": scopes}
+	if token, ok := c.Get(middleware.ContextTokenKey); ok {
+		response["token"] = token
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword ändert das Passwort des angemeldeten Benutzers
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Anmeldung erforderlich"})
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if _, err := h.service.Authenticate(user.Username, req.CurrentPassword); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Aktuelles Passwort ist falsch"})
+		return
+	}
+	if _, err := h.service.UpdateUser(user.ID, req.NewPassword, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passwort geändert"})
+}
+
+// ListUsers liefert alle Benutzer
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	users, err := h.service.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		result = append(result, userResponse(user))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": result})
+}
+
+// CreateUser legt einen neuen Benutzer an
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+
+	user, err := h.service.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"user": userResponse(*user)})
+}
+
+// UpdateUser ändert Passwort oder Rolle eines Benutzers
+func (h *AuthHandler) UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, err := h.service.UpdateUser(uint(id), req.Password, req.Role)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": userResponse(*user)})
+}
+
+// DeleteUser löscht einen Benutzer
+func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.service.DeleteUser(uint(id)); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// ListTokens liefert alle API-Tokens ohne Klartext
+func (h *AuthHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.service.ListTokens(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken erzeugt einen API-Token. Der Klartext ist nur in dieser Antwort enthalten.
+func (h *AuthHandler) CreateToken(c *gin.Context) {
+	var req struct {
+		Name          string     `json:"name" binding:"required"`
+		Scopes        []string   `json:"scopes"`
+		ExpiresAt     *time.Time `json:"expires_at"`
+		ExpiresInDays int        `json:"expires_in_days"`
+		UserID        uint       `json:"user_id"` // Standard: angemeldeter Benutzer
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.UserID == 0 {
+		if user := middleware.CurrentUser(c); user != nil {
+			req.UserID = user.ID
+		}
+	}
+	if req.ExpiresAt == nil && req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		req.ExpiresAt = &expiresAt
+	}
+
+	plain, token, err := h.service.CreateToken(req.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Infof("API-Token %s (%s) mit Berechtigungen %s angelegt", token.Name, token.Prefix, token.Scopes)
+	c.JSON(http.StatusCreated, gin.H{"token": plain, "details": token})
+}
+
+// DeleteToken widerruft einen API-Token
+func (h *AuthHandler) DeleteToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.service.DeleteToken(uint(id)); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// ListRequestLogs liefert das Protokoll ändernder Anfragen
+func (h *AuthHandler) ListRequestLogs(c *gin.Context) {
+	filter := auth.RequestLogFilter{}
+	if tokenID, err := strconv.ParseUint(c.Query("token_id"), 10, 32); err == nil {
+		filter.TokenID = uint(tokenID)
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 32); err == nil {
+		filter.UserID = uint(userID)
+	}
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since, expected RFC3339"})
+			return
+		}
+		filter.Since = parsed
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	entries, total, err := h.service.ListRequestLogs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list request log"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": entries, "total": total})
+}
+
+// userResponse gibt die öffentlichen Felder eines Benutzers zurück
+func userResponse(user models.User) gin.H {
+	return gin.H{
+		"id":            user.ID,
+		"username":      user.Username,
+		"role":          user.Role,
+		"created_at":    user.CreatedAt,
+		"last_login_at": user.LastLoginAt,
+	}
+}
+
+// authErrorStatus bildet Fehler des Auth-Service auf HTTP-Statuscodes ab
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrLastAdmin):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// safeRedirect lässt nur relative Ziele innerhalb der Anwendung zu
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
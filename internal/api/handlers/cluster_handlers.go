@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+	"double-take-go-reborn/internal/services/audit"
+	"double-take-go-reborn/internal/services/clustering"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// clusterExample ist ein beim Benennen eines Clusters trainierter Ausschnitt
+type clusterExample struct {
+	face      models.Face
+	exampleID string
+	provider  string
+	cropPath  string
+}
+
+// ListClusters gibt die unbenannten Cluster unbekannter Gesichter zurück
+func (h *APIHandler) ListClusters(c *gin.Context) {
+	if !h.clusteringEnabled(c) {
+		return
+	}
+
+	clusters, err := h.clusterService.List()
+	if err != nil {
+		log.WithError(err).Error("Failed to list face clusters")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list clusters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clusters": clusters})
+}
+
+// GetCluster gibt einen Cluster mit seinen unbekannten Gesichtern zurück, beste zuerst
+func (h *APIHandler) GetCluster(c *gin.Context) {
+	if !h.clusteringEnabled(c) {
+		return
+	}
+	cluster, ok := h.findCluster(c)
+	if !ok {
+		return
+	}
+
+	faces, err := h.clusterService.Members(cluster.ID)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to load faces of cluster %d", cluster.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load cluster faces"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cluster": cluster,
+		"faces":   faces,
+	})
+}
+
+// RebuildClusters gruppiert alle unbekannten Gesichter neu
+func (h *APIHandler) RebuildClusters(c *gin.Context) {
+	if !h.clusteringEnabled(c) {
+		return
+	}
+
+	count, err := h.clusterService.Rebuild()
+	if err != nil {
+		log.WithError(err).Error("Failed to rebuild face clusters")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to rebuild clusters: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Clusters rebuilt successfully",
+		"clusters": count,
+	})
+}
+
+// NameCluster benennt einen Cluster: Die Identität wird angelegt (oder eine bestehende
+// verwendet), der Anbieter mit den besten Ausschnitten trainiert und alle Gesichter des
+// Clusters der Identität zugeordnet.
+func (h *APIHandler) NameCluster(c *gin.Context) {
+	if !h.clusteringEnabled(c) {
+		return
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		IdentityID uint   `json:"identity_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Name == "" && req.IdentityID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either name or identity_id is required"})
+		return
+	}
+
+	cluster, ok := h.findCluster(c)
+	if !ok {
+		return
+	}
+	if cluster.IdentityID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cluster has already been named"})
+		return
+	}
+
+	faces, err := h.clusterService.Members(cluster.ID)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to load faces of cluster %d", cluster.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load cluster faces"})
+		return
+	}
+	if len(faces) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Cluster has no unknown faces left"})
+		return
+	}
+
+	// Bestehende Identität verwenden oder nach dem Training neu anlegen
+	var identity models.Identity
+	if req.IdentityID != 0 {
+		if err := h.db.First(&identity, req.IdentityID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+			return
+		}
+	} else if err := h.db.Where("name = ?", req.Name).First(&identity).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up identity"})
+			return
+		}
+		identity = models.Identity{Name: req.Name}
+	}
+
+	ctx := c.Request.Context()
+	examples, trainErr := h.trainClusterFaces(ctx, identity, faces)
+	if len(examples) == 0 {
+		log.WithError(trainErr).Warnf("Cannot train identity '%s' with cluster %d", identity.Name, cluster.ID)
+		status := http.StatusUnprocessableEntity
+		if trainErr != nil && trainingCropStatus(trainErr) == http.StatusServiceUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": fmt.Sprintf("None of the cluster faces could be used for training: %v", trainErr)})
+		return
+	}
+
+	// Identität, Treffer, Audit-Eintrag und Trainingsbeispiele gemeinsam speichern
+	var matches []models.Match
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if identity.ID == 0 {
+			if err := tx.Create(&identity).Error; err != nil {
+				return fmt.Errorf("fehler beim Anlegen der Identität: %w", err)
+			}
+		}
+
+		var err error
+		matches, err = h.clusterService.Assign(tx, cluster, identity, faces)
+		if err != nil {
+			return err
+		}
+
+		faceIDs := make([]uint, len(faces))
+		for i, face := range faces {
+			faceIDs[i] = face.ID
+		}
+		exampleIDs := make([]string, len(examples))
+		for i, example := range examples {
+			exampleIDs[i] = example.exampleID
+		}
+		after := map[string]interface{}{
+			"cluster_id":    cluster.ID,
+			"identity_id":   identity.ID,
+			"identity_name": identity.Name,
+			"face_ids":      faceIDs,
+			"example_ids":   exampleIDs,
+		}
+		entry, err := audit.Record(tx, auditActor(c), audit.ActionClusterName, audit.EntityCluster, cluster.ID, nil, after)
+		if err != nil {
+			return err
+		}
+
+		for _, example := range examples {
+			faceID, imageID := example.face.ID, example.face.ImageID
+			if err := createTrainingExample(tx, models.TrainingExample{
+				ExampleID:    example.exampleID,
+				Provider:     example.provider,
+				Subject:      identity.Name,
+				IdentityID:   identity.ID,
+				FaceID:       &faceID,
+				ImageID:      &imageID,
+				AuditEntryID: &entry.ID,
+				CropPath:     example.cropPath,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("Failed to assign cluster %d to identity '%s'", cluster.ID, identity.Name)
+		if errors.Is(err, clustering.ErrClusterNamed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cluster has already been named"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Training succeeded but the faces could not be assigned: %v", err)})
+		return
+	}
+
+	log.Infof("Named cluster %d as '%s': %d faces assigned, trained with %d crop(s)", cluster.ID, identity.Name, len(matches), len(examples))
+	c.JSON(http.StatusOK, gin.H{
+		"message":          fmt.Sprintf("Cluster assigned to identity '%s'", identity.Name),
+		"identity":         identity,
+		"cluster_id":       cluster.ID,
+		"faces_assigned":   len(matches),
+		"examples_trained": len(examples),
+	})
+}
+
+// trainClusterFaces trainiert den Anbieter mit den besten Ausschnitten eines Clusters.
+// Gesichter, deren Ausschnitt abgelehnt wird, werden übersprungen. Zurückgegeben wird
+// zusätzlich der letzte Fehler, falls kein Ausschnitt verwendet werden konnte.
+func (h *APIHandler) trainClusterFaces(ctx context.Context, identity models.Identity, faces []models.Face) ([]clusterExample, error) {
+	if h.cfg.CompreFace.Enabled {
+		if _, err := h.compreface.CreateSubject(ctx, identity.Name); err != nil {
+			log.WithError(err).Warn("Failed to create subject in CompreFace (might already exist)")
+		}
+	}
+
+	var examples []clusterExample
+	var lastErr error
+	for _, face := range faces {
+		if len(examples) >= h.clusterService.TrainFaces() {
+			break
+		}
+
+		cropData, cropPath, err := storedFaceCrop(ctx, h.imageProcessor, h.cfg.Server.SnapshotDir, face)
+		if err != nil {
+			log.WithError(err).Debugf("Skipping face %d for cluster training", face.ID)
+			lastErr = err
+			if errors.Is(err, context.Canceled) {
+				break
+			}
+			continue
+		}
+
+		exampleID, provider, err := h.addClusterExample(ctx, identity, cropData, cropPath)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to train identity '%s' with face %d", identity.Name, face.ID)
+			removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
+			lastErr = err
+			continue
+		}
+		examples = append(examples, clusterExample{face: face, exampleID: exampleID, provider: provider, cropPath: cropPath})
+	}
+	return examples, lastErr
+}
+
+// addClusterExample legt einen Ausschnitt als Beispiel an: in CompreFace, sofern aktiviert,
+// sonst beim aktiven Gesichtserkennungsanbieter
+func (h *APIHandler) addClusterExample(ctx context.Context, identity models.Identity, cropData []byte, cropPath string) (string, string, error) {
+	if h.cfg.CompreFace.Enabled {
+		result, err := h.compreface.AddSubjectExample(ctx, identity.Name, cropData, filepath.Base(cropPath))
+		if err != nil {
+			return "", "", err
+		}
+		return result.ImageID, compreFaceProvider, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(cropData))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode training crop: %w", err)
+	}
+
+	var provider facerecognition.Provider
+	manager := h.imageProcessor.GetProviderManager()
+	if manager != nil {
+		provider, _ = manager.GetActiveProvider()
+	}
+	if provider == nil {
+		return "", "", errors.New("no face recognition provider available for training")
+	}
+
+	result, err := provider.AddFace(ctx, img, facerecognition.AddFaceRequest{SubjectID: identity.Name})
+	manager.RecordRequestResult(ctx, provider.GetProviderName(), err)
+	if err != nil {
+		return "", "", err
+	}
+	if !result.Success {
+		return "", "", fmt.Errorf("provider rejected the example: %s", result.ErrorMessage)
+	}
+	return result.FaceID, string(provider.GetProviderName()), nil
+}
+
+// clusteringEnabled prüft, ob das Clustering verfügbar ist, und antwortet andernfalls
+func (h *APIHandler) clusteringEnabled(c *gin.Context) bool {
+	if h.clusterService == nil || !h.clusterService.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Face clustering is not enabled"})
+		return false
+	}
+	return true
+}
+
+// findCluster lädt den Cluster aus dem URL-Pfad und antwortet bei Fehlern
+func (h *APIHandler) findCluster(c *gin.Context) (*models.FaceCluster, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+		return nil, false
+	}
+	cluster, err := h.clusterService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return nil, false
+	}
+	return cluster, true
+}
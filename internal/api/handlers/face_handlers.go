@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/core/processor"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+	"double-take-go-reborn/internal/services/similarity"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetFaceCrop liefert den Ausschnitt eines Gesichts als JPEG. Fehlt der Ausschnitt, etwa
+// bei Gesichtern aus älteren Versionen, wird er aus dem Schnappschuss erzeugt.
+func (h *APIHandler) GetFaceCrop(c *gin.Context) {
+	var face models.Face
+	if err := h.db.First(&face, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Face not found"})
+		return
+	}
+
+	cropPath, err := h.imageProcessor.EnsureFaceCrop(&face)
+	if err != nil {
+		log.Warnf("Face crop for face %d not available: %v", face.ID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Face crop not available"})
+		return
+	}
+
+	// Ausschnitte ändern sich nicht, solange das Gesicht existiert
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(filepath.Join(h.cfg.Server.SnapshotDir, cropPath))
+}
+
+// FindSimilarFaces sucht in der gesamten Historie nach Gesichtern, die dem
+// angegebenen Gesicht ähneln, absteigend sortiert nach Ähnlichkeit
+func (h *APIHandler) FindSimilarFaces(c *gin.Context) {
+	if h.similarityService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Similarity search is not available"})
+		return
+	}
+
+	var face models.Face
+	if err := h.db.First(&face, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Face not found"})
+		return
+	}
+	if len(face.Embedding) == 0 || face.EmbeddingProvider == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Face has no stored embedding"})
+		return
+	}
+
+	query, ok := similarityQuery(c)
+	if !ok {
+		return
+	}
+	query.Vector = face.EmbeddingVector()
+	query.Provider = face.EmbeddingProvider
+	query.ExcludeFaceID = face.ID
+
+	h.respondSimilarFaces(c, query)
+}
+
+// SearchFacesByImage sucht in der gesamten Historie nach Gesichtern, die dem größten
+// Gesicht eines hochgeladenen Bildes ähneln
+func (h *APIHandler) SearchFacesByImage(c *gin.Context) {
+	if h.similarityService == nil || h.imageProcessor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Similarity search is not available"})
+		return
+	}
+
+	file, _, err := c.Request.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No image uploaded"})
+		return
+	}
+	defer file.Close()
+
+	imageData, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	query, ok := similarityQuery(c)
+	if !ok {
+		return
+	}
+
+	provider := facerecognition.ProviderType(searchParam(c, "provider"))
+	vector, embeddingProvider, err := h.imageProcessor.EmbedUpload(c.Request.Context(), imageData, provider)
+	if err != nil {
+		log.WithError(err).Warn("Failed to compute embedding for similarity search")
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, image.ErrFormat):
+			status = http.StatusBadRequest
+		case errors.Is(err, processor.ErrNoFace), errors.Is(err, processor.ErrNoEmbedding):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, processor.ErrNoDetector):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": fmt.Sprintf("Cannot search with this image: %v", err)})
+		return
+	}
+	// Gespeicherte Vektoren sind normalisiert, der Suchvektor muss es ebenfalls sein
+	query.Vector = models.DecodeVector(models.EncodeVector(vector))
+	query.Provider = string(embeddingProvider)
+
+	h.respondSimilarFaces(c, query)
+}
+
+// respondSimilarFaces führt die Suche aus und schreibt die Antwort
+func (h *APIHandler) respondSimilarFaces(c *gin.Context, query similarity.Query) {
+	results, err := h.similarityService.Search(query)
+	if err != nil {
+		log.WithError(err).Error("Similarity search failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Similarity search failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"provider": query.Provider,
+		"results":  results,
+		"count":    len(results),
+	})
+}
+
+// similarityQuery liest die Filter der Ähnlichkeitssuche aus Query-Parametern oder
+// Formularfeldern und antwortet bei ungültigen Werten mit 400
+func similarityQuery(c *gin.Context) (similarity.Query, bool) {
+	query := similarity.Query{
+		Limit:         similarity.DefaultLimit,
+		MinSimilarity: similarity.DefaultMinSimilarity,
+	}
+
+	if !timeRangeParams(c, &query.Since, &query.Until) {
+		return query, false
+	}
+
+	if value := searchParam(c, "limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return query, false
+		}
+		query.Limit = limit
+	}
+	if value := searchParam(c, "min_similarity"); value != "" {
+		minSimilarity, err := strconv.ParseFloat(value, 64)
+		if err != nil || minSimilarity < -1 || minSimilarity > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_similarity, expected a value between -1 and 1"})
+			return query, false
+		}
+		query.MinSimilarity = minSimilarity
+	}
+
+	query.Cameras = cameraParams(c)
+	return query, true
+}
+
+// timeRangeParams liest die Parameter since und until (RFC3339) und antwortet bei
+// ungültigen Werten mit 400
+func timeRangeParams(c *gin.Context, since, until *time.Time) bool {
+	for param, target := range map[string]*time.Time{"since": since, "until": until} {
+		value := searchParam(c, param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected RFC3339"})
+			return false
+		}
+		*target = parsed
+	}
+	return true
+}
+
+// cameraParams liest den Kamerafilter als wiederholten Parameter oder kommagetrennt
+func cameraParams(c *gin.Context) []string {
+	var cameras []string
+	values := c.QueryArray("camera")
+	if form, ok := c.GetPostFormArray("camera"); ok {
+		values = append(values, form...)
+	}
+	for _, value := range values {
+		for _, camera := range strings.Split(value, ",") {
+			if camera = strings.TrimSpace(camera); camera != "" {
+				cameras = append(cameras, camera)
+			}
+		}
+	}
+	return cameras
+}
+
+// searchParam liest einen Parameter aus der URL oder, bei Uploads, aus dem Formular
+func searchParam(c *gin.Context, name string) string {
+	if value, ok := c.GetQuery(name); ok {
+		return value
+	}
+	return c.PostForm(name)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"double-take-go-reborn/internal/integrations/frigate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backfillRequest ist der Body von POST /frigate/backfill
+type backfillRequest struct {
+	After     time.Time  `json:"after" binding:"required"`
+	Before    *time.Time `json:"before"`
+	Cameras   []string   `json:"cameras"`
+	Reprocess bool       `json:"reprocess"`
+}
+
+// StartFrigateBackfill übernimmt nachträglich alle Frigate-Events eines Zeitraums.
+// Bereits bekannte Events werden übersprungen oder mit "reprocess" erneut erkannt.
+func (h *APIHandler) StartFrigateBackfill(c *gin.Context) {
+	if h.frigatePoller == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Frigate integration is not enabled"})
+		return
+	}
+
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	backfill := frigate.BackfillRequest{
+		After:     req.After,
+		Cameras:   req.Cameras,
+		Reprocess: req.Reprocess,
+	}
+	if req.Before != nil {
+		backfill.Before = *req.Before
+	}
+
+	status, err := h.frigatePoller.Backfill(backfill)
+	if err != nil {
+		if errors.Is(err, frigate.ErrBackfillRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "backfill": h.frigatePoller.BackfillStatus()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Backfill started", "backfill": status})
+}
+
+// GetFrigateBackfill liefert den Fortschritt des letzten Backfills
+func (h *APIHandler) GetFrigateBackfill(c *gin.Context) {
+	if h.frigatePoller == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Frigate integration is not enabled"})
+		return
+	}
+
+	status := h.frigatePoller.BackfillStatus()
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No backfill has been started"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"backfill": status})
+}
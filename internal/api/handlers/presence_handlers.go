@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"double-take-go-reborn/internal/services/presence"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetPresence gibt alle laufenden Aufenthalte zurück, zuletzt gesehene zuerst
+func (h *APIHandler) GetPresence(c *gin.Context) {
+	if !h.presenceEnabled(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": h.presenceService.Current()})
+}
+
+// ListPresenceSessions gibt gespeicherte Aufenthalte zurück, neueste zuerst
+func (h *APIHandler) ListPresenceSessions(c *gin.Context) {
+	if !h.presenceEnabled(c) {
+		return
+	}
+
+	filter := presence.Filter{
+		Camera:   c.Query("camera"),
+		OpenOnly: c.Query("open") == "true",
+	}
+	if value := c.Query("identity_id"); value != "" {
+		identityID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity_id"})
+			return
+		}
+		filter.IdentityID = uint(identityID)
+	}
+	if !timeRangeParams(c, &filter.Since, &filter.Until) {
+		return
+	}
+
+	var err error
+	filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || filter.Limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	sessions, total, err := h.presenceService.Sessions(filter)
+	if err != nil {
+		log.WithError(err).Error("Failed to list presence sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list presence sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+	})
+}
+
+// presenceEnabled prüft, ob die Anwesenheitserkennung verfügbar ist, und antwortet andernfalls
+func (h *APIHandler) presenceEnabled(c *gin.Context) bool {
+	if h.presenceService == nil || !h.presenceService.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Presence tracking is not enabled"})
+		return false
+	}
+	return true
+}
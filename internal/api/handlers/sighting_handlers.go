@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/db/repository"
+	"double-take-go-reborn/internal/util/timezone"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetIdentityTimeline gibt die Sichtungen einer Identität zurück, neueste zuerst.
+// Treffer desselben Frigate-Events bilden eine Sichtung.
+func (h *APIHandler) GetIdentityTimeline(c *gin.Context) {
+	identity, filter, ok := h.sightingRequest(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	sightings, err := h.repo.GetIdentitySightings(identity.ID, filter)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to load timeline of identity %d", identity.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load timeline"})
+		return
+	}
+
+	total := len(sightings)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identity_id": identity.ID,
+		"sightings":   sightings[offset:end],
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// GetIdentityStatistics gibt die Sichtungsstatistik einer Identität zurück: erste und
+// letzte Sichtung, durchschnittliche Sicherheit sowie Sichtungen je Tag, Stunde,
+// Kamera und Zone in der konfigurierten Zeitzone
+func (h *APIHandler) GetIdentityStatistics(c *gin.Context) {
+	identity, filter, ok := h.sightingRequest(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.repo.GetIdentityStatistics(identity.ID, filter, timezone.Location())
+	if err != nil {
+		log.WithError(err).Errorf("Failed to compute statistics of identity %d", identity.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute statistics"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// sightingRequest lädt die Identität aus dem URL-Pfad und liest Zeitraum und Kameras
+func (h *APIHandler) sightingRequest(c *gin.Context) (models.Identity, repository.SightingFilter, bool) {
+	var identity models.Identity
+	var filter repository.SightingFilter
+	if err := h.db.First(&identity, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return identity, filter, false
+	}
+
+	if !timeRangeParams(c, &filter.Since, &filter.Until) {
+		return identity, filter, false
+	}
+	filter.Cameras = cameraParams(c)
+	return identity, filter, true
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
 
 	"double-take-go-reborn/internal/core/models"
 
@@ -51,9 +52,15 @@ func (h *APIHandler) TrainIdentityWithImage(c *gin.Context) {
 	log.Infof("Füge Trainingsbild für Identität '%s' (%d) mit Datei '%s' (Größe: %d Bytes) hinzu", 
 		identity.Name, identity.ID, header.Filename, len(imageData))
 
-	// An CompreFace senden
+	// Nur das erkannte Gesicht mit Rand trainieren; das Bild muss genau ein Gesicht enthalten
 	ctx := c.Request.Context()
-	
+	cropData, cropPath, err := uploadedFaceCrop(ctx, h.imageProcessor, identity, imageData)
+	if err != nil {
+		log.WithError(err).Warnf("Trainingsbild für Identität '%s' abgelehnt", identity.Name)
+		c.JSON(trainingCropStatus(err), gin.H{"error": fmt.Sprintf("Das Bild kann nicht zum Training verwendet werden: %v", err)})
+		return
+	}
+
 	// Sicherstellen, dass das Subjekt existiert
 	_, err = h.compreface.CreateSubject(ctx, identity.Name)
 	if err != nil {
@@ -61,15 +68,22 @@ func (h *APIHandler) TrainIdentityWithImage(c *gin.Context) {
 		// Wir fahren trotzdem fort, da das Subjekt möglicherweise bereits existiert
 	}
 
-	// Bild als Beispiel zu CompreFace hinzufügen
-	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, imageData, header.Filename)
+	// Ausschnitt als Beispiel zu CompreFace hinzufügen
+	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, cropData, filepath.Base(cropPath))
 	if err != nil {
 		log.WithError(err).Error("Fehler beim Hinzufügen des Trainingsbilds zu CompreFace")
+		removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Hinzufügen des Trainingsbilds zu CompreFace"})
 		return
 	}
 
 	log.Infof("Trainingsbild erfolgreich zu Identität '%s' hinzugefügt (CompreFace-ID: %s)", identity.Name, result.ImageID)
+	recordTrainingExample(h.db, models.TrainingExample{
+		ExampleID:  result.ImageID,
+		Subject:    identity.Name,
+		IdentityID: identity.ID,
+		CropPath:   cropPath,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
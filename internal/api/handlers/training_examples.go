@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/core/processor"
+	"double-take-go-reborn/internal/services/audit"
+	"double-take-go-reborn/internal/util/timezone"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// compreFaceProvider ist der Anbietername für Trainingsbeispiele in CompreFace
+const compreFaceProvider = "compreface"
+
+// errRevertConflict wird zurückgegeben, wenn sich ein Treffer seit der Änderung erneut geändert hat
+var errRevertConflict = errors.New("der Treffer wurde seitdem erneut geändert")
+
+// createTrainingExample speichert ein beim Anbieter hinterlegtes Trainingsbeispiel
+func createTrainingExample(tx *gorm.DB, example models.TrainingExample) error {
+	if example.ExampleID == "" {
+		return nil
+	}
+	if example.Provider == "" {
+		example.Provider = compreFaceProvider
+	}
+	if err := tx.Create(&example).Error; err != nil {
+		return fmt.Errorf("fehler beim Speichern des Trainingsbeispiels: %w", err)
+	}
+	return nil
+}
+
+// recordTrainingExample speichert ein Trainingsbeispiel und protokolliert Fehler nur,
+// da das Beispiel beim Anbieter bereits angelegt ist
+func recordTrainingExample(db *gorm.DB, example models.TrainingExample) {
+	if err := createTrainingExample(db, example); err != nil {
+		log.WithError(err).Warnf("Trainingsbeispiel %s für %s konnte nicht gespeichert werden", example.ExampleID, example.Subject)
+	}
+}
+
+// markTrainingExamplesRemoved vermerkt, dass ein Beispiel beim Anbieter entfernt wurde
+func markTrainingExamplesRemoved(db *gorm.DB, provider, exampleID string) error {
+	return db.Model(&models.TrainingExample{}).
+		Where("provider = ? AND example_id = ? AND removed_at IS NULL", provider, exampleID).
+		Update("removed_at", time.Now()).Error
+}
+
+// storedFaceCrop schneidet ein gespeichertes Gesicht mit Rand aus seinem Schnappschuss aus
+// und legt den Ausschnitt für das Trainingsbeispiel ab. Zurückgegeben werden die
+// Bilddaten und der Pfad relativ zum Snapshot-Verzeichnis.
+func storedFaceCrop(ctx context.Context, imageProcessor *processor.ImageProcessor, snapshotDir string, face models.Face) ([]byte, string, error) {
+	if imageProcessor == nil {
+		return nil, "", processor.ErrNoDetector
+	}
+	box, err := face.Box()
+	if err != nil {
+		return nil, "", err
+	}
+
+	crop, err := imageProcessor.CropFaceFromFile(ctx, filepath.Join(snapshotDir, face.Image.FilePath), box)
+	if err != nil {
+		return nil, "", err
+	}
+	cropPath, err := imageProcessor.SaveTrainingCrop(crop, fmt.Sprintf("face_%d_%d.jpg", face.ID, timezone.Now().UnixMilli()))
+	if err != nil {
+		return nil, "", err
+	}
+	return crop.Data, cropPath, nil
+}
+
+// uploadedFaceCrop erkennt das einzige Gesicht in einem hochgeladenen Bild, schneidet es
+// mit Rand aus und legt den Ausschnitt für das Trainingsbeispiel ab
+func uploadedFaceCrop(ctx context.Context, imageProcessor *processor.ImageProcessor, identity models.Identity, imageData []byte) ([]byte, string, error) {
+	if imageProcessor == nil {
+		return nil, "", processor.ErrNoDetector
+	}
+
+	crop, err := imageProcessor.CropFaceFromUpload(ctx, imageData)
+	if err != nil {
+		return nil, "", err
+	}
+	cropPath, err := imageProcessor.SaveTrainingCrop(crop, fmt.Sprintf("upload_%d_%d.jpg", identity.ID, timezone.Now().UnixMilli()))
+	if err != nil {
+		return nil, "", err
+	}
+	return crop.Data, cropPath, nil
+}
+
+// removeTrainingCrop löscht einen abgelegten Ausschnitt, der nicht beim Anbieter angekommen ist
+func removeTrainingCrop(snapshotDir, cropPath string) {
+	if cropPath == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(snapshotDir, cropPath)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warnf("Trainingsausschnitt %s konnte nicht gelöscht werden", cropPath)
+	}
+}
+
+// trainingCropStatus ordnet Fehler beim Zuschneiden eines Trainingsbeispiels einem HTTP-Status zu
+func trainingCropStatus(err error) int {
+	switch {
+	case errors.Is(err, image.ErrFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, processor.ErrFaceTooSmall), errors.Is(err, processor.ErrNotSingleFace):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, processor.ErrNoDetector):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// RevertAuditEntry macht eine Trefferkorrektur oder ein Training rückgängig: Der
+// vorherige Treffer wird wiederhergestellt und genau die dabei angelegten
+// Trainingsbeispiele werden beim Anbieter entfernt.
+func (h *APIHandler) RevertAuditEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audit entry ID"})
+		return
+	}
+
+	var entry models.AuditEntry
+	if err := h.db.First(&entry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit entry not found"})
+		return
+	}
+	if entry.RevertedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Change has already been reverted"})
+		return
+	}
+	if !audit.Revertible(&entry) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Action %s cannot be reverted", entry.Action)})
+		return
+	}
+
+	before, err := audit.ParseMatchState(entry.Before)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := audit.ParseMatchState(entry.After)
+	if err != nil || after == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Audit entry has no recorded match state"})
+		return
+	}
+
+	var examples []models.TrainingExample
+	if err := h.db.Where("audit_entry_id = ? AND removed_at IS NULL", entry.ID).Find(&examples).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load training examples"})
+		return
+	}
+
+	// Treffer wiederherstellen und die Rücknahme protokollieren
+	var revertEntry *models.AuditEntry
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var match models.Match
+		if err := tx.Preload("Face").Preload("Identity").Where("face_id = ?", after.FaceID).First(&match).Error; err != nil {
+			return fmt.Errorf("treffer für Gesicht %d nicht gefunden: %w", after.FaceID, err)
+		}
+		if match.IdentityID != after.IdentityID {
+			return errRevertConflict
+		}
+		current := audit.MatchState(match, match.Identity.Name)
+
+		var restored interface{}
+		if before == nil {
+			// Vor dem Training gab es keinen Treffer
+			if err := tx.Delete(&match).Error; err != nil {
+				return err
+			}
+		} else {
+			var identity models.Identity
+			if err := tx.First(&identity, before.IdentityID).Error; err != nil {
+				return fmt.Errorf("vorherige Identität %s existiert nicht mehr: %w", before.IdentityName, err)
+			}
+			match.IdentityID = identity.ID
+			match.Identity = identity
+			match.Confidence = before.Confidence
+			if err := tx.Omit("Face", "Identity").Save(&match).Error; err != nil {
+				return err
+			}
+			restored = audit.MatchState(match, identity.Name)
+		}
+
+		now := time.Now()
+		for i := range examples {
+			examples[i].RemovedAt = &now
+			if err := tx.Model(&examples[i]).Update("removed_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		revertEntry, err = audit.Record(tx, auditActor(c), audit.ActionMatchRevert, audit.EntityMatch, match.ID, current, restored)
+		if err != nil {
+			return err
+		}
+		return audit.MarkReverted(tx, &entry, revertEntry)
+	})
+	if err != nil {
+		if errors.Is(err, errRevertConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Match has been changed since, revert the newer change first"})
+			return
+		}
+		log.WithError(err).Errorf("Failed to revert audit entry %d", entry.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to revert change: %v", err)})
+		return
+	}
+
+	// Angelegte Beispiele beim Anbieter entfernen, bei Fehlern später erneut versuchen
+	removed, queued := h.removeTrainingExamples(c.Request.Context(), examples)
+
+	log.Infof("Reverted audit entry %d (%s), removed %d training example(s)", entry.ID, entry.Action, removed)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Change reverted successfully",
+		"revert_entry":     revertEntry,
+		"examples_removed": removed,
+		"examples_queued":  queued,
+	})
+}
+
+// removeTrainingExamples entfernt Trainingsbeispiele beim Anbieter. Fehlgeschlagene
+// Löschungen werden als ausstehende Operation eingereiht.
+func (h *APIHandler) removeTrainingExamples(ctx context.Context, examples []models.TrainingExample) (removed, queued int) {
+	for _, example := range examples {
+		if example.Provider == compreFaceProvider && h.compreface != nil && h.cfg.CompreFace.Enabled {
+			deleteCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := h.compreface.DeleteSubjectExample(deleteCtx, example.ExampleID)
+			cancel()
+			if err == nil {
+				removed++
+				continue
+			}
+			log.WithError(err).Warnf("Failed to delete example %s from CompreFace, queueing", example.ExampleID)
+		}
+
+		if h.syncService == nil {
+			continue
+		}
+		if err := h.syncService.AddPendingOperation(models.POTypeDeleteExample, models.POResourceExample,
+			example.ExampleID, example.IdentityID, nil); err != nil {
+			log.WithError(err).Errorf("Failed to queue deletion of example %s", example.ExampleID)
+			continue
+		}
+		queued++
+	}
+	return removed, queued
+}
@@ -18,9 +18,13 @@ import (
 	"time"
 
 	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/api/middleware"
 	"double-take-go-reborn/internal/core/models"
 	"double-take-go-reborn/internal/core/processor"
 	"double-take-go-reborn/internal/integrations/compreface"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+	"double-take-go-reborn/internal/services/audit"
+	"double-take-go-reborn/internal/services/clustering"
 	syncservice "double-take-go-reborn/internal/services/sync"
 	"double-take-go-reborn/internal/server/sse"
 	"double-take-go-reborn/internal/utils"
@@ -41,6 +45,9 @@ type WebHandler struct {
 	workerPool  *processor.WorkerPool // Zugriff auf den Worker-Pool
 	compreface  *compreface.APIClient    // Zugriff auf den CompreFace-Client
 	syncService *syncservice.Service     // Synchronisierungsservice für ausstehende Operationen
+	providerManager *facerecognition.ProviderManager // Zustand der Gesichtserkennungsanbieter
+	imageProcessor *processor.ImageProcessor // Zuschnitt und Prüfung von Trainingsbildern
+	clusterService *clustering.Service       // Cluster unbekannter Gesichter
 	translations map[string]map[string]string // Cache für Übersetzungen
 	transMutex  sync.RWMutex               // Mutex für thread-sicheren Zugriff
 	activeLanguage string                 // Aktuelle Sprache für Standardanzeige
@@ -348,6 +355,11 @@ func (h *WebHandler) renderTemplate(c *gin.Context, name string, data interface{
 	if _, exists := templateData["Config"]; !exists {
 		templateData["Config"] = h.cfg
 	}
+
+	// Angemeldeten Benutzer für die Navigation bereitstellen (nil ohne Anmeldung)
+	if user := middleware.CurrentUser(c); user != nil {
+		templateData["CurrentUser"] = user
+	}
 	
 	// Sprachauswahl über lang-Parameter oder Cookie
 	language := "de" // Standardsprache Deutsch
@@ -416,6 +428,21 @@ func (h *WebHandler) renderTemplate(c *gin.Context, name string, data interface{
 	log.Infof("Template '%s' erfolgreich gerendert mit Sprache: %s", name, language)
 }
 
+// SetProviderManager setzt den ProviderManager für die Zustandsanzeige der Gesichtserkennungsanbieter
+func (h *WebHandler) SetProviderManager(manager *facerecognition.ProviderManager) {
+	h.providerManager = manager
+}
+
+// SetImageProcessor setzt den ImageProcessor für den Zuschnitt von Trainingsbildern
+func (h *WebHandler) SetImageProcessor(imageProcessor *processor.ImageProcessor) {
+	h.imageProcessor = imageProcessor
+}
+
+// SetClusterService setzt den Dienst für das Clustering unbekannter Gesichter
+func (h *WebHandler) SetClusterService(service *clustering.Service) {
+	h.clusterService = service
+}
+
 // RegisterRoutes registriert alle Web-Routen
 func (h *WebHandler) RegisterRoutes(router *gin.Engine) {
 	// Statische Dateien und Router für Frontend-Komponenten
@@ -432,6 +459,7 @@ func (h *WebHandler) RegisterRoutes(router *gin.Engine) {
 	router.GET("/gallery", h.handleGallery)
 	router.GET("/identities", h.handleIdentities)
 	router.GET("/identities/:id", h.handleIdentityDetails)
+	router.GET("/clusters", h.handleClusters)
 	router.POST("/identities/:id/training", h.handleAddTrainingImage)
 	router.POST("/identities/:id/delete", h.handleDeleteIdentity)
 	router.GET("/settings", h.handleSettings)
@@ -878,19 +906,11 @@ func (h *WebHandler) handleIdentities(c *gin.Context) {
 		// Bestes Match-Bild finden
 		bestMatchURL := "/static/img/placeholder.png" // Standard-Platzhalter
 		
-		// Versuchen, ein Matchbild zu finden, wenn Matches vorhanden sind
+		// Versuchen, den Gesichtsausschnitt des letzten Matches zu verwenden, wenn Matches vorhanden sind
 		if count > 0 {
 			var match models.Match
-			var face models.Face
-			var image models.Image
-			
-			// Den letzten Match mit einem Bild finden
 			if err := h.db.Model(&models.Match{}).Where("identity_id = ?", identity.ID).Order("created_at DESC").First(&match).Error; err == nil {
-				if err := h.db.Model(&models.Face{}).Where("id = ?", match.FaceID).First(&face).Error; err == nil {
-					if err := h.db.Model(&models.Image{}).Where("id = ?", face.ImageID).First(&image).Error; err == nil {
-						bestMatchURL = "/snapshots/" + image.FilePath
-					}
-				}
+				bestMatchURL = fmt.Sprintf("/api/faces/%d/crop", match.FaceID)
 			}
 		}
 
@@ -914,6 +934,32 @@ func (h *WebHandler) handleIdentities(c *gin.Context) {
 	h.renderTemplate(c, "identities.html", data)
 }
 
+// handleClusters zeigt die Cluster unbekannter Gesichter an, die benannt werden können
+func (h *WebHandler) handleClusters(c *gin.Context) {
+	enabled := h.clusterService != nil && h.clusterService.Enabled()
+
+	var clusters []clustering.Summary
+	if enabled {
+		var err error
+		if clusters, err = h.clusterService.List(); err != nil {
+			log.Errorf("Failed to list face clusters: %v", err)
+		}
+	}
+
+	var identities []models.Identity
+	if err := h.db.Order("name").Find(&identities).Error; err != nil {
+		log.Errorf("Failed to fetch identities: %v", err)
+	}
+
+	h.renderTemplate(c, "clusters.html", gin.H{
+		"Title":       "Cluster",
+		"CurrentPage": "clusters",
+		"Enabled":     enabled,
+		"Clusters":    clusters,
+		"Identities":  identities,
+	})
+}
+
 // handleSettings zeigt die Einstellungen-Seite an
 func (h *WebHandler) handleSettings(c *gin.Context) {
 	// Konfiguration für die Anzeige aufbereiten
@@ -1022,6 +1068,7 @@ func (h *WebHandler) handleIdentityDetails(c *gin.Context) {
 	// Letzten Matches für diese Identität finden
 	type matchData struct {
 		ID          uint
+		FaceID      uint
 		ImageID     uint
 		ImagePath   string
 		Source      string
@@ -1033,7 +1080,7 @@ func (h *WebHandler) handleIdentityDetails(c *gin.Context) {
 
 	// SQL-Query für die Verbindung mehrerer Tabellen
 	query := h.db.Table("matches").Select(
-		"matches.id, faces.image_id, images.file_path as image_path, " +
+		"matches.id, matches.face_id, faces.image_id, images.file_path as image_path, " +
 		"images.source, matches.confidence, images.created_at as timestamp",
 	).Joins(
 		"LEFT JOIN faces ON matches.face_id = faces.id",
@@ -1074,7 +1121,7 @@ func (h *WebHandler) handleIdentityDetails(c *gin.Context) {
 	// Bestes Bild für Avatar finden
 	bestMatchURL := ""
 	if len(matches) > 0 {
-		bestMatchURL = "/snapshots/" + matches[0].ImagePath
+		bestMatchURL = fmt.Sprintf("/api/faces/%d/crop", matches[0].FaceID)
 	}
 
 	data := gin.H{
@@ -1119,14 +1166,29 @@ func (h *WebHandler) handleAddTrainingImage(c *gin.Context) {
 		return
 	}
 
-	// An CompreFace senden
+	// Nur das erkannte Gesicht mit Rand trainieren; das Bild muss genau ein Gesicht enthalten
 	ctx := c.Request.Context()
-	_, err = h.compreface.AddSubjectExample(ctx, identity.Name, imageData, header.Filename)
+	cropData, cropPath, err := uploadedFaceCrop(ctx, h.imageProcessor, identity, imageData)
+	if err != nil {
+		log.WithError(err).Warnf("Trainingsbild '%s' für Identität '%s' abgelehnt", header.Filename, identity.Name)
+		c.Redirect(http.StatusFound, fmt.Sprintf("/identities/%d", identity.ID))
+		return
+	}
+
+	// An CompreFace senden
+	result, err := h.compreface.AddSubjectExample(ctx, identity.Name, cropData, filepath.Base(cropPath))
 	if err != nil {
 		log.WithError(err).Error("Fehler beim Hinzufügen des Beispiels zu CompreFace")
+		removeTrainingCrop(h.cfg.Server.SnapshotDir, cropPath)
 		c.Redirect(http.StatusFound, fmt.Sprintf("/identities/%d", identity.ID))
 		return
 	}
+	recordTrainingExample(h.db, models.TrainingExample{
+		ExampleID:  result.ImageID,
+		Subject:    identity.Name,
+		IdentityID: identity.ID,
+		CropPath:   cropPath,
+	})
 
 	// Zurück zur Identitätsseite
 	c.Redirect(http.StatusFound, fmt.Sprintf("/identities/%d", identity.ID))
@@ -1164,8 +1226,8 @@ func (h *WebHandler) handleDeleteIdentity(c *gin.Context) {
 		}
 	}
 
-	// Identität in der Datenbank löschen
-	if err := h.db.Delete(&identity).Error; err != nil {
+	// Identität in der Datenbank löschen und die Löschung protokollieren
+	if err := deleteIdentityAudited(h.db, c, identity); err != nil {
 		log.WithError(err).Error("Fehler beim Löschen der Identität aus der Datenbank")
 		c.Redirect(http.StatusFound, fmt.Sprintf("/identities/%d", identity.ID))
 		return
@@ -1347,7 +1409,14 @@ func (h *WebHandler) handleDiagnostics(c *gin.Context) {
 		log.Infof("OpenCV Config: %s = %v", k, v)
 	}
 	
+	// Zustand der Gesichtserkennungsanbieter (Circuit Breaker, Failover)
+	var providerHealth []facerecognition.ProviderHealth
+	if h.providerManager != nil {
+		providerHealth = h.providerManager.GetHealthStatus()
+	}
+	
 	data := gin.H{
+		"ProviderHealth": providerHealth,
 		"DBStats": dbStats,
 		"Services": gin.H{
 			"CompreFace": compreFaceStatus,
@@ -1366,7 +1435,11 @@ func (h *WebHandler) handleDiagnostics(c *gin.Context) {
 			"MemorySys":        utils.FormatBytes(systemStats.MemorySys),
 			"WorkerCount":      systemStats.WorkerCount,
 			"ActiveJobs":       systemStats.ActiveJobs,
-			"QueueCapacity":    systemStats.QueueCapacity,
+			"QueueDepth":       systemStats.QueueDepth,
+			"QueueFailed":      systemStats.QueueFailed,
+			"QueueOldestWait":  fmt.Sprintf("%.1f s", systemStats.QueueOldestWait),
+			"QueueAvgWait":     fmt.Sprintf("%.1f s", systemStats.QueueAvgWait),
+			"AvgProcessingTime": fmt.Sprintf("%.1f s", systemStats.AvgProcessingTime),
 			"Timestamp":        systemStats.Timestamp,
 		},
 	}
@@ -1419,11 +1492,20 @@ func (h *WebHandler) handleUpdateMatch(c *gin.Context) {
 		return
 	}
 
-	// Aktualisieren des Matches in der lokalen Datenbank
+	// Aktualisieren des Matches in der lokalen Datenbank, zusammen mit dem Audit-Eintrag
+	before := audit.MatchState(match, oldIdentityName)
 	match.IdentityID = uint(newIdentityID)
 	match.Identity = newIdentity
-	
-	if err := h.db.Save(&match).Error; err != nil {
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&match).Error; err != nil {
+			return err
+		}
+		_, err := audit.Record(tx, auditActor(c), audit.ActionMatchUpdate, audit.EntityMatch, match.ID,
+			before, audit.MatchState(match, newIdentity.Name))
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Fehler beim Aktualisieren des Treffers: %v", err)})
 		return
 	}
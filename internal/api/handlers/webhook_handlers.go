@@ -1,183 +1,402 @@
 package handlers
 
 import (
-	"io/ioutil"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/core/processor"
-	"double-take-go-reborn/internal/db/repository"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"gorm.io/datatypes"
 )
 
+// Standardwerte für den Webhook-Endpunkt
+const (
+	defaultWebhookMaxImageSize = 10 * 1024 * 1024
+	defaultWebhookFetchTimeout = 10 * time.Second
+)
+
+// errImageTooLarge wird zurückgegeben, wenn ein Bild die maximale Größe überschreitet
+var errImageTooLarge = errors.New("bild überschreitet die maximale Größe")
+
+// unsafePathChars enthält alle Zeichen, die nicht in Quell- oder Kameranamen von Dateipfaden vorkommen dürfen
+var unsafePathChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
 // WebhookHandler verarbeitet eingehende Webhook-Anfragen
 type WebhookHandler struct {
 	imageProcessor *processor.ImageProcessor
-	repo           repository.Repository
+	cfg            config.WebhookConfig
 	snapshotDir    string
+	httpClient     *http.Client
 }
 
 // NewWebhookHandler erstellt einen neuen Webhook-Handler
-func NewWebhookHandler(imageProcessor *processor.ImageProcessor, repo repository.Repository, snapshotDir string) *WebhookHandler {
+func NewWebhookHandler(imageProcessor *processor.ImageProcessor, cfg *config.Config) *WebhookHandler {
+	timeout := time.Duration(cfg.Webhook.FetchTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookFetchTimeout
+	}
+
+	if cfg.Webhook.Token == "" && cfg.Webhook.Secret == "" && len(cfg.Webhook.Sources) == 0 {
+		log.Warn("Webhook ist aktiviert, aber weder Token noch Secret sind konfiguriert - alle Anfragen werden abgelehnt")
+	}
+
 	return &WebhookHandler{
 		imageProcessor: imageProcessor,
-		repo:           repo,
-		snapshotDir:    snapshotDir,
+		cfg:            cfg.Webhook,
+		snapshotDir:    cfg.Server.SnapshotDir,
+		httpClient:     &http.Client{Timeout: timeout},
 	}
 }
 
-// WebhookRequest repräsentiert die Anfrage an einen Webhook
+// RegisterRoutes registriert die Webhook-Routen
+func (h *WebhookHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/webhook/:source", h.ReceiveWebhook)
+}
+
+// WebhookRequest repräsentiert die Anfrage an einen Webhook. Bei multipart/form-data
+// werden die Felder als Formularfelder übergeben, source_data als JSON-String.
 type WebhookRequest struct {
-	ImageURL     string                 `json:"image_url,omitempty"`
-	ImageBase64  string                 `json:"image_base64,omitempty"`
-	Source       string                 `json:"source,omitempty"`
-	CameraName   string                 `json:"camera_name,omitempty"`
-	Timestamp    string                 `json:"timestamp,omitempty"`
-	DetectedAt   time.Time              `json:"detected_at,omitempty"`
-	SourceData   map[string]interface{} `json:"source_data,omitempty"`
-	DetectFaces  bool                   `json:"detect_faces,omitempty"`
-	RecognizeFaces bool                 `json:"recognize_faces,omitempty"`
+	ImageURL    string                 `json:"image_url,omitempty"`
+	ImageBase64 string                 `json:"image_base64,omitempty"`
+	CameraName  string                 `json:"camera_name,omitempty"`
+	Timestamp   string                 `json:"timestamp,omitempty"`
+	DetectedAt  time.Time              `json:"detected_at,omitempty"`
+	SourceData  map[string]interface{} `json:"source_data,omitempty"`
 }
 
 // ReceiveWebhook verarbeitet eingehende Webhook-Anfragen
 func (h *WebhookHandler) ReceiveWebhook(c *gin.Context) {
-	var req WebhookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Errorf("Failed to parse webhook request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Anforderungsformat"})
+	source := unsafePathChars.ReplaceAllString(c.Param("source"), "_")
+	if strings.Trim(source, "_") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Quelle"})
 		return
 	}
 
-	// Validierung
-	if req.ImageURL == "" && req.ImageBase64 == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Bild-URL oder Base64-kodiertes Bild erforderlich"})
+	// Den Body vollständig lesen, um die Signatur prüfen zu können. Base64 und
+	// Multipart benötigen etwas mehr Platz als das Bild selbst.
+	maxImageSize := h.maxImageSize()
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImageSize*4/3+64*1024))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Anfrage ist zu groß"})
 		return
 	}
 
-	// Quelle setzen, falls nicht angegeben
-	if req.Source == "" {
-		req.Source = "webhook"
+	if !h.authenticate(c, source, body) {
+		log.Warnf("Webhook-Anfrage für Quelle %s von %s abgelehnt: ungültige Authentifizierung", source, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Ungültige Authentifizierung"})
+		return
 	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
-	// Zeit verarbeiten
-	now := time.Now()
-	detectedAt := now
-	
-	if req.Timestamp != "" {
-		if parsedTime, err := time.Parse(time.RFC3339, req.Timestamp); err == nil {
-			detectedAt = parsedTime
-		} else {
-			log.Warnf("Konnte Zeitstempel nicht parsen: %v", err)
-		}
-	} else if !req.DetectedAt.IsZero() {
-		detectedAt = req.DetectedAt
+	var req WebhookRequest
+	var imageBytes []byte
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		req, imageBytes, err = parseMultipartWebhook(c, maxImageSize)
+	} else {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		log.Errorf("Failed to parse webhook request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Anforderungsformat"})
+		return
 	}
 
-	// Datei herunterladen oder aus Base64 dekodieren
-	var imageBytes []byte
-	var err error
-	
-	if req.ImageURL != "" {
-		// Bild von URL herunterladen
-		resp, err := http.Get(req.ImageURL)
+	// Angehaltene, deaktivierte oder außerhalb ihres Zeitfensters liegende Kameras nicht verarbeiten
+	if req.CameraName != "" && !h.imageProcessor.CameraActive(req.CameraName) {
+		c.JSON(http.StatusOK, gin.H{"message": "Verarbeitung für diese Kamera ist derzeit nicht aktiv"})
+		return
+	}
+
+	// Bild aus Upload, URL oder Base64 übernehmen
+	switch {
+	case imageBytes != nil:
+	case req.ImageURL != "":
+		imageBytes, err = h.fetchImage(c.Request.Context(), req.ImageURL, maxImageSize)
 		if err != nil {
 			log.Errorf("Fehler beim Herunterladen des Bildes: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Bild konnte nicht heruntergeladen werden"})
-			return
-		}
-		defer resp.Body.Close()
-		
-		imageBytes, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Errorf("Fehler beim Lesen des Bildinhalts: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Bild konnte nicht gelesen werden"})
+			if errors.Is(err, errImageTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Bild ist zu groß"})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Bild konnte nicht heruntergeladen werden"})
 			return
 		}
-	} else if req.ImageBase64 != "" {
-		// Base64-kodiertes Bild dekodieren
+	case req.ImageBase64 != "":
 		imageBytes, err = decodeBase64Image(req.ImageBase64)
 		if err != nil {
 			log.Errorf("Fehler beim Dekodieren des Base64-Bildes: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Base64-kodiertes Bild"})
 			return
 		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bild-URL, Base64-kodiertes Bild oder Datei-Upload erforderlich"})
+		return
 	}
 
-	// Dateinamen generieren
-	filename := generateWebhookFilename(req.Source, req.CameraName, detectedAt)
-	filepath := filepath.Join(h.snapshotDir, filename)
-
-	// Bild auf Festplatte speichern
-	if err := saveImageFile(imageBytes, filepath); err != nil {
-		log.Errorf("Fehler beim Speichern des Bildes: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bild konnte nicht gespeichert werden"})
+	if int64(len(imageBytes)) > maxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Bild ist zu groß"})
 		return
 	}
-
-	// Bild in die Datenbank einfügen
-	image := &models.Image{
-		Source:      req.Source,
-		FileName:    filename,
-		FilePath:    filename,
-		DetectedAt:  detectedAt,
-		SourceData:  datatypes.JSON{},
+	extension := imageExtension(imageBytes)
+	if extension == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nicht unterstütztes Bildformat"})
+		return
 	}
 
-	if err := h.repo.SaveImage(image); err != nil {
-		log.Errorf("Fehler beim Speichern des Bildes in der Datenbank: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bild konnte nicht in der Datenbank gespeichert werden"})
-		return
+	// Zeit verarbeiten
+	detectedAt := time.Now()
+	if req.Timestamp != "" {
+		if parsedTime, err := time.Parse(time.RFC3339, req.Timestamp); err == nil {
+			detectedAt = parsedTime
+		} else {
+			log.Warnf("Konnte Zeitstempel nicht parsen: %v", err)
+		}
+	} else if !req.DetectedAt.IsZero() {
+		detectedAt = req.DetectedAt
 	}
 
-	// Bild für die Gesichtserkennung verarbeiten
-	processingOptions := processor.ProcessingOptions{
-		DetectFaces:    req.DetectFaces,
-		RecognizeFaces: req.RecognizeFaces,
+	// Bild auf Festplatte speichern
+	filename := generateWebhookFilename(source, req.CameraName, detectedAt, extension)
+	fullPath := filepath.Join(h.snapshotDir, filename)
+	if err := saveImageFile(imageBytes, fullPath); err != nil {
+		log.Errorf("Fehler beim Speichern des Bildes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bild konnte nicht gespeichert werden"})
+		return
 	}
 
-	ctx := c.Request.Context()
-	_, err = h.imageProcessor.ProcessImage(ctx, filepath, req.Source, processingOptions)
+	// Bild für die Gesichtserkennung verarbeiten, die Quelldaten landen in den Metadaten
+	image, err := h.imageProcessor.ProcessImage(c.Request.Context(), fullPath, source, processor.ProcessingOptions{
+		DetectFaces:    true,
+		RecognizeFaces: true,
+		Metadata:       webhookMetadata(source, req, detectedAt),
+		Priority:       processor.PriorityNew,
+	})
 	if err != nil {
 		log.Errorf("Fehler bei der Bildverarbeitung: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Bildverarbeitung"})
 		return
 	}
+	if image == nil {
+		// Die Vorfilterung hat keine Person erkannt, das Bild wurde nicht gespeichert
+		os.Remove(fullPath)
+		c.JSON(http.StatusOK, gin.H{"message": "Keine Person im Bild erkannt"})
+		return
+	}
 
 	// Erfolgsantwort senden
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Bild erfolgreich verarbeitet",
+		"message":  "Bild erfolgreich verarbeitet",
 		"image_id": image.ID,
 	})
 }
 
+// authenticate prüft die Signatur oder den Token einer Anfrage. Für Quellen mit
+// eigenen Zugangsdaten gelten ausschließlich diese.
+func (h *WebhookHandler) authenticate(c *gin.Context, source string, body []byte) bool {
+	token, secret := h.cfg.Token, h.cfg.Secret
+	if credentials, ok := h.cfg.Sources[strings.ToLower(source)]; ok {
+		token, secret = credentials.Token, credentials.Secret
+	}
+
+	if signature := c.GetHeader("X-Webhook-Signature"); signature != "" && secret != "" {
+		return validWebhookSignature(secret, body, signature)
+	}
+
+	if token != "" {
+		provided := c.GetHeader("X-Webhook-Token")
+		if provided == "" {
+			if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				provided = strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+		return provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+	}
+
+	return false
+}
+
+// maxImageSize liefert die maximale Bildgröße in Bytes
+func (h *WebhookHandler) maxImageSize() int64 {
+	if h.cfg.MaxImageSize > 0 {
+		return h.cfg.MaxImageSize
+	}
+	return defaultWebhookMaxImageSize
+}
+
+// fetchImage lädt ein Bild per HTTP(S) herunter und bricht bei Überschreitung der
+// maximalen Größe ab
+func (h *WebhookHandler) fetchImage(ctx context.Context, imageURL string, maxSize int64) ([]byte, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("ungültige Bild-URL: %s", imageURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Erstellen der Anfrage: %w", err)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Abrufen von %s: %w", parsed.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unerwarteter Statuscode %d von %s", resp.StatusCode, parsed.Host)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, errImageTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen des Bildinhalts: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errImageTooLarge
+	}
+	return data, nil
+}
+
 // Hilfsfunktionen
 
-// decodeBase64Image dekodiert ein Base64-kodiertes Bild
+// parseMultipartWebhook liest Datei und Felder einer multipart/form-data-Anfrage.
+// Die Datei wird im Feld "file" (alternativ "image") erwartet.
+func parseMultipartWebhook(c *gin.Context, maxSize int64) (WebhookRequest, []byte, error) {
+	var req WebhookRequest
+	if err := c.Request.ParseMultipartForm(maxSize); err != nil {
+		return req, nil, fmt.Errorf("fehler beim Lesen des Formulars: %w", err)
+	}
+
+	req.ImageURL = c.PostForm("image_url")
+	req.ImageBase64 = c.PostForm("image_base64")
+	req.CameraName = c.PostForm("camera_name")
+	req.Timestamp = c.PostForm("timestamp")
+	if sourceData := c.PostForm("source_data"); sourceData != "" {
+		if err := json.Unmarshal([]byte(sourceData), &req.SourceData); err != nil {
+			return req, nil, fmt.Errorf("ungültige source_data: %w", err)
+		}
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		header, err = c.FormFile("image")
+	}
+	if err != nil {
+		// Ohne Datei wird auf image_url bzw. image_base64 zurückgegriffen
+		return req, nil, nil
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return req, nil, fmt.Errorf("fehler beim Öffnen der Datei: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return req, nil, fmt.Errorf("fehler beim Lesen der Datei: %w", err)
+	}
+	return req, data, nil
+}
+
+// webhookMetadata übernimmt die Quelldaten der Anfrage in die Verarbeitungsmetadaten.
+// Bekannte Schlüssel wie event_id, label oder current_zones werden vom Processor ausgewertet.
+func webhookMetadata(source string, req WebhookRequest, detectedAt time.Time) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(req.SourceData)+3)
+	for key, value := range req.SourceData {
+		metadata[key] = value
+	}
+	metadata["source"] = source
+	metadata["detected_at"] = detectedAt.Format(time.RFC3339)
+	if req.CameraName != "" {
+		metadata["camera"] = req.CameraName
+	}
+	return metadata
+}
+
+// validWebhookSignature prüft eine HMAC-SHA256-Signatur im Format "sha256=<hex>" oder "<hex>"
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// decodeBase64Image dekodiert ein Base64-kodiertes Bild, auch als Data-URL
 func decodeBase64Image(base64Data string) ([]byte, error) {
-	// Implementierung hier
-	// Beispiel: return base64.StdEncoding.DecodeString(strings.TrimPrefix(base64Data, "data:image/jpeg;base64,"))
-	return nil, nil // Platzhalter
+	if strings.HasPrefix(base64Data, "data:") {
+		if comma := strings.Index(base64Data, ","); comma >= 0 {
+			base64Data = base64Data[comma+1:]
+		}
+	}
+	base64Data = strings.Join(strings.Fields(base64Data), "")
+
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(base64Data, "="))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("leeres Bild")
+	}
+	return data, nil
+}
+
+// imageExtension ermittelt die Dateiendung anhand des Bildinhalts ("" bei nicht unterstützten Formaten)
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	default:
+		return ""
+	}
 }
 
 // generateWebhookFilename generiert einen Dateinamen für ein über Webhook empfangenes Bild
-func generateWebhookFilename(source, cameraName string, timestamp time.Time) string {
+func generateWebhookFilename(source, cameraName string, timestamp time.Time, extension string) string {
 	timeStr := timestamp.Format("20060102_150405")
-	
-	if cameraName == "" {
+
+	cameraName = unsafePathChars.ReplaceAllString(cameraName, "_")
+	if strings.Trim(cameraName, "_") == "" {
 		cameraName = "unknown"
 	}
-	
-	return filepath.Join("webhook", source, cameraName, timeStr+".jpg")
+
+	// Der Zusatz verhindert Kollisionen bei mehreren Bildern pro Sekunde
+	unique := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return filepath.Join("webhook", source, cameraName, timeStr+"_"+unique+extension)
 }
 
 // saveImageFile speichert ein Bild auf der Festplatte
 func saveImageFile(imageData []byte, filePath string) error {
-	// Implementierung hier
-	// Beispiel: return ioutil.WriteFile(filePath, imageData, 0644)
-	return nil // Platzhalter
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("fehler beim Erstellen des Verzeichnisses: %w", err)
+	}
+	return os.WriteFile(filePath, imageData, 0644)
 }
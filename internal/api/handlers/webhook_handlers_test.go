@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/core/processor"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testPNG ist ein 8x8 Pixel großes PNG. Es ist bewusst fest kodiert, damit der Test
+// den PNG-Decoder nicht selbst registriert.
+const testPNG = "iVBORw0KGgoAAAANSUhEUgAAAAgAAAAICAIAAABLbSncAAAAGUlEQVR4nGJhYGhQYGDARCwgAhsYnBKAAQBqxwJhq0KzfgAAAABJRU5ErkJggg=="
+
+// faceProvider erkennt in jedem Bild ein Gesicht ohne Treffer
+type faceProvider struct{}
+
+func (faceProvider) GetProviderName() facerecognition.ProviderType { return "test" }
+func (faceProvider) IsAvailable(ctx context.Context) bool           { return true }
+func (faceProvider) DetectFaces(ctx context.Context, img image.Image, opts facerecognition.DetectionRequest) (*facerecognition.DetectionResponse, error) {
+	return &facerecognition.DetectionResponse{Faces: []facerecognition.Face{{BoundingBox: []int{1, 1, 6, 6}, Confidence: 0.9}}}, nil
+}
+func (faceProvider) RecognizeFaces(ctx context.Context, img image.Image, opts facerecognition.RecognitionRequest) (*facerecognition.RecognitionResponse, error) {
+	return &facerecognition.RecognitionResponse{}, nil
+}
+func (faceProvider) AddFace(ctx context.Context, img image.Image, opts facerecognition.AddFaceRequest) (*facerecognition.AddFaceResponse, error) {
+	return &facerecognition.AddFaceResponse{Success: true}, nil
+}
+func (faceProvider) GetSubjects(ctx context.Context) ([]facerecognition.SubjectInfo, error) {
+	return nil, nil
+}
+func (faceProvider) DeleteSubject(ctx context.Context, subjectID string) error { return nil }
+
+// newTestWebhookHandler liefert einen Webhook-Handler mit Token, leerer SQLite-Datenbank
+// und einem Provider, der in jedem Bild ein Gesicht findet
+func newTestWebhookHandler(t *testing.T) (*gin.Engine, *gorm.DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Image{}, &models.Face{}, &models.Identity{}, &models.Match{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	cfg := &config.Config{}
+	cfg.Server.SnapshotDir = filepath.Join(dir, "snapshots")
+	cfg.Webhook.Token = "secret"
+
+	manager := facerecognition.NewProviderManager()
+	manager.RegisterProvider(faceProvider{})
+	manager.SetActiveProvider("test")
+	imageProcessor := processor.NewImageProcessor(db, cfg, nil, manager, nil, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewWebhookHandler(imageProcessor, cfg).RegisterRoutes(router.Group("/api"))
+	return router, db, cfg.Server.SnapshotDir
+}
+
+func TestReceiveWebhookAcceptsPNG(t *testing.T) {
+	router, db, snapshotDir := newTestWebhookHandler(t)
+
+	body, _ := json.Marshal(WebhookRequest{ImageBase64: testPNG, CameraName: "door"})
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook/doorbell", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var stored models.Image
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("image should be stored: %v", err)
+	}
+	if !strings.HasSuffix(stored.FilePath, ".png") {
+		t.Fatalf("image should keep its png extension, got %s", stored.FilePath)
+	}
+	var faces int64
+	db.Model(&models.Face{}).Where("image_id = ?", stored.ID).Count(&faces)
+	if faces != 1 {
+		t.Fatalf("png should be decoded and its face stored, got %d faces", faces)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(snapshotDir, "webhook", "doorbell", "door", "*.png")); len(matches) != 1 {
+		t.Fatalf("png should be saved below the snapshot directory, got %v", matches)
+	}
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/services/auth"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Schlüssel im Gin-Kontext und in der Session
+const (
+	ContextUserKey   = "user"   // *models.User des angemeldeten Benutzers
+	ContextRoleKey   = "role"   // Wirksame Rolle der Anfrage
+	ContextScopesKey = "scopes" // Wirksame Berechtigungen der Anfrage
+	ContextTokenKey  = "token"  // *models.APIToken bei Anfragen mit API-Token
+	SessionUserKey   = "user_id"
+)
+
+// publicPaths sind ohne Anmeldung erreichbar. Der Webhook prüft Token und
+// Signatur selbst.
+var publicPaths = []string{
+	"/login",
+	"/logout",
+	"/static/",
+	"/favicon.ico",
+	"/api/webhook/",
+}
+
+// viewerWritePaths dürfen auch Betrachter mit schreibenden Methoden aufrufen
+var viewerWritePaths = []string{
+	"/api/auth/password",
+}
+
+// adminReadPaths sind auch lesend nur für Administratoren zugänglich
+var adminReadPaths = []string{
+	"/settings",
+	"/train-compreface/",
+	"/api/auth/users",
+	"/api/auth/tokens",
+	"/api/auth/requests",
+	"/api/audit",
+}
+
+// writeScopes ordnet ändernde Routen (Methode und Routenmuster) der erforderlichen
+// Berechtigung zu. Alle anderen ändernden Routen erfordern admin.
+var writeScopes = map[string]string{
+	"POST /api/process/image":                        models.ScopeIngest,
+	"POST /api/process/compreface":                   models.ScopeIngest,
+	"POST /api/images/:id/recognize":                 models.ScopeIngest,
+	"POST /api/identities":                           models.ScopeTraining,
+	"PUT /api/identities/:id":                        models.ScopeTraining,
+	"POST /api/identities/:id/rename":                models.ScopeTraining,
+	"POST /api/identities/:id/train":                 models.ScopeTraining,
+	"POST /api/identities/:id/examples":              models.ScopeTraining,
+	"DELETE /api/identities/:id/examples/:exampleId": models.ScopeTraining,
+	"PUT /api/matches/:id":                           models.ScopeTraining,
+	"POST /api/faces/:id/train-compreface":           models.ScopeTraining,
+	"POST /api/audit/:id/revert":                     models.ScopeTraining,
+	"POST /api/faces/search":                         models.ScopeRead,
+	"POST /api/clusters/:id/name":                    models.ScopeTraining,
+	"POST /api/clusters/rebuild":                     models.ScopeTraining,
+	"POST /identities/:id/training":                  models.ScopeTraining,
+	"POST /matches/:id/update":                       models.ScopeTraining,
+}
+
+// Auth ermittelt den Benutzer einer Anfrage aus der Session oder einem API-Token
+// ("Authorization: Bearer <token>" oder "X-API-Key") und setzt die Berechtigungen
+// durch. Betrachter dürfen nur lesen, API-Tokens nur das, wofür sie ausgestellt
+// wurden. Alle ändernden Anfragen werden im Anfrageprotokoll festgehalten.
+func Auth(service *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if matchesPath(path, publicPaths) {
+			c.Next()
+			return
+		}
+
+		user, token, scopes, err := authenticate(c, service)
+		if user == nil {
+			message := "Anmeldung erforderlich"
+			if errors.Is(err, auth.ErrTokenExpired) {
+				message = "API-Token ist abgelaufen"
+			}
+			deny(c, http.StatusUnauthorized, message)
+			return
+		}
+		c.Set(ContextUserKey, user)
+		c.Set(ContextRoleKey, auth.ScopesRole(scopes))
+		c.Set(ContextScopesKey, scopes)
+		if token != nil {
+			c.Set(ContextTokenKey, token)
+		}
+
+		if !auth.HasScope(scopes, requiredScope(c.Request.Method, path, c.FullPath())) {
+			deny(c, http.StatusForbidden, "Keine Berechtigung für diese Aktion")
+			return
+		}
+
+		c.Next()
+
+		if isWriteMethod(c.Request.Method) {
+			logRequest(c, service, user, token)
+		}
+	}
+}
+
+// CurrentUser liefert den angemeldeten Benutzer (nil ohne Anmeldung)
+func CurrentUser(c *gin.Context) *models.User {
+	if value, ok := c.Get(ContextUserKey); ok {
+		if user, ok := value.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// authenticate prüft zuerst einen API-Token und danach die Session
+func authenticate(c *gin.Context, service *auth.Service) (*models.User, *models.APIToken, []string, error) {
+	if plain := requestToken(c); plain != "" {
+		token, err := service.AuthenticateToken(plain, c.ClientIP())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return &token.User, token, auth.TokenScopes(token), nil
+	}
+
+	session := sessions.Default(c)
+	userID, ok := session.Get(SessionUserKey).(uint)
+	if !ok {
+		return nil, nil, nil, nil
+	}
+	user, err := service.GetUser(userID)
+	if err != nil {
+		// Benutzer wurde gelöscht
+		session.Clear()
+		session.Save()
+		return nil, nil, nil, err
+	}
+	return user, nil, auth.RoleScopes(user.Role), nil
+}
+
+// requestToken liest einen API-Token aus den Headern
+func requestToken(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// requiredScope bestimmt die für eine Anfrage erforderliche Berechtigung
+func requiredScope(method, path, route string) string {
+	if !isWriteMethod(method) {
+		if matchesPath(path, adminReadPaths) {
+			return models.ScopeAdmin
+		}
+		return models.ScopeRead
+	}
+	if matchesPath(path, viewerWritePaths) {
+		return models.ScopeRead
+	}
+	if scope, ok := writeScopes[method+" "+route]; ok {
+		return scope
+	}
+	return models.ScopeAdmin
+}
+
+// isWriteMethod prüft, ob eine HTTP-Methode Daten ändern kann
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// logRequest schreibt eine ändernde Anfrage ins Anfrageprotokoll
+func logRequest(c *gin.Context, service *auth.Service, user *models.User, token *models.APIToken) {
+	entry := models.APIRequestLog{
+		UserID:   user.ID,
+		Username: user.Username,
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		Route:    c.FullPath(),
+		Status:   c.Writer.Status(),
+		ClientIP: c.ClientIP(),
+	}
+	if token != nil {
+		entry.TokenID = &token.ID
+		entry.TokenName = token.Name
+		entry.TokenPrefix = token.Prefix
+	}
+	if err := service.LogRequest(&entry); err != nil {
+		log.Errorf("Fehler beim Protokollieren der Anfrage %s %s: %v", entry.Method, entry.Path, err)
+	}
+}
+
+// deny beendet eine Anfrage. API-Aufrufe und der Event-Stream erhalten JSON,
+// Seitenaufrufe ohne Anmeldung werden zur Anmeldeseite umgeleitet.
+func deny(c *gin.Context, status int, message string) {
+	path := c.Request.URL.Path
+	isPage := c.Request.Method == http.MethodGet &&
+		!strings.HasPrefix(path, "/api/") &&
+		path != "/events" &&
+		!strings.Contains(c.GetHeader("Accept"), "application/json")
+
+	if status == http.StatusUnauthorized && isPage {
+		c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+		c.Abort()
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// matchesPath prüft, ob ein Pfad einem der Einträge entspricht. Einträge mit
+// abschließendem Schrägstrich gelten als Präfix.
+func matchesPath(path string, entries []string) bool {
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			if strings.HasPrefix(path, entry) {
+				return true
+			}
+		} else if path == entry || strings.HasPrefix(path, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
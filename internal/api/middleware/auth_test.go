@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/services/auth"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path, route string
+		want                string
+	}{
+		// Lesende Anfragen
+		{http.MethodGet, "/", "/", models.ScopeRead},
+		{http.MethodGet, "/api/images", "/api/images", models.ScopeRead},
+		{http.MethodHead, "/api/identities", "/api/identities", models.ScopeRead},
+		{http.MethodOptions, "/api/process/image", "/api/process/image", models.ScopeRead},
+
+		// Lesende Anfragen, die nur Administratoren vorbehalten sind
+		{http.MethodGet, "/settings", "/settings", models.ScopeAdmin},
+		{http.MethodGet, "/train-compreface/12", "/train-compreface/:id", models.ScopeAdmin},
+		{http.MethodGet, "/api/auth/users", "/api/auth/users", models.ScopeAdmin},
+		{http.MethodGet, "/api/auth/users/3", "/api/auth/users/:id", models.ScopeAdmin},
+		{http.MethodGet, "/api/auth/tokens", "/api/auth/tokens", models.ScopeAdmin},
+		{http.MethodGet, "/api/auth/requests", "/api/auth/requests", models.ScopeAdmin},
+		{http.MethodGet, "/api/audit", "/api/audit", models.ScopeAdmin},
+		{http.MethodGet, "/api/audit/5", "/api/audit/:id", models.ScopeAdmin},
+		{http.MethodGet, "/api/auth/me", "/api/auth/me", models.ScopeRead},
+		{http.MethodGet, "/api/auditing", "", models.ScopeRead},
+
+		// Ändernde Anfragen mit eigener Berechtigung
+		{http.MethodPost, "/api/process/image", "/api/process/image", models.ScopeIngest},
+		{http.MethodPost, "/api/images/7/recognize", "/api/images/:id/recognize", models.ScopeIngest},
+		{http.MethodPut, "/api/identities/3", "/api/identities/:id", models.ScopeTraining},
+		{http.MethodPut, "/api/matches/9", "/api/matches/:id", models.ScopeTraining},
+		{http.MethodPost, "/api/audit/4/revert", "/api/audit/:id/revert", models.ScopeTraining},
+		{http.MethodPost, "/api/faces/search", "/api/faces/search", models.ScopeRead},
+
+		// Betrachter dürfen ihr eigenes Passwort ändern
+		{http.MethodPost, "/api/auth/password", "/api/auth/password", models.ScopeRead},
+
+		// Alle übrigen ändernden Anfragen erfordern admin
+		{http.MethodDelete, "/api/identities/3", "/api/identities/:id", models.ScopeAdmin},
+		{http.MethodPost, "/api/identities/3", "/api/identities/:id", models.ScopeAdmin},
+		{http.MethodPost, "/api/auth/users", "/api/auth/users", models.ScopeAdmin},
+		{http.MethodPost, "/api/auth/tokens", "/api/auth/tokens", models.ScopeAdmin},
+		{http.MethodPatch, "/api/matches/9", "/api/matches/:id", models.ScopeAdmin},
+		{http.MethodPost, "/api/unknown", "", models.ScopeAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := requiredScope(tt.method, tt.path, tt.route); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessByRoleAndToken(t *testing.T) {
+	admin := models.User{Role: models.RoleAdmin}
+	viewer := models.User{Role: models.RoleViewer}
+
+	token := func(user models.User, scopes string) []string {
+		return auth.TokenScopes(&models.APIToken{User: user, Scopes: scopes})
+	}
+
+	type request struct {
+		method, path, route string
+	}
+	var (
+		listImages   = request{http.MethodGet, "/api/images", "/api/images"}
+		listUsers    = request{http.MethodGet, "/api/auth/users", "/api/auth/users"}
+		readAudit    = request{http.MethodGet, "/api/audit", "/api/audit"}
+		processImage = request{http.MethodPost, "/api/process/image", "/api/process/image"}
+		updateMatch  = request{http.MethodPut, "/api/matches/9", "/api/matches/:id"}
+		deleteIdent  = request{http.MethodDelete, "/api/identities/3", "/api/identities/:id"}
+		changePass   = request{http.MethodPost, "/api/auth/password", "/api/auth/password"}
+		searchFaces  = request{http.MethodPost, "/api/faces/search", "/api/faces/search"}
+	)
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		request request
+		want    bool
+	}{
+		{"viewer reads images", auth.RoleScopes(viewer.Role), listImages, true},
+		{"viewer cannot list users", auth.RoleScopes(viewer.Role), listUsers, false},
+		{"viewer cannot read audit log", auth.RoleScopes(viewer.Role), readAudit, false},
+		{"viewer cannot process images", auth.RoleScopes(viewer.Role), processImage, false},
+		{"viewer cannot correct matches", auth.RoleScopes(viewer.Role), updateMatch, false},
+		{"viewer cannot delete identities", auth.RoleScopes(viewer.Role), deleteIdent, false},
+		{"viewer changes own password", auth.RoleScopes(viewer.Role), changePass, true},
+		{"viewer searches faces", auth.RoleScopes(viewer.Role), searchFaces, true},
+
+		{"admin lists users", auth.RoleScopes(admin.Role), listUsers, true},
+		{"admin deletes identities", auth.RoleScopes(admin.Role), deleteIdent, true},
+
+		{"ingest token processes images", token(admin, "ingest"), processImage, true},
+		{"ingest token cannot read", token(admin, "ingest"), listImages, false},
+		{"ingest token cannot correct matches", token(admin, "ingest"), updateMatch, false},
+		{"training token corrects matches", token(admin, "read,training"), updateMatch, true},
+		{"training token cannot process images", token(admin, "read,training"), processImage, false},
+		{"training token cannot read audit log", token(admin, "read,training"), readAudit, false},
+		{"admin token lists users", token(admin, "admin"), listUsers, true},
+
+		{"viewer token cannot gain ingest", token(viewer, "ingest"), processImage, false},
+		{"viewer token cannot gain training", token(viewer, "read,training"), updateMatch, false},
+		{"viewer token cannot gain admin", token(viewer, "admin"), listUsers, false},
+		{"viewer token keeps read", token(viewer, "read,admin"), listImages, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			required := requiredScope(tt.request.method, tt.request.path, tt.request.route)
+			if got := auth.HasScope(tt.scopes, required); got != tt.want {
+				t.Fatalf("scopes %v, required %q: got %v, want %v", tt.scopes, required, got, tt.want)
+			}
+		})
+	}
+}
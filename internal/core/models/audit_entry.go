@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditEntry protokolliert eine Änderung an Identitäten, Treffern oder Trainingsdaten
+// mit dem Zustand vor und nach der Änderung
+type AuditEntry struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	UserID     *uint     `gorm:"index"` // nil ohne Anmeldung
+	Actor      string    `gorm:"index"` // Benutzername bzw. "anonymous"
+	TokenID    *uint     `gorm:"index"` // API-Token, falls die Änderung darüber erfolgte
+	TokenName  string
+	ClientIP   string
+	Action     string         `gorm:"index;not null"` // z.B. "match.update"
+	EntityType string         `gorm:"index;not null"` // z.B. "match", "identity"
+	EntityID   uint           `gorm:"index"`
+	Before     datatypes.JSON `gorm:"type:json"`
+	After      datatypes.JSON `gorm:"type:json"`
+
+	RevertedAt   *time.Time // Zeitpunkt, an dem die Änderung rückgängig gemacht wurde
+	RevertedByID *uint      // Audit-Eintrag der Rücknahme
+}
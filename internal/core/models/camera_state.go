@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// CameraState speichert den zur Laufzeit (z.B. per MQTT-Befehl) geänderten Zustand einer
+// Kamera, damit er nach einem Neustart erhalten bleibt
+type CameraState struct {
+	Camera    string `gorm:"primaryKey"` // Name der Kamera wie in Frigate
+	Paused    bool   // Automatische Verarbeitung ist angehalten
+	UpdatedAt time.Time
+}
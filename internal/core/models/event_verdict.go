@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// EventVerdict ist das zusammengefasste Erkennungsergebnis eines Frigate-Events.
+// Es wird aus den besten Gesichtern aller Snapshots des Events abgeleitet und ist
+// das Ergebnis, das an Home Assistant und die Weboberfläche gemeldet wird.
+type EventVerdict struct {
+	ID            uint      `gorm:"primaryKey"`
+	EventID       string    `gorm:"uniqueIndex;not null"` // Frigate-Event-ID
+	Camera        string    `gorm:"index"`
+	IdentityID    *uint     `gorm:"index"` // Erkannte Identität, nil = unbekannt
+	Identity      *Identity `gorm:"foreignKey:IdentityID;constraint:OnDelete:SET NULL;"`
+	Confidence    float64   // Höchste Übereinstimmung der erkannten Identität
+	Quality       float64   // Qualität des besten Gesichts
+	FaceID        uint      // Bestes Gesicht des Events
+	ImageID       uint      // Bild des besten Gesichts
+	FaceCount     int       // Anzahl der bewerteten Gesichter
+	SubLabel      string    // In Frigate gesetztes Sub-Label
+	SubLabelScore float64   // Score des gesetzten Sub-Labels
+	CreatedAt     time.Time `gorm:"index"`
+	UpdatedAt     time.Time
+}
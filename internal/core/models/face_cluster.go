@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// FaceCluster fasst ähnliche unbekannte Gesichter zusammen. Die Cluster entstehen
+// inkrementell per DBSCAN auf der Kosinus-Distanz der Embeddings. Wird ein Cluster
+// benannt, werden seine Gesichter der neuen Identität zugeordnet.
+type FaceCluster struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	UpdatedAt  time.Time
+	Provider   string `gorm:"index;not null"` // Provider der Embeddings
+	IdentityID *uint  `gorm:"index"`          // Identität, sobald der Cluster benannt wurde
+	NamedAt    *time.Time
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// FaceEmbedding speichert einen Gesichtsvektor einer bekannten Identität.
+// Die Einträge bilden die lokale Galerie für Provider ohne eigene
+// Gesichtsdatenbank (z.B. InsightFace).
+type FaceEmbedding struct {
+	ID         uint      `gorm:"primaryKey"`
+	IdentityID uint      `gorm:"index;not null"` // Fremdschlüssel zur Identity-Tabelle
+	Provider   string    `gorm:"index;not null"` // Provider, der den Vektor erzeugt hat
+	Dimensions int       // Anzahl der Vektorkomponenten
+	Vector     []byte    `gorm:"not null"` // Normalisierter Vektor als Little-Endian-float32
+	CreatedAt  time.Time `gorm:"index"`
+	Identity   Identity  `gorm:"foreignKey:IdentityID;constraint:OnDelete:CASCADE;"`
+}
+
+// SetVector normalisiert den Vektor (L2) und speichert ihn in kompakter Binärform
+func (e *FaceEmbedding) SetVector(vec []float32) {
+	e.Vector = EncodeVector(vec)
+	e.Dimensions = len(vec)
+}
+
+// GetVector dekodiert den gespeicherten Vektor
+func (e *FaceEmbedding) GetVector() []float32 {
+	return DecodeVector(e.Vector)
+}
+
+// EncodeVector normalisiert einen Vektor (L2) und kodiert ihn als Little-Endian-float32.
+// Das Skalarprodukt zweier normalisierter Vektoren ist ihre Kosinus-Ähnlichkeit.
+func EncodeVector(vec []float32) []byte {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		if norm > 0 {
+			v = float32(float64(v) / norm)
+		}
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// DecodeVector dekodiert einen mit EncodeVector gespeicherten Vektor
+func DecodeVector(data []byte) []float32 {
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vec
+}
+
+// CosineSimilarity berechnet die Kosinus-Ähnlichkeit zweier mit EncodeVector normalisierter
+// Vektoren als Skalarprodukt. Vektoren unterschiedlicher Länge gelten als unähnlich (-1).
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return -1
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
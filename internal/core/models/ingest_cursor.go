@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// IngestCursor speichert den Fortschritt eines Ingesters, damit er nach einem
+// Neustart dort weitermacht, wo er aufgehört hat
+type IngestCursor struct {
+	Name      string         `gorm:"primaryKey"` // Name des Ingesters (z.B. "frigate_events")
+	Position  float64        // Startzeit (Unix) des zuletzt übernommenen Events
+	EventID   string         // ID des zuletzt übernommenen Events
+	Failures  datatypes.JSON // Fehlgeschlagene Übernahmen je Event-ID nach dem Cursor
+	UpdatedAt time.Time
+}
+
+// FailureCounts liefert die gespeicherten Fehlversuche je Event-ID
+func (c *IngestCursor) FailureCounts() map[string]int {
+	counts := make(map[string]int)
+	if len(c.Failures) > 0 {
+		// Ungültige Daten zählen wie keine Fehlversuche
+		_ = json.Unmarshal(c.Failures, &counts)
+	}
+	return counts
+}
+
+// SetFailureCounts speichert die Fehlversuche je Event-ID
+func (c *IngestCursor) SetFailureCounts(counts map[string]int) {
+	if len(counts) == 0 {
+		c.Failures = nil
+		return
+	}
+	data, _ := json.Marshal(counts)
+	c.Failures = data
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"gorm.io/datatypes"
@@ -24,6 +28,12 @@ type Image struct {
 	SourceData  datatypes.JSON `gorm:"type:json;null"`  // Rohdaten vom Quellsystem
 }
 
+// FaceCropDir gibt das Verzeichnis der Gesichtsausschnitte des Bildes relativ zum
+// Snapshot-Verzeichnis zurück
+func (i *Image) FaceCropDir() string {
+	return filepath.Join("faces", strconv.FormatUint(uint64(i.ID), 10))
+}
+
 // Face repräsentiert ein erkanntes Gesicht in einem Bild
 type Face struct {
 	gorm.Model
@@ -31,10 +41,41 @@ type Face struct {
 	BoundingBox datatypes.JSON `gorm:"type:json"`      // JSON-Objekt mit x_min, y_min, x_max, y_max
 	Confidence  float64        // Erkennungssicherheit
 	Detector    string         `gorm:"index"` // Name des Detektors (z.B. 'compreface')
+	Quality     float64        `gorm:"index"` // Qualitätsbewertung (0-1) aus Größe, Konfidenz, Schärfe und Kopfhaltung
+	CropPath    string         // Gesichtsausschnitt relativ zum Snapshot-Verzeichnis
+	Embedding   []byte         `json:"-"` // Normalisierter Gesichtsvektor (siehe EncodeVector)
+	EmbeddingProvider string   `gorm:"index"` // Provider des Vektors; nur Vektoren desselben Providers sind vergleichbar
+	ClusterID   *uint          `gorm:"index"` // Cluster ähnlicher unbekannter Gesichter
 	Matches     []Match        `gorm:"foreignKey:FaceID;constraint:OnDelete:CASCADE;"`
+	ProviderScores []ProviderScore `gorm:"foreignKey:FaceID;constraint:OnDelete:CASCADE;"`
 	Image       Image          `gorm:"foreignKey:ImageID"`
 }
 
+// EmbeddingVector gibt den gespeicherten Gesichtsvektor zurück (leer ohne Embedding)
+func (f *Face) EmbeddingVector() []float32 {
+	return DecodeVector(f.Embedding)
+}
+
+// Box gibt die gespeicherte Bounding Box des Gesichts im Format (x1, y1, x2, y2) zurück
+func (f *Face) Box() ([]int, error) {
+	var box struct {
+		XMin int `json:"x_min"`
+		YMin int `json:"y_min"`
+		XMax int `json:"x_max"`
+		YMax int `json:"y_max"`
+	}
+	if len(f.BoundingBox) == 0 {
+		return nil, fmt.Errorf("gesicht %d hat keine Bounding Box", f.ID)
+	}
+	if err := json.Unmarshal(f.BoundingBox, &box); err != nil {
+		return nil, fmt.Errorf("ungültige Bounding Box für Gesicht %d: %w", f.ID, err)
+	}
+	if box.XMin < 0 || box.YMin < 0 || box.XMax <= box.XMin || box.YMax <= box.YMin {
+		return nil, fmt.Errorf("ungültige Koordinaten für Gesicht %d", f.ID)
+	}
+	return []int{box.XMin, box.YMin, box.XMax, box.YMax}, nil
+}
+
 // Identity repräsentiert eine bekannte Person
 type Identity struct {
 	gorm.Model
@@ -53,6 +94,16 @@ type Match struct {
 	Identity   Identity `gorm:"foreignKey:IdentityID"`
 }
 
+// ProviderScore speichert das unverarbeitete Ergebnis eines einzelnen Providers im Ensemble-Modus.
+// Ein leeres SubjectID bedeutet, dass der Provider das Gesicht ohne Treffer erkannt hat.
+type ProviderScore struct {
+	gorm.Model
+	FaceID     uint    `gorm:"index;not null"` // Fremdschlüssel zur Face-Tabelle
+	Provider   string  `gorm:"index;not null"` // Name des Providers (z.B. 'insightface')
+	SubjectID  string  `gorm:"index"`          // Vom Provider gemeldetes Subjekt
+	Confidence float64 // Rohwert des Providers
+}
+
 // Statistics repräsentiert Statistiken über die verarbeiteten Bilder und erkannten Gesichter
 type Statistics struct {
 	TotalImages      int64       // Gesamtzahl der verarbeiteten Bilder
@@ -63,3 +114,37 @@ type Statistics struct {
 	IdentityCount    int64       // Anzahl der bekannten Identitäten
 	RecentDetections []Image     // Kürzlich erkannte Bilder (optional)
 }
+
+// Sighting fasst die Treffer einer Identität in einem Frigate-Event zusammen. Bilder ohne
+// Event bilden jeweils eine eigene Sichtung.
+type Sighting struct {
+	EventID        string    // Frigate-Event-ID (leer bei Bildern ohne Event)
+	ImageID        uint      // Bild mit dem sichersten Treffer
+	FaceID         uint      // Gesicht mit dem sichersten Treffer
+	Camera         string    // Quelle/Kamera
+	Zones          []string  // Alle Zonen der Sichtung
+	Start          time.Time // Erste Aufnahme
+	End            time.Time // Letzte Aufnahme
+	Detections     int       // Anzahl der Treffer
+	BestConfidence float64   // Höchste Übereinstimmungssicherheit
+}
+
+// CountBucket ist ein benannter Zähler für Aggregationen (Tag, Kamera, Zone)
+type CountBucket struct {
+	Key   string
+	Count int64
+}
+
+// IdentityStatistics enthält die Sichtungsstatistik einer Identität
+type IdentityStatistics struct {
+	IdentityID        uint
+	FirstSeen         *time.Time    // Erste Sichtung (nil ohne Sichtungen)
+	LastSeen          *time.Time    // Letzte Sichtung
+	Sightings         int64         // Anzahl der Sichtungen
+	Detections        int64         // Anzahl der Treffer
+	AverageConfidence float64       // Durchschnittliche Übereinstimmungssicherheit aller Treffer
+	PerDay            []CountBucket // Sichtungen je Kalendertag (YYYY-MM-DD), aufsteigend
+	PerHour           [24]int64     // Sichtungen je Stunde des Tages
+	PerCamera         []CountBucket // Sichtungen je Kamera, häufigste zuerst
+	PerZone           []CountBucket // Sichtungen je Zone, häufigste zuerst
+}
@@ -27,6 +27,8 @@ const (
 	POTypeDeleteIdentity = "delete_identity"
 	POTypeRenameIdentity = "rename_identity"
 	POTypeAddExample     = "add_example"
+	POTypeDeleteExample  = "delete_example"  // Trainingsbeispiel beim Anbieter entfernen
+	POTypeReprocessImage = "reprocess_image" // Bild erneut erkennen, nachdem der Provider ausgefallen war
 )
 
 // PendingOperationStatus definiert die möglichen Status
@@ -40,4 +42,5 @@ const (
 const (
 	POResourceIdentity = "identity"
 	POResourceExample  = "example"
+	POResourceImage    = "image"
 )
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Ereignistypen der Anwesenheitserkennung
+const (
+	PresenceArrived = "arrived" // Aufenthalt hat begonnen
+	PresenceLeft    = "left"    // Aufenthalt ist nach dem Timeout ohne Erkennung beendet
+)
+
+// PresenceSession ist ein zusammenhängender Aufenthalt einer Identität. Ohne Kamera gilt
+// er für alle Kameras, ohne Zone für die gesamte Kamera. Offene Aufenthalte (EndedAt nil)
+// werden nach einem Neustart fortgesetzt.
+type PresenceSession struct {
+	ID             uint      `gorm:"primaryKey"`
+	IdentityID     uint      `gorm:"index;not null"`
+	Identity       Identity  `gorm:"foreignKey:IdentityID;constraint:OnDelete:CASCADE;"`
+	Camera         string    `gorm:"index"` // Leer = unabhängig von der Kamera
+	Zone           string    `gorm:"index"` // Leer = gesamte Kamera
+	StartedAt      time.Time `gorm:"index"`
+	LastSeenAt     time.Time
+	EndedAt        *time.Time `gorm:"index"` // nil, solange die Identität anwesend ist
+	Detections     int        // Anzahl der Erkennungen während des Aufenthalts
+	BestConfidence float64    // Höchste Übereinstimmung während des Aufenthalts
+	ImageID        uint       // Bild der sichersten Erkennung
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// PresenceEvent meldet den Beginn oder das Ende eines Aufenthalts
+type PresenceEvent struct {
+	Type    string // PresenceArrived oder PresenceLeft
+	Session PresenceSession
+}
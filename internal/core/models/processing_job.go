@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// ProcessingJob ist ein persistierter Bildverarbeitungsauftrag des Worker-Pools.
+// Aufträge überleben einen Neustart und werden nach Priorität abgearbeitet.
+type ProcessingJob struct {
+	ID         uint      `gorm:"primaryKey"`
+	ImagePath  string    `gorm:"not null"` // Vollständiger Pfad zur Bilddatei
+	Source     string    `gorm:"index"`    // Quelle des Bildes (frigate, api, ...)
+	Options    []byte    // JSON-kodierte Verarbeitungsoptionen
+	Priority   int       `gorm:"index;default:0"`        // Höhere Werte werden zuerst verarbeitet
+	Status     string    `gorm:"index;default:'queued'"` // "queued", "running", "failed"
+	Attempts   int       `gorm:"default:0"`              // Anzahl der Verarbeitungsversuche
+	ImageID    uint      // ID des erzeugten Bildes (nach erfolgreicher Verarbeitung)
+	LastError  string    // Letzte Fehlermeldung
+	CreatedAt  time.Time `gorm:"index"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// ProcessingJobStatus definiert die möglichen Status eines Verarbeitungsauftrags.
+// Erfolgreich abgeschlossene Aufträge werden gelöscht.
+const (
+	JobStatusQueued  = "queued"
+	JobStatusRunning = "running"
+	JobStatusFailed  = "failed"
+)
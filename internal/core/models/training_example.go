@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// TrainingExample ist ein beim Gesichtserkennungsanbieter hinterlegtes Trainingsbeispiel.
+// Über die ID beim Anbieter lässt sich genau dieses Beispiel wieder entfernen, etwa
+// wenn eine Korrektur rückgängig gemacht wird.
+type TrainingExample struct {
+	ID           uint      `gorm:"primaryKey"`
+	CreatedAt    time.Time `gorm:"index"`
+	Provider     string    `gorm:"index;not null"` // z.B. "compreface"
+	ExampleID    string    `gorm:"index;not null"` // ID beim Anbieter (CompreFace: image_id)
+	Subject      string    `gorm:"index"`          // Subjekt beim Anbieter
+	IdentityID   uint      `gorm:"index"`
+	FaceID       *uint     `gorm:"index"` // Gesicht, aus dem das Beispiel stammt
+	ImageID      *uint     `gorm:"index"` // Bild, aus dem das Beispiel stammt
+	AuditEntryID *uint     `gorm:"index"` // Audit-Eintrag der auslösenden Aktion
+	CropPath     string    // An den Anbieter gesendeter Gesichtsausschnitt, relativ zum Snapshot-Verzeichnis
+	RemovedAt    *time.Time
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rollen für Benutzer und API-Tokens. Administratoren dürfen alles, Betrachter
+// nur lesend zugreifen.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// User ist ein lokaler Benutzer der Weboberfläche und der REST-API
+type User struct {
+	gorm.Model
+	Username     string `gorm:"uniqueIndex;not null"`
+	PasswordHash string `gorm:"not null" json:"-"` // bcrypt-Hash des Passworts
+	Role         string `gorm:"index;not null;default:'viewer'"`
+	LastLoginAt  *time.Time
+}
+
+// Berechtigungen (Scopes) von API-Tokens
+const (
+	ScopeIngest   = "ingest"   // Bilder einliefern und verarbeiten
+	ScopeRead     = "read"     // Lesender Zugriff
+	ScopeTraining = "training" // Identitäten trainieren und Treffer korrigieren
+	ScopeAdmin    = "admin"    // Vollzugriff
+)
+
+// APIToken ist ein langlebiger API-Schlüssel für Automatisierungen. Gespeichert wird
+// nur der SHA-256-Hash, der Klartext wird einmalig beim Anlegen angezeigt.
+type APIToken struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix     string // Anfang des Tokens zur Wiedererkennung
+	UserID     uint   `gorm:"index;not null"`
+	User       User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Scopes     string `gorm:"not null"` // Kommagetrennte Berechtigungen, z. B. "ingest,read"
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string
+	CreatedAt  time.Time
+}
+
+// ScopeList liefert die Berechtigungen des Tokens als Liste
+func (t *APIToken) ScopeList() []string {
+	var scopes []string
+	for _, scope := range strings.Split(t.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Expired prüft, ob das Token zum angegebenen Zeitpunkt abgelaufen ist
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// APIRequestLog protokolliert eine ändernde Anfrage zusammen mit dem API-Token bzw.
+// dem Benutzer, der sie ausgeführt hat
+type APIRequestLog struct {
+	ID          uint      `gorm:"primaryKey"`
+	CreatedAt   time.Time `gorm:"index"`
+	TokenID     *uint     `gorm:"index"` // nil bei Anfragen über die Session
+	TokenName   string
+	TokenPrefix string
+	UserID      uint `gorm:"index"`
+	Username    string
+	Method      string
+	Path        string
+	Route       string // Routenmuster, z. B. "/api/identities/:id"
+	Status      int
+	ClientIP    string
+}
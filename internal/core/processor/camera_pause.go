@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/homeassistant"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetCameraPaused hält die automatische Verarbeitung einer Kamera an oder setzt sie fort.
+// Der Zustand wird gespeichert und gilt auch nach einem Neustart. Manuell angestoßene
+// Erkennungen sind davon nicht betroffen.
+func (p *ImageProcessor) SetCameraPaused(camera string, paused bool) error {
+	camera = strings.TrimSpace(camera)
+	if camera == "" {
+		return fmt.Errorf("camera name is required")
+	}
+
+	p.pausedMutex.Lock()
+	defer p.pausedMutex.Unlock()
+	if err := p.loadPausedCamerasLocked(); err != nil {
+		return err
+	}
+
+	state := models.CameraState{Camera: camera, Paused: paused}
+	if err := p.db.Save(&state).Error; err != nil {
+		return fmt.Errorf("failed to save state of camera %s: %w", camera, err)
+	}
+	if paused {
+		p.pausedCameras[camera] = true
+		log.Infof("Processing for camera %s paused", camera)
+	} else {
+		delete(p.pausedCameras, camera)
+		log.Infof("Processing for camera %s resumed", camera)
+	}
+	return nil
+}
+
+// CameraPaused prüft, ob die automatische Verarbeitung einer Kamera angehalten ist. Der
+// Name wird auch in der für Home Assistant bereinigten Form verglichen (ohne "frigate_"
+// und "_camera").
+func (p *ImageProcessor) CameraPaused(camera string) bool {
+	if camera == "" {
+		return false
+	}
+
+	p.pausedMutex.Lock()
+	defer p.pausedMutex.Unlock()
+	if err := p.loadPausedCamerasLocked(); err != nil {
+		log.Errorf("Fehler beim Laden der angehaltenen Kameras: %v", err)
+		return false
+	}
+	return p.pausedCameras[camera] || p.pausedCameras[homeassistant.CleanCameraName(camera)]
+}
+
+// PausedCameras gibt alle Kameras zurück, deren Verarbeitung angehalten ist
+func (p *ImageProcessor) PausedCameras() ([]string, error) {
+	p.pausedMutex.Lock()
+	defer p.pausedMutex.Unlock()
+	if err := p.loadPausedCamerasLocked(); err != nil {
+		return nil, err
+	}
+
+	cameras := make([]string, 0, len(p.pausedCameras))
+	for camera := range p.pausedCameras {
+		cameras = append(cameras, camera)
+	}
+	sort.Strings(cameras)
+	return cameras, nil
+}
+
+// loadPausedCamerasLocked lädt die angehaltenen Kameras einmalig aus der Datenbank.
+// Muss mit gehaltenem pausedMutex aufgerufen werden.
+func (p *ImageProcessor) loadPausedCamerasLocked() error {
+	if p.pausedCameras != nil {
+		return nil
+	}
+
+	var cameras []string
+	if err := p.db.Model(&models.CameraState{}).Where("paused = ?", true).Pluck("camera", &cameras).Error; err != nil {
+		return fmt.Errorf("failed to load paused cameras: %w", err)
+	}
+	p.pausedCameras = make(map[string]bool, len(cameras))
+	for _, camera := range cameras {
+		p.pausedCameras[camera] = true
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/frigate"
+	"double-take-go-reborn/internal/integrations/homeassistant"
+	"double-take-go-reborn/internal/util/timezone"
+)
+
+// cameraRules gibt die Regeln einer Kamera zurück. Der Name wird wie bei Pausen auch in
+// der bereinigten Form verglichen (ohne "frigate_" und "_camera").
+func (p *ImageProcessor) cameraRules(camera string) (config.CameraConfig, bool) {
+	if camera == "" || len(p.cfg.Cameras) == 0 {
+		return config.CameraConfig{}, false
+	}
+	if rules, ok := p.cfg.Cameras[strings.ToLower(camera)]; ok {
+		return rules, true
+	}
+	rules, ok := p.cfg.Cameras[strings.ToLower(homeassistant.CleanCameraName(camera))]
+	return rules, ok
+}
+
+// cameraInactiveReason gibt zurück, warum eine Kamera zum Zeitpunkt nicht verarbeitet
+// wird, oder einen leeren String, wenn sie aktiv ist
+func (p *ImageProcessor) cameraInactiveReason(camera string, at time.Time) string {
+	if p.CameraPaused(camera) {
+		return "processing is paused"
+	}
+	rules, ok := p.cameraRules(camera)
+	if !ok {
+		return ""
+	}
+	if !rules.IsEnabled() {
+		return "camera is disabled"
+	}
+	if !rules.ScheduleActive(at) {
+		return "outside of the camera schedule"
+	}
+	return ""
+}
+
+// personOnly gibt zurück, ob von der Kamera nur Personen verarbeitet werden
+func (p *ImageProcessor) personOnly(camera string) bool {
+	if rules, _ := p.cameraRules(camera); rules.ProcessPersonOnly != nil {
+		return *rules.ProcessPersonOnly
+	}
+	return p.cfg.Frigate.ProcessPersonOnly
+}
+
+// ProcessPersonOnly gibt zurück, ob von allen angegebenen Kameras nur Personen verarbeitet
+// werden. Ohne Kameras gilt das nur, wenn keine Kamera frigate.process_person_only aufhebt.
+func (p *ImageProcessor) ProcessPersonOnly(cameras []string) bool {
+	if len(cameras) == 0 {
+		if !p.cfg.Frigate.ProcessPersonOnly {
+			return false
+		}
+		for _, rules := range p.cfg.Cameras {
+			if rules.ProcessPersonOnly != nil && !*rules.ProcessPersonOnly {
+				return false
+			}
+		}
+		return true
+	}
+	for _, camera := range cameras {
+		if !p.personOnly(camera) {
+			return false
+		}
+	}
+	return true
+}
+
+// CameraActive prüft, ob Bilder einer Kamera aktuell automatisch verarbeitet werden:
+// Die Kamera ist weder angehalten noch deaktiviert und liegt in ihrem Zeitfenster
+func (p *ImageProcessor) CameraActive(camera string) bool {
+	return p.cameraInactiveReason(camera, timezone.Now()) == ""
+}
+
+// acceptFrigateEvent prüft ein Frigate-Event gegen die globalen und die Kamera-Regeln
+// (Label, Pause, Zeitfenster, Score, Zonen) und gibt andernfalls den Grund für das Ignorieren zurück
+func (p *ImageProcessor) acceptFrigateEvent(eventData *frigate.FrigateEventData) (bool, string) {
+	rules, _ := p.cameraRules(eventData.Camera)
+
+	if eventData.Label != "person" && p.personOnly(eventData.Camera) {
+		return false, fmt.Sprintf("label %q is not a person", eventData.Label)
+	}
+
+	// Das Zeitfenster gilt für den Beginn des Events, damit nachgeholte Events (Backfill)
+	// nach ihrem tatsächlichen Zeitpunkt beurteilt werden
+	if reason := p.cameraInactiveReason(eventData.Camera, eventData.GetStartTime().In(timezone.Location())); reason != "" {
+		return false, reason
+	}
+
+	score := eventData.TopScore
+	if score == 0 {
+		score = eventData.Score
+	}
+	if rules.MinScore > 0 && score < rules.MinScore {
+		return false, fmt.Sprintf("score %.2f is below %.2f", score, rules.MinScore)
+	}
+
+	// Aktuelle Zonen haben Vorrang, sonst zählen die bisher betretenen
+	zones := eventData.CurrentZones
+	if len(zones) == 0 {
+		zones = eventData.EnteredZones
+	}
+	if len(rules.Zones) > 0 && !anyZoneIn(zones, rules.Zones) {
+		return false, fmt.Sprintf("zones %v are not in %v", zones, rules.Zones)
+	}
+	if len(rules.IgnoreZones) > 0 && len(zones) > 0 && allZonesIn(zones, rules.IgnoreZones) {
+		return false, fmt.Sprintf("zones %v are ignored", zones)
+	}
+	return true, ""
+}
+
+// imageCamera ermittelt die Kamera eines Bildes: aus den Metadaten, bei Frigate-Bildern
+// ohne Metadaten (z.B. bei einer Wiederholung) aus dem Ergebnis des Events, sonst die Quelle
+func (p *ImageProcessor) imageCamera(image *models.Image, metadata map[string]interface{}) string {
+	if camera, _ := metadata["camera"].(string); camera != "" {
+		return camera
+	}
+	if image.Source == "frigate" && image.EventID != "" {
+		var verdict models.EventVerdict
+		if err := p.db.Select("camera").Where("event_id = ?", image.EventID).Limit(1).Find(&verdict).Error; err == nil && verdict.Camera != "" {
+			return verdict.Camera
+		}
+	}
+	return image.Source
+}
+
+// faceTooSmall prüft, ob die kürzere Kante eines Gesichts unter der Mindestgröße der
+// Kamera liegt. Kleine Gesichter werden selten zuverlässig erkannt.
+func (p *ImageProcessor) faceTooSmall(camera string, box []int) bool {
+	rules, _ := p.cameraRules(camera)
+	if rules.MinFaceSize <= 0 || len(box) < 4 {
+		return false
+	}
+	width := box[2] - box[0]
+	height := box[3] - box[1]
+	if height < width {
+		width = height
+	}
+	return width < rules.MinFaceSize
+}
+
+// anyZoneIn prüft, ob mindestens eine Zone in der Liste enthalten ist
+func anyZoneIn(zones, list []string) bool {
+	for _, zone := range zones {
+		if containsZone(list, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// allZonesIn prüft, ob alle Zonen in der Liste enthalten sind
+func allZonesIn(zones, list []string) bool {
+	for _, zone := range zones {
+		if !containsZone(list, zone) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsZone vergleicht Zonennamen ohne Beachtung der Groß-/Kleinschreibung
+func containsZone(list []string, zone string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(strings.TrimSpace(entry), zone) {
+			return true
+		}
+	}
+	return false
+}
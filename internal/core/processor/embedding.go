@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	stdimage "image"
+
+	"double-take-go-reborn/internal/integrations/facerecognition"
+)
+
+var (
+	// ErrNoFace wird zurückgegeben, wenn im hochgeladenen Bild kein Gesicht erkannt wurde
+	ErrNoFace = errors.New("no face detected in the image")
+	// ErrNoEmbedding wird zurückgegeben, wenn der Provider keinen Gesichtsvektor liefert
+	ErrNoEmbedding = errors.New("provider did not return a face embedding")
+)
+
+// EmbedUpload erkennt das größte Gesicht in einem hochgeladenen Bild und gibt seinen
+// Gesichtsvektor samt erzeugendem Provider zurück. Ist provider leer, wird der aktive
+// Provider verwendet.
+func (p *ImageProcessor) EmbedUpload(ctx context.Context, imageData []byte, provider facerecognition.ProviderType) ([]float32, facerecognition.ProviderType, error) {
+	img, _, err := stdimage.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if p.providerManager == nil {
+		return nil, "", ErrNoDetector
+	}
+
+	var detector facerecognition.Provider
+	var ok bool
+	if provider == "" {
+		detector, ok = p.providerManager.GetActiveProvider()
+	} else {
+		detector, ok = p.providerManager.GetProvider(provider)
+	}
+	if !ok || detector == nil {
+		return nil, "", ErrNoDetector
+	}
+
+	result, err := detector.DetectFaces(ctx, img, facerecognition.DetectionRequest{ExtractEmbedding: true})
+	p.providerManager.RecordRequestResult(ctx, detector.GetProviderName(), err)
+	if err != nil {
+		return nil, "", fmt.Errorf("face detection failed: %w", err)
+	}
+
+	var largest *facerecognition.Face
+	largestArea := 0
+	for i := range result.Faces {
+		box := result.Faces[i].BoundingBox
+		if len(box) < 4 {
+			continue
+		}
+		if area := (box[2] - box[0]) * (box[3] - box[1]); area > largestArea {
+			largest, largestArea = &result.Faces[i], area
+		}
+	}
+	if largest == nil {
+		return nil, "", ErrNoFace
+	}
+	if len(largest.Embedding) == 0 {
+		return nil, "", ErrNoEmbedding
+	}
+
+	embeddingProvider := largest.EmbeddingProvider
+	if embeddingProvider == "" {
+		embeddingProvider = detector.GetProviderName()
+	}
+	return largest.Embedding, embeddingProvider, nil
+}
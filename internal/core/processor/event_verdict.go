@@ -0,0 +1,338 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"double-take-go-reborn/internal/core/models"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Standardwerte für die Auswertung der Gesichter eines Events
+const (
+	defaultBestFaces = 3
+)
+
+// eventFace ist ein Gesicht eines Events mit dem zugehörigen Bild
+type eventFace struct {
+	face  *models.Face
+	image *models.Image
+}
+
+// verdictCandidate sammelt die Stimmen der besten Gesichter für eine Identität
+type verdictCandidate struct {
+	identity   models.Identity
+	votes      float64
+	confidence float64
+	best       eventFace
+}
+
+// updateEventVerdict bewertet die Gesichter aller Bilder eines Frigate-Events neu und
+// leitet aus den besten Gesichtern ein Gesamtergebnis ab. Ein unscharfes Update kann
+// so einen guten früheren Treffer nicht mehr überschreiben. Überzählige Bilder mit den
+// schlechtesten Gesichtern werden entfernt; imageID ist das soeben verarbeitete Bild.
+// Ändert sich das Ergebnis, wird es per SSE und an Home Assistant gemeldet.
+func (p *ImageProcessor) updateEventVerdict(eventID, camera string, imageID uint) {
+	p.verdictMutex.Lock()
+	defer p.verdictMutex.Unlock()
+
+	var images []models.Image
+	if err := p.db.Preload("Faces.Matches.Identity").
+		Where("source = ? AND event_id = ?", "frigate", eventID).
+		Order("timestamp ASC").
+		Find(&images).Error; err != nil {
+		log.Errorf("Failed to load images of event %s: %v", eventID, err)
+		return
+	}
+
+	// Alle Gesichter des Events nach Qualität sortieren
+	var faces []eventFace
+	for i := range images {
+		for j := range images[i].Faces {
+			faces = append(faces, eventFace{face: &images[i].Faces[j], image: &images[i]})
+		}
+	}
+	sort.SliceStable(faces, func(i, j int) bool {
+		if faces[i].face.Quality != faces[j].face.Quality {
+			return faces[i].face.Quality > faces[j].face.Quality
+		}
+		return faces[i].face.Confidence > faces[j].face.Confidence
+	})
+
+	bestFaces := p.cfg.Frigate.BestFaces
+	if bestFaces <= 0 {
+		bestFaces = defaultBestFaces
+	}
+	top := faces
+	if len(top) > bestFaces {
+		top = top[:bestFaces]
+	}
+
+	keep := make(map[uint]bool, len(top))
+	for _, f := range top {
+		keep[f.image.ID] = true
+	}
+	p.pruneEventImages(eventID, images, keep, imageID)
+
+	if len(top) == 0 {
+		return
+	}
+
+	verdict := models.EventVerdict{
+		EventID:   eventID,
+		Camera:    camera,
+		Quality:   top[0].face.Quality,
+		FaceID:    top[0].face.ID,
+		ImageID:   top[0].image.ID,
+		FaceCount: len(faces),
+	}
+
+	if winner := electIdentity(top); winner != nil {
+		identityID := winner.identity.ID
+		verdict.IdentityID = &identityID
+		verdict.Identity = &winner.identity
+		verdict.Confidence = winner.confidence
+		verdict.Quality = winner.best.face.Quality
+		verdict.FaceID = winner.best.face.ID
+		verdict.ImageID = winner.best.image.ID
+	}
+
+	var existing models.EventVerdict
+	err := p.db.Where("event_id = ?", eventID).First(&existing).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Errorf("Failed to load verdict of event %s: %v", eventID, err)
+		return
+	}
+	found := err == nil
+	if found {
+		verdict.ID = existing.ID
+		verdict.CreatedAt = existing.CreatedAt
+		if verdict.Camera == "" {
+			verdict.Camera = existing.Camera
+		}
+		verdict.SubLabel = existing.SubLabel
+		verdict.SubLabelScore = existing.SubLabelScore
+	}
+
+	identityChanged := !found || !sameIdentity(existing.IdentityID, verdict.IdentityID)
+	changed := identityChanged || existing.FaceID != verdict.FaceID || existing.FaceCount != verdict.FaceCount
+
+	if !changed {
+		// Ein zuvor fehlgeschlagenes Setzen des Sub-Labels wird beim nächsten Update nachgeholt
+		p.writeFrigateSubLabel(verdict)
+		return
+	}
+	if err := p.db.Omit(clause.Associations).Save(&verdict).Error; err != nil {
+		log.Errorf("Failed to save verdict of event %s: %v", eventID, err)
+		return
+	}
+
+	var verdictImage *models.Image
+	for i := range images {
+		if images[i].ID == verdict.ImageID {
+			verdictImage = &images[i]
+			break
+		}
+	}
+
+	name := "unknown"
+	if verdict.Identity != nil {
+		name = verdict.Identity.Name
+	}
+	log.Infof("Event %s verdict: %s (confidence %.2f, best face %d with quality %.2f, %d faces)",
+		eventID, name, verdict.Confidence, verdict.FaceID, verdict.Quality, verdict.FaceCount)
+
+	if p.sseHub != nil {
+		snapshotURL := ""
+		if verdictImage != nil {
+			snapshotURL = p.cfg.Server.SnapshotURL + "/" + verdictImage.FilePath
+		}
+		p.sseHub.BroadcastEventVerdict(verdict, snapshotURL)
+	}
+
+	// Home Assistant nur bei einer neuen oder geänderten Identität benachrichtigen
+	if identityChanged && p.haPublisher != nil && verdictImage != nil {
+		if err := p.haPublisher.PublishEventVerdict(&verdict, verdictImage); err != nil {
+			log.Warnf("Failed to publish verdict of event %s to Home Assistant: %v", eventID, err)
+		}
+	}
+
+	p.writeFrigateSubLabel(verdict)
+}
+
+// electIdentity wählt die Identität mit den meisten Stimmen. Jedes Gesicht stimmt für
+// seinen besten Treffer, gewichtet mit Übereinstimmung und Gesichtsqualität.
+func electIdentity(faces []eventFace) *verdictCandidate {
+	candidates := make(map[uint]*verdictCandidate)
+	for _, f := range faces {
+		var best *models.Match
+		for i := range f.face.Matches {
+			if best == nil || f.face.Matches[i].Confidence > best.Confidence {
+				best = &f.face.Matches[i]
+			}
+		}
+		if best == nil || best.Identity.ID == 0 {
+			continue
+		}
+
+		candidate, ok := candidates[best.IdentityID]
+		if !ok {
+			candidate = &verdictCandidate{identity: best.Identity}
+			candidates[best.IdentityID] = candidate
+		}
+		candidate.votes += f.face.Quality * best.Confidence
+		if best.Confidence > candidate.confidence {
+			candidate.confidence = best.Confidence
+			candidate.best = f
+		}
+	}
+
+	var winner *verdictCandidate
+	for _, candidate := range candidates {
+		if winner == nil || candidate.votes > winner.votes ||
+			(candidate.votes == winner.votes && candidate.confidence > winner.confidence) {
+			winner = candidate
+		}
+	}
+	return winner
+}
+
+// pruneEventImages begrenzt die Anzahl der Bilder eines Events. Bilder mit einem der
+// besten Gesichter bleiben erhalten, ebenso Bilder, deren Verarbeitung noch nicht
+// abgeschlossen ist. Von den übrigen werden zuerst die mit den schlechtesten
+// Gesichtern entfernt (bei Gleichstand die ältesten). finishedID ist das Bild, dessen
+// Verarbeitung gerade abgeschlossen wurde, dessen Auftrag aber noch als laufend gilt.
+func (p *ImageProcessor) pruneEventImages(eventID string, images []models.Image, keep map[uint]bool, finishedID uint) {
+	maxImages := p.cfg.Frigate.MaxImagesPerEvent
+	if maxImages <= 0 || len(images) <= maxImages {
+		return
+	}
+
+	busy := p.unfinishedImages(images, finishedID)
+
+	var candidates []*models.Image
+	for i := range images {
+		if !keep[images[i].ID] && !busy[images[i].ID] {
+			candidates = append(candidates, &images[i])
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		qi, qj := bestFaceQuality(candidates[i]), bestFaceQuality(candidates[j])
+		if qi != qj {
+			return qi < qj
+		}
+		return candidates[i].Timestamp.Before(candidates[j].Timestamp)
+	})
+
+	excess := len(images) - maxImages
+	if excess > len(candidates) {
+		excess = len(candidates)
+	}
+
+	for _, image := range candidates[:excess] {
+		var faceIDs []uint
+		for _, face := range image.Faces {
+			faceIDs = append(faceIDs, face.ID)
+		}
+		if len(faceIDs) > 0 {
+			if err := p.db.Where("face_id IN ?", faceIDs).Delete(&models.Match{}).Error; err != nil {
+				log.Warnf("Failed to delete matches of image %d: %v", image.ID, err)
+				continue
+			}
+			if err := p.db.Where("image_id = ?", image.ID).Delete(&models.Face{}).Error; err != nil {
+				log.Warnf("Failed to delete faces of image %d: %v", image.ID, err)
+				continue
+			}
+		}
+		if err := p.db.Delete(&models.Image{}, image.ID).Error; err != nil {
+			log.Warnf("Failed to delete image %d: %v", image.ID, err)
+			continue
+		}
+		RemoveFaceCrops(p.cfg.Server.SnapshotDir, image)
+
+		filePath := filepath.Join(p.cfg.Server.SnapshotDir, image.FilePath)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to delete image file %s: %v", filePath, err)
+		}
+		log.Infof("Removed image %d of event %s (best face quality %.2f)", image.ID, eventID, bestFaceQuality(image))
+	}
+}
+
+// unfinishedImages ermittelt die Bilder, die noch von einem Worker verarbeitet werden,
+// in der Queue warten oder zur erneuten Erkennung vorgemerkt sind. Solche Bilder haben
+// womöglich nur noch keine Gesichter und dürfen nicht entfernt werden.
+func (p *ImageProcessor) unfinishedImages(images []models.Image, finishedID uint) map[uint]bool {
+	busy := make(map[uint]bool)
+
+	paths := make(map[string]uint, len(images))
+	ids := make([]uint, 0, len(images))
+	for _, image := range images {
+		if image.ID == finishedID {
+			continue
+		}
+		paths[filepath.Join(p.cfg.Server.SnapshotDir, image.FilePath)] = image.ID
+		ids = append(ids, image.ID)
+	}
+	if len(ids) == 0 {
+		return busy
+	}
+
+	pathList := make([]string, 0, len(paths))
+	for path := range paths {
+		pathList = append(pathList, path)
+	}
+	var jobPaths []string
+	if err := p.db.Model(&models.ProcessingJob{}).
+		Where("status IN ? AND image_path IN ?", []string{models.JobStatusQueued, models.JobStatusRunning}, pathList).
+		Pluck("image_path", &jobPaths).Error; err != nil {
+		// Im Zweifel nichts entfernen
+		log.Warnf("Failed to check processing jobs of event images: %v", err)
+		for _, id := range ids {
+			busy[id] = true
+		}
+		return busy
+	}
+	for _, path := range jobPaths {
+		busy[paths[path]] = true
+	}
+
+	var reprocessIDs []uint
+	if err := p.db.Model(&models.PendingOperation{}).
+		Where("operation_type = ? AND status = ? AND resource_id IN ?", models.POTypeReprocessImage, models.POStatusPending, ids).
+		Pluck("resource_id", &reprocessIDs).Error; err != nil {
+		log.Warnf("Failed to check pending reprocessing of event images: %v", err)
+		for _, id := range ids {
+			busy[id] = true
+		}
+		return busy
+	}
+	for _, id := range reprocessIDs {
+		busy[id] = true
+	}
+
+	return busy
+}
+
+// bestFaceQuality liefert die Qualität des besten Gesichts eines Bildes. Bilder ohne
+// Gesicht zählen wie Bilder mit Gesichtern der Qualität 0.
+func bestFaceQuality(image *models.Image) float64 {
+	best := 0.0
+	for _, face := range image.Faces {
+		if face.Quality > best {
+			best = face.Quality
+		}
+	}
+	return best
+}
+
+// sameIdentity vergleicht zwei optionale Identitäts-IDs
+func sameIdentity(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
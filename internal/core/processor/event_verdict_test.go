@@ -0,0 +1,313 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+
+	"gorm.io/gorm"
+)
+
+// testFace baut ein Gesicht eines Events mit den angegebenen Treffern
+func testFace(id uint, quality float64, matches ...models.Match) eventFace {
+	return eventFace{
+		face:  &models.Face{Model: gorm.Model{ID: id}, Quality: quality, Matches: matches},
+		image: &models.Image{Model: gorm.Model{ID: id}},
+	}
+}
+
+// testMatch baut einen Treffer für die Identität mit der angegebenen ID
+func testMatch(identityID uint, confidence float64) models.Match {
+	return models.Match{
+		IdentityID: identityID,
+		Confidence: confidence,
+		Identity:   models.Identity{Model: gorm.Model{ID: identityID}, Name: fmt.Sprintf("identity-%d", identityID)},
+	}
+}
+
+func TestElectIdentity(t *testing.T) {
+	const alice, bob = 1, 2
+
+	tests := []struct {
+		name           string
+		faces          []eventFace
+		wantIdentity   uint // 0 = kein Ergebnis
+		wantConfidence float64
+		wantBestFace   uint
+	}{
+		{
+			name:  "no faces",
+			faces: nil,
+		},
+		{
+			name:  "faces without matches",
+			faces: []eventFace{testFace(1, 0.9), testFace(2, 0.8)},
+		},
+		{
+			name:           "single face",
+			faces:          []eventFace{testFace(1, 0.9, testMatch(alice, 0.8))},
+			wantIdentity:   alice,
+			wantConfidence: 0.8,
+			wantBestFace:   1,
+		},
+		{
+			name: "each face votes only for its best match",
+			faces: []eventFace{
+				testFace(1, 0.9, testMatch(alice, 0.6), testMatch(bob, 0.9)),
+			},
+			wantIdentity:   bob,
+			wantConfidence: 0.9,
+			wantBestFace:   1,
+		},
+		{
+			name: "two weaker faces outvote one strong face",
+			faces: []eventFace{
+				testFace(1, 0.9, testMatch(alice, 0.8)),
+				testFace(2, 0.5, testMatch(bob, 0.9)),
+				testFace(3, 0.5, testMatch(bob, 0.8)),
+			},
+			wantIdentity:   bob,
+			wantConfidence: 0.9,
+			wantBestFace:   2,
+		},
+		{
+			name: "high quality outweighs a second vote",
+			faces: []eventFace{
+				testFace(1, 1.0, testMatch(alice, 0.9)),
+				testFace(2, 0.2, testMatch(bob, 0.9)),
+				testFace(3, 0.2, testMatch(bob, 0.9)),
+			},
+			wantIdentity:   alice,
+			wantConfidence: 0.9,
+			wantBestFace:   1,
+		},
+		{
+			name: "tie in votes goes to the higher confidence",
+			faces: []eventFace{
+				testFace(1, 1.0, testMatch(alice, 0.4)),
+				testFace(2, 0.5, testMatch(bob, 0.8)),
+			},
+			wantIdentity:   bob,
+			wantConfidence: 0.8,
+			wantBestFace:   2,
+		},
+		{
+			name: "tie in votes in reverse order",
+			faces: []eventFace{
+				testFace(1, 0.5, testMatch(bob, 0.8)),
+				testFace(2, 1.0, testMatch(alice, 0.4)),
+			},
+			wantIdentity:   bob,
+			wantConfidence: 0.8,
+			wantBestFace:   1,
+		},
+		{
+			name: "best face of the winner is its most confident one",
+			faces: []eventFace{
+				testFace(1, 0.9, testMatch(alice, 0.7)),
+				testFace(2, 0.6, testMatch(alice, 0.95)),
+			},
+			wantIdentity:   alice,
+			wantConfidence: 0.95,
+			wantBestFace:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winner := electIdentity(tt.faces)
+			if tt.wantIdentity == 0 {
+				if winner != nil {
+					t.Fatalf("expected no winner, got identity %d", winner.identity.ID)
+				}
+				return
+			}
+			if winner == nil {
+				t.Fatalf("expected identity %d, got no winner", tt.wantIdentity)
+			}
+			if winner.identity.ID != tt.wantIdentity {
+				t.Fatalf("got identity %d, want %d", winner.identity.ID, tt.wantIdentity)
+			}
+			if winner.confidence != tt.wantConfidence {
+				t.Fatalf("got confidence %v, want %v", winner.confidence, tt.wantConfidence)
+			}
+			if winner.best.face.ID != tt.wantBestFace {
+				t.Fatalf("got best face %d, want %d", winner.best.face.ID, tt.wantBestFace)
+			}
+		})
+	}
+}
+
+// pruneImage beschreibt ein Bild eines Events für TestPruneEventImages
+type pruneImage struct {
+	name      string
+	quality   float64 // < 0 = ohne Gesicht
+	keep      bool    // Enthält eines der besten Gesichter
+	job       string  // Status eines Verarbeitungsauftrags ("" = keiner)
+	reprocess string  // Status einer vorgemerkten erneuten Erkennung ("" = keine)
+	finished  bool    // Soeben verarbeitetes Bild
+}
+
+func TestPruneEventImages(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxImages int
+		images    []pruneImage
+		want      []string
+	}{
+		{
+			name:      "worst faces are removed first",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "good", quality: 0.6},
+				{name: "poor", quality: 0.2},
+			},
+			want: []string{"best", "good"},
+		},
+		{
+			name:      "oldest image is removed on equal quality",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "old", quality: 0.5},
+				{name: "new", quality: 0.5},
+				{name: "best", quality: 0.9, keep: true},
+			},
+			want: []string{"best", "new"},
+		},
+		{
+			name:      "running job keeps an image without faces",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "running", quality: -1, job: models.JobStatusRunning},
+				{name: "poor", quality: 0.2},
+			},
+			want: []string{"best", "running"},
+		},
+		{
+			name:      "queued job keeps an image",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "queued", quality: -1, job: models.JobStatusQueued},
+				{name: "poor", quality: 0.2},
+			},
+			want: []string{"best", "queued"},
+		},
+		{
+			name:      "pending reprocessing keeps an image",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "reprocess", quality: -1, reprocess: models.POStatusPending},
+				{name: "poor", quality: 0.2},
+			},
+			want: []string{"best", "reprocess"},
+		},
+		{
+			name:      "failed job and finished reprocessing do not keep an image",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "failed", quality: -1, job: models.JobStatusFailed},
+				{name: "done", quality: 0.1, reprocess: models.POStatusCompleted},
+				{name: "good", quality: 0.6},
+			},
+			want: []string{"best", "good"},
+		},
+		{
+			name:      "job of the just finished image does not keep it",
+			maxImages: 2,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "finished", quality: 0.1, job: models.JobStatusRunning, finished: true},
+				{name: "good", quality: 0.6},
+			},
+			want: []string{"best", "good"},
+		},
+		{
+			name:      "more unfinished images than allowed are all kept",
+			maxImages: 1,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "running", quality: -1, job: models.JobStatusRunning},
+				{name: "queued", quality: -1, job: models.JobStatusQueued},
+			},
+			want: []string{"best", "queued", "running"},
+		},
+		{
+			name:      "nothing is removed below the limit",
+			maxImages: 3,
+			images: []pruneImage{
+				{name: "best", quality: 0.9, keep: true},
+				{name: "empty", quality: -1},
+			},
+			want: []string{"best", "empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t)
+			p.cfg.Frigate.MaxImagesPerEvent = tt.maxImages
+
+			start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			keep := make(map[uint]bool)
+			var finishedID uint
+			for i, spec := range tt.images {
+				image := models.Image{
+					FilePath:  spec.name + ".jpg",
+					Timestamp: start.Add(time.Duration(i) * time.Second),
+					Source:    "frigate",
+					EventID:   "event",
+				}
+				p.db.Create(&image)
+				if spec.quality >= 0 {
+					p.db.Create(&models.Face{ImageID: image.ID, Quality: spec.quality})
+				}
+				if spec.job != "" {
+					p.db.Create(&models.ProcessingJob{
+						ImagePath: filepath.Join(p.cfg.Server.SnapshotDir, image.FilePath),
+						Status:    spec.job,
+					})
+				}
+				if spec.reprocess != "" {
+					p.db.Create(&models.PendingOperation{
+						OperationType: models.POTypeReprocessImage,
+						ResourceType:  "image",
+						ResourceName:  image.FilePath,
+						ResourceID:    image.ID,
+						Status:        spec.reprocess,
+					})
+				}
+				if spec.keep {
+					keep[image.ID] = true
+				}
+				if spec.finished {
+					finishedID = image.ID
+				}
+			}
+
+			var images []models.Image
+			p.db.Preload("Faces").Where("event_id = ?", "event").Order("timestamp ASC").Find(&images)
+			p.pruneEventImages("event", images, keep, finishedID)
+
+			var remaining []string
+			var stored []models.Image
+			p.db.Find(&stored)
+			for _, image := range stored {
+				remaining = append(remaining, image.FilePath[:len(image.FilePath)-len(".jpg")])
+			}
+			sort.Strings(remaining)
+			sort.Strings(tt.want)
+			if fmt.Sprint(remaining) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %v, want %v", remaining, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// trainingCropDir ist das Unterverzeichnis des Snapshot-Verzeichnisses für Trainingsausschnitte
+const trainingCropDir = "training"
+
+// Einstellungen für die Gesichtsausschnitte, die für jedes erkannte Gesicht gespeichert werden
+const (
+	faceCropPadding = 0.2 // Rand um die Bounding Box als Anteil ihrer Breite/Höhe je Seite
+	faceCropMaxSize = 160 // Maximale Kantenlänge in Pixeln
+	faceCropQuality = 85  // JPEG-Qualität
+)
+
+var (
+	// ErrFaceTooSmall wird zurückgegeben, wenn das Gesicht kleiner als training.min_face_size ist
+	ErrFaceTooSmall = errors.New("face is smaller than the minimum training size")
+	// ErrNotSingleFace wird zurückgegeben, wenn der Ausschnitt nicht genau ein Gesicht enthält
+	ErrNotSingleFace = errors.New("crop does not contain exactly one detectable face")
+	// ErrNoDetector wird zurückgegeben, wenn kein Provider für die Prüfung verfügbar ist
+	ErrNoDetector = errors.New("no face recognition provider available to verify the crop")
+)
+
+// TrainingCrop ist ein geprüfter Gesichtsausschnitt für ein Trainingsbeispiel
+type TrainingCrop struct {
+	Data []byte             // JPEG-kodierter Ausschnitt
+	Rect stdimage.Rectangle // Ausschnitt im Ausgangsbild
+}
+
+// CropFaceFromFile schneidet das Gesicht mit der gespeicherten Bounding Box (x1, y1, x2, y2)
+// aus einem Schnappschuss aus und prüft, ob der Ausschnitt genau ein Gesicht enthält.
+func (p *ImageProcessor) CropFaceFromFile(ctx context.Context, imagePath string, box []int) (*TrainingCrop, error) {
+	imageData, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image data: %w", err)
+	}
+	img, _, err := stdimage.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return p.cropTrainingFace(ctx, img, box)
+}
+
+// CropFaceFromUpload erkennt das Gesicht in einem hochgeladenen Bild und schneidet es aus.
+// Hochgeladene Bilder müssen genau ein Gesicht enthalten.
+func (p *ImageProcessor) CropFaceFromUpload(ctx context.Context, imageData []byte) (*TrainingCrop, error) {
+	img, _, err := stdimage.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	faces, err := p.detectTrainingFaces(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	if len(faces) != 1 {
+		return nil, fmt.Errorf("%w (found %d)", ErrNotSingleFace, len(faces))
+	}
+	return p.cropTrainingFace(ctx, img, faces[0].BoundingBox)
+}
+
+// SaveTrainingCrop speichert einen Ausschnitt unter <snapshot_dir>/training und gibt
+// den Pfad relativ zum Snapshot-Verzeichnis zurück
+func (p *ImageProcessor) SaveTrainingCrop(crop *TrainingCrop, filename string) (string, error) {
+	dir := filepath.Join(p.cfg.Server.SnapshotDir, trainingCropDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create training directory: %w", err)
+	}
+
+	relPath := filepath.Join(trainingCropDir, filepath.Base(filename))
+	if err := os.WriteFile(filepath.Join(p.cfg.Server.SnapshotDir, relPath), crop.Data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write training crop: %w", err)
+	}
+	return relPath, nil
+}
+
+// saveFaceCrop speichert einen verkleinerten Ausschnitt des Gesichts unter
+// <snapshot_dir>/faces/<image_id>/<face_id>.jpg und gibt den relativen Pfad zurück
+func (p *ImageProcessor) saveFaceCrop(img stdimage.Image, image *models.Image, face *models.Face, box []int) (string, error) {
+	rect := facerecognition.PadBox(box, faceCropPadding, img.Bounds())
+	if rect.Empty() {
+		return "", fmt.Errorf("face bounding box %v lies outside the image", box)
+	}
+	thumbnail := facerecognition.ScaleDown(facerecognition.CropImage(img, rect), faceCropMaxSize)
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: faceCropQuality}); err != nil {
+		return "", fmt.Errorf("failed to encode face crop: %w", err)
+	}
+
+	dir := filepath.Join(p.cfg.Server.SnapshotDir, image.FaceCropDir())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create face crop directory: %w", err)
+	}
+	relPath := filepath.Join(image.FaceCropDir(), fmt.Sprintf("%d.jpg", face.ID))
+	if err := os.WriteFile(filepath.Join(p.cfg.Server.SnapshotDir, relPath), buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write face crop: %w", err)
+	}
+	return relPath, nil
+}
+
+// EnsureFaceCrop liefert den Ausschnitt eines Gesichts und erzeugt ihn bei Bedarf aus dem
+// Schnappschuss, etwa für Gesichter, die vor Einführung der Ausschnitte erkannt wurden
+func (p *ImageProcessor) EnsureFaceCrop(face *models.Face) (string, error) {
+	if face.CropPath != "" {
+		if _, err := os.Stat(filepath.Join(p.cfg.Server.SnapshotDir, face.CropPath)); err == nil {
+			return face.CropPath, nil
+		}
+	}
+
+	var image models.Image
+	if err := p.db.First(&image, face.ImageID).Error; err != nil {
+		return "", fmt.Errorf("failed to find image %d: %w", face.ImageID, err)
+	}
+	box, err := face.Box()
+	if err != nil {
+		return "", err
+	}
+	imageData, err := os.ReadFile(filepath.Join(p.cfg.Server.SnapshotDir, image.FilePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image data: %w", err)
+	}
+	img, _, err := stdimage.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	cropPath, err := p.saveFaceCrop(img, &image, face, box)
+	if err != nil {
+		return "", err
+	}
+	if err := p.db.Model(face).Update("crop_path", cropPath).Error; err != nil {
+		return "", fmt.Errorf("failed to update face crop path: %w", err)
+	}
+	face.CropPath = cropPath
+	return cropPath, nil
+}
+
+// RemoveFaceCrops löscht alle Gesichtsausschnitte eines Bildes
+func RemoveFaceCrops(snapshotDir string, image *models.Image) {
+	if image.ID == 0 {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(snapshotDir, image.FaceCropDir())); err != nil {
+		log.Warnf("Failed to delete face crops of image %d: %v", image.ID, err)
+	}
+}
+
+// cropTrainingFace schneidet die Box mit dem konfigurierten Rand aus und prüft Größe
+// und Anzahl der Gesichter im Ausschnitt
+func (p *ImageProcessor) cropTrainingFace(ctx context.Context, img stdimage.Image, box []int) (*TrainingCrop, error) {
+	if len(box) < 4 || box[2] <= box[0] || box[3] <= box[1] {
+		return nil, fmt.Errorf("invalid face bounding box %v", box)
+	}
+
+	minSize := p.cfg.Training.MinFaceSize
+	if width, height := box[2]-box[0], box[3]-box[1]; width < minSize || height < minSize {
+		return nil, fmt.Errorf("%w (%dx%d, minimum %d)", ErrFaceTooSmall, width, height, minSize)
+	}
+
+	rect := facerecognition.PadBox(box, p.cfg.Training.CropPadding, img.Bounds())
+	if rect.Empty() {
+		return nil, fmt.Errorf("face bounding box %v lies outside the image", box)
+	}
+	cropped := facerecognition.CropImage(img, rect)
+
+	faces, err := p.detectTrainingFaces(ctx, cropped)
+	if err != nil {
+		return nil, err
+	}
+	if len(faces) != 1 {
+		return nil, fmt.Errorf("%w (found %d)", ErrNotSingleFace, len(faces))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, cropped, &jpeg.Options{Quality: 95}); err != nil {
+		return nil, fmt.Errorf("failed to encode training crop: %w", err)
+	}
+	return &TrainingCrop{Data: buf.Bytes(), Rect: rect}, nil
+}
+
+// detectTrainingFaces erkennt die Gesichter in einem Bild mit dem aktiven Provider
+func (p *ImageProcessor) detectTrainingFaces(ctx context.Context, img stdimage.Image) ([]facerecognition.Face, error) {
+	if p.providerManager == nil {
+		return nil, ErrNoDetector
+	}
+	provider, ok := p.providerManager.GetActiveProvider()
+	if !ok || provider == nil {
+		return nil, ErrNoDetector
+	}
+
+	result, err := provider.DetectFaces(ctx, img, facerecognition.DetectionRequest{})
+	p.providerManager.RecordRequestResult(ctx, provider.GetProviderName(), err)
+	if err != nil {
+		return nil, fmt.Errorf("face detection failed: %w", err)
+	}
+	return result.Faces, nil
+}
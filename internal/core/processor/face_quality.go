@@ -0,0 +1,184 @@
+package processor
+
+import (
+	stdimage "image"
+	"math"
+
+	"double-take-go-reborn/internal/integrations/facerecognition"
+)
+
+// Gewichtung der Qualitätsmerkmale eines Gesichts
+const (
+	qualityWeightSize       = 0.3
+	qualityWeightConfidence = 0.2
+	qualityWeightSharpness  = 0.3
+	qualityWeightPose       = 0.2
+)
+
+const (
+	qualityMinFaceSize   = 24.0  // Kantenlänge in Pixeln, unter der ein Gesicht unbrauchbar ist
+	qualityFullFaceSize  = 160.0 // Kantenlänge in Pixeln für die volle Punktzahl
+	qualityFullSharpness = 300.0 // Varianz des Laplace-Filters für die volle Punktzahl
+	sharpnessSampleSize  = 128   // Maximale Kantenlänge des Ausschnitts für die Schärfemessung
+)
+
+// FaceQuality enthält die Teilbewertungen eines Gesichts (jeweils 0-1)
+type FaceQuality struct {
+	Size       float64
+	Confidence float64
+	Sharpness  float64
+	Pose       float64
+	HasPose    bool // false, wenn der Provider keine Landmarks liefert
+	Score      float64
+}
+
+// assessFaceQuality bewertet, wie gut sich ein Gesicht für die Erkennung eignet.
+// Ohne Landmarks fließt die Kopfhaltung nicht in die Bewertung ein.
+func assessFaceQuality(img stdimage.Image, face facerecognition.Face) FaceQuality {
+	var quality FaceQuality
+	if len(face.BoundingBox) < 4 {
+		return quality
+	}
+
+	rect := stdimage.Rect(face.BoundingBox[0], face.BoundingBox[1], face.BoundingBox[2], face.BoundingBox[3])
+	if img != nil {
+		rect = rect.Intersect(img.Bounds())
+	}
+
+	edge := math.Min(float64(rect.Dx()), float64(rect.Dy()))
+	quality.Size = clamp01((edge - qualityMinFaceSize) / (qualityFullFaceSize - qualityMinFaceSize))
+	quality.Confidence = clamp01(face.Confidence)
+	if img != nil {
+		quality.Sharpness = clamp01(laplacianVariance(img, rect) / qualityFullSharpness)
+	}
+	quality.Pose, quality.HasPose = poseScore(face.Landmarks)
+
+	score := qualityWeightSize*quality.Size +
+		qualityWeightConfidence*quality.Confidence +
+		qualityWeightSharpness*quality.Sharpness
+	weights := qualityWeightSize + qualityWeightConfidence + qualityWeightSharpness
+	if quality.HasPose {
+		score += qualityWeightPose * quality.Pose
+		weights += qualityWeightPose
+	}
+	quality.Score = score / weights
+
+	return quality
+}
+
+// laplacianVariance misst die Schärfe eines Bildausschnitts als Varianz des
+// Laplace-Filters auf den Grauwerten. Große Ausschnitte werden dafür verkleinert.
+func laplacianVariance(img stdimage.Image, rect stdimage.Rectangle) float64 {
+	if rect.Dx() < 3 || rect.Dy() < 3 {
+		return 0
+	}
+
+	step := 1
+	if longest := max(rect.Dx(), rect.Dy()); longest > sharpnessSampleSize {
+		step = (longest + sharpnessSampleSize - 1) / sharpnessSampleSize
+	}
+
+	width := rect.Dx() / step
+	height := rect.Dy() / step
+	if width < 3 || height < 3 {
+		return 0
+	}
+
+	gray := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(rect.Min.X+x*step, rect.Min.Y+y*step).RGBA()
+			gray[y*width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+
+	var sum, sumSq float64
+	count := 0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			l := 4*gray[i] - gray[i-1] - gray[i+1] - gray[i-width] - gray[i+width]
+			sum += l
+			sumSq += l * l
+			count++
+		}
+	}
+
+	mean := sum / float64(count)
+	return sumSq/float64(count) - mean*mean
+}
+
+// poseScore bewertet anhand der Landmarks, wie frontal ein Gesicht zur Kamera steht.
+// Unterstützt werden 5 Punkte (Augen, Nase, Mundwinkel) und 68 Punkte.
+func poseScore(landmarks [][]float64) (float64, bool) {
+	var leftEye, rightEye, nose [2]float64
+
+	switch {
+	case len(landmarks) == 68:
+		var ok bool
+		if leftEye, ok = meanPoint(landmarks[36:42]); !ok {
+			return 0, false
+		}
+		if rightEye, ok = meanPoint(landmarks[42:48]); !ok {
+			return 0, false
+		}
+		if nose, ok = meanPoint(landmarks[30:31]); !ok {
+			return 0, false
+		}
+	case len(landmarks) >= 5:
+		for _, point := range landmarks[:3] {
+			if len(point) < 2 {
+				return 0, false
+			}
+		}
+		leftEye = [2]float64{landmarks[0][0], landmarks[0][1]}
+		rightEye = [2]float64{landmarks[1][0], landmarks[1][1]}
+		nose = [2]float64{landmarks[2][0], landmarks[2][1]}
+	default:
+		return 0, false
+	}
+
+	dx := rightEye[0] - leftEye[0]
+	dy := rightEye[1] - leftEye[1]
+	eyeDistSq := dx*dx + dy*dy
+	if eyeDistSq == 0 {
+		return 0, false
+	}
+
+	// Gierwinkel: Versatz der Nase zur Augenmitte entlang der Augenachse
+	// (0 = frontal, 0.5 = Nase auf Höhe eines Auges)
+	midX := (leftEye[0] + rightEye[0]) / 2
+	midY := (leftEye[1] + rightEye[1]) / 2
+	offset := ((nose[0]-midX)*dx + (nose[1]-midY)*dy) / eyeDistSq
+	yaw := clamp01(1 - 2*math.Abs(offset))
+
+	// Rollwinkel: Neigung der Augenachse (45° und mehr = 0)
+	roll := clamp01(1 - math.Atan2(math.Abs(dy), math.Abs(dx))/(math.Pi/4))
+
+	return 0.7*yaw + 0.3*roll, true
+}
+
+// meanPoint berechnet den Mittelpunkt mehrerer Landmarks
+func meanPoint(points [][]float64) ([2]float64, bool) {
+	var mean [2]float64
+	for _, point := range points {
+		if len(point) < 2 {
+			return mean, false
+		}
+		mean[0] += point[0]
+		mean[1] += point[1]
+	}
+	mean[0] /= float64(len(points))
+	mean[1] /= float64(len(points))
+	return mean, true
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
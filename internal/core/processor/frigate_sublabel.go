@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// subLabelTimeout begrenzt die Dauer der Frigate-Aufrufe für ein Sub-Label
+const subLabelTimeout = 15 * time.Second
+
+// Richtlinien für bereits vorhandene Sub-Labels, die nicht von Double Take stammen
+const (
+	SubLabelOverwriteNever    = "never"
+	SubLabelOverwriteIfHigher = "if_higher"
+	SubLabelOverwriteAlways   = "always"
+)
+
+// writeFrigateSubLabel schreibt die erkannte Identität eines Events als Sub-Label nach
+// Frigate, damit sich Events dort nach Personen durchsuchen lassen. Die Aufrufe laufen
+// im Hintergrund, damit die Auswertung weiterer Events nicht blockiert wird.
+func (p *ImageProcessor) writeFrigateSubLabel(verdict models.EventVerdict) {
+	cfg := p.cfg.Frigate.SubLabel
+	if !cfg.Enabled || !p.cfg.Frigate.Enabled || p.frigateClient == nil || verdict.Identity == nil {
+		return
+	}
+	if verdict.Confidence < cfg.MinConfidence {
+		return
+	}
+
+	name := verdict.Identity.Name
+	if verdict.SubLabel == name && verdict.Confidence <= verdict.SubLabelScore {
+		return
+	}
+	if _, busy := p.subLabelWrites.LoadOrStore(verdict.EventID, true); busy {
+		return
+	}
+
+	go func() {
+		defer p.subLabelWrites.Delete(verdict.EventID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), subLabelTimeout)
+		defer cancel()
+
+		current, currentScore, err := p.frigateClient.GetEventSubLabel(ctx, verdict.EventID)
+		if err != nil {
+			log.Warnf("Failed to read sub label of Frigate event %s: %v", verdict.EventID, err)
+			return
+		}
+
+		if current != name && !overwriteSubLabel(cfg.Overwrite, current, currentScore, verdict) {
+			log.Debugf("Keeping sub label %q (score %.2f) of Frigate event %s, policy %q",
+				current, currentScore, verdict.EventID, cfg.Overwrite)
+			return
+		}
+
+		write, score := subLabelWrite(current, currentScore, name, verdict.Confidence)
+		if write {
+			if err := p.frigateClient.SetSubLabel(ctx, verdict.EventID, name, verdict.Confidence); err != nil {
+				log.Warnf("Failed to set sub label of Frigate event %s: %v", verdict.EventID, err)
+				return
+			}
+			log.Infof("Set sub label of Frigate event %s to %s (confidence %.2f)", verdict.EventID, name, verdict.Confidence)
+		}
+
+		if err := p.db.Model(&models.EventVerdict{}).Where("id = ?", verdict.ID).Updates(map[string]interface{}{
+			"sub_label":       name,
+			"sub_label_score": score,
+		}).Error; err != nil {
+			log.Errorf("Failed to store sub label of event %s: %v", verdict.EventID, err)
+		}
+	}()
+}
+
+// subLabelWrite entscheidet, ob der Name in Frigate geschrieben werden muss, und liefert
+// den Score, der danach in Frigate steht. Hat Frigate denselben Namen bereits mit einem
+// mindestens gleich hohen Score, wird nichts geschrieben und dieser Score übernommen.
+func subLabelWrite(current string, currentScore float64, name string, confidence float64) (bool, float64) {
+	if current == name && confidence <= currentScore {
+		return false, currentScore
+	}
+	return true, confidence
+}
+
+// overwriteSubLabel entscheidet, ob ein vorhandenes Sub-Label ersetzt werden darf. Leere
+// und von Double Take selbst gesetzte Sub-Labels werden immer ersetzt, unbekannte
+// Richtlinien werden wie "never" behandelt.
+func overwriteSubLabel(policy, current string, currentScore float64, verdict models.EventVerdict) bool {
+	if current == "" || current == verdict.SubLabel {
+		return true
+	}
+	switch policy {
+	case SubLabelOverwriteAlways:
+		return true
+	case SubLabelOverwriteIfHigher:
+		return verdict.Confidence > currentScore
+	default:
+		return false
+	}
+}
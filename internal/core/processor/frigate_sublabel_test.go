@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"testing"
+
+	"double-take-go-reborn/internal/core/models"
+)
+
+func TestSubLabelWrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		current      string
+		currentScore float64
+		confidence   float64
+		wantWrite    bool
+		wantScore    float64
+	}{
+		{"missing sub label", "", 0, 0.8, true, 0.8},
+		{"same name with higher score is kept", "alice", 0.95, 0.8, false, 0.95},
+		{"same name with equal score is kept", "alice", 0.8, 0.8, false, 0.8},
+		{"same name with lower score is raised", "alice", 0.6, 0.8, true, 0.8},
+		{"other name with higher score is replaced", "bob", 0.95, 0.8, true, 0.8},
+		{"other name with lower score is replaced", "bob", 0.5, 0.8, true, 0.8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write, score := subLabelWrite(tt.current, tt.currentScore, "alice", tt.confidence)
+			if write != tt.wantWrite || score != tt.wantScore {
+				t.Fatalf("got write %v with score %v, want write %v with score %v", write, score, tt.wantWrite, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestOverwriteSubLabel(t *testing.T) {
+	// Das Ergebnis stammt von Double Take, das zuvor "carol" gesetzt hatte
+	verdict := models.EventVerdict{SubLabel: "carol", Confidence: 0.8}
+
+	tests := []struct {
+		name         string
+		policy       string
+		current      string
+		currentScore float64
+		want         bool
+	}{
+		{"missing sub label", SubLabelOverwriteNever, "", 0, true},
+		{"own earlier sub label", SubLabelOverwriteNever, "carol", 0.99, true},
+		{"never keeps a foreign sub label", SubLabelOverwriteNever, "bob", 0.1, false},
+		{"if_higher keeps a higher foreign score", SubLabelOverwriteIfHigher, "bob", 0.9, false},
+		{"if_higher keeps an equal foreign score", SubLabelOverwriteIfHigher, "bob", 0.8, false},
+		{"if_higher replaces a lower foreign score", SubLabelOverwriteIfHigher, "bob", 0.5, true},
+		{"always replaces a higher foreign score", SubLabelOverwriteAlways, "bob", 0.99, true},
+		{"unknown policy keeps a foreign sub label", "sometimes", "bob", 0.1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overwriteSubLabel(tt.policy, tt.current, tt.currentScore, verdict); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	stdimage "image"
+	_ "image/png" // PNG-Decoder für stdimage.Decode, JPEG registriert face_crop.go
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"double-take-go-reborn/config"
@@ -36,6 +39,26 @@ type ProcessingOptions struct {
 	RecognizeFaces bool
 	Metadata       map[string]interface{} // Zusätzliche Metadaten
 	ExistingImageID uint                  // Falls gesetzt, wird dieses existierende Bild verwendet anstatt ein neues zu erstellen
+	Retry          bool                   // Wiederholung aus der Reprocessing-Queue: Erkennungsfehler werden zurückgegeben statt erneut eingereiht
+	Priority       int                    // Priorität in der Verarbeitungs-Queue (PriorityManual, PriorityNew, ...)
+}
+
+// PendingQueue nimmt fehlgeschlagene Verarbeitungen zur späteren Wiederholung entgegen
+// (implementiert durch den SyncService)
+type PendingQueue interface {
+	AddPendingOperation(opType, resourceType, resourceName string, resourceID uint, data interface{}) error
+}
+
+// FaceClusterer ordnet unbekannte Gesichter anhand ihres Embeddings einem Cluster zu
+// (implementiert durch den Clustering-Service)
+type FaceClusterer interface {
+	AddFace(face *models.Face) error
+}
+
+// PresenceTracker fasst die Erkennungen einer Identität zu Aufenthalten zusammen
+// (implementiert durch den Anwesenheits-Service)
+type PresenceTracker interface {
+	Observe(identity models.Identity, camera string, zones []string, confidence float64, imageID uint, at time.Time)
 }
 
 // ImageProcessor verarbeitet Bilder, extrahiert Gesichter und identifiziert Personen
@@ -48,7 +71,16 @@ type ImageProcessor struct {
 	sseHub        *sse.Hub
 	frigateClient *frigate.FrigateClient
 	haPublisher   *homeassistant.Publisher
+	resultPublisher *homeassistant.Publisher // Veröffentlicht die Ergebnisse auf den Topics matches und cameras
 	workerPool    *WorkerPool // Referenz zum Worker-Pool für parallele Verarbeitung
+	ensemble      *facerecognition.Ensemble // Gesetzt, wenn der Ensemble-Modus aktiv ist
+	pendingQueue  PendingQueue // Queue für Bilder, deren Erkennung wiederholt werden muss
+	clusterer     FaceClusterer // Gruppiert Gesichter ohne Treffer
+	presence      PresenceTracker // Verfolgt die Anwesenheit erkannter Identitäten
+	pausedCameras map[string]bool // Kameras, deren automatische Verarbeitung angehalten ist (nil = noch nicht geladen)
+	pausedMutex   sync.Mutex
+	verdictMutex  sync.Mutex   // Serialisiert die Auswertung der Gesichter eines Events
+	subLabelWrites sync.Map    // Events, deren Sub-Label gerade in Frigate gesetzt wird
 }
 
 // NewImageProcessor erstellt einen neuen Bildverarbeitungsprozessor
@@ -75,6 +107,23 @@ func NewImageProcessor(db *gorm.DB, cfg *config.Config, compreface *compreface.A
 		log.Info("OpenCV-Service ist in der Konfiguration deaktiviert")
 	}
 
+	// Ensemble-Modus nur nutzen, wenn mehrere Provider registriert sind
+	var ensemble *facerecognition.Ensemble
+	if cfg.Ensemble.Enabled && providerManager != nil {
+		if len(providerManager.GetProviders()) > 1 {
+			ensemble = facerecognition.NewEnsemble(
+				providerManager,
+				facerecognition.EnsembleStrategy(cfg.Ensemble.Strategy),
+				cfg.Ensemble.Weights,
+				cfg.Ensemble.MinIoU,
+				cfg.Ensemble.MinConfidence,
+			)
+			log.Infof("Ensemble-Modus aktiv (Strategie: %s)", ensemble.Strategy())
+		} else {
+			log.Warn("Ensemble-Modus aktiviert, aber weniger als zwei Provider registriert. Verwende den aktiven Provider.")
+		}
+	}
+
 	return &ImageProcessor{
 		db:            db,
 		cfg:           cfg,
@@ -84,6 +133,7 @@ func NewImageProcessor(db *gorm.DB, cfg *config.Config, compreface *compreface.A
 		sseHub:        sseHub,
 		frigateClient: frigateClient,
 		haPublisher:   haPublisher,
+		ensemble:      ensemble,
 	}
 }
 
@@ -92,6 +142,26 @@ func (p *ImageProcessor) SetWorkerPool(workerPool *WorkerPool) {
 	p.workerPool = workerPool
 }
 
+// SetPendingQueue setzt die Queue, in die Bilder mit fehlgeschlagener Erkennung eingereiht werden
+func (p *ImageProcessor) SetPendingQueue(queue PendingQueue) {
+	p.pendingQueue = queue
+}
+
+// SetFaceClusterer setzt den Dienst, der unbekannte Gesichter gruppiert
+func (p *ImageProcessor) SetFaceClusterer(clusterer FaceClusterer) {
+	p.clusterer = clusterer
+}
+
+// SetPresenceTracker setzt den Dienst, der die Anwesenheit erkannter Identitäten verfolgt
+func (p *ImageProcessor) SetPresenceTracker(tracker PresenceTracker) {
+	p.presence = tracker
+}
+
+// GetProviderManager gibt den ProviderManager der Gesichtserkennungsdienste zurück
+func (p *ImageProcessor) GetProviderManager() *facerecognition.ProviderManager {
+	return p.providerManager
+}
+
 // GetOpenCVService gibt einen Verweis auf den OpenCV-Service zurück
 func (p *ImageProcessor) GetOpenCVService() *opencv.Service {
 	return p.opencvService
@@ -108,10 +178,23 @@ func (p *ImageProcessor) ProcessImage(ctx context.Context, imagePath, source str
 	return p.processImageInternal(ctx, imagePath, source, options)
 }
 
+// EnqueueImage reiht ein Bild zur Verarbeitung ein, ohne auf das Ergebnis zu warten
+func (p *ImageProcessor) EnqueueImage(imagePath, source string, options ProcessingOptions) error {
+	if p.workerPool != nil {
+		_, err := p.workerPool.Enqueue(imagePath, source, options)
+		return err
+	}
+
+	// Ohne Worker-Pool direkt verarbeiten
+	_, err := p.processImageInternal(context.Background(), imagePath, source, options)
+	return err
+}
+
 // processImageInternal enthält die interne Verarbeitungslogik für die Bildverarbeitung
 // Diese Methode wird vom Worker-Pool aufgerufen
 func (p *ImageProcessor) processImageInternal(ctx context.Context, imagePath, source string, options ProcessingOptions) (*models.Image, error) {
 	log.Infof("Processing image %s from source %s", imagePath, source)
+	started := time.Now()
 
 	// 1. Überprüfen, ob die Datei existiert
 	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
@@ -179,10 +262,10 @@ func (p *ImageProcessor) processImageInternal(ctx context.Context, imagePath, so
 		
 		// Zonen-Informationen extrahieren und zusammenführen, wenn vorhanden
 		var zones []string
-		if currentZones, ok := options.Metadata["current_zones"].([]string); ok && len(currentZones) > 0 {
+		if currentZones := metadataStrings(options.Metadata["current_zones"]); len(currentZones) > 0 {
 			zones = append(zones, currentZones...)
 		}
-		if enteredZones, ok := options.Metadata["entered_zones"].([]string); ok && len(enteredZones) > 0 {
+		if enteredZones := metadataStrings(options.Metadata["entered_zones"]); len(enteredZones) > 0 {
 			for _, zone := range enteredZones {
 				if !contains(zones, zone) {
 					zones = append(zones, zone)
@@ -271,10 +354,17 @@ func (p *ImageProcessor) processImageInternal(ctx context.Context, imagePath, so
 	var faceRecognitionErr error
 	if !p.cfg.OpenCV.Enabled || hasPersons {
 		// Gesichtserkennung mit dem aktiven Provider durchführen
-		recognitionMatches, err := p.processWithFaceRecognition(ctx, imagePath, &image)
+		recognitionMatches, err := p.processWithFaceRecognition(ctx, imagePath, &image, p.imageCamera(&image, options.Metadata))
 		faceRecognitionErr = err
 		if err != nil {
 			log.Warnf("Face recognition failed: %v", err)
+			
+			// Bei einer Wiederholung entscheidet der Aufrufer über das weitere Vorgehen
+			if options.Retry {
+				return &image, fmt.Errorf("face recognition failed: %w", err)
+			}
+			p.queueReprocessing(&image, err)
+			p.publishError(&image, options.Metadata, err)
 		} else if len(recognitionMatches) > 0 {
 			matches = recognitionMatches
 		}
@@ -295,17 +385,193 @@ func (p *ImageProcessor) processImageInternal(ctx context.Context, imagePath, so
 		p.sseHub.BroadcastNewImage(image, p.cfg.Server.SnapshotURL+"/"+image.FilePath, matches)
 	}
 	
+	// 8.1 Anwesenheit der erkannten Identitäten aktualisieren
+	if p.presence != nil && len(matches) > 0 {
+		p.observePresence(&image, options.Metadata, matches)
+	}
+	
+	// 9. Gesamtergebnis des Frigate-Events aus den besten Gesichtern aller Snapshots ableiten
+	if image.Source == "frigate" && image.EventID != "" && faceRecognitionErr == nil {
+		camera, _ := options.Metadata["camera"].(string)
+		p.updateEventVerdict(image.EventID, camera, image.ID)
+	}
+	
+	// 10. Ergebnisse wie im ursprünglichen Double Take per MQTT veröffentlichen
+	if p.resultPublisher != nil && faceRecognitionErr == nil && (!p.cfg.OpenCV.Enabled || hasPersons) {
+		p.publishResults(&image, options.Metadata, time.Since(started).Seconds())
+	}
+	
 	return &image, nil
 }
 
-// processWithFaceRecognition verarbeitet ein Bild mit dem aktiven Gesichtserkennungsanbieter
-func (p *ImageProcessor) processWithFaceRecognition(ctx context.Context, imagePath string, image *models.Image) ([]models.Match, error) {
-	// Den aktiven Provider ermitteln
-	activeProvider, ok := p.providerManager.GetActiveProvider()
-	if !ok || activeProvider == nil {
-		return nil, fmt.Errorf("no active face recognition provider available")
+// publishResults veröffentlicht alle Gesichter eines Bildes samt Treffern
+func (p *ImageProcessor) publishResults(image *models.Image, metadata map[string]interface{}, duration float64) {
+	var faces []models.Face
+	if err := p.db.Preload("Matches.Identity").Where("image_id = ?", image.ID).Find(&faces).Error; err != nil {
+		log.Warnf("Failed to load faces of image %d for MQTT results: %v", image.ID, err)
+		return
+	}
+
+	result := homeassistant.Result{
+		ID:       fmt.Sprintf("%d", image.ID),
+		Camera:   p.imageCamera(image, metadata),
+		Type:     image.Source,
+		Image:    image,
+		Faces:    faces,
+		Duration: duration,
+		Attempts: 1,
+	}
+	if image.EventID != "" {
+		result.ID = image.EventID
+	}
+	if imageType, _ := metadata["image_type"].(string); imageType != "" {
+		result.Type = imageType
+	}
+	if image.Zone != "" {
+		result.Zones = strings.Split(image.Zone, ",")
+	}
+
+	if err := p.resultPublisher.PublishResults(result); err != nil {
+		log.Warnf("Failed to publish MQTT results of image %d: %v", image.ID, err)
+	}
+}
+
+// publishError meldet eine fehlgeschlagene Gesichtserkennung auf dem Topic errors
+func (p *ImageProcessor) publishError(image *models.Image, metadata map[string]interface{}, err error) {
+	if p.resultPublisher == nil {
+		return
+	}
+	err = fmt.Errorf("face recognition failed for image %d (camera %s): %w", image.ID, p.imageCamera(image, metadata), err)
+	if pubErr := p.resultPublisher.PublishError(err); pubErr != nil {
+		log.Warnf("Failed to publish MQTT error of image %d: %v", image.ID, pubErr)
+	}
+}
+
+// observePresence meldet jede im Bild erkannte Identität einmal an die Anwesenheitserkennung.
+// Bei Frigate-Bildern ist die Quelle "frigate", die Kamera ermittelt imageCamera.
+func (p *ImageProcessor) observePresence(image *models.Image, metadata map[string]interface{}, matches []models.Match) {
+	camera := p.imageCamera(image, metadata)
+	var zones []string
+	if image.Zone != "" {
+		zones = strings.Split(image.Zone, ",")
+	}
+
+	best := make(map[uint]models.Match)
+	for _, match := range matches {
+		if current, ok := best[match.IdentityID]; !ok || match.Confidence > current.Confidence {
+			best[match.IdentityID] = match
+		}
+	}
+	for _, match := range best {
+		p.presence.Observe(match.Identity, camera, zones, match.Confidence, image.ID, image.Timestamp)
+	}
+}
+
+// queueReprocessing reiht ein Bild, dessen Erkennung fehlgeschlagen ist, zur späteren
+// Wiederholung ein. Für jedes Bild gibt es höchstens eine offene Wiederholung.
+func (p *ImageProcessor) queueReprocessing(image *models.Image, recognitionErr error) {
+	if p.pendingQueue == nil {
+		return
 	}
 	
+	var existing int64
+	p.db.Model(&models.PendingOperation{}).
+		Where("operation_type = ? AND resource_id = ? AND status = ?", models.POTypeReprocessImage, image.ID, models.POStatusPending).
+		Count(&existing)
+	if existing > 0 {
+		log.Debugf("Image ID %d is already queued for reprocessing", image.ID)
+		return
+	}
+	
+	data := map[string]interface{}{
+		"file_path": image.FilePath,
+		"source":    image.Source,
+		"error":     recognitionErr.Error(),
+	}
+	if err := p.pendingQueue.AddPendingOperation(models.POTypeReprocessImage, models.POResourceImage, image.FilePath, image.ID, data); err != nil {
+		log.Errorf("Failed to queue image ID %d for reprocessing: %v", image.ID, err)
+		return
+	}
+	log.Infof("Image ID %d queued for reprocessing once face recognition is available again", image.ID)
+}
+
+// CanReprocess gibt an, ob derzeit mindestens ein Gesichtserkennungsanbieter Anfragen annimmt
+func (p *ImageProcessor) CanReprocess() bool {
+	if p.providerManager == nil {
+		return false
+	}
+	return p.providerManager.HasHealthyProvider()
+}
+
+// ErrAlreadyProcessing wird zurückgegeben, wenn für ein Bild bereits ein Auftrag wartet oder läuft
+var ErrAlreadyProcessing = errors.New("image is already queued or being processed")
+
+// ReprocessImage verarbeitet ein bereits gespeichertes Bild erneut. Vorhandene Gesichter
+// und Treffer des Bildes werden dabei ersetzt.
+func (p *ImageProcessor) ReprocessImage(ctx context.Context, imageID uint) error {
+	var image models.Image
+	if err := p.db.First(&image, imageID).Error; err != nil {
+		return fmt.Errorf("failed to find image %d: %w", imageID, err)
+	}
+	
+	imagePath := filepath.Join(p.cfg.Server.SnapshotDir, image.FilePath)
+	if _, err := os.Stat(imagePath); err != nil {
+		return fmt.Errorf("image file not available: %w", err)
+	}
+	
+	// Läuft bereits ein Auftrag für das Bild (z.B. aus einem abgebrochenen Versuch),
+	// keinen zweiten einreihen, der dieselben Gesichter und Treffer schreibt
+	var activeJobs int64
+	if err := p.db.Model(&models.ProcessingJob{}).
+		Where("status IN ? AND image_path = ?", []string{models.JobStatusQueued, models.JobStatusRunning}, imagePath).
+		Count(&activeJobs).Error; err != nil {
+		return fmt.Errorf("failed to check processing jobs of image %d: %w", imageID, err)
+	}
+	if activeJobs > 0 {
+		return fmt.Errorf("image %d: %w", imageID, ErrAlreadyProcessing)
+	}
+	
+	// Reste eines früheren Versuchs entfernen
+	RemoveFaceCrops(p.cfg.Server.SnapshotDir, &image)
+	if err := p.db.Transaction(func(tx *gorm.DB) error {
+		var faceIDs []uint
+		if err := tx.Model(&models.Face{}).Where("image_id = ?", image.ID).Pluck("id", &faceIDs).Error; err != nil {
+			return fmt.Errorf("failed to load old faces: %w", err)
+		}
+		if len(faceIDs) == 0 {
+			return nil
+		}
+		if err := tx.Where("face_id IN ?", faceIDs).Delete(&models.Match{}).Error; err != nil {
+			return fmt.Errorf("failed to delete old matches: %w", err)
+		}
+		if err := tx.Where("image_id = ?", image.ID).Delete(&models.Face{}).Error; err != nil {
+			return fmt.Errorf("failed to delete old faces: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	
+	_, err := p.ProcessImage(ctx, imagePath, image.Source, ProcessingOptions{
+		DetectFaces:     true,
+		RecognizeFaces:  true,
+		ExistingImageID: image.ID,
+		Retry:           true,
+		Priority:        PriorityReprocess,
+	})
+	return err
+}
+
+// faceMatchMinIoU ist die minimale Überlappung, ab der ein Erkennungsergebnis
+// einem erkannten Gesicht zugeordnet wird
+const faceMatchMinIoU = 0.3
+
+// processWithFaceRecognition verarbeitet ein Bild mit dem aktiven Gesichtserkennungsanbieter.
+// Die Gesichter werden einmal erkannt und das gesamte Bild einmal abgeglichen; die
+// Erkennungsergebnisse werden anschließend über die Überlappung der Bounding Boxes
+// dem jeweils passenden Gesicht zugeordnet. Schwellwert und Mindestgröße der Gesichter
+// richten sich nach den Regeln der Kamera.
+func (p *ImageProcessor) processWithFaceRecognition(ctx context.Context, imagePath string, image *models.Image, camera string) ([]models.Match, error) {
 	// 1. Bilddaten lesen
 	imageData, err := ioutil.ReadFile(imagePath)
 	if err != nil {
@@ -318,6 +584,39 @@ func (p *ImageProcessor) processWithFaceRecognition(ctx context.Context, imagePa
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 	
+	// Im Ensemble-Modus alle Provider abfragen
+	if p.ensemble != nil {
+		return p.processWithEnsemble(ctx, img, imagePath, image, camera)
+	}
+	
+	// Den aktiven Provider ermitteln (bei Ausfall des primären ggf. einen Ausweich-Provider)
+	activeProvider, ok := p.providerManager.GetActiveProvider()
+	if !ok || activeProvider == nil {
+		return nil, fmt.Errorf("no active face recognition provider available")
+	}
+	
+	matches, err := p.processWithProvider(ctx, img, imagePath, image, activeProvider, camera)
+	if err != nil && ctx.Err() == nil {
+		// Hat der Fehler zum Umschalten geführt, das Bild direkt mit dem neuen Provider verarbeiten
+		if fallback, ok := p.providerManager.GetActiveProvider(); ok && fallback.GetProviderName() != activeProvider.GetProviderName() {
+			log.Warnf("%s failed (%v), retrying image %s with %s", activeProvider.GetProviderName(), err, imagePath, fallback.GetProviderName())
+			return p.processWithProvider(ctx, img, imagePath, image, fallback, camera)
+		}
+	}
+	return matches, err
+}
+
+// processWithProvider führt Erkennung und Abgleich mit einem einzelnen Provider durch
+// und meldet das Ergebnis an die Zustandsüberwachung des ProviderManagers
+func (p *ImageProcessor) processWithProvider(ctx context.Context, img stdimage.Image, imagePath string, image *models.Image, activeProvider facerecognition.Provider, camera string) ([]models.Match, error) {
+	providerName := activeProvider.GetProviderName()
+
+	// Das Ergebnis zählt genau einmal je Bild, egal in welchem Schritt ein Fehler auftritt
+	var providerErr error
+	defer func() {
+		p.providerManager.RecordRequestResult(ctx, providerName, providerErr)
+	}()
+	
 	// 2. Gesichtserkennung durchführen
 	detectionRequest := facerecognition.DetectionRequest{
 		ReturnFaceData: true,
@@ -326,136 +625,293 @@ func (p *ImageProcessor) processWithFaceRecognition(ctx context.Context, imagePa
 	
 	detectionResult, err := activeProvider.DetectFaces(ctx, img, detectionRequest)
 	if err != nil {
+		providerErr = err
 		return nil, fmt.Errorf("face detection failed: %w", err)
 	}
 	
-	log.Infof("%s detected %d faces in image %s", p.providerManager.GetActiveProviderName(), len(detectionResult.Faces), imagePath)
-
-	// 3. Für jedes erkannte Gesicht Gesichts-DB-Eintrag erstellen
+	log.Infof("%s detected %d faces in image %s", providerName, len(detectionResult.Faces), imagePath)
+	
+	if len(detectionResult.Faces) == 0 {
+		return nil, nil
+	}
+	
+	// 3. Einmaliger Abgleich des gesamten Bildes
+	recognitionRequest := facerecognition.RecognitionRequest{
+		DetectionRequest: detectionRequest,
+		Threshold:        p.recognitionThreshold(providerName, camera),
+	}
+	
+	recognitionResult, err := activeProvider.RecognizeFaces(ctx, img, recognitionRequest)
+	if err != nil {
+		providerErr = err
+		return nil, fmt.Errorf("face recognition failed: %w", err)
+	}
+	
+	// 4. Erkennungsergebnisse den erkannten Gesichtern zuordnen
+	detectedBoxes := make([][]int, len(detectionResult.Faces))
+	for i, face := range detectionResult.Faces {
+		detectedBoxes[i] = face.BoundingBox
+	}
+	recognizedBoxes := make([][]int, len(recognitionResult.Faces))
+	for i, face := range recognitionResult.Faces {
+		recognizedBoxes[i] = face.BoundingBox
+	}
+	assignment := facerecognition.AssignByIoU(detectedBoxes, recognizedBoxes, faceMatchMinIoU)
+	
+	// 5. Für jedes erkannte Gesicht DB-Einträge für Gesicht und Matches erstellen
 	var matches []models.Match
 	
 	for i, face := range detectionResult.Faces {
 		log.Infof("Processing face #%d with confidence %.2f", i+1, face.Confidence)
-		
-		// BoundingBox Array auspacken [x_min, y_min, x_max, y_max]
-		if len(face.BoundingBox) < 4 {
-			log.Errorf("Invalid bounding box format for face #%d", i+1)
+		if p.faceTooSmall(camera, face.BoundingBox) {
+			log.Infof("Skipping face #%d: smaller than the minimum face size of camera %s", i+1, camera)
 			continue
 		}
 		
-		// Bounding Box als JSON für die Datenbank vorbereiten
-		boundingBoxJSON, err := json.Marshal(map[string]interface{}{
-			"x_min": face.BoundingBox[0],
-			"y_min": face.BoundingBox[1],
-			"x_max": face.BoundingBox[2],
-			"y_max": face.BoundingBox[3],
-		})
+		dbFace, err := p.saveFace(img, image, face, string(providerName))
 		if err != nil {
-			log.Errorf("Failed to marshal bounding box data: %v", err)
+			log.Errorf("Failed to store face #%d: %v", i+1, err)
 			continue
 		}
 		
-		// Gesichter-DB-Eintrag erstellen
-		dbFace := models.Face{
-			ImageID:     image.ID,
-			BoundingBox: datatypes.JSON(boundingBoxJSON),
-			Confidence:  face.Confidence,
-			Detector:    string(p.providerManager.GetActiveProviderName()),
+		recognitionIndex := assignment[i]
+		if recognitionIndex < 0 || recognitionIndex >= len(recognitionResult.Matches) || len(recognitionResult.Matches[recognitionIndex]) == 0 {
+			log.Infof("No matching identity found for face #%d", i+1)
+			p.clusterUnknownFace(dbFace)
+			continue
 		}
 		
-		if err := p.db.Create(&dbFace).Error; err != nil {
-			log.Errorf("Failed to create face record: %v", err)
-			continue
+		faceMatches := p.saveMatches(dbFace, recognitionResult.Matches[recognitionIndex])
+		if len(faceMatches) == 0 {
+			p.clusterUnknownFace(dbFace)
 		}
+		matches = append(matches, faceMatches...)
+	}
+	
+	// Erkennungsergebnisse ohne zugehöriges Gesicht protokollieren
+	assigned := make(map[int]bool, len(assignment))
+	for _, j := range assignment {
+		assigned[j] = true
+	}
+	for j := range recognitionResult.Faces {
+		if !assigned[j] {
+			log.Debugf("Recognition result #%d could not be assigned to a detected face", j+1)
+		}
+	}
 
-		log.Infof("Created face record ID: %d for image ID: %d", dbFace.ID, image.ID)
+	return matches, nil
+}
 
-		// 4. Gesichtserkennung durchführen
-		// Erkennungsparameter festlegen
-		threshold := 0.7 // Standard-Schwellwert
-		if p.providerManager.GetActiveProviderName() == facerecognition.ProviderCompreFace && p.cfg.CompreFace.SimilarityThreshold > 0 {
-			threshold = p.cfg.CompreFace.SimilarityThreshold / 100.0 // Umrechnung von Prozent (0-100) auf Dezimalwert (0-1)
-		} else if p.providerManager.GetActiveProviderName() == facerecognition.ProviderInsightFace && p.cfg.InsightFace.RecognitionThreshold > 0 {
-			threshold = p.cfg.InsightFace.RecognitionThreshold
+// processWithEnsemble fragt alle Provider parallel ab und speichert die kombinierten
+// Treffer sowie die Rohwerte der einzelnen Provider
+func (p *ImageProcessor) processWithEnsemble(ctx context.Context, img stdimage.Image, imagePath string, image *models.Image, camera string) ([]models.Match, error) {
+	detectionRequest := facerecognition.DetectionRequest{
+		ReturnFaceData: true,
+		ExtractEmbedding: true,
+	}
+	
+	result, err := p.ensemble.Recognize(ctx, img, func(provider facerecognition.ProviderType) facerecognition.RecognitionRequest {
+		return facerecognition.RecognitionRequest{
+			DetectionRequest: detectionRequest,
+			Threshold:        p.recognitionThreshold(provider, camera),
 		}
-		
-		// Gesichtserkennung mit der RecognizeFaces-Methode (aus der Provider-Schnittstelle)
-		recognitionRequest := facerecognition.RecognitionRequest{
-			Threshold: threshold,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensemble recognition failed: %w", err)
+	}
+	
+	for provider, providerErr := range result.Failed {
+		log.Warnf("Ensemble provider %s failed: %s", provider, providerErr)
+	}
+	log.Infof("Ensemble (%s) detected %d faces in image %s using %v", p.ensemble.Strategy(), len(result.Faces), imagePath, result.Providers)
+	
+	var matches []models.Match
+	for i, ensembleFace := range result.Faces {
+		if p.faceTooSmall(camera, ensembleFace.Face.BoundingBox) {
+			log.Infof("Skipping face #%d: smaller than the minimum face size of camera %s", i+1, camera)
+			continue
 		}
 		
-		// Gesichtserkennung durchführen
-		recognitionResult, err := activeProvider.RecognizeFaces(ctx, img, recognitionRequest)
+		dbFace, err := p.saveFace(img, image, ensembleFace.Face, "ensemble")
 		if err != nil {
-			log.Errorf("Face recognition failed for face #%d: %v", i+1, err)
+			log.Errorf("Failed to store face #%d: %v", i+1, err)
 			continue
 		}
 		
-		// Wenn Ergebnisse vorhanden sind und Gesichter gefunden wurden
-		if recognitionResult != nil && len(recognitionResult.Faces) > 0 && len(recognitionResult.Matches) > 0 {
-			// Für jedes gefundene Gesicht und dessen Matches DB-Einträge erstellen
-			for faceIndex, _ := range recognitionResult.Faces {
-				// Wir verwenden den faceIndex, um die entsprechenden Matches zu finden
-				if faceIndex >= len(recognitionResult.Matches) || len(recognitionResult.Matches[faceIndex]) == 0 {
-					// Keine Matches für dieses Gesicht
-					continue
-				}
-				
-				// Für jeden Match ein DB-Eintrag erstellen
-				for _, match := range recognitionResult.Matches[faceIndex] {
-					// Identity finden oder erstellen
-					var identity models.Identity
-					
-					// Erst versuchen, vorhandene Identity zu finden
-					if err := p.db.Where("external_id = ?", match.SubjectID).First(&identity).Error; err != nil {
-						if err == gorm.ErrRecordNotFound {
-							// Neue Identity erstellen
-							identity = models.Identity{
-								Name:       match.SubjectID, // SubjectID als Standardname verwenden
-								ExternalID: match.SubjectID,
-							}
-						
-							if err := p.db.Create(&identity).Error; err != nil {
-								log.Errorf("Failed to create identity record: %v", err)
-								continue
-							}
-							log.Infof("Created new identity record: %s (ID: %d)", identity.Name, identity.ID)
-						} else {
-							log.Errorf("Failed to query identity: %v", err)
-							continue
-						}
-					}
-					
-					// Match-Eintrag erstellen
-					matchRecord := models.Match{
-						FaceID:     dbFace.ID,
-						IdentityID: identity.ID,
-						Confidence: match.Similarity,
-					}
-					
-					if err := p.db.Create(&matchRecord).Error; err != nil {
-						log.Errorf("Failed to create match record: %v", err)
-						continue
-					}
-
-					// Match mit Identity nachladen für SSE
-					p.db.Model(&matchRecord).Association("Identity").Find(&matchRecord.Identity)
-					
-					// Match zur Liste hinzufügen
-					matches = append(matches, matchRecord)
-					
-					log.Infof("Created match record ID: %d (face: %d, identity: %d, confidence: %.2f)", 
-						matchRecord.ID, matchRecord.FaceID, matchRecord.IdentityID, matchRecord.Confidence)
-				}
+		// Rohwerte der einzelnen Provider speichern
+		for _, score := range ensembleFace.Scores {
+			record := models.ProviderScore{
+				FaceID:     dbFace.ID,
+				Provider:   string(score.Provider),
+				SubjectID:  score.SubjectID,
+				Confidence: score.Similarity,
 			}
-		} else {
+			if err := p.db.Create(&record).Error; err != nil {
+				log.Errorf("Failed to create provider score record: %v", err)
+			}
+		}
+		if ensembleFace.Disagreement() {
+			log.Infof("Providers disagree on face #%d (face ID %d): %v", i+1, dbFace.ID, ensembleFace.Scores)
+		}
+		
+		if len(ensembleFace.Matches) == 0 {
 			log.Infof("No matching identity found for face #%d", i+1)
+			p.clusterUnknownFace(dbFace)
+			continue
+		}
+		
+		faceMatches := p.saveMatches(dbFace, ensembleFace.Matches)
+		if len(faceMatches) == 0 {
+			p.clusterUnknownFace(dbFace)
 		}
+		matches = append(matches, faceMatches...)
 	}
-
+	
 	return matches, nil
 }
 
+// saveFace legt den Datenbankeintrag für ein erkanntes Gesicht samt Qualitätsbewertung an
+func (p *ImageProcessor) saveFace(img stdimage.Image, image *models.Image, face facerecognition.Face, detector string) (*models.Face, error) {
+	// BoundingBox Array auspacken [x_min, y_min, x_max, y_max]
+	if len(face.BoundingBox) < 4 {
+		return nil, fmt.Errorf("invalid bounding box format")
+	}
+	
+	// Bounding Box als JSON für die Datenbank vorbereiten
+	boundingBoxJSON, err := json.Marshal(map[string]interface{}{
+		"x_min": face.BoundingBox[0],
+		"y_min": face.BoundingBox[1],
+		"x_max": face.BoundingBox[2],
+		"y_max": face.BoundingBox[3],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bounding box data: %w", err)
+	}
+	
+	// Gesichter-DB-Eintrag erstellen
+	dbFace := models.Face{
+		ImageID:     image.ID,
+		BoundingBox: datatypes.JSON(boundingBoxJSON),
+		Confidence:  face.Confidence,
+		Detector:    detector,
+	}
+	if len(face.Embedding) > 0 {
+		dbFace.Embedding = models.EncodeVector(face.Embedding)
+		dbFace.EmbeddingProvider = string(face.EmbeddingProvider)
+		if dbFace.EmbeddingProvider == "" {
+			dbFace.EmbeddingProvider = detector
+		}
+	}
+	
+	quality := assessFaceQuality(img, face)
+	dbFace.Quality = quality.Score
+	
+	if err := p.db.Create(&dbFace).Error; err != nil {
+		return nil, fmt.Errorf("failed to create face record: %w", err)
+	}
+
+	log.Infof("Created face record ID: %d for image ID: %d (quality %.2f: size %.2f, confidence %.2f, sharpness %.2f, pose %.2f)",
+		dbFace.ID, image.ID, quality.Score, quality.Size, quality.Confidence, quality.Sharpness, quality.Pose)
+	
+	// Ausschnitt für Oberfläche und Home Assistant speichern; ohne Ausschnitt bleibt das Gesicht trotzdem erhalten
+	if img != nil {
+		cropPath, err := p.saveFaceCrop(img, image, &dbFace, face.BoundingBox)
+		if err != nil {
+			log.Warnf("Failed to save crop for face %d: %v", dbFace.ID, err)
+		} else if err := p.db.Model(&dbFace).Update("crop_path", cropPath).Error; err != nil {
+			log.Warnf("Failed to store crop path for face %d: %v", dbFace.ID, err)
+		} else {
+			dbFace.CropPath = cropPath
+		}
+	}
+	return &dbFace, nil
+}
+
+// clusterUnknownFace übergibt ein Gesicht ohne Treffer an das Clustering
+func (p *ImageProcessor) clusterUnknownFace(face *models.Face) {
+	if p.clusterer == nil || len(face.Embedding) == 0 {
+		return
+	}
+	if err := p.clusterer.AddFace(face); err != nil {
+		log.Warnf("Failed to cluster unknown face %d: %v", face.ID, err)
+	}
+}
+
+// saveMatches legt für jeden Treffer eines Gesichts einen Match-Eintrag an
+func (p *ImageProcessor) saveMatches(dbFace *models.Face, recognized []facerecognition.Match) []models.Match {
+	var matches []models.Match
+	
+	for _, match := range recognized {
+		identity, err := p.findOrCreateIdentity(match.SubjectID)
+		if err != nil {
+			log.Errorf("Failed to resolve identity '%s': %v", match.SubjectID, err)
+			continue
+		}
+		
+		// Match-Eintrag erstellen
+		matchRecord := models.Match{
+			FaceID:     dbFace.ID,
+			IdentityID: identity.ID,
+			Confidence: match.Similarity,
+		}
+		
+		if err := p.db.Create(&matchRecord).Error; err != nil {
+			log.Errorf("Failed to create match record: %v", err)
+			continue
+		}
+		matchRecord.Identity = *identity
+		
+		// Match zur Liste hinzufügen
+		matches = append(matches, matchRecord)
+		
+		log.Infof("Created match record ID: %d (face: %d, identity: %d, confidence: %.2f)", 
+			matchRecord.ID, matchRecord.FaceID, matchRecord.IdentityID, matchRecord.Confidence)
+	}
+	
+	return matches
+}
+
+// recognitionThreshold liefert den Ähnlichkeits-Schwellwert (0-1) für den angegebenen Provider.
+// Ein Schwellwert der Kamera hat Vorrang vor dem des Providers.
+func (p *ImageProcessor) recognitionThreshold(providerName facerecognition.ProviderType, camera string) float64 {
+	if rules, ok := p.cameraRules(camera); ok && rules.Threshold > 0 {
+		return rules.Threshold
+	}
+	threshold := 0.7 // Standard-Schwellwert
+	if providerName == facerecognition.ProviderCompreFace && p.cfg.CompreFace.SimilarityThreshold > 0 {
+		threshold = p.cfg.CompreFace.SimilarityThreshold / 100.0 // Umrechnung von Prozent (0-100) auf Dezimalwert (0-1)
+	} else if providerName == facerecognition.ProviderInsightFace && p.cfg.InsightFace.RecognitionThreshold > 0 {
+		threshold = p.cfg.InsightFace.RecognitionThreshold
+	}
+	return threshold
+}
+
+// findOrCreateIdentity sucht die Identität zu einer Subjekt-ID des Providers oder legt sie an
+func (p *ImageProcessor) findOrCreateIdentity(subjectID string) (*models.Identity, error) {
+	var identity models.Identity
+	
+	// Erst versuchen, vorhandene Identity zu finden (lokal angelegte Identitäten haben ggf. nur einen Namen)
+	err := p.db.Where("external_id = ? OR name = ?", subjectID, subjectID).First(&identity).Error
+	if err == nil {
+		return &identity, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to query identity: %w", err)
+	}
+	
+	// Neue Identity erstellen
+	identity = models.Identity{
+		Name:       subjectID, // SubjectID als Standardname verwenden
+		ExternalID: subjectID,
+	}
+	if err := p.db.Create(&identity).Error; err != nil {
+		return nil, fmt.Errorf("failed to create identity record: %w", err)
+	}
+	log.Infof("Created new identity record: %s (ID: %d)", identity.Name, identity.ID)
+	
+	return &identity, nil
+}
+
 // contains prüft, ob ein String in einem Slice enthalten ist
 func contains(s []string, e string) bool {
 	for _, a := range s {
@@ -466,6 +922,24 @@ func contains(s []string, e string) bool {
 	return false
 }
 
+// metadataStrings liest eine Liste von Strings aus den Metadaten. Nach dem Laden
+// eines Auftrags aus der Queue liegen Listen als []interface{} vor.
+func metadataStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
 // ProcessFrigateEvent verarbeitet ein Ereignis aus Frigate via MQTT
 // und erfasst mehrere Snapshots während des Ereignisses, nicht nur den letzten
 func (p *ImageProcessor) ProcessFrigateEvent(ctx context.Context, payload []byte) error {
@@ -503,7 +977,7 @@ func (p *ImageProcessor) ProcessFrigateEvent(ctx context.Context, payload []byte
 	switch event.Type {
 	case "new": 
 		// Neues Ereignis - mehrere Snapshots verarbeiten, wenn verfügbar
-		return p.processNewFrigateEvent(ctx, event)
+		return p.processNewFrigateEvent(ctx, event, PriorityNew)
 	case "update": 
 		// Update-Ereignis - Wir verarbeiten auch Updates, um mehr Bilder zu erfassen
 		return p.processUpdateFrigateEvent(ctx, event)
@@ -513,21 +987,57 @@ func (p *ImageProcessor) ProcessFrigateEvent(ctx context.Context, payload []byte
 	}
 }
 
-// processNewFrigateEvent verarbeitet ein neues Frigate-Ereignis und versucht,
-// möglichst frühe Snapshots zu erfassen, wenn die Person zur Kamera hinläuft
-func (p *ImageProcessor) processNewFrigateEvent(ctx context.Context, event *frigate.FrigateEvent) error {
-	// Prüfen, ob es ein Personen-Event ist (falls process_person_only aktiviert ist)
-	if p.cfg.Frigate.ProcessPersonOnly && !p.frigateClient.IsPersonEvent(event) {
-		log.Debug("Ignoriere Nicht-Personen-Event von Frigate")
-		return nil
+// IngestFrigateEvent verarbeitet ein über die Frigate-API abgerufenes Event wie ein
+// neues MQTT-Event. Nachgeholte Events (Backfill) werden mit niedriger Priorität verarbeitet.
+func (p *ImageProcessor) IngestFrigateEvent(ctx context.Context, eventData *frigate.FrigateEventData, backfill bool) error {
+	if p.frigateClient == nil {
+		p.frigateClient = frigate.NewFrigateClient(p.cfg.Frigate)
+	}
+
+	priority := PriorityNew
+	if backfill {
+		priority = PriorityBackfill
+	}
+	return p.processNewFrigateEvent(ctx, &frigate.FrigateEvent{Type: "new", After: eventData}, priority)
+}
+
+// ReprocessFrigateEvent erkennt alle gespeicherten Bilder eines Frigate-Events erneut,
+// z.B. nachdem eine neue Person angelernt wurde
+func (p *ImageProcessor) ReprocessFrigateEvent(ctx context.Context, eventID string) error {
+	var imageIDs []uint
+	if err := p.db.Model(&models.Image{}).
+		Where("source = ? AND event_id = ?", "frigate", eventID).
+		Pluck("id", &imageIDs).Error; err != nil {
+		return fmt.Errorf("failed to load images of event %s: %w", eventID, err)
+	}
+
+	var firstErr error
+	for _, imageID := range imageIDs {
+		if err := p.ReprocessImage(ctx, imageID); err != nil {
+			log.Warnf("Failed to reprocess image %d of event %s: %v", imageID, eventID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return firstErr
+}
 
+// processNewFrigateEvent verarbeitet ein neues Frigate-Ereignis und versucht,
+// möglichst frühe Snapshots zu erfassen, wenn die Person zur Kamera hinläuft
+func (p *ImageProcessor) processNewFrigateEvent(ctx context.Context, event *frigate.FrigateEvent, priority int) error {
 	// Extrahieren der Event-Daten (After hat Priorität)
 	eventData := p.frigateClient.GetEventData(event)
 	if eventData == nil {
 		return fmt.Errorf("keine Event-Daten im Frigate-Event gefunden")
 	}
 
+	// Globale und Kamera-Regeln prüfen (Label, Pause, Zeitfenster, Score, Zonen)
+	if ok, reason := p.acceptFrigateEvent(eventData); !ok {
+		log.Debugf("Ignoriere Frigate-Event %s von Kamera %s: %s", eventData.ID, eventData.Camera, reason)
+		return nil
+	}
+
 	// Prüfen, ob das Event einen Snapshot hat
 	if !eventData.HasSnapshot {
 		log.Debug("Ignoriere Frigate-Event ohne Snapshot")
@@ -622,6 +1132,7 @@ func (p *ImageProcessor) processNewFrigateEvent(ctx context.Context, event *frig
 			DetectFaces:    true,
 			RecognizeFaces: true,
 			Metadata:       imageMetadata,
+			Priority:       priority,
 		})
 		if processErr != nil {
 			log.Warnf("Fehler bei der Verarbeitung des Bildes %s: %v", fullPath, processErr)
@@ -665,12 +1176,6 @@ func (p *ImageProcessor) processNewFrigateEvent(ctx context.Context, event *frig
 // processUpdateFrigateEvent verarbeitet ein Update eines Frigate-Ereignisses
 // Updates können wichtig sein, weil sie oft bessere Bilder der Person enthalten
 func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *frigate.FrigateEvent) error {
-	// Prüfen, ob es ein Personen-Event ist (falls process_person_only aktiviert ist)
-	if p.cfg.Frigate.ProcessPersonOnly && !p.frigateClient.IsPersonEvent(event) {
-		log.Debug("Ignoriere Nicht-Personen-Update-Event von Frigate")
-		return nil
-	}
-
 	// Bei Updates interessieren uns insbesondere die After-Daten
 	if event.After == nil {
 		log.Debug("Ignoriere Frigate-Update-Event ohne After-Daten")
@@ -678,6 +1183,10 @@ func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *f
 	}
 
 	eventData := event.After
+	if ok, reason := p.acceptFrigateEvent(eventData); !ok {
+		log.Debugf("Ignoriere Frigate-Update-Event %s von Kamera %s: %s", eventData.ID, eventData.Camera, reason)
+		return nil
+	}
 	
 	// Prüfen, ob das Event einen Snapshot hat
 	if !eventData.HasSnapshot {
@@ -708,60 +1217,11 @@ func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *f
 		}
 	}
 	
-	// Wenn mehr als 5 Bilder für dieses Event existieren, nur die ältesten löschen, um Platz zu schaffen
-	if len(existingImages) >= 5 {
-		log.Infof("Für dieses Event existieren bereits %d Bilder. Begrenze auf maximal 5.", len(existingImages))
-		
-		// Bestimme, wie viele Bilder gelöscht werden müssen
-		excessCount := len(existingImages) - 4 // 5 - 1 für das neue Bild
-		if excessCount > 0 {
-			// Nimm die ältesten Bilder zum Löschen (die ersten 'excessCount' im Array)
-			var imagesToDelete []models.Image
-			var imageIDsToDelete []uint
-			
-			// Da wir keine Sortierung implementiert haben, nehmen wir einfach die ersten Einträge
-			// In einer vollständigen Implementierung würden wir nach Zeitstempel sortieren
-			for i := 0; i < excessCount; i++ {
-				imagesToDelete = append(imagesToDelete, existingImages[i])
-				imageIDsToDelete = append(imageIDsToDelete, existingImages[i].ID)
-			}
-			
-			// Finde alle Gesichter für diese zu löschenden Bilder
-			var faces []models.Face
-			if err := p.db.Where("image_id IN ?", imageIDsToDelete).Find(&faces).Error; err != nil {
-				log.Warnf("Fehler beim Laden zu löschender Gesichter: %v", err)
-			} else {
-				// Sammle alle Gesichts-IDs
-				var faceIDs []uint
-				for _, face := range faces {
-					faceIDs = append(faceIDs, face.ID)
-				}
-				
-				// Lösche alle Matches dieser Gesichter
-				if len(faceIDs) > 0 {
-					if err := p.db.Where("face_id IN ?", faceIDs).Delete(&models.Match{}).Error; err != nil {
-						log.Warnf("Fehler beim Löschen alter Matches: %v", err)
-					} else {
-						log.Infof("Alte Matches für %d Gesichter gelöscht", len(faceIDs))
-					}
-				}
-				
-				// Lösche die Gesichter der zu löschenden Bilder
-				if err := p.db.Where("image_id IN ?", imageIDsToDelete).Delete(&models.Face{}).Error; err != nil {
-					log.Warnf("Fehler beim Löschen alter Gesichter: %v", err)
-				} else {
-					log.Infof("Alte Gesichter für Event %s gelöscht", eventData.ID)
-				}
-			}
-			
-			// Lösche die überzähligen Bildeinträge
-			if err := p.db.Where("id IN ?", imageIDsToDelete).Delete(&models.Image{}).Error; err != nil {
-				log.Warnf("Fehler beim Löschen alter Bilder: %v", err)
-			} else {
-				log.Infof("Alte Bilder für Event %s gelöscht (%d Stück)", eventData.ID, len(imageIDsToDelete))
-			}
-		}
-	}
+	// Die Anzahl der Bilder je Event wird nach der Verarbeitung anhand der Gesichtsqualität
+	// begrenzt (siehe updateEventVerdict). Für eindeutige Dateinamen zählen auch bereits
+	// entfernte Bilder mit.
+	var sequence int64
+	p.db.Unscoped().Model(&models.Image{}).Where("source = ? AND event_id = ?", "frigate", eventData.ID).Count(&sequence)
 
 	// Früher: Limitierung auf max. 3 Bilder pro Event - jetzt entfernt
 	// Wir verarbeiten alle Updates, um mehr Bilder in der UI zu haben
@@ -774,7 +1234,7 @@ func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *f
 		"score":           eventData.Score,
 		"current_zones":   eventData.CurrentZones,
 		"entered_zones":   eventData.EnteredZones,
-		"update_number":   len(existingImages),
+		"update_number":   sequence,
 		"start_time":      eventData.GetStartTime().Format(time.RFC3339),
 		"frame_time":      eventData.GetCurrentTime().Format(time.RFC3339),
 		"source":          "frigate",
@@ -790,7 +1250,7 @@ func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *f
 		extension = "." + filenameParts[1]
 	}
 	// Sequenznummer basierend auf vorhandenen Bildern und sicherstellen, dass die Erweiterung vorhanden ist
-	filename := fmt.Sprintf("%s_update%d%s", baseName, len(existingImages), extension)
+	filename := fmt.Sprintf("%s_update%d%s", baseName, sequence, extension)
 	
 	// Explizit prüfen, ob die Dateiendung vorhanden ist
 	if !strings.HasSuffix(filename, ".jpg") {
@@ -823,24 +1283,18 @@ func (p *ImageProcessor) processUpdateFrigateEvent(ctx context.Context, event *f
 		}
 	*/
 
-	// Bild zur Verarbeitung an den Worker-Pool übergeben
-	// Dies stellt sicher, dass Karten erst nach der CompreFace-Verarbeitung erstellt werden
-	processedImage, processErr := p.ProcessImage(ctx, fullPath, "frigate", ProcessingOptions{
+	// Bild mit niedriger Priorität in die Queue stellen, ohne auf das Ergebnis zu warten,
+	// damit Bursts von Updates neue Events und den MQTT-Empfang nicht blockieren
+	if err := p.EnqueueImage(fullPath, "frigate", ProcessingOptions{
 		DetectFaces:    true,
 		RecognizeFaces: true,
 		Metadata:       metadata,
-	})
-	
-	if processErr != nil {
-		return fmt.Errorf("Fehler bei der Bildverarbeitung: %w", processErr)
-	} else if processedImage == nil {
-		// Wenn OpenCV aktiviert ist und keine Person erkannt wurde, wird nil zurückgegeben
-		// Das ist kein Fehler, sondern ein normaler Filterungsfall
-		log.Infof("Frigate Update-Event-Bild übersprungen (keine Person erkannt): %s", localPath)
-		return nil
+		Priority:       PriorityUpdate,
+	}); err != nil {
+		return fmt.Errorf("Fehler beim Einreihen des Bildes: %w", err)
 	}
 
-	log.Infof("Frigate Update-Event-Bild verarbeitet: %s", localPath)
+	log.Infof("Frigate Update-Event-Bild zur Verarbeitung eingereiht: %s", localPath)
 	return nil
 }
 
@@ -849,6 +1303,11 @@ func (p *ImageProcessor) SetHomeAssistantPublisher(publisher *homeassistant.Publ
 	p.haPublisher = publisher
 }
 
+// SetResultPublisher setzt den Publisher für die Ergebnis-Topics (auch ohne Home Assistant)
+func (p *ImageProcessor) SetResultPublisher(publisher *homeassistant.Publisher) {
+	p.resultPublisher = publisher
+}
+
 // GetHomeAssistantPublisher gibt den Home Assistant Publisher zurück
 func (p *ImageProcessor) GetHomeAssistantPublisher() *homeassistant.Publisher {
 	return p.haPublisher
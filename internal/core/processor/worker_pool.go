@@ -3,6 +3,8 @@ package processor
 import (
 	"double-take-go-reborn/internal/util/timezone"
 	"context"
+	"encoding/json"
+	"fmt"
 	"runtime"
 	"sync"
 	"time"
@@ -10,26 +12,53 @@ import (
 	"double-take-go-reborn/internal/core/models"
 
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-// WorkerPool verwaltet einen Pool von Worker-Goroutinen für die Bildverarbeitung
+// Prioritäten der Verarbeitungsaufträge. Höhere Werte werden zuerst verarbeitet.
+const (
+	PriorityReprocess = 0  // Wiederholungen aus der Reprocessing-Queue
+	PriorityBackfill  = 5  // Nachträglich über die Frigate-API übernommene Events
+	PriorityUpdate    = 10 // Update-Events von Frigate
+	PriorityNew       = 20 // Neue Frigate-Events, Webhooks und MQTT-Snapshots
+	PriorityManual    = 30 // Manuelle Verarbeitung über API oder Weboberfläche
+)
+
+// maxJobAttempts begrenzt die Versuche für Aufträge, die bei einem Absturz liefen
+const maxJobAttempts = 3
+
+// WorkerPool verwaltet einen Pool von Worker-Goroutinen für die Bildverarbeitung.
+// Aufträge werden in der Datenbank gespeichert, überleben so einen Neustart
+// und werden nach Priorität und Alter abgearbeitet.
 type WorkerPool struct {
-	processor      *ImageProcessor
-	jobs           chan *ProcessJob
-	results        chan *ProcessResult
-	workerCount    int
-	activeJobs     int
+	processor         *ImageProcessor
+	db                *gorm.DB
+	workerCount       int
+	pollInterval      time.Duration
+	drainTimeout      time.Duration
+	maxProcessingTime time.Duration
+
+	ctx    context.Context    // Basis-Kontext der Worker, wird nach Ablauf des Drain-Timeouts abgebrochen
+	cancel context.CancelFunc
+	notify chan struct{}      // Weckt wartende Worker bei neuen Aufträgen
+	drain  chan struct{}      // Geschlossen beim Herunterfahren: Queue abarbeiten, dann beenden
+	wg     sync.WaitGroup
+
+	startOnce sync.Once // Start darf die Worker nur einmal starten
+
+	claimMutex sync.Mutex // Serialisiert das Einreihen und Abholen von Aufträgen
+
+	waiters      map[uint]chan *ProcessResult // Ergebniskanäle synchron wartender Aufrufer
+	waitersMutex sync.Mutex
+	closed       bool
+
+	activeJobs      int
 	activeJobsMutex sync.Mutex
-	shutdown       chan struct{}
-}
 
-// ProcessJob repräsentiert einen Bildverarbeitungsjob
-type ProcessJob struct {
-	ctx       context.Context
-	imagePath string
-	source    string
-	options   ProcessingOptions
-	resultCh  chan *ProcessResult // Individueller Ergebniskanal pro Job
+	statsMutex        sync.Mutex
+	processedJobs     int64
+	avgWaitTime       time.Duration
+	avgProcessingTime time.Duration
 }
 
 // ProcessResult enthält das Ergebnis der Bildverarbeitung
@@ -38,121 +67,375 @@ type ProcessResult struct {
 	Err   error
 }
 
-// NewWorkerPool erstellt einen neuen Worker-Pool für die Bildverarbeitung
+// QueueStats enthält Kennzahlen der Verarbeitungs-Queue
+type QueueStats struct {
+	Depth             int64         // Anzahl wartender Aufträge
+	Failed            int64         // Anzahl fehlgeschlagener Aufträge
+	OldestWait        time.Duration // Wartezeit des ältesten wartenden Auftrags
+	AvgWaitTime       time.Duration // Gleitender Mittelwert der Wartezeit bis zur Verarbeitung
+	AvgProcessingTime time.Duration // Gleitender Mittelwert der Verarbeitungsdauer
+	ProcessedJobs     int64         // Seit dem Start verarbeitete Aufträge
+}
+
+// NewWorkerPool erstellt einen neuen Worker-Pool für die Bildverarbeitung.
+// Aufträge können sofort eingereiht werden, verarbeitet werden sie erst nach Start.
 func NewWorkerPool(processor *ImageProcessor) *WorkerPool {
-	// Container-bewusste Konfiguration: Verwende 75% der verfügbaren CPUs, mindestens 2
-	availableCPUs := runtime.NumCPU()
-	workerCount := max(2, (availableCPUs * 3) / 4)
-	
+	cfg := processor.cfg.Processor
+
+	workerCount := cfg.MaxWorkers
+	if workerCount <= 0 {
+		// Container-bewusste Konfiguration: Verwende 75% der verfügbaren CPUs, mindestens 2
+		availableCPUs := runtime.NumCPU()
+		workerCount = max(2, (availableCPUs * 3) / 4)
+	}
+
+	pollInterval := time.Duration(cfg.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+
 	log.Infof("Initializing image processing worker pool with %d workers", workerCount)
-	
+
+	ctx, cancel := context.WithCancel(context.Background())
 	pool := &WorkerPool{
-		processor:   processor,
-		jobs:        make(chan *ProcessJob, workerCount*2), // Puffer für Jobs
-		results:     make(chan *ProcessResult, workerCount*2), // Puffer für Ergebnisse
-		workerCount: workerCount,
-		shutdown:    make(chan struct{}),
-	}
-	
-	// Workers starten
-	pool.startWorkers()
-	
+		processor:         processor,
+		db:                processor.db,
+		workerCount:       workerCount,
+		pollInterval:      pollInterval,
+		drainTimeout:      time.Duration(cfg.DrainTimeout) * time.Second,
+		maxProcessingTime: time.Duration(cfg.MaxProcessingTime) * time.Second,
+		ctx:               ctx,
+		cancel:            cancel,
+		notify:            make(chan struct{}, workerCount),
+		drain:             make(chan struct{}),
+		waiters:           make(map[uint]chan *ProcessResult),
+	}
+
 	return pool
 }
 
+// Start setzt Aufträge fort, die beim letzten Beenden nicht abgeschlossen wurden,
+// und startet die Worker. Erst aufrufen, wenn der ImageProcessor vollständig
+// verdrahtet ist, da die Worker dessen Abhängigkeiten ohne Synchronisation lesen.
+func (p *WorkerPool) Start() {
+	p.startOnce.Do(func() {
+		p.recoverJobs()
+
+		// Workers starten
+		p.startWorkers()
+	})
+}
+
+// recoverJobs setzt Aufträge, die beim letzten Beenden noch liefen, in die Queue zurück
+func (p *WorkerPool) recoverJobs() {
+	// Aufträge, die wiederholt einen Absturz verursacht haben, nicht erneut versuchen
+	if err := p.db.Model(&models.ProcessingJob{}).
+		Where("status = ? AND attempts >= ?", models.JobStatusRunning, maxJobAttempts).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusFailed,
+			"last_error": "Verarbeitung wiederholt abgebrochen",
+		}).Error; err != nil {
+		log.Errorf("Failed to mark aborted processing jobs as failed: %v", err)
+	}
+
+	result := p.db.Model(&models.ProcessingJob{}).
+		Where("status = ?", models.JobStatusRunning).
+		Update("status", models.JobStatusQueued)
+	if result.Error != nil {
+		log.Errorf("Failed to requeue interrupted processing jobs: %v", result.Error)
+	}
+
+	// Fehlgeschlagene Aufträge nach Ablauf der Aufbewahrungsfrist entfernen
+	if days := p.processor.cfg.Cleanup.RetentionDays; days > 0 {
+		cutoff := timezone.Now().AddDate(0, 0, -days)
+		if err := p.db.Where("status = ? AND created_at < ?", models.JobStatusFailed, cutoff).
+			Delete(&models.ProcessingJob{}).Error; err != nil {
+			log.Errorf("Failed to delete old processing jobs: %v", err)
+		}
+	}
+
+	var pending int64
+	p.db.Model(&models.ProcessingJob{}).Where("status = ?", models.JobStatusQueued).Count(&pending)
+	if pending > 0 {
+		log.Infof("Resuming %d queued image processing jobs (%d interrupted)", pending, result.RowsAffected)
+	}
+}
+
 // startWorkers startet die Worker-Goroutinen
 func (p *WorkerPool) startWorkers() {
 	for i := 0; i < p.workerCount; i++ {
+		p.wg.Add(1)
 		go func(workerID int) {
+			defer p.wg.Done()
 			log.Debugf("Worker %d started", workerID)
-			
+
+			ticker := time.NewTicker(p.pollInterval)
+			defer ticker.Stop()
+
 			for {
+				// Nach Ablauf des Drain-Timeouts keine weiteren Aufträge annehmen
+				if p.ctx.Err() != nil {
+					log.Debugf("Worker %d stopped", workerID)
+					return
+				}
+
+				job, err := p.claimJob()
+				if err != nil {
+					log.Errorf("Worker %d: failed to fetch job from queue: %v", workerID, err)
+				}
+				if job != nil {
+					p.runJob(workerID, job)
+					continue
+				}
+
+				// Queue leer: beim Herunterfahren beenden, sonst auf neue Aufträge warten
 				select {
-				case job, ok := <-p.jobs:
-					if !ok {
-						log.Debugf("Worker %d shutting down (job channel closed)", workerID)
-						return
-					}
-					
-					// Job-Zähler erhöhen
-					p.activeJobsMutex.Lock()
-					p.activeJobs++
-					jobCount := p.activeJobs
-					p.activeJobsMutex.Unlock()
-					
-					log.Debugf("Worker %d processing image from %s (active jobs: %d)", 
-						workerID, job.source, jobCount)
-					
-					startTime := timezone.Now()
-					
-					// Bild verarbeiten
-					image, err := p.processor.processImageInternal(
-						job.ctx, job.imagePath, job.source, job.options)
-					
-					// Job-Zähler reduzieren
-					p.activeJobsMutex.Lock()
-					p.activeJobs--
-					p.activeJobsMutex.Unlock()
-					
-					// Ergebnis liefern
-					result := &ProcessResult{
-						Image: image,
-						Err:   err,
-					}
-					
-					// Direkt an den anfragenden Goroutine senden
-					select {
-					case job.resultCh <- result:
-						// Ergebnis erfolgreich gesendet
-					default:
-						log.Warnf("Worker %d: Could not send result, channel might be closed", workerID)
-					}
-					
-					elapsed := time.Since(startTime)
-					log.Infof("Worker %d completed image processing in %v", workerID, elapsed)
-					
-				case <-p.shutdown:
-					log.Debugf("Worker %d received shutdown signal", workerID)
+				case <-p.drain:
+					log.Debugf("Worker %d shutting down (queue drained)", workerID)
 					return
+				default:
+				}
+
+				select {
+				case <-p.notify:
+				case <-ticker.C:
+				case <-p.drain:
+				case <-p.ctx.Done():
 				}
 			}
 		}(i)
 	}
 }
 
-// ProcessImage verarbeitet ein Bild asynchron über den Worker-Pool
-func (p *WorkerPool) ProcessImage(ctx context.Context, imagePath, source string, 
+// claimJob holt den nächsten Auftrag mit der höchsten Priorität aus der Queue
+// und markiert ihn als laufend. Liefert nil, wenn die Queue leer ist.
+func (p *WorkerPool) claimJob() (*models.ProcessingJob, error) {
+	p.claimMutex.Lock()
+	defer p.claimMutex.Unlock()
+
+	var job models.ProcessingJob
+	err := p.db.Where("status = ?", models.JobStatusQueued).
+		Order("priority DESC, id ASC").
+		First(&job).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := timezone.Now()
+	job.Status = models.JobStatusRunning
+	job.StartedAt = &now
+	job.Attempts++
+	if err := p.db.Model(&job).Updates(map[string]interface{}{
+		"status":     job.Status,
+		"started_at": now,
+		"attempts":   job.Attempts,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// runJob verarbeitet einen Auftrag und liefert das Ergebnis an einen wartenden Aufrufer
+func (p *WorkerPool) runJob(workerID int, job *models.ProcessingJob) {
+	// Job-Zähler erhöhen
+	p.activeJobsMutex.Lock()
+	p.activeJobs++
+	jobCount := p.activeJobs
+	p.activeJobsMutex.Unlock()
+
+	log.Debugf("Worker %d processing job %d from %s (priority %d, active jobs: %d)",
+		workerID, job.ID, job.Source, job.Priority, jobCount)
+
+	startTime := timezone.Now()
+
+	var options ProcessingOptions
+	var image *models.Image
+	var err error
+	if len(job.Options) > 0 {
+		err = json.Unmarshal(job.Options, &options)
+		if err != nil {
+			err = fmt.Errorf("invalid job options: %w", err)
+		}
+	}
+
+	if err == nil {
+		ctx := p.ctx
+		var cancel context.CancelFunc
+		if p.maxProcessingTime > 0 {
+			ctx, cancel = context.WithTimeout(ctx, p.maxProcessingTime)
+		}
+
+		// Bild verarbeiten
+		image, err = p.processor.processImageInternal(ctx, job.ImagePath, job.Source, options)
+
+		if cancel != nil {
+			cancel()
+		}
+	}
+
+	// Job-Zähler reduzieren
+	p.activeJobsMutex.Lock()
+	p.activeJobs--
+	p.activeJobsMutex.Unlock()
+
+	elapsed := time.Since(startTime)
+	p.finishJob(job, image, err)
+	p.recordStats(startTime.Sub(job.CreatedAt), elapsed)
+
+	// Ergebnis an den anfragenden Goroutine senden, falls jemand wartet
+	p.waitersMutex.Lock()
+	resultCh, ok := p.waiters[job.ID]
+	delete(p.waiters, job.ID)
+	p.waitersMutex.Unlock()
+	if ok {
+		resultCh <- &ProcessResult{Image: image, Err: err}
+	}
+
+	if err != nil {
+		log.Warnf("Worker %d: job %d failed after %v: %v", workerID, job.ID, elapsed, err)
+	} else {
+		log.Infof("Worker %d completed image processing in %v", workerID, elapsed)
+	}
+}
+
+// finishJob entfernt erfolgreich verarbeitete Aufträge aus der Queue und
+// markiert fehlgeschlagene. Wurde die Verarbeitung durch das Herunterfahren
+// abgebrochen, bleibt der Auftrag für den nächsten Start in der Queue.
+func (p *WorkerPool) finishJob(job *models.ProcessingJob, image *models.Image, err error) {
+	if err == nil {
+		if dbErr := p.db.Delete(&models.ProcessingJob{}, job.ID).Error; dbErr != nil {
+			log.Errorf("Failed to remove finished processing job %d: %v", job.ID, dbErr)
+		}
+		return
+	}
+
+	updates := map[string]interface{}{
+		"last_error":  err.Error(),
+		"finished_at": timezone.Now(),
+		"status":      models.JobStatusFailed,
+	}
+	if p.ctx.Err() != nil {
+		updates["status"] = models.JobStatusQueued
+		updates["finished_at"] = nil
+	}
+	if image != nil {
+		updates["image_id"] = image.ID
+	}
+	if dbErr := p.db.Model(&models.ProcessingJob{}).Where("id = ?", job.ID).Updates(updates).Error; dbErr != nil {
+		log.Errorf("Failed to update processing job %d: %v", job.ID, dbErr)
+	}
+}
+
+// recordStats aktualisiert die gleitenden Mittelwerte für Warte- und Verarbeitungszeit
+func (p *WorkerPool) recordStats(wait, processing time.Duration) {
+	const alpha = 0.2
+
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+
+	if p.processedJobs == 0 {
+		p.avgWaitTime = wait
+		p.avgProcessingTime = processing
+	} else {
+		p.avgWaitTime = time.Duration(alpha*float64(wait) + (1-alpha)*float64(p.avgWaitTime))
+		p.avgProcessingTime = time.Duration(alpha*float64(processing) + (1-alpha)*float64(p.avgProcessingTime))
+	}
+	p.processedJobs++
+}
+
+// enqueue speichert einen Auftrag in der Queue und registriert optional einen Ergebniskanal
+func (p *WorkerPool) enqueue(imagePath, source string, options ProcessingOptions, resultCh chan *ProcessResult) (uint, error) {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode processing options: %w", err)
+	}
+
+	job := models.ProcessingJob{
+		ImagePath: imagePath,
+		Source:    source,
+		Options:   data,
+		Priority:  options.Priority,
+		Status:    models.JobStatusQueued,
+	}
+
+	// Einreihen und Registrieren des Ergebniskanals dürfen nicht vom Abholen unterbrochen werden
+	p.claimMutex.Lock()
+	p.waitersMutex.Lock()
+	if p.closed {
+		p.waitersMutex.Unlock()
+		p.claimMutex.Unlock()
+		return 0, fmt.Errorf("worker pool is shutting down")
+	}
+	err = p.db.Create(&job).Error
+	if err == nil && resultCh != nil {
+		p.waiters[job.ID] = resultCh
+	}
+	p.waitersMutex.Unlock()
+	p.claimMutex.Unlock()
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue image for processing: %w", err)
+	}
+
+	// Einen wartenden Worker wecken
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+
+	return job.ID, nil
+}
+
+// Enqueue reiht ein Bild zur Verarbeitung ein, ohne auf das Ergebnis zu warten
+func (p *WorkerPool) Enqueue(imagePath, source string, options ProcessingOptions) (uint, error) {
+	return p.enqueue(imagePath, source, options, nil)
+}
+
+// ProcessImage reiht ein Bild zur Verarbeitung ein und wartet auf das Ergebnis.
+// Bricht der Aufrufer ab, wird ein noch wartender Auftrag aus der Queue entfernt;
+// ein bereits laufender Auftrag wird zu Ende verarbeitet.
+func (p *WorkerPool) ProcessImage(ctx context.Context, imagePath, source string,
 	options ProcessingOptions) (*models.Image, error) {
-	
+
 	// Ergebniskanal für diesen spezifischen Job
 	resultCh := make(chan *ProcessResult, 1)
-	
-	// Job erstellen
-	job := &ProcessJob{
-		ctx:       ctx,
-		imagePath: imagePath,
-		source:    source,
-		options:   options,
-		resultCh:  resultCh,
-	}
-	
-	// Job an den Pool senden
-	select {
-	case p.jobs <- job:
-		// Job angenommen
-	case <-ctx.Done():
-		return nil, ctx.Err()
+
+	jobID, err := p.enqueue(imagePath, source, options, resultCh)
+	if err != nil {
+		return nil, err
 	}
-	
+
 	// Auf Ergebnis warten
 	select {
 	case result := <-resultCh:
 		return result.Image, result.Err
 	case <-ctx.Done():
+		p.cancelJob(jobID)
 		return nil, ctx.Err()
 	}
 }
 
+// cancelJob meldet den wartenden Aufrufer eines Auftrags ab und entfernt den Auftrag,
+// sofern er noch nicht abgeholt wurde
+func (p *WorkerPool) cancelJob(jobID uint) {
+	p.claimMutex.Lock()
+	defer p.claimMutex.Unlock()
+
+	p.waitersMutex.Lock()
+	delete(p.waiters, jobID)
+	p.waitersMutex.Unlock()
+
+	result := p.db.Where("id = ? AND status = ?", jobID, models.JobStatusQueued).Delete(&models.ProcessingJob{})
+	if result.Error != nil {
+		log.Errorf("Failed to cancel processing job %d: %v", jobID, result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Infof("Canceled queued processing job %d, the caller stopped waiting", jobID)
+	}
+}
+
 // ActiveJobCount gibt die Anzahl der aktuell aktiven Jobs zurück
 func (p *WorkerPool) ActiveJobCount() int {
 	p.activeJobsMutex.Lock()
@@ -165,15 +448,57 @@ func (p *WorkerPool) GetWorkerCount() int {
 	return p.workerCount
 }
 
-// GetQueueCapacity gibt die Kapazität der Job-Queue zurück
-func (p *WorkerPool) GetQueueCapacity() int {
-	return cap(p.jobs)
+// GetQueueStats liefert Tiefe und Latenz der Verarbeitungs-Queue
+func (p *WorkerPool) GetQueueStats() QueueStats {
+	var stats QueueStats
+
+	p.db.Model(&models.ProcessingJob{}).Where("status = ?", models.JobStatusQueued).Count(&stats.Depth)
+	p.db.Model(&models.ProcessingJob{}).Where("status = ?", models.JobStatusFailed).Count(&stats.Failed)
+
+	var oldest models.ProcessingJob
+	if err := p.db.Where("status = ?", models.JobStatusQueued).Order("created_at ASC").
+		Limit(1).Find(&oldest).Error; err == nil && oldest.ID != 0 {
+		stats.OldestWait = time.Since(oldest.CreatedAt)
+	}
+
+	p.statsMutex.Lock()
+	stats.AvgWaitTime = p.avgWaitTime
+	stats.AvgProcessingTime = p.avgProcessingTime
+	stats.ProcessedJobs = p.processedJobs
+	p.statsMutex.Unlock()
+
+	return stats
 }
 
-// Shutdown fährt den Worker-Pool herunter
+// Shutdown fährt den Worker-Pool herunter. Neue Aufträge werden abgelehnt, die
+// Queue wird bis zum Drain-Timeout abgearbeitet. Danach werden laufende Aufträge
+// abgebrochen; nicht verarbeitete Aufträge werden beim nächsten Start fortgesetzt.
 func (p *WorkerPool) Shutdown() {
-	close(p.shutdown)
-	close(p.jobs)
+	p.waitersMutex.Lock()
+	if p.closed {
+		p.waitersMutex.Unlock()
+		return
+	}
+	p.closed = true
+	p.waitersMutex.Unlock()
+
+	close(p.drain)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("Worker pool drained")
+	case <-time.After(p.drainTimeout):
+		log.Warnf("Worker pool not drained within %v, remaining jobs will resume on next start", p.drainTimeout)
+		p.cancel()
+		<-done
+	}
+	p.cancel()
 }
 
 // Hilfsfunktion max
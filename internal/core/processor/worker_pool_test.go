@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestProcessor liefert einen ImageProcessor mit einer leeren SQLite-Datenbank und
+// einem eigenen Snapshot-Verzeichnis
+func newTestProcessor(t *testing.T) *ImageProcessor {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.Image{},
+		&models.Face{},
+		&models.Identity{},
+		&models.Match{},
+		&models.PendingOperation{},
+		&models.ProcessingJob{},
+		&models.EventVerdict{},
+	); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	cfg := &config.Config{}
+	cfg.Server.SnapshotDir = dir
+	cfg.Processor.MaxWorkers = 1
+	return &ImageProcessor{db: db, cfg: cfg}
+}
+
+func TestProcessImageCancelsQueuedJob(t *testing.T) {
+	pool := NewWorkerPool(newTestProcessor(t))
+
+	// Ohne gestartete Worker bleibt der Auftrag in der Queue, bis der Aufrufer aufgibt
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.ProcessImage(ctx, "/snapshots/a.jpg", "api", ProcessingOptions{Priority: PriorityReprocess})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+
+	var count int64
+	pool.db.Model(&models.ProcessingJob{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("queued job of a caller that stopped waiting should be removed, %d left", count)
+	}
+	if len(pool.waiters) != 0 {
+		t.Fatalf("waiter should be removed, got %d", len(pool.waiters))
+	}
+}
+
+func TestCancelJobKeepsRunningJob(t *testing.T) {
+	pool := NewWorkerPool(newTestProcessor(t))
+
+	job := models.ProcessingJob{ImagePath: "/snapshots/a.jpg", Status: models.JobStatusRunning}
+	pool.db.Create(&job)
+	pool.waiters[job.ID] = make(chan *ProcessResult, 1)
+
+	pool.cancelJob(job.ID)
+
+	var stored models.ProcessingJob
+	if err := pool.db.First(&stored, job.ID).Error; err != nil {
+		t.Fatalf("running job should be kept: %v", err)
+	}
+	if _, ok := pool.waiters[job.ID]; ok {
+		t.Fatal("waiter should be removed")
+	}
+}
+
+func TestReprocessImageSkipsImageWithActiveJob(t *testing.T) {
+	p := newTestProcessor(t)
+
+	if err := os.WriteFile(filepath.Join(p.cfg.Server.SnapshotDir, "a.jpg"), []byte("jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	image := models.Image{FilePath: "a.jpg", Source: "frigate"}
+	p.db.Create(&image)
+	face := models.Face{ImageID: image.ID}
+	p.db.Create(&face)
+	p.db.Create(&models.ProcessingJob{
+		ImagePath: filepath.Join(p.cfg.Server.SnapshotDir, "a.jpg"),
+		Status:    models.JobStatusRunning,
+	})
+
+	err := p.ReprocessImage(context.Background(), image.ID)
+	if !errors.Is(err, ErrAlreadyProcessing) {
+		t.Fatalf("got %v, want ErrAlreadyProcessing", err)
+	}
+
+	var jobs, faces int64
+	p.db.Model(&models.ProcessingJob{}).Count(&jobs)
+	p.db.Model(&models.Face{}).Count(&faces)
+	if jobs != 1 || faces != 1 {
+		t.Fatalf("no second job may be queued and faces must be kept, got %d jobs and %d faces", jobs, faces)
+	}
+}
+
+func TestClaimJobOrdersByPriorityThenAge(t *testing.T) {
+	pool := NewWorkerPool(newTestProcessor(t))
+
+	// Eingereiht in umgekehrter Reihenfolge, jede Priorität zweimal
+	priorities := []int{PriorityReprocess, PriorityBackfill, PriorityUpdate, PriorityNew, PriorityManual}
+	var want []uint
+	ids := make(map[int][]uint)
+	for round := 0; round < 2; round++ {
+		for _, priority := range priorities {
+			id, err := pool.Enqueue("/snapshots/a.jpg", "api", ProcessingOptions{Priority: priority})
+			if err != nil {
+				t.Fatalf("failed to enqueue: %v", err)
+			}
+			ids[priority] = append(ids[priority], id)
+		}
+	}
+	for i := len(priorities) - 1; i >= 0; i-- {
+		want = append(want, ids[priorities[i]]...)
+	}
+
+	for i, wantID := range want {
+		job, err := pool.claimJob()
+		if err != nil || job == nil {
+			t.Fatalf("claim %d: got %v, %v", i, job, err)
+		}
+		if job.ID != wantID {
+			t.Fatalf("claim %d: got job %d (priority %d), want job %d", i, job.ID, job.Priority, wantID)
+		}
+		if job.Status != models.JobStatusRunning || job.Attempts != 1 || job.StartedAt == nil {
+			t.Fatalf("claimed job should be running with one attempt, got %+v", job)
+		}
+	}
+
+	if job, err := pool.claimJob(); job != nil || err != nil {
+		t.Fatalf("empty queue should return nil, got %+v, %v", job, err)
+	}
+}
+
+func TestRecoverJobs(t *testing.T) {
+	pool := NewWorkerPool(newTestProcessor(t))
+
+	jobs := []models.ProcessingJob{
+		{ImagePath: "interrupted.jpg", Status: models.JobStatusRunning, Attempts: 1},
+		{ImagePath: "retried.jpg", Status: models.JobStatusRunning, Attempts: maxJobAttempts - 1},
+		{ImagePath: "crashing.jpg", Status: models.JobStatusRunning, Attempts: maxJobAttempts},
+		{ImagePath: "queued.jpg", Status: models.JobStatusQueued},
+		{ImagePath: "failed.jpg", Status: models.JobStatusFailed, Attempts: 1},
+	}
+	for i := range jobs {
+		pool.db.Create(&jobs[i])
+	}
+
+	pool.recoverJobs()
+
+	want := map[string]string{
+		"interrupted.jpg": models.JobStatusQueued,
+		"retried.jpg":     models.JobStatusQueued,
+		"crashing.jpg":    models.JobStatusFailed,
+		"queued.jpg":      models.JobStatusQueued,
+		"failed.jpg":      models.JobStatusFailed,
+	}
+	for _, job := range jobs {
+		var stored models.ProcessingJob
+		if err := pool.db.First(&stored, job.ID).Error; err != nil {
+			t.Fatalf("job %s: %v", job.ImagePath, err)
+		}
+		if stored.Status != want[job.ImagePath] {
+			t.Fatalf("job %s: got status %q, want %q", job.ImagePath, stored.Status, want[job.ImagePath])
+		}
+	}
+
+	// Ein erneut abgeholter Auftrag zählt den Versuch weiter, bis er aufgegeben wird
+	pool.db.Model(&models.ProcessingJob{}).Where("image_path <> ?", "retried.jpg").Delete(&models.ProcessingJob{})
+	job, err := pool.claimJob()
+	if err != nil || job == nil || job.Attempts != maxJobAttempts {
+		t.Fatalf("got %+v, %v, want retried job with %d attempts", job, err, maxJobAttempts)
+	}
+	pool.recoverJobs()
+	var stored models.ProcessingJob
+	pool.db.First(&stored, job.ID)
+	if stored.Status != models.JobStatusFailed || stored.LastError == "" {
+		t.Fatalf("job interrupted %d times should be given up, got %+v", maxJobAttempts, stored)
+	}
+}
@@ -73,7 +73,20 @@ func Initialize(cfg *config.Config) error {
 		&models.Face{},
 		&models.Identity{},
 		&models.Match{},
+		&models.ProviderScore{},
 		&models.PendingOperation{},
+		&models.FaceEmbedding{},
+		&models.ProcessingJob{},
+		&models.EventVerdict{},
+		&models.IngestCursor{},
+		&models.User{},
+		&models.APIToken{},
+		&models.APIRequestLog{},
+		&models.AuditEntry{},
+		&models.TrainingExample{},
+		&models.FaceCluster{},
+		&models.PresenceSession{},
+		&models.CameraState{},
 	); err != nil {
 		log.Errorf("Database migration failed: %v", err)
 		return fmt.Errorf("database migration failed: %w", err)
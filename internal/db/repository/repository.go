@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"time"
 
 	"double-take-go-reborn/internal/core/models"
 
@@ -38,6 +39,8 @@ type Repository interface {
 
 	// Statistik-Methoden
 	GetStatistics() (models.Statistics, error)
+	GetIdentitySightings(identityID uint, filter SightingFilter) ([]models.Sighting, error)
+	GetIdentityStatistics(identityID uint, filter SightingFilter, loc *time.Location) (models.IdentityStatistics, error)
 }
 
 // SQLiteRepository implementiert die Repository-Schnittstelle für SQLite
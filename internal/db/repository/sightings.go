@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+
+	"gorm.io/gorm"
+)
+
+// SightingFilter schränkt Sichtungen auf einen Zeitraum und Kameras ein
+type SightingFilter struct {
+	Since   time.Time // Nur Aufnahmen ab diesem Zeitpunkt (optional)
+	Until   time.Time // Nur Aufnahmen bis zu diesem Zeitpunkt (optional)
+	Cameras []string  // Nur Aufnahmen dieser Kameras (optional)
+}
+
+// sightingRow ist ein Treffer einer Identität samt Aufnahmedaten
+type sightingRow struct {
+	FaceID     uint
+	ImageID    uint
+	Confidence float64
+	Timestamp  time.Time
+	Source     string
+	Zone       string
+	EventID    string
+}
+
+// GetIdentitySightings gibt die Sichtungen einer Identität zurück, neueste zuerst.
+// Treffer desselben Frigate-Events werden zu einer Sichtung zusammengefasst.
+func (r *SQLiteRepository) GetIdentitySightings(identityID uint, filter SightingFilter) ([]models.Sighting, error) {
+	rows, err := r.identityMatchRows(identityID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var sightings []models.Sighting
+	byKey := make(map[string]int)
+	for _, row := range rows {
+		key := "event:" + row.EventID
+		if row.EventID == "" {
+			key = fmt.Sprintf("image:%d", row.ImageID)
+		}
+
+		index, ok := byKey[key]
+		if !ok {
+			index = len(sightings)
+			byKey[key] = index
+			sightings = append(sightings, models.Sighting{
+				EventID: row.EventID,
+				Camera:  row.Source,
+				Start:   row.Timestamp,
+				End:     row.Timestamp,
+			})
+		}
+
+		sighting := &sightings[index]
+		sighting.Detections++
+		if row.Timestamp.Before(sighting.Start) {
+			sighting.Start = row.Timestamp
+		}
+		if row.Timestamp.After(sighting.End) {
+			sighting.End = row.Timestamp
+		}
+		if row.Confidence > sighting.BestConfidence || sighting.FaceID == 0 {
+			sighting.BestConfidence = row.Confidence
+			sighting.FaceID = row.FaceID
+			sighting.ImageID = row.ImageID
+		}
+		for _, zone := range strings.Split(row.Zone, ",") {
+			if zone = strings.TrimSpace(zone); zone != "" && !containsString(sighting.Zones, zone) {
+				sighting.Zones = append(sighting.Zones, zone)
+			}
+		}
+	}
+
+	sort.SliceStable(sightings, func(i, j int) bool {
+		return sightings[i].Start.After(sightings[j].Start)
+	})
+	return sightings, nil
+}
+
+// GetIdentityStatistics berechnet die Sichtungsstatistik einer Identität. Tage und
+// Stunden werden in der übergebenen Zeitzone gezählt.
+func (r *SQLiteRepository) GetIdentityStatistics(identityID uint, filter SightingFilter, loc *time.Location) (models.IdentityStatistics, error) {
+	stats := models.IdentityStatistics{IdentityID: identityID}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// Durchschnitt und Anzahl über alle Treffer
+	var totals struct {
+		Detections        int64
+		AverageConfidence float64
+	}
+	err := r.identityMatchQuery(identityID, filter).
+		Select("COUNT(*) AS detections, COALESCE(AVG(matches.confidence), 0) AS average_confidence").
+		Scan(&totals).Error
+	if err != nil {
+		return stats, fmt.Errorf("fehler beim Berechnen der Treffer: %w", err)
+	}
+	stats.Detections = totals.Detections
+	stats.AverageConfidence = totals.AverageConfidence
+
+	sightings, err := r.GetIdentitySightings(identityID, filter)
+	if err != nil {
+		return stats, err
+	}
+	stats.Sightings = int64(len(sightings))
+
+	perDay := make(map[string]int64)
+	perCamera := make(map[string]int64)
+	perZone := make(map[string]int64)
+	for i := range sightings {
+		sighting := &sightings[i]
+		if stats.FirstSeen == nil || sighting.Start.Before(*stats.FirstSeen) {
+			stats.FirstSeen = &sighting.Start
+		}
+		if stats.LastSeen == nil || sighting.End.After(*stats.LastSeen) {
+			stats.LastSeen = &sighting.End
+		}
+
+		local := sighting.Start.In(loc)
+		perDay[local.Format("2006-01-02")]++
+		stats.PerHour[local.Hour()]++
+		if sighting.Camera != "" {
+			perCamera[sighting.Camera]++
+		}
+		for _, zone := range sighting.Zones {
+			perZone[zone]++
+		}
+	}
+
+	stats.PerDay = buckets(perDay)
+	sort.Slice(stats.PerDay, func(i, j int) bool { return stats.PerDay[i].Key < stats.PerDay[j].Key })
+	stats.PerCamera = sortedByCount(buckets(perCamera))
+	stats.PerZone = sortedByCount(buckets(perZone))
+	return stats, nil
+}
+
+// identityMatchRows lädt alle Treffer einer Identität samt Aufnahmedaten, älteste zuerst
+func (r *SQLiteRepository) identityMatchRows(identityID uint, filter SightingFilter) ([]sightingRow, error) {
+	var rows []sightingRow
+	err := r.identityMatchQuery(identityID, filter).
+		Select("matches.face_id, faces.image_id, matches.confidence, images.timestamp, images.source, images.zone, images.event_id").
+		Order("images.timestamp ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Sichtungen: %w", err)
+	}
+	return rows, nil
+}
+
+// identityMatchQuery baut die Abfrage auf die nicht gelöschten Treffer einer Identität
+func (r *SQLiteRepository) identityMatchQuery(identityID uint, filter SightingFilter) *gorm.DB {
+	query := r.db.Model(&models.Match{}).
+		Joins("JOIN faces ON faces.id = matches.face_id AND faces.deleted_at IS NULL").
+		Joins("JOIN images ON images.id = faces.image_id AND images.deleted_at IS NULL").
+		Where("matches.identity_id = ?", identityID)
+	if !filter.Since.IsZero() {
+		query = query.Where("images.timestamp >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("images.timestamp <= ?", filter.Until)
+	}
+	if len(filter.Cameras) > 0 {
+		query = query.Where("images.source IN ?", filter.Cameras)
+	}
+	return query
+}
+
+// buckets wandelt eine Zählung in eine Liste um
+func buckets(counts map[string]int64) []models.CountBucket {
+	result := make([]models.CountBucket, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, models.CountBucket{Key: key, Count: count})
+	}
+	return result
+}
+
+// sortedByCount sortiert Zähler absteigend, bei Gleichstand nach Namen
+func sortedByCount(result []models.CountBucket) []models.CountBucket {
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// containsString prüft, ob ein Wert in der Liste enthalten ist
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
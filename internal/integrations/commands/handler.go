@@ -0,0 +1,509 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/core/processor"
+	"double-take-go-reborn/internal/integrations/compreface"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+	"double-take-go-reborn/internal/integrations/frigate"
+	"double-take-go-reborn/internal/integrations/homeassistant"
+	"double-take-go-reborn/internal/integrations/mqtt"
+	"double-take-go-reborn/internal/services/cleanup"
+	"double-take-go-reborn/internal/util/timezone"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Grenzen für Befehle, die Bilder herunterladen und verarbeiten
+const (
+	commandTimeout      = 2 * time.Minute
+	commandFetchTimeout = 10 * time.Second
+	commandMaxImageSize = 10 * 1024 * 1024
+	commandSnapshotDir  = "mqtt"
+	commandImageSource  = "mqtt"
+	commandMaxRedirects = 10
+)
+
+// unsafeFileChars enthält alle Zeichen, die nicht in Dateinamen übernommen werden
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// CommandRequest ist die Nutzlast eines Befehls. Statt JSON kann auch einfacher Text
+// gesendet werden (z.B. eine URL, ein Kameraname oder "ON"/"OFF"), der in Value landet.
+type CommandRequest struct {
+	ID            string `json:"id"`              // Wird in der Antwort zurückgegeben
+	URL           string `json:"url"`             // recognize: Bild-URL
+	Camera        string `json:"camera"`          // recognize, pause, resume: Kamera
+	Provider      string `json:"provider"`        // provider: Name des Diensts
+	OlderThanDays int    `json:"older_than_days"` // purge: Bilder löschen, die älter sind
+	All           bool   `json:"all"`             // purge: alle Bilder löschen
+	Value         string `json:"-"`
+}
+
+// CommandResponse wird nach jedem Befehl auf <topic_prefix>/response/<befehl> veröffentlicht
+type CommandResponse struct {
+	ID        string      `json:"id,omitempty"`
+	Command   string      `json:"command"`
+	Success   bool        `json:"success"`
+	Message   string      `json:"message,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Timestamp string      `json:"timestamp"`
+}
+
+// RecognitionResult ist das Ergebnis des Befehls recognize
+type RecognitionResult struct {
+	ImageID uint              `json:"image_id"`
+	Camera  string            `json:"camera,omitempty"`
+	Faces   int               `json:"faces"`
+	Matches []RecognizedMatch `json:"matches"`
+}
+
+// RecognizedMatch ist eine im Bild erkannte Identität
+type RecognizedMatch struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Handler führt Befehle aus, die über <topic_prefix>/cmd/<befehl>[/<argument>]
+// eingehen, z.B. aus Home Assistant, und meldet das Ergebnis auf <topic_prefix>/response/<befehl>
+type Handler struct {
+	db              *gorm.DB
+	cfg             *config.Config
+	mqttClient      *mqtt.Client
+	processor       *processor.ImageProcessor
+	providerManager *facerecognition.ProviderManager
+	compreface      *compreface.APIClient
+	frigateClient   *frigate.FrigateClient
+	cleanup         *cleanup.CleanupService
+	httpClient      *http.Client
+	allowedHosts    []string // Hosts, von denen recognize Bilder laden darf
+	prefix          string
+}
+
+// NewHandler erstellt einen neuen Handler für MQTT-Befehle
+func NewHandler(db *gorm.DB, cfg *config.Config, mqttClient *mqtt.Client, imageProcessor *processor.ImageProcessor, compreFaceClient *compreface.APIClient, frigateClient *frigate.FrigateClient) *Handler {
+	h := &Handler{
+		db:              db,
+		cfg:             cfg,
+		mqttClient:      mqttClient,
+		processor:       imageProcessor,
+		providerManager: imageProcessor.GetProviderManager(),
+		compreface:      compreFaceClient,
+		frigateClient:   frigateClient,
+		allowedHosts:    allowedImageHosts(cfg, frigateClient),
+		prefix:          mqttClient.TopicPrefix(),
+	}
+	h.httpClient = &http.Client{Timeout: commandFetchTimeout, CheckRedirect: h.checkRedirect}
+	return h
+}
+
+// allowedImageHosts liefert den Frigate-Host und mqtt.commands.allowed_hosts in Kleinschreibung
+func allowedImageHosts(cfg *config.Config, frigateClient *frigate.FrigateClient) []string {
+	var hosts []string
+	if frigateClient != nil {
+		if hostURL, err := frigateClient.HostURL(); err == nil {
+			if parsed, err := url.Parse(hostURL); err == nil && parsed.Host != "" {
+				hosts = append(hosts, strings.ToLower(parsed.Host))
+			}
+		}
+	}
+	for _, host := range cfg.MQTT.Commands.AllowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// imageHostAllowed prüft, ob recognize von einer URL laden darf. Ein erlaubter Host ohne
+// Port gilt für alle Ports, mit Port nur für diesen.
+func (h *Handler) imageHostAllowed(imageURL *url.URL) bool {
+	host, hostname := strings.ToLower(imageURL.Host), strings.ToLower(imageURL.Hostname())
+	for _, allowed := range h.allowedHosts {
+		if allowed == host || allowed == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect folgt Weiterleitungen nur zu erlaubten Hosts
+func (h *Handler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= commandMaxRedirects {
+		return errors.New("stopped after too many redirects")
+	}
+	if !h.imageHostAllowed(req.URL) {
+		return fmt.Errorf("redirect to host %s is not allowed", req.URL.Host)
+	}
+	return nil
+}
+
+// SetCleanupService setzt den Dienst, mit dem der Befehl purge Bilder löscht
+func (h *Handler) SetCleanupService(cleanupService *cleanup.CleanupService) {
+	h.cleanup = cleanupService
+}
+
+// Subscribe abonniert alle Befehls-Topics
+func (h *Handler) Subscribe() error {
+	return h.mqttClient.Subscribe(h.prefix + "/cmd/#")
+}
+
+// Matches prüft, ob ein Topic ein Befehl ist
+func (h *Handler) Matches(topic string) bool {
+	return strings.HasPrefix(topic, h.prefix+"/cmd/")
+}
+
+// CameraPaused implementiert homeassistant.CommandState
+func (h *Handler) CameraPaused(camera string) bool {
+	return h.processor.CameraPaused(camera)
+}
+
+// ProviderNames implementiert homeassistant.CommandState
+func (h *Handler) ProviderNames() []string {
+	if h.providerManager == nil {
+		return nil
+	}
+	var names []string
+	for _, provider := range h.providerManager.GetProviders() {
+		names = append(names, string(provider.GetProviderName()))
+	}
+	return names
+}
+
+// ActiveProvider implementiert homeassistant.CommandState
+func (h *Handler) ActiveProvider() string {
+	if h.providerManager == nil {
+		return ""
+	}
+	return string(h.providerManager.GetActiveProviderName())
+}
+
+// HandleCommand führt einen Befehl aus und veröffentlicht die Antwort
+func (h *Handler) HandleCommand(topic string, payload []byte) {
+	parts := strings.SplitN(strings.TrimPrefix(topic, h.prefix+"/cmd/"), "/", 2)
+	command := parts[0]
+	argument := ""
+	if len(parts) > 1 {
+		argument = parts[1]
+	}
+
+	response := CommandResponse{Command: command}
+	req, err := parseCommandRequest(payload)
+	if err == nil {
+		response.ID = req.ID
+		log.Infof("Executing MQTT command %s %s", command, argument)
+
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		response.Message, response.Data, err = h.execute(ctx, command, argument, req)
+		cancel()
+	}
+
+	response.Success = err == nil
+	if err != nil {
+		log.Warnf("MQTT command %s failed: %v", command, err)
+		response.Error = err.Error()
+	}
+	response.Timestamp = timezone.Now().Format(time.RFC3339)
+
+	if err := h.mqttClient.PublishAs(mqtt.ClassResponses, homeassistant.ResponseTopic(h.prefix, command), response); err != nil {
+		log.Errorf("Failed to publish response to MQTT command %s: %v", command, err)
+	}
+}
+
+// execute führt einen Befehl aus und gibt Meldung und Ergebnisdaten zurück
+func (h *Handler) execute(ctx context.Context, command, argument string, req CommandRequest) (string, interface{}, error) {
+	switch command {
+	case homeassistant.CommandRecognize:
+		return h.recognize(ctx, req)
+	case homeassistant.CommandPause, homeassistant.CommandResume:
+		return h.pause(command, argument, req)
+	case homeassistant.CommandProvider:
+		return h.switchProvider(argument, req)
+	case homeassistant.CommandSync:
+		return h.syncCompreFace(ctx)
+	case homeassistant.CommandPurge:
+		return h.purge(ctx, req)
+	default:
+		return "", nil, fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+// recognize lädt das Bild einer URL oder den aktuellen Frigate-Schnappschuss einer Kamera
+// und erkennt die Gesichter darin. Angehaltene Kameras werden dabei trotzdem verarbeitet.
+// URLs sind nur vom Frigate-Host und aus mqtt.commands.allowed_hosts erlaubt.
+func (h *Handler) recognize(ctx context.Context, req CommandRequest) (string, interface{}, error) {
+	imageURL, camera := req.URL, req.Camera
+	if imageURL == "" && camera == "" {
+		if strings.HasPrefix(req.Value, "http://") || strings.HasPrefix(req.Value, "https://") {
+			imageURL = req.Value
+		} else {
+			camera = req.Value
+		}
+	}
+	if imageURL == "" && camera == "" {
+		return "", nil, fmt.Errorf("url or camera is required")
+	}
+
+	detectedAt := timezone.Now()
+	name := camera
+	if name == "" {
+		name = "url"
+	}
+	filename := fmt.Sprintf("%s_%s", detectedAt.Format("20060102-150405"), unsafeFileChars.ReplaceAllString(name, "_"))
+	basePath := filepath.Join(h.cfg.Server.SnapshotDir, commandSnapshotDir, filename)
+
+	var fullPath string
+	var err error
+	if imageURL != "" {
+		fullPath, err = h.downloadImage(ctx, imageURL, basePath)
+	} else {
+		fullPath, err = h.downloadCameraSnapshot(camera, basePath)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	metadata := map[string]interface{}{
+		"source":      commandImageSource,
+		"detected_at": detectedAt.Format(time.RFC3339),
+	}
+	if camera != "" {
+		metadata["camera"] = camera
+	}
+	image, err := h.processor.ProcessImage(ctx, fullPath, commandImageSource, processor.ProcessingOptions{
+		DetectFaces:    true,
+		RecognizeFaces: true,
+		Metadata:       metadata,
+		Priority:       processor.PriorityManual,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to process image: %w", err)
+	}
+	if image == nil {
+		// Die Vorfilterung hat keine Person erkannt, das Bild wurde nicht gespeichert
+		os.Remove(fullPath)
+		return "No person detected", RecognitionResult{Camera: camera, Matches: []RecognizedMatch{}}, nil
+	}
+
+	var faces []models.Face
+	if err := h.db.Preload("Matches.Identity").Where("image_id = ?", image.ID).Find(&faces).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to load recognition result: %w", err)
+	}
+	result := RecognitionResult{ImageID: image.ID, Camera: camera, Faces: len(faces), Matches: []RecognizedMatch{}}
+	for _, face := range faces {
+		for _, match := range face.Matches {
+			result.Matches = append(result.Matches, RecognizedMatch{Name: match.Identity.Name, Confidence: match.Confidence})
+		}
+	}
+
+	return fmt.Sprintf("Recognized %d of %d faces", len(result.Matches), result.Faces), result, nil
+}
+
+// downloadImage lädt ein Bild per HTTP(S) herunter und speichert es mit passender Endung
+func (h *Handler) downloadImage(ctx context.Context, imageURL, basePath string) (string, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("invalid image url: %s", imageURL)
+	}
+	if !h.imageHostAllowed(parsed) {
+		return "", fmt.Errorf("host %s is not allowed, add it to mqtt.commands.allowed_hosts", parsed.Host)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := h.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image from %s: %w", parsed.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, parsed.Host)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, commandMaxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) > commandMaxImageSize {
+		return "", fmt.Errorf("image exceeds the maximum size of %d bytes", commandMaxImageSize)
+	}
+
+	var fullPath string
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		fullPath = basePath + ".jpg"
+	case "image/png":
+		fullPath = basePath + ".png"
+	default:
+		return "", fmt.Errorf("unsupported image format")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+	return fullPath, nil
+}
+
+// downloadCameraSnapshot lädt das aktuelle Bild einer Kamera aus Frigate
+func (h *Handler) downloadCameraSnapshot(camera, basePath string) (string, error) {
+	if h.frigateClient == nil {
+		return "", fmt.Errorf("frigate integration is disabled")
+	}
+
+	fullPath := basePath + ".jpg"
+	if err := h.frigateClient.DownloadSnapshot(fmt.Sprintf("/api/%s/latest.jpg", url.PathEscape(camera)), fullPath); err != nil {
+		return "", fmt.Errorf("failed to fetch snapshot of camera %s: %w", camera, err)
+	}
+	return fullPath, nil
+}
+
+// pause hält die Verarbeitung einer Kamera an oder setzt sie fort. Die Kamera steht im
+// Topic (cmd/pause/<kamera>) oder in der Nutzlast; bei cmd/pause/<kamera> entscheidet die
+// Nutzlast: "ON" hält an, "OFF" setzt fort (wie ein Schalter in Home Assistant).
+func (h *Handler) pause(command, argument string, req CommandRequest) (string, interface{}, error) {
+	camera := argument
+	paused := command == homeassistant.CommandPause
+	if camera == "" {
+		camera = req.Camera
+		if camera == "" {
+			camera = req.Value
+		}
+	} else if paused {
+		switch strings.ToLower(req.Value) {
+		case "", "on", "true", "1", "pause":
+		case "off", "false", "0", "resume":
+			paused = false
+		default:
+			return "", nil, fmt.Errorf("invalid payload %q, expected ON or OFF", req.Value)
+		}
+	}
+	if camera == "" {
+		return "", nil, fmt.Errorf("camera is required")
+	}
+
+	if err := h.processor.SetCameraPaused(camera, paused); err != nil {
+		return "", nil, err
+	}
+
+	state := "OFF"
+	message := fmt.Sprintf("Processing for camera %s resumed", camera)
+	if paused {
+		state = "ON"
+		message = fmt.Sprintf("Processing for camera %s paused", camera)
+	}
+	if err := h.mqttClient.PublishAs(mqtt.ClassState, homeassistant.CameraPausedTopic(h.prefix, camera), state); err != nil {
+		log.Warnf("Failed to publish pause state of camera %s: %v", camera, err)
+	}
+	return message, map[string]interface{}{"camera": camera, "paused": paused}, nil
+}
+
+// switchProvider wechselt den primären Gesichtserkennungsdienst bis zum nächsten Neustart
+func (h *Handler) switchProvider(argument string, req CommandRequest) (string, interface{}, error) {
+	if h.providerManager == nil {
+		return "", nil, fmt.Errorf("no face recognition providers available")
+	}
+
+	name := argument
+	if name == "" {
+		name = req.Provider
+		if name == "" {
+			name = req.Value
+		}
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !h.providerManager.SetActiveProvider(facerecognition.ProviderType(name)) {
+		return "", nil, fmt.Errorf("unknown provider %q, available: %s", name, strings.Join(h.ProviderNames(), ", "))
+	}
+
+	if err := h.mqttClient.PublishAs(mqtt.ClassState, homeassistant.ProviderTopic(h.prefix), name); err != nil {
+		log.Warnf("Failed to publish active provider: %v", err)
+	}
+	return fmt.Sprintf("Active provider switched to %s", name), map[string]interface{}{"provider": name}, nil
+}
+
+// syncCompreFace gleicht die Identitäten mit CompreFace ab
+func (h *Handler) syncCompreFace(ctx context.Context) (string, interface{}, error) {
+	if h.compreface == nil || !h.cfg.CompreFace.Enabled {
+		return "", nil, fmt.Errorf("compreface integration is disabled")
+	}
+	if err := h.compreface.SyncIdentities(ctx, h.db); err != nil {
+		return "", nil, fmt.Errorf("compreface sync failed: %w", err)
+	}
+	return "CompreFace synchronization completed", nil, nil
+}
+
+// purge löscht Bilder: ohne Angabe oder mit "retention" die nach cleanup.retention_days
+// abgelaufenen, mit older_than_days (oder einer Zahl) die älteren, mit "all" alle
+// (nur mit mqtt.commands.allow_purge_all)
+func (h *Handler) purge(ctx context.Context, req CommandRequest) (string, interface{}, error) {
+	days := req.OlderThanDays
+	all := req.All
+	switch value := strings.ToLower(req.Value); {
+	case value == "all":
+		all = true
+	case value == "" || value == "retention":
+	default:
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return "", nil, fmt.Errorf("invalid payload %q, expected retention, all or a number of days", req.Value)
+		}
+		days = parsed
+	}
+	if all && !h.cfg.MQTT.Commands.AllowPurgeAll {
+		return "", nil, fmt.Errorf("purging all images is disabled, set mqtt.commands.allow_purge_all to enable it")
+	}
+	if h.cleanup == nil {
+		return "", nil, fmt.Errorf("cleanup service is not available")
+	}
+	if !all && days <= 0 {
+		days = h.cfg.Cleanup.RetentionDays
+		if days <= 0 {
+			return "", nil, fmt.Errorf("cleanup.retention_days is not set, specify older_than_days or all")
+		}
+	}
+
+	before := time.Now()
+	if !all {
+		before = before.AddDate(0, 0, -days)
+	}
+	deleted, err := h.cleanup.PurgeImages(ctx, before)
+	if err != nil {
+		return "", nil, fmt.Errorf("purge failed after %d images: %w", deleted, err)
+	}
+	return fmt.Sprintf("Deleted %d images", deleted), map[string]interface{}{"deleted": deleted}, nil
+}
+
+// parseCommandRequest liest die Nutzlast eines Befehls als JSON oder als einfachen Text
+func parseCommandRequest(payload []byte) (CommandRequest, error) {
+	var req CommandRequest
+	text := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(text, "{") {
+		req.Value = text
+		return req, nil
+	}
+	if err := json.Unmarshal([]byte(text), &req); err != nil {
+		return req, fmt.Errorf("invalid payload: %w", err)
+	}
+	return req, nil
+}
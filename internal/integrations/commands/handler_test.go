@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/integrations/frigate"
+)
+
+// testPNG ist ein 8x8 Pixel großes PNG
+const testPNG = "iVBORw0KGgoAAAANSUhEUgAAAAgAAAAICAIAAABLbSncAAAAGUlEQVR4nGJhYGhQYGDARCwgAhsYnBKAAQBqxwJhq0KzfgAAAABJRU5ErkJggg=="
+
+// newTestHandler liefert einen Handler ohne MQTT-Client und Processor
+func newTestHandler(cfg *config.Config, frigateClient *frigate.FrigateClient) *Handler {
+	h := &Handler{cfg: cfg, frigateClient: frigateClient, allowedHosts: allowedImageHosts(cfg, frigateClient)}
+	h.httpClient = &http.Client{Timeout: commandFetchTimeout, CheckRedirect: h.checkRedirect}
+	return h
+}
+
+func TestImageHostAllowed(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.MQTT.Commands.AllowedHosts = []string{"Camera.local", " 10.0.0.5:8080 ", ""}
+	h := newTestHandler(cfg, frigate.NewFrigateClient(config.FrigateConfig{Host: "http://frigate.local:5000/"}))
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://frigate.local:5000/api/events/1/snapshot.jpg", true},
+		{"http://FRIGATE.local:5000/api/front/latest.jpg", true},
+		{"http://frigate.local:8123/api/states", false},
+		{"http://frigate.local/snapshot.jpg", false},
+		{"http://camera.local/snapshot.jpg", true},
+		{"https://camera.local:8443/snapshot.jpg", true},
+		{"http://10.0.0.5:8080/image.png", true},
+		{"http://10.0.0.5:9090/image.png", false},
+		{"http://10.0.0.5/image.png", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://localhost:8080/api/faces", false},
+		{"http://camera.local.evil.com/snapshot.jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			parsed, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := h.imageHostAllowed(parsed); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageHostAllowedWithoutConfiguredHosts(t *testing.T) {
+	h := newTestHandler(&config.Config{}, nil)
+	parsed, _ := url.Parse("http://camera.local/snapshot.jpg")
+	if h.imageHostAllowed(parsed) {
+		t.Fatal("without frigate and allowed_hosts no url may be fetched")
+	}
+}
+
+func TestDownloadImage(t *testing.T) {
+	png, _ := base64.StdEncoding.DecodeString(testPNG)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(png)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, other.URL+"/image.png", http.StatusFound)
+			return
+		}
+		w.Write(png)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.MQTT.Commands.AllowedHosts = []string{strings.TrimPrefix(server.URL, "http://")}
+	h := newTestHandler(cfg, nil)
+	basePath := filepath.Join(t.TempDir(), "image")
+
+	fullPath, err := h.downloadImage(context.Background(), server.URL+"/image.png", basePath)
+	if err != nil {
+		t.Fatalf("allowed host should be fetched: %v", err)
+	}
+	if fullPath != basePath+".png" {
+		t.Fatalf("png should be saved with its extension, got %s", fullPath)
+	}
+
+	if _, err := h.downloadImage(context.Background(), other.URL+"/image.png", basePath); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("host outside the allowlist should be rejected, got %v", err)
+	}
+	if _, err := h.downloadImage(context.Background(), server.URL+"/redirect", basePath); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("redirect to a host outside the allowlist should be rejected, got %v", err)
+	}
+}
+
+func TestPurgeAllRequiresOptIn(t *testing.T) {
+	h := newTestHandler(&config.Config{}, nil)
+
+	for _, req := range []CommandRequest{{Value: "all"}, {Value: "ALL"}, {All: true}} {
+		if _, _, err := h.purge(context.Background(), req); err == nil || !strings.Contains(err.Error(), "allow_purge_all") {
+			t.Fatalf("purge %+v without allow_purge_all should be rejected, got %v", req, err)
+		}
+	}
+
+	// Mit Opt-in scheitert der Befehl erst am fehlenden Cleanup-Dienst
+	h.cfg.MQTT.Commands.AllowPurgeAll = true
+	if _, _, err := h.purge(context.Background(), CommandRequest{Value: "all"}); err == nil || strings.Contains(err.Error(), "allow_purge_all") {
+		t.Fatalf("purge all with allow_purge_all should pass the opt-in check, got %v", err)
+	}
+}
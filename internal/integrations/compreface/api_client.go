@@ -42,8 +42,10 @@ type Subject struct {
 
 // RecognitionResult repräsentiert ein erkanntes Gesicht
 type RecognitionResult struct {
-	Box      Box       `json:"box"`
-	Subjects []Subject `json:"subjects"`
+	Box       Box         `json:"box"`
+	Subjects  []Subject   `json:"subjects"`
+	Landmarks [][]float64 `json:"landmarks,omitempty"` // Nur mit dem Plugin "landmarks"
+	Embedding []float32   `json:"embedding,omitempty"` // Nur mit dem Plugin "calculator"
 }
 
 // RecognitionResponse repräsentiert die Antwort der CompreFace-API
@@ -182,7 +184,7 @@ func (c *APIClient) Recognize(ctx context.Context, imageData []byte, filename st
 	q.Set("det_prob_threshold", fmt.Sprintf("%g", c.config.DetProbThreshold))
 	q.Set("prediction_count", "3")
 	// Ähnlichkeitsschwelle in Prozent (z.B. 80.0 für 80%)
-	q.Set("face_plugins", "")
+	q.Set("face_plugins", "landmarks,calculator") // Gesichtsmerkmale für die Kopfhaltung, Embedding für Clustering und Suche
 	apiURLWithParams.RawQuery = q.Encode()
 
 	// Request erstellen
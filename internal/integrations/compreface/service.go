@@ -78,10 +78,15 @@ func (s *Service) DetectFaces(ctx context.Context, img image.Image, opts facerec
 		// Bounding-Box konvertieren
 		bbox := []int{r.Box.XMin, r.Box.YMin, r.Box.XMax, r.Box.YMax}
 		
-		// CompreFace liefert kein Embedding, wir können es hier nicht extrahieren
+		// Das Embedding liefert CompreFace über das Plugin "calculator"
 		face := facerecognition.Face{
 			BoundingBox: bbox,
 			Confidence:  r.Box.Probability,
+			Landmarks:   r.Landmarks,
+			Embedding:   r.Embedding,
+		}
+		if len(r.Embedding) > 0 {
+			face.EmbeddingProvider = facerecognition.ProviderCompreFace
 		}
 		
 		// Optional: Wenn angefordert, extrahieren wir das Gesichtsbild
@@ -131,10 +136,15 @@ func (s *Service) RecognizeFaces(ctx context.Context, img image.Image, opts face
 		// Bounding-Box konvertieren
 		bbox := []int{r.Box.XMin, r.Box.YMin, r.Box.XMax, r.Box.YMax}
 		
-		// CompreFace liefert kein Embedding, wir können es hier nicht extrahieren
+		// Das Embedding liefert CompreFace über das Plugin "calculator"
 		face := facerecognition.Face{
 			BoundingBox: bbox,
 			Confidence:  r.Box.Probability,
+			Landmarks:   r.Landmarks,
+			Embedding:   r.Embedding,
+		}
+		if len(r.Embedding) > 0 {
+			face.EmbeddingProvider = facerecognition.ProviderCompreFace
 		}
 		
 		// Optional: Wenn angefordert, extrahieren wir das Gesichtsbild
@@ -0,0 +1,372 @@
+package facerecognition
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EnsembleStrategy definiert, wie die Ergebnisse mehrerer Provider kombiniert werden
+type EnsembleStrategy string
+
+const (
+	// StrategyMax übernimmt die höchste Ähnlichkeit eines beliebigen Providers
+	StrategyMax EnsembleStrategy = "max"
+
+	// StrategyWeightedAverage bildet den gewichteten Mittelwert über alle Provider,
+	// die das Gesicht gesehen haben (fehlende Treffer zählen als 0)
+	StrategyWeightedAverage EnsembleStrategy = "weighted_average"
+
+	// StrategyMajorityVote übernimmt ein Subjekt nur, wenn die Mehrheit der Provider
+	// es als besten Treffer liefert
+	StrategyMajorityVote EnsembleStrategy = "majority_vote"
+)
+
+// ProviderScore ist das unverarbeitete Ergebnis eines einzelnen Providers für ein Gesicht.
+// Ein leeres SubjectID bedeutet, dass der Provider das Gesicht ohne Treffer erkannt hat.
+type ProviderScore struct {
+	Provider   ProviderType `json:"provider"`
+	SubjectID  string       `json:"subject_id,omitempty"`
+	Similarity float64      `json:"similarity"`
+}
+
+// EnsembleFace ist ein über mehrere Provider zusammengeführtes Gesicht
+type EnsembleFace struct {
+	// Face enthält Bounding Box und Daten des zuverlässigsten Providers
+	Face Face `json:"face"`
+
+	// Matches enthält die kombinierten Übereinstimmungen, absteigend sortiert
+	Matches []Match `json:"matches"`
+
+	// Scores enthält die Rohwerte aller beteiligten Provider
+	Scores []ProviderScore `json:"scores"`
+
+	// Providers listet die Provider, die dieses Gesicht erkannt haben
+	Providers []ProviderType `json:"providers"`
+}
+
+// Disagreement gibt an, ob die beteiligten Provider unterschiedliche beste Treffer
+// (oder teils keinen Treffer) für dieses Gesicht geliefert haben
+func (f EnsembleFace) Disagreement() bool {
+	top := make(map[ProviderType]ProviderScore, len(f.Providers))
+	for _, score := range f.Scores {
+		if current, ok := top[score.Provider]; !ok || score.Similarity > current.Similarity {
+			top[score.Provider] = score
+		}
+	}
+
+	subjects := make(map[string]bool)
+	for _, score := range top {
+		subjects[score.SubjectID] = true
+	}
+	return len(subjects) > 1
+}
+
+// EnsembleResponse enthält das kombinierte Ergebnis aller Provider
+type EnsembleResponse struct {
+	Faces []EnsembleFace `json:"faces"`
+
+	// Providers listet die Provider, die erfolgreich geantwortet haben
+	Providers []ProviderType `json:"providers"`
+
+	// Failed enthält die Fehlermeldungen der Provider, die nicht geantwortet haben
+	Failed map[ProviderType]string `json:"failed,omitempty"`
+
+	ExecutionTime float64 `json:"execution_time,omitempty"`
+}
+
+// Ensemble fragt alle registrierten Provider parallel ab und kombiniert ihre Ergebnisse
+type Ensemble struct {
+	manager       *ProviderManager
+	strategy      EnsembleStrategy
+	weights       map[ProviderType]float64
+	minIoU        float64
+	minConfidence float64
+}
+
+// NewEnsemble erstellt ein neues Ensemble auf Basis der im Manager registrierten Provider.
+// Unbekannte Strategien fallen auf StrategyMax zurück, fehlende Gewichte auf 1.
+func NewEnsemble(manager *ProviderManager, strategy EnsembleStrategy, weights map[string]float64, minIoU, minConfidence float64) *Ensemble {
+	switch strategy {
+	case StrategyMax, StrategyWeightedAverage, StrategyMajorityVote:
+	default:
+		strategy = StrategyMax
+	}
+
+	w := make(map[ProviderType]float64, len(weights))
+	for name, weight := range weights {
+		w[ProviderType(name)] = weight
+	}
+
+	return &Ensemble{
+		manager:       manager,
+		strategy:      strategy,
+		weights:       w,
+		minIoU:        minIoU,
+		minConfidence: minConfidence,
+	}
+}
+
+// Strategy gibt die verwendete Kombinationsstrategie zurück
+func (e *Ensemble) Strategy() EnsembleStrategy {
+	return e.strategy
+}
+
+// weight liefert die Gewichtung eines Providers (Standard 1)
+func (e *Ensemble) weight(provider ProviderType) float64 {
+	if w, ok := e.weights[provider]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// providerResult ist das Ergebnis eines einzelnen Providers
+type providerResult struct {
+	provider ProviderType
+	response *RecognitionResponse
+	err      error
+}
+
+// ensembleCluster sammelt die Gesichter verschiedener Provider, die sich überlappen
+type ensembleCluster struct {
+	face    Face
+	matches map[ProviderType][]Match
+	order   []ProviderType
+}
+
+// Recognize fragt alle Provider parallel ab und kombiniert die Ergebnisse.
+// requestFor liefert die Erkennungsparameter (z.B. den Schwellwert) je Provider.
+func (e *Ensemble) Recognize(ctx context.Context, img image.Image, requestFor func(ProviderType) RecognitionRequest) (*EnsembleResponse, error) {
+	startTime := time.Now()
+
+	// Provider mit offenem Circuit Breaker auslassen, solange mindestens einer gesund ist
+	providers := e.manager.GetHealthyProviders()
+	if len(providers) == 0 {
+		providers = e.manager.GetProviders()
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("keine Provider für den Ensemble-Modus registriert")
+	}
+
+	// Alle Provider parallel abfragen
+	results := make([]providerResult, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			name := provider.GetProviderName()
+			resp, err := provider.RecognizeFaces(ctx, img, requestFor(name))
+			e.manager.RecordRequestResult(ctx, name, err)
+			results[i] = providerResult{provider: name, response: resp, err: err}
+		}(i, provider)
+	}
+	wg.Wait()
+
+	response := &EnsembleResponse{
+		Failed: make(map[ProviderType]string),
+	}
+
+	// Gesichter der Provider über die Überlappung der Bounding Boxes zusammenführen
+	var clusters []*ensembleCluster
+	for _, result := range results {
+		if result.err != nil || result.response == nil {
+			if result.err != nil {
+				response.Failed[result.provider] = result.err.Error()
+			} else {
+				response.Failed[result.provider] = "leere Antwort"
+			}
+			continue
+		}
+		response.Providers = append(response.Providers, result.provider)
+
+		providerBoxes := make([][]int, len(result.response.Faces))
+		for i, face := range result.response.Faces {
+			providerBoxes[i] = face.BoundingBox
+		}
+		clusterBoxes := make([][]int, len(clusters))
+		for i, cluster := range clusters {
+			clusterBoxes[i] = cluster.face.BoundingBox
+		}
+		assignment := AssignByIoU(providerBoxes, clusterBoxes, e.minIoU)
+
+		for i, face := range result.response.Faces {
+			if len(face.Embedding) > 0 && face.EmbeddingProvider == "" {
+				face.EmbeddingProvider = result.provider
+			}
+
+			var matches []Match
+			if i < len(result.response.Matches) {
+				matches = result.response.Matches[i]
+			}
+
+			if assignment[i] < 0 {
+				clusters = append(clusters, &ensembleCluster{
+					face:    face,
+					matches: map[ProviderType][]Match{result.provider: matches},
+					order:   []ProviderType{result.provider},
+				})
+				continue
+			}
+
+			cluster := clusters[assignment[i]]
+			cluster.matches[result.provider] = matches
+			cluster.order = append(cluster.order, result.provider)
+			mergeFace(&cluster.face, face)
+		}
+	}
+
+	if len(response.Providers) == 0 {
+		return nil, fmt.Errorf("kein Provider hat geantwortet: %v", response.Failed)
+	}
+
+	for _, cluster := range clusters {
+		response.Faces = append(response.Faces, e.fuse(cluster))
+	}
+	response.ExecutionTime = time.Since(startTime).Seconds()
+
+	return response, nil
+}
+
+// mergeFace übernimmt fehlende Daten (Embedding, Gesichtsbild, Landmarks) und die
+// Bounding Box des Gesichts mit der höheren Erkennungskonfidenz
+func mergeFace(target *Face, other Face) {
+	if other.Confidence > target.Confidence && len(other.BoundingBox) >= 4 {
+		target.BoundingBox = other.BoundingBox
+		target.Confidence = other.Confidence
+		if len(other.Landmarks) > 0 {
+			target.Landmarks = other.Landmarks
+		}
+	}
+	if len(target.Landmarks) == 0 {
+		target.Landmarks = other.Landmarks
+	}
+	if len(target.Embedding) == 0 {
+		target.Embedding = other.Embedding
+		target.EmbeddingProvider = other.EmbeddingProvider
+	}
+	if target.FaceImage == "" {
+		target.FaceImage = other.FaceImage
+	}
+}
+
+// fuse kombiniert die Treffer der Provider eines Clusters nach der konfigurierten Strategie
+func (e *Ensemble) fuse(cluster *ensembleCluster) EnsembleFace {
+	result := EnsembleFace{
+		Face:      cluster.face,
+		Providers: cluster.order,
+	}
+
+	// Rohwerte aller Provider übernehmen
+	for _, provider := range cluster.order {
+		matches := cluster.matches[provider]
+		if len(matches) == 0 {
+			result.Scores = append(result.Scores, ProviderScore{Provider: provider})
+			continue
+		}
+		for _, match := range matches {
+			result.Scores = append(result.Scores, ProviderScore{
+				Provider:   provider,
+				SubjectID:  match.SubjectID,
+				Similarity: match.Similarity,
+			})
+		}
+	}
+
+	var fused map[string]float64
+	switch e.strategy {
+	case StrategyWeightedAverage:
+		fused = e.fuseWeightedAverage(cluster)
+	case StrategyMajorityVote:
+		fused = e.fuseMajorityVote(cluster)
+	default:
+		fused = e.fuseMax(cluster)
+	}
+
+	for subject, similarity := range fused {
+		if similarity <= 0 || similarity < e.minConfidence {
+			continue
+		}
+		result.Matches = append(result.Matches, Match{SubjectID: subject, Similarity: similarity})
+	}
+	sort.Slice(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Similarity > result.Matches[j].Similarity
+	})
+
+	return result
+}
+
+// bestPerSubject liefert die höchste Ähnlichkeit je Subjekt für einen Provider
+func bestPerSubject(matches []Match) map[string]float64 {
+	best := make(map[string]float64, len(matches))
+	for _, match := range matches {
+		if match.Similarity > best[match.SubjectID] {
+			best[match.SubjectID] = match.Similarity
+		}
+	}
+	return best
+}
+
+func (e *Ensemble) fuseMax(cluster *ensembleCluster) map[string]float64 {
+	fused := make(map[string]float64)
+	for _, provider := range cluster.order {
+		for subject, similarity := range bestPerSubject(cluster.matches[provider]) {
+			if similarity > fused[subject] {
+				fused[subject] = similarity
+			}
+		}
+	}
+	return fused
+}
+
+func (e *Ensemble) fuseWeightedAverage(cluster *ensembleCluster) map[string]float64 {
+	sums := make(map[string]float64)
+	var totalWeight float64
+	for _, provider := range cluster.order {
+		weight := e.weight(provider)
+		totalWeight += weight
+		for subject, similarity := range bestPerSubject(cluster.matches[provider]) {
+			sums[subject] += weight * similarity
+		}
+	}
+
+	fused := make(map[string]float64, len(sums))
+	if totalWeight == 0 {
+		return fused
+	}
+	for subject, sum := range sums {
+		fused[subject] = sum / totalWeight
+	}
+	return fused
+}
+
+func (e *Ensemble) fuseMajorityVote(cluster *ensembleCluster) map[string]float64 {
+	votes := make(map[string]int)
+	sums := make(map[string]float64)
+	for _, provider := range cluster.order {
+		matches := cluster.matches[provider]
+		if len(matches) == 0 {
+			continue
+		}
+		// Jeder Provider stimmt für seinen besten Treffer
+		top := matches[0]
+		for _, match := range matches[1:] {
+			if match.Similarity > top.Similarity {
+				top = match
+			}
+		}
+		votes[top.SubjectID]++
+		sums[top.SubjectID] += top.Similarity
+	}
+
+	fused := make(map[string]float64)
+	for subject, count := range votes {
+		if count*2 > len(cluster.order) {
+			fused[subject] = sums[subject] / float64(count)
+		}
+	}
+	return fused
+}
@@ -0,0 +1,265 @@
+package facerecognition
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	providerA ProviderType = "a"
+	providerB ProviderType = "b"
+	providerC ProviderType = "c"
+)
+
+// newCluster baut einen Cluster aus den Treffern je Provider in der angegebenen Reihenfolge
+func newCluster(order []ProviderType, matches map[ProviderType][]Match) *ensembleCluster {
+	return &ensembleCluster{
+		face:    Face{BoundingBox: []int{0, 0, 10, 10}},
+		matches: matches,
+		order:   order,
+	}
+}
+
+func assertFused(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for subject, similarity := range want {
+		if math.Abs(got[subject]-similarity) > 1e-9 {
+			t.Fatalf("subject %q: got %v, want %v (all: %v)", subject, got[subject], similarity, got)
+		}
+	}
+}
+
+func TestFuseWeightedAverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		order   []ProviderType
+		matches map[ProviderType][]Match
+		want    map[string]float64
+	}{
+		{
+			name:  "all providers agree",
+			order: []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.9}},
+				providerB: {{SubjectID: "alice", Similarity: 0.7}},
+			},
+			want: map[string]float64{"alice": 0.8},
+		},
+		{
+			name:  "provider sees the face without a match counts as zero",
+			order: []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.9}},
+				providerB: nil,
+			},
+			want: map[string]float64{"alice": 0.45},
+		},
+		{
+			name:    "weights shift the average",
+			weights: map[string]float64{"a": 3, "b": 1},
+			order:   []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.8}},
+				providerB: {{SubjectID: "bob", Similarity: 0.8}},
+			},
+			want: map[string]float64{"alice": 0.6, "bob": 0.2},
+		},
+		{
+			name:    "non-positive weights fall back to 1",
+			weights: map[string]float64{"a": 0, "b": -2},
+			order:   []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 1}},
+				providerB: {{SubjectID: "alice", Similarity: 0.5}},
+			},
+			want: map[string]float64{"alice": 0.75},
+		},
+		{
+			name:  "only the best similarity per subject and provider counts",
+			order: []ProviderType{providerA},
+			matches: map[ProviderType][]Match{
+				providerA: {
+					{SubjectID: "alice", Similarity: 0.4},
+					{SubjectID: "alice", Similarity: 0.9},
+				},
+			},
+			want: map[string]float64{"alice": 0.9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnsemble(nil, StrategyWeightedAverage, tt.weights, 0.3, 0)
+			assertFused(t, e.fuseWeightedAverage(newCluster(tt.order, tt.matches)), tt.want)
+		})
+	}
+}
+
+func TestFuseMajorityVote(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   []ProviderType
+		matches map[ProviderType][]Match
+		want    map[string]float64
+	}{
+		{
+			name:  "majority averages the similarities of its voters",
+			order: []ProviderType{providerA, providerB, providerC},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.9}},
+				providerB: {{SubjectID: "alice", Similarity: 0.7}},
+				providerC: {{SubjectID: "bob", Similarity: 0.95}},
+			},
+			want: map[string]float64{"alice": 0.8},
+		},
+		{
+			name:  "provider sees the face without a match blocks a majority",
+			order: []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.9}},
+				providerB: nil,
+			},
+			want: map[string]float64{},
+		},
+		{
+			name:  "tie has no majority",
+			order: []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.9}},
+				providerB: {{SubjectID: "bob", Similarity: 0.9}},
+			},
+			want: map[string]float64{},
+		},
+		{
+			name:  "each provider votes only for its best match",
+			order: []ProviderType{providerA, providerB},
+			matches: map[ProviderType][]Match{
+				providerA: {
+					{SubjectID: "bob", Similarity: 0.6},
+					{SubjectID: "alice", Similarity: 0.8},
+				},
+				providerB: {{SubjectID: "alice", Similarity: 0.6}},
+			},
+			want: map[string]float64{"alice": 0.7},
+		},
+		{
+			name:  "single provider is its own majority",
+			order: []ProviderType{providerA},
+			matches: map[ProviderType][]Match{
+				providerA: {{SubjectID: "alice", Similarity: 0.5}},
+			},
+			want: map[string]float64{"alice": 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnsemble(nil, StrategyMajorityVote, nil, 0.3, 0)
+			assertFused(t, e.fuseMajorityVote(newCluster(tt.order, tt.matches)), tt.want)
+		})
+	}
+}
+
+func TestFuseFiltersAndSortsMatches(t *testing.T) {
+	cluster := newCluster([]ProviderType{providerA, providerB}, map[ProviderType][]Match{
+		providerA: {
+			{SubjectID: "alice", Similarity: 0.6},
+			{SubjectID: "bob", Similarity: 0.9},
+			{SubjectID: "carol", Similarity: 0.2},
+		},
+		providerB: nil,
+	})
+
+	e := NewEnsemble(nil, StrategyMax, nil, 0.3, 0.5)
+	result := e.fuse(cluster)
+
+	if len(result.Matches) != 2 || result.Matches[0].SubjectID != "bob" || result.Matches[1].SubjectID != "alice" {
+		t.Fatalf("unexpected matches: %+v", result.Matches)
+	}
+
+	// Der Provider ohne Treffer erscheint mit leerem Subjekt in den Rohwerten
+	var empty int
+	for _, score := range result.Scores {
+		if score.Provider == providerB {
+			if score.SubjectID != "" || score.Similarity != 0 {
+				t.Fatalf("unexpected score for provider without match: %+v", score)
+			}
+			empty++
+		}
+	}
+	if empty != 1 {
+		t.Fatalf("expected one empty score for provider b, got %d", empty)
+	}
+}
+
+func TestNewEnsembleUnknownStrategyFallsBackToMax(t *testing.T) {
+	if got := NewEnsemble(nil, "median", nil, 0.3, 0).Strategy(); got != StrategyMax {
+		t.Fatalf("got %q, want %q", got, StrategyMax)
+	}
+}
+
+func TestDisagreement(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []ProviderScore
+		want   bool
+	}{
+		{
+			name: "same best subject",
+			scores: []ProviderScore{
+				{Provider: providerA, SubjectID: "alice", Similarity: 0.9},
+				{Provider: providerA, SubjectID: "bob", Similarity: 0.4},
+				{Provider: providerB, SubjectID: "alice", Similarity: 0.7},
+			},
+			want: false,
+		},
+		{
+			name: "different best subjects",
+			scores: []ProviderScore{
+				{Provider: providerA, SubjectID: "alice", Similarity: 0.9},
+				{Provider: providerB, SubjectID: "bob", Similarity: 0.7},
+			},
+			want: true,
+		},
+		{
+			name: "provider sees the face without a match",
+			scores: []ProviderScore{
+				{Provider: providerA, SubjectID: "alice", Similarity: 0.9},
+				{Provider: providerB},
+			},
+			want: true,
+		},
+		{
+			name: "no provider has a match",
+			scores: []ProviderScore{
+				{Provider: providerA},
+				{Provider: providerB},
+			},
+			want: false,
+		},
+		{
+			name: "single provider",
+			scores: []ProviderScore{
+				{Provider: providerA, SubjectID: "alice", Similarity: 0.9},
+				{Provider: providerA, SubjectID: "bob", Similarity: 0.8},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			face := EnsembleFace{Scores: tt.scores}
+			for _, score := range tt.scores {
+				face.Providers = append(face.Providers, score.Provider)
+			}
+			if got := face.Disagreement(); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package facerecognition
+
+import (
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// IoU berechnet die Überlappung (Intersection over Union) zweier Bounding Boxes
+// im Format (x1, y1, x2, y2). Ungültige Boxen liefern 0.
+func IoU(a, b []int) float64 {
+	if len(a) < 4 || len(b) < 4 {
+		return 0
+	}
+
+	ix1, iy1 := maxInt(a[0], b[0]), maxInt(a[1], b[1])
+	ix2, iy2 := minInt(a[2], b[2]), minInt(a[3], b[3])
+	if ix2 <= ix1 || iy2 <= iy1 {
+		return 0
+	}
+
+	intersection := float64((ix2 - ix1) * (iy2 - iy1))
+	areaA := float64((a[2] - a[0]) * (a[3] - a[1]))
+	areaB := float64((b[2] - b[0]) * (b[3] - b[1]))
+	union := areaA + areaB - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+// AssignByIoU ordnet jeder Box aus a höchstens eine Box aus b zu (1:1, gierig nach
+// absteigender Überlappung). Das Ergebnis enthält für jeden Index aus a den Index in b
+// oder -1, wenn keine Box mit mindestens minIoU Überlappung gefunden wurde.
+func AssignByIoU(a, b [][]int, minIoU float64) []int {
+	type pair struct {
+		i, j int
+		iou  float64
+	}
+
+	var pairs []pair
+	for i := range a {
+		for j := range b {
+			if iou := IoU(a[i], b[j]); iou >= minIoU && iou > 0 {
+				pairs = append(pairs, pair{i, j, iou})
+			}
+		}
+	}
+	sort.Slice(pairs, func(x, y int) bool {
+		return pairs[x].iou > pairs[y].iou
+	})
+
+	assignment := make([]int, len(a))
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	used := make(map[int]bool, len(b))
+	for _, p := range pairs {
+		if assignment[p.i] != -1 || used[p.j] {
+			continue
+		}
+		assignment[p.i] = p.j
+		used[p.j] = true
+	}
+	return assignment
+}
+
+// PadBox vergrößert eine Bounding Box (x1, y1, x2, y2) um den Anteil padding ihrer
+// Breite bzw. Höhe auf jeder Seite und beschränkt sie auf bounds. Ungültige Boxen
+// liefern ein leeres Rechteck.
+func PadBox(box []int, padding float64, bounds image.Rectangle) image.Rectangle {
+	if len(box) < 4 || box[2] <= box[0] || box[3] <= box[1] {
+		return image.Rectangle{}
+	}
+	if padding < 0 {
+		padding = 0
+	}
+
+	padX := int(float64(box[2]-box[0]) * padding)
+	padY := int(float64(box[3]-box[1]) * padding)
+	rect := image.Rect(box[0]-padX, box[1]-padY, box[2]+padX, box[3]+padY)
+	return rect.Intersect(bounds)
+}
+
+// CropImage schneidet rect aus img aus. Das Ergebnis ist eine Kopie mit Ursprung (0, 0),
+// sodass spätere Änderungen am Ausgangsbild den Ausschnitt nicht beeinflussen.
+func CropImage(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Intersect(img.Bounds())
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	return cropped
+}
+
+// ScaleDown verkleinert img so, dass die längere Kante höchstens maxEdge Pixel lang ist.
+// Jedes Zielpixel ist der Mittelwert der abgedeckten Quellpixel. Kleinere Bilder werden
+// unverändert zurückgegeben.
+func ScaleDown(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxEdge <= 0 || (width <= maxEdge && height <= maxEdge) {
+		return img
+	}
+
+	scale := float64(maxEdge) / float64(maxInt(width, height))
+	dstW, dstH := maxInt(1, int(float64(width)*scale)), maxInt(1, int(float64(height)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		y0, y1 := bounds.Min.Y+y*height/dstH, bounds.Min.Y+maxInt((y+1)*height/dstH, y*height/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := bounds.Min.X+x*width/dstW, bounds.Min.X+maxInt((x+1)*width/dstW, x*width/dstW+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+pr, g+pg, b+pb, a+pa
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
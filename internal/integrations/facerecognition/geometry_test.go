@@ -0,0 +1,202 @@
+package facerecognition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestIoU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want float64
+	}{
+		{"identical boxes", []int{0, 0, 10, 10}, []int{0, 0, 10, 10}, 1},
+		{"half overlap", []int{0, 0, 10, 10}, []int{5, 0, 15, 10}, 50.0 / 150.0},
+		{"contained box", []int{0, 0, 10, 10}, []int{0, 0, 5, 5}, 0.25},
+		{"disjoint boxes", []int{0, 0, 10, 10}, []int{20, 20, 30, 30}, 0},
+		{"touching edges", []int{0, 0, 10, 10}, []int{10, 0, 20, 10}, 0},
+		{"empty box", []int{0, 0, 10, 10}, []int{}, 0},
+		{"short box", []int{0, 0, 10}, []int{0, 0, 10, 10}, 0},
+		{"zero area box", []int{0, 0, 0, 0}, []int{0, 0, 10, 10}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IoU(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if got := IoU(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("IoU is not symmetric: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignByIoU(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   [][]int
+		minIoU float64
+		want   []int
+	}{
+		{
+			name:   "each box gets its best partner",
+			a:      [][]int{{0, 0, 10, 10}, {5, 0, 15, 10}},
+			b:      [][]int{{6, 0, 16, 10}, {1, 0, 11, 10}},
+			minIoU: 0.3,
+			want:   []int{1, 0},
+		},
+		{
+			name:   "a box in b is assigned only once",
+			a:      [][]int{{3, 0, 13, 10}, {0, 0, 10, 10}},
+			b:      [][]int{{1, 0, 11, 10}},
+			minIoU: 0.3,
+			want:   []int{-1, 0},
+		},
+		{
+			name:   "greedy takes the highest overlap first",
+			a:      [][]int{{0, 0, 10, 10}, {3, 0, 13, 10}},
+			b:      [][]int{{1, 0, 11, 10}, {8, 0, 18, 10}},
+			minIoU: 0.1,
+			want:   []int{0, 1},
+		},
+		{
+			name:   "pair below the threshold is not assigned",
+			a:      [][]int{{0, 0, 10, 10}},
+			b:      [][]int{{6, 0, 16, 10}},
+			minIoU: 0.3,
+			want:   []int{-1},
+		},
+		{
+			name:   "disjoint boxes are not assigned without threshold",
+			a:      [][]int{{0, 0, 10, 10}},
+			b:      [][]int{{20, 20, 30, 30}},
+			minIoU: 0,
+			want:   []int{-1},
+		},
+		{
+			name:   "invalid box is not assigned",
+			a:      [][]int{{1, 2}, {0, 0, 10, 10}},
+			b:      [][]int{{0, 0, 10, 10}},
+			minIoU: 0.3,
+			want:   []int{-1, 0},
+		},
+		{
+			name:   "no boxes in b",
+			a:      [][]int{{0, 0, 10, 10}, {20, 20, 30, 30}},
+			b:      nil,
+			minIoU: 0.3,
+			want:   []int{-1, -1},
+		},
+		{
+			name:   "no boxes in a",
+			a:      nil,
+			b:      [][]int{{0, 0, 10, 10}},
+			minIoU: 0.3,
+			want:   []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AssignByIoU(tt.a, tt.b, tt.minIoU)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPadBox(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+
+	tests := []struct {
+		name    string
+		box     []int
+		padding float64
+		bounds  image.Rectangle
+		want    image.Rectangle
+	}{
+		{"padding per side", []int{10, 10, 30, 50}, 0.25, bounds, image.Rect(5, 0, 35, 60)},
+		{"no padding", []int{10, 10, 30, 50}, 0, bounds, image.Rect(10, 10, 30, 50)},
+		{"negative padding is ignored", []int{10, 10, 30, 50}, -0.5, bounds, image.Rect(10, 10, 30, 50)},
+		{"clamped at the top left", []int{2, 2, 22, 22}, 0.5, bounds, image.Rect(0, 0, 32, 32)},
+		{"clamped at the bottom right", []int{80, 90, 100, 100}, 0.5, bounds, image.Rect(70, 85, 100, 100)},
+		{"clamped at an offset origin", []int{10, 10, 20, 20}, 1, image.Rect(5, 5, 25, 25), image.Rect(5, 5, 25, 25)},
+		{"box outside the bounds", []int{200, 200, 220, 220}, 0.1, bounds, image.Rectangle{}},
+		{"empty box", []int{}, 0.1, bounds, image.Rectangle{}},
+		{"inverted box", []int{30, 30, 10, 10}, 0.1, bounds, image.Rectangle{}},
+		{"zero width box", []int{10, 10, 10, 30}, 0.1, bounds, image.Rectangle{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PadBox(tt.box, tt.padding, tt.bounds)
+			if got.Empty() && tt.want.Empty() {
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	// 4x2 Pixel, links schwarz und rechts weiß, Ursprung nicht bei (0, 0)
+	img := image.NewRGBA(image.Rect(10, 20, 14, 22))
+	for y := 20; y < 22; y++ {
+		for x := 10; x < 14; x++ {
+			c := color.RGBA{A: 255}
+			if x >= 12 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		maxEdge   int
+		wantSize  image.Point
+		unchanged bool
+	}{
+		{"smaller image is unchanged", 8, image.Pt(4, 2), true},
+		{"image at the limit is unchanged", 4, image.Pt(4, 2), true},
+		{"non-positive limit is unchanged", 0, image.Pt(4, 2), true},
+		{"longer edge is scaled to the limit", 2, image.Pt(2, 1), false},
+		{"shorter edge keeps at least one pixel", 1, image.Pt(1, 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScaleDown(img, tt.maxEdge)
+			if tt.unchanged && got != image.Image(img) {
+				t.Fatal("expected the original image")
+			}
+			if size := got.Bounds().Size(); size != tt.wantSize {
+				t.Fatalf("got size %v, want %v", size, tt.wantSize)
+			}
+		})
+	}
+
+	// Jedes Zielpixel ist der Mittelwert der abgedeckten Quellpixel
+	scaled := ScaleDown(img, 2)
+	if r, _, _, _ := scaled.At(0, 0).RGBA(); r>>8 != 0 {
+		t.Fatalf("left pixel should be black, got red %d", r>>8)
+	}
+	if r, _, _, _ := scaled.At(1, 0).RGBA(); r>>8 != 255 {
+		t.Fatalf("right pixel should be white, got red %d", r>>8)
+	}
+	if r, _, _, _ := ScaleDown(img, 1).At(0, 0).RGBA(); r>>8 < 126 || r>>8 > 128 {
+		t.Fatalf("single pixel should be the mean gray, got red %d", r>>8)
+	}
+}
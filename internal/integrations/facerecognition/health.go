@@ -0,0 +1,426 @@
+package facerecognition
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CircuitState beschreibt den Zustand des Circuit Breakers eines Providers
+type CircuitState string
+
+const (
+	// CircuitClosed: Provider arbeitet normal, Anfragen werden durchgelassen
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen: Provider gilt als ausgefallen, Anfragen werden umgeleitet
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen: Provider scheint wieder erreichbar, eine einzelne Probeanfrage entscheidet.
+	// Weitere Anfragen werden umgeleitet, bis deren Ergebnis gemeldet wurde.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// HealthConfig enthält die Parameter für Zustandsüberwachung und Circuit Breaker
+type HealthConfig struct {
+	// FailureThreshold ist die Anzahl aufeinanderfolgender Fehler, ab der ein Provider als ausgefallen gilt
+	FailureThreshold int
+
+	// ErrorRateThreshold ist die Fehlerquote (0-1) im Beobachtungsfenster, ab der ein Provider als ausgefallen gilt
+	ErrorRateThreshold float64
+
+	// WindowSize ist die Anzahl der letzten Anfragen, über die die Fehlerquote berechnet wird
+	WindowSize int
+
+	// OpenTimeout ist die Wartezeit, nach der ein ausgefallener Provider erneut versucht wird
+	OpenTimeout time.Duration
+
+	// CheckInterval ist das Intervall der aktiven Verfügbarkeitsprüfung (IsAvailable)
+	CheckInterval time.Duration
+}
+
+// DefaultHealthConfig liefert die Standardwerte für die Zustandsüberwachung
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		FailureThreshold:   3,
+		ErrorRateThreshold: 0.5,
+		WindowSize:         10,
+		OpenTimeout:        60 * time.Second,
+		CheckInterval:      30 * time.Second,
+	}
+}
+
+// ProviderHealth ist eine Momentaufnahme des Zustands eines Providers
+type ProviderHealth struct {
+	Provider            ProviderType `json:"provider"`
+	State               CircuitState `json:"state"`
+	Available           bool         `json:"available"`
+	Primary             bool         `json:"primary"`
+	Current             bool         `json:"current"`
+	ErrorRate           float64      `json:"error_rate"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	TotalRequests       int64        `json:"total_requests"`
+	TotalFailures       int64        `json:"total_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastFailure         time.Time    `json:"last_failure,omitempty"`
+	LastCheck           time.Time    `json:"last_check,omitempty"`
+	OpenedAt            time.Time    `json:"opened_at,omitempty"`
+}
+
+// providerHealth speichert den internen Zustand eines Providers
+type providerHealth struct {
+	state               CircuitState
+	available           bool
+	window              []bool // true = Fehler
+	windowPos           int
+	windowCount         int
+	consecutiveFailures int
+	totalRequests       int64
+	totalFailures       int64
+	lastError           string
+	lastFailure         time.Time
+	lastCheck           time.Time
+	openedAt            time.Time
+	probeStartedAt      time.Time // Beginn der laufenden Probeanfrage im halboffenen Zustand
+}
+
+func newProviderHealth(windowSize int) *providerHealth {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	return &providerHealth{
+		state:     CircuitClosed,
+		available: true,
+		window:    make([]bool, windowSize),
+	}
+}
+
+// record trägt das Ergebnis einer Anfrage in das Beobachtungsfenster ein
+func (h *providerHealth) record(failed bool) {
+	h.window[h.windowPos] = failed
+	h.windowPos = (h.windowPos + 1) % len(h.window)
+	if h.windowCount < len(h.window) {
+		h.windowCount++
+	}
+}
+
+// errorRate berechnet die Fehlerquote im Beobachtungsfenster
+func (h *providerHealth) errorRate() float64 {
+	if h.windowCount == 0 {
+		return 0
+	}
+	failures := 0
+	for i := 0; i < h.windowCount; i++ {
+		if h.window[i] {
+			failures++
+		}
+	}
+	return float64(failures) / float64(h.windowCount)
+}
+
+// open setzt den Circuit Breaker in den offenen Zustand
+func (h *providerHealth) open() {
+	h.state = CircuitOpen
+	h.openedAt = time.Now()
+	h.probeStartedAt = time.Time{}
+}
+
+// halfOpen setzt den Circuit Breaker in den halboffenen Zustand ohne laufende Probeanfrage
+func (h *providerHealth) halfOpen() {
+	h.state = CircuitHalfOpen
+	h.probeStartedAt = time.Time{}
+}
+
+// probeInFlight gibt an, ob im halboffenen Zustand bereits eine Probeanfrage läuft.
+// Eine Probe, deren Ergebnis nach OpenTimeout noch nicht gemeldet wurde, gilt als
+// verloren, damit der Provider nicht dauerhaft gesperrt bleibt.
+func (h *providerHealth) probeInFlight(timeout time.Duration) bool {
+	return !h.probeStartedAt.IsZero() && time.Since(h.probeStartedAt) < timeout
+}
+
+// permitsLocked prüft, ob ein Provider Anfragen erhalten dürfte, ohne eine
+// Probeanfrage zu belegen. Nach Ablauf von OpenTimeout wechselt ein offener
+// Circuit Breaker in den halboffenen Zustand. Der Aufrufer muss m.mu halten.
+func (m *ProviderManager) permitsLocked(name ProviderType) bool {
+	h, ok := m.health[name]
+	if !ok {
+		return true
+	}
+	if h.state == CircuitOpen && time.Since(h.openedAt) >= m.healthCfg.OpenTimeout {
+		h.halfOpen()
+		log.Infof("Circuit Breaker für Provider %s halboffen, nächste Anfrage wird versucht", name)
+	}
+	switch h.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return !h.probeInFlight(m.healthCfg.OpenTimeout)
+	default:
+		return true
+	}
+}
+
+// allowsLocked prüft, ob ein Provider die nächste Anfrage erhalten darf. Im halboffenen
+// Zustand wird dabei die einzige Probeanfrage vergeben; bis deren Ergebnis über
+// RecordResult gemeldet wurde, werden weitere Anfragen abgewiesen.
+// Der Aufrufer muss m.mu halten.
+func (m *ProviderManager) allowsLocked(name ProviderType) bool {
+	if !m.permitsLocked(name) {
+		return false
+	}
+	if h, ok := m.health[name]; ok && h.state == CircuitHalfOpen {
+		h.probeStartedAt = time.Now()
+	}
+	return true
+}
+
+// selectLocked wählt den zu verwendenden Provider: den primären, wenn möglich,
+// sonst den ersten weiteren Provider, der Anfragen zulässt. Lässt kein Provider
+// Anfragen zu, bleibt es beim primären, es sei denn, dessen Probeanfrage läuft
+// noch; dann wird kein Provider geliefert. Der Aufrufer muss m.mu halten.
+func (m *ProviderManager) selectLocked() ProviderType {
+	if m.allowsLocked(m.active) {
+		return m.active
+	}
+	for _, name := range m.sortedNamesLocked() {
+		if name != m.active && m.allowsLocked(name) {
+			return name
+		}
+	}
+	if h, ok := m.health[m.active]; ok && h.state == CircuitHalfOpen {
+		return ""
+	}
+	return m.active
+}
+
+// SetHealthConfig setzt die Parameter der Zustandsüberwachung.
+// Muss vor dem Registrieren der Provider aufgerufen werden.
+func (m *ProviderManager) SetHealthConfig(cfg HealthConfig) {
+	defaults := DefaultHealthConfig()
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaults.FailureThreshold
+	}
+	if cfg.ErrorRateThreshold <= 0 {
+		cfg.ErrorRateThreshold = defaults.ErrorRateThreshold
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = defaults.WindowSize
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaults.OpenTimeout
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaults.CheckInterval
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.healthCfg = cfg
+}
+
+// RecordResult meldet das Ergebnis einer Anfrage an einen Provider.
+// Fehler können den Circuit Breaker öffnen, ein Erfolg im halboffenen Zustand schließt ihn.
+func (m *ProviderManager) RecordResult(name ProviderType, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.health[name]
+	if !ok {
+		return
+	}
+
+	h.totalRequests++
+	h.record(err != nil)
+	h.probeStartedAt = time.Time{}
+
+	if err == nil {
+		h.consecutiveFailures = 0
+		h.available = true
+		if h.state != CircuitClosed {
+			log.Infof("Provider %s antwortet wieder, Circuit Breaker geschlossen", name)
+			h.state = CircuitClosed
+		}
+		return
+	}
+
+	h.totalFailures++
+	h.consecutiveFailures++
+	h.lastError = err.Error()
+	h.lastFailure = time.Now()
+
+	switch h.state {
+	case CircuitHalfOpen:
+		log.Warnf("Provider %s weiterhin fehlerhaft, Circuit Breaker wieder geöffnet: %v", name, err)
+		h.open()
+	case CircuitClosed:
+		minSamples := (len(h.window) + 1) / 2
+		if h.consecutiveFailures >= m.healthCfg.FailureThreshold ||
+			(h.windowCount >= minSamples && h.errorRate() >= m.healthCfg.ErrorRateThreshold) {
+			log.Warnf("Provider %s ausgefallen (%d Fehler in Folge, Fehlerquote %.0f%%), Circuit Breaker geöffnet",
+				name, h.consecutiveFailures, h.errorRate()*100)
+			h.open()
+		}
+	}
+}
+
+// RecordRequestResult meldet wie RecordResult das Ergebnis einer Anfrage, zählt aber keine
+// Anfragen, die der Aufrufer über ctx abgebrochen hat. Sie sagen nichts über den Zustand
+// des Providers aus; eine laufende Probeanfrage wird nur freigegeben.
+func (m *ProviderManager) RecordRequestResult(ctx context.Context, name ProviderType, err error) {
+	if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if h, ok := m.health[name]; ok {
+			h.probeStartedAt = time.Time{}
+		}
+		return
+	}
+	m.RecordResult(name, err)
+}
+
+// recordCheck trägt das Ergebnis einer aktiven Verfügbarkeitsprüfung ein
+func (m *ProviderManager) recordCheck(name ProviderType, available bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.health[name]
+	if !ok {
+		return
+	}
+
+	h.lastCheck = time.Now()
+	h.available = available
+
+	switch {
+	case !available && h.state != CircuitOpen:
+		log.Warnf("Provider %s nicht erreichbar, Circuit Breaker geöffnet", name)
+		h.lastError = "Verfügbarkeitsprüfung fehlgeschlagen"
+		h.lastFailure = h.lastCheck
+		h.open()
+	case available && h.state == CircuitOpen:
+		// Die nächste echte Anfrage entscheidet über das Schließen
+		log.Infof("Provider %s wieder erreichbar, Circuit Breaker halboffen", name)
+		h.halfOpen()
+	}
+}
+
+// CheckHealth prüft die Verfügbarkeit aller registrierten Provider einmalig
+func (m *ProviderManager) CheckHealth(ctx context.Context) {
+	for _, provider := range m.GetProviders() {
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		available := provider.IsAvailable(checkCtx)
+		cancel()
+		m.recordCheck(provider.GetProviderName(), available)
+	}
+}
+
+// StartHealthChecks startet die periodische Verfügbarkeitsprüfung im Hintergrund
+func (m *ProviderManager) StartHealthChecks() {
+	m.mu.Lock()
+	if m.stopCh != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stopCh = make(chan struct{})
+	stopCh := m.stopCh
+	interval := m.healthCfg.CheckInterval
+	m.mu.Unlock()
+
+	log.Infof("Starte Zustandsüberwachung der Gesichtserkennungsanbieter (Intervall: %s)", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		m.CheckHealth(context.Background())
+		for {
+			select {
+			case <-ticker.C:
+				m.CheckHealth(context.Background())
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthChecks beendet die periodische Verfügbarkeitsprüfung
+func (m *ProviderManager) StopHealthChecks() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+}
+
+// GetCurrentProviderName gibt den Namen des zuletzt tatsächlich verwendeten Providers zurück
+// (nach einem Failover ggf. ein anderer als der primäre)
+func (m *ProviderManager) GetCurrentProviderName() ProviderType {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// GetHealthyProviders gibt alle Provider zurück, deren Circuit Breaker Anfragen zulässt.
+// Halboffene Provider vergeben dabei ihre Probeanfrage; der Aufrufer muss das Ergebnis
+// für jeden zurückgegebenen Provider über RecordResult melden.
+func (m *ProviderManager) GetHealthyProviders() []Provider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var providers []Provider
+	for _, name := range m.sortedNamesLocked() {
+		if m.allowsLocked(name) {
+			providers = append(providers, m.providers[name])
+		}
+	}
+	return providers
+}
+
+// HasHealthyProvider gibt an, ob mindestens ein Provider Anfragen zulässt, ohne
+// dabei eine Probeanfrage zu belegen
+func (m *ProviderManager) HasHealthyProvider() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.providers {
+		if m.permitsLocked(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHealthStatus liefert den Zustand aller registrierten Provider
+func (m *ProviderManager) GetHealthStatus() []ProviderHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := make([]ProviderHealth, 0, len(m.providers))
+	for _, name := range m.sortedNamesLocked() {
+		h := m.health[name]
+		if h == nil {
+			continue
+		}
+		status = append(status, ProviderHealth{
+			Provider:            name,
+			State:               h.state,
+			Available:           h.available,
+			Primary:             name == m.active,
+			Current:             name == m.current,
+			ErrorRate:           h.errorRate(),
+			ConsecutiveFailures: h.consecutiveFailures,
+			TotalRequests:       h.totalRequests,
+			TotalFailures:       h.totalFailures,
+			LastError:           h.lastError,
+			LastFailure:         h.lastFailure,
+			LastCheck:           h.lastCheck,
+			OpenedAt:            h.openedAt,
+		})
+	}
+	return status
+}
@@ -0,0 +1,125 @@
+package facerecognition
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+// stubProvider ist ein Provider ohne Funktion, der nur seinen Namen liefert
+type stubProvider struct {
+	name ProviderType
+}
+
+func (p stubProvider) GetProviderName() ProviderType        { return p.name }
+func (p stubProvider) IsAvailable(ctx context.Context) bool { return true }
+func (p stubProvider) DetectFaces(ctx context.Context, img image.Image, opts DetectionRequest) (*DetectionResponse, error) {
+	return &DetectionResponse{}, nil
+}
+func (p stubProvider) RecognizeFaces(ctx context.Context, img image.Image, opts RecognitionRequest) (*RecognitionResponse, error) {
+	return &RecognitionResponse{}, nil
+}
+func (p stubProvider) AddFace(ctx context.Context, img image.Image, opts AddFaceRequest) (*AddFaceResponse, error) {
+	return &AddFaceResponse{Success: true}, nil
+}
+func (p stubProvider) GetSubjects(ctx context.Context) ([]SubjectInfo, error) { return nil, nil }
+func (p stubProvider) DeleteSubject(ctx context.Context, subjectID string) error {
+	return nil
+}
+
+// newHalfOpenManager liefert einen Manager mit einem einzigen, halboffenen Provider
+func newHalfOpenManager(t *testing.T) *ProviderManager {
+	t.Helper()
+	m := NewProviderManager()
+	m.SetHealthConfig(HealthConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+	m.RegisterProvider(stubProvider{name: providerA})
+	m.SetActiveProvider(providerA)
+
+	m.RecordResult(providerA, errors.New("down"))
+	if _, ok := m.GetActiveProvider(); !ok {
+		t.Fatal("open circuit without alternative should still fall back to the primary")
+	}
+	m.recordCheck(providerA, true)
+	return m
+}
+
+func TestHalfOpenAllowsSingleProbe(t *testing.T) {
+	m := newHalfOpenManager(t)
+
+	if !m.HasHealthyProvider() {
+		t.Fatal("half-open provider without probe should count as healthy")
+	}
+	if _, ok := m.GetActiveProvider(); !ok {
+		t.Fatal("first request in half-open state should be let through as probe")
+	}
+	if _, ok := m.GetActiveProvider(); ok {
+		t.Fatal("second request must be short-circuited while the probe is in flight")
+	}
+	if len(m.GetHealthyProviders()) != 0 {
+		t.Fatal("ensemble must not query a provider whose probe is in flight")
+	}
+
+	m.RecordResult(providerA, nil)
+	for i := 0; i < 3; i++ {
+		if _, ok := m.GetActiveProvider(); !ok {
+			t.Fatal("closed circuit should let every request through")
+		}
+	}
+}
+
+func TestHalfOpenProbeFailureReopens(t *testing.T) {
+	m := newHalfOpenManager(t)
+
+	if _, ok := m.GetActiveProvider(); !ok {
+		t.Fatal("probe should be let through")
+	}
+	m.RecordResult(providerA, errors.New("still down"))
+
+	status := m.GetHealthStatus()
+	if len(status) != 1 || status[0].State != CircuitOpen {
+		t.Fatalf("failed probe should reopen the circuit, got %+v", status)
+	}
+}
+
+func TestRecordRequestResultIgnoresCanceledRequests(t *testing.T) {
+	m := NewProviderManager()
+	m.SetHealthConfig(HealthConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+	m.RegisterProvider(stubProvider{name: providerA})
+	m.SetActiveProvider(providerA)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.RecordRequestResult(canceled, providerA, context.Canceled)
+	m.RecordRequestResult(context.Background(), providerA, context.Canceled)
+	m.RecordRequestResult(canceled, providerA, errors.New("connection reset"))
+
+	status := m.GetHealthStatus()
+	if len(status) != 1 || status[0].State != CircuitClosed || status[0].TotalFailures != 0 {
+		t.Fatalf("canceled requests must not count as failures, got %+v", status)
+	}
+
+	m.RecordRequestResult(context.Background(), providerA, errors.New("down"))
+	if status := m.GetHealthStatus(); status[0].State != CircuitOpen {
+		t.Fatalf("failure of a live request should open the circuit, got %+v", status)
+	}
+}
+
+func TestCanceledProbeReleasesHalfOpenCircuit(t *testing.T) {
+	m := newHalfOpenManager(t)
+
+	if _, ok := m.GetActiveProvider(); !ok {
+		t.Fatal("probe should be let through")
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.RecordRequestResult(canceled, providerA, context.Canceled)
+
+	if status := m.GetHealthStatus(); status[0].State != CircuitHalfOpen {
+		t.Fatalf("canceled probe should leave the circuit half-open, got %+v", status)
+	}
+	if _, ok := m.GetActiveProvider(); !ok {
+		t.Fatal("next request should be let through as a new probe")
+	}
+}
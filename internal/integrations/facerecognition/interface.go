@@ -3,7 +3,11 @@ package facerecognition
 import (
 	"context"
 	"image"
+	"sort"
+	"sync"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // ProviderType definiert den Typ des Gesichtserkennungsdiensts
@@ -28,8 +32,16 @@ type Face struct {
 	// Embedding ist der Gesichtsvektor für die Gesichtserkennung
 	Embedding []float32 `json:"embedding,omitempty"`
 	
+	// EmbeddingProvider ist der Provider, der das Embedding erzeugt hat. Vektoren
+	// verschiedener Provider sind nicht miteinander vergleichbar.
+	EmbeddingProvider ProviderType `json:"embedding_provider,omitempty"`
+	
 	// FaceImage enthält optional das zugeschnittene Gesichtsbild als Base64-String
 	FaceImage string `json:"face_image,omitempty"`
+	
+	// Landmarks enthält optional Gesichtsmerkmale als (x, y)-Punkte im Bild:
+	// 5 Punkte (Augen, Nase, Mundwinkel) oder 68 Punkte, je nach Provider
+	Landmarks [][]float64 `json:"landmarks,omitempty"`
 }
 
 // Match repräsentiert eine Übereinstimmung mit einem bekannten Gesicht
@@ -147,59 +159,132 @@ type Provider interface {
 	DeleteSubject(ctx context.Context, subjectID string) error
 }
 
-// ProviderManager verwaltet verschiedene Gesichtserkennungsdienste
+// ProviderManager verwaltet verschiedene Gesichtserkennungsdienste.
+// Neben dem konfigurierten (primären) Provider wird der Zustand aller Provider
+// überwacht, sodass bei Ausfällen automatisch auf einen anderen Provider
+// umgeschaltet werden kann (siehe health.go).
 type ProviderManager struct {
+	mu        sync.RWMutex
 	providers map[ProviderType]Provider
 	active    ProviderType
+	current   ProviderType
+	health    map[ProviderType]*providerHealth
+	healthCfg HealthConfig
+	stopCh    chan struct{}
 }
 
 // NewProviderManager erstellt einen neuen ProviderManager für Gesichtserkennungsdienste
 func NewProviderManager() *ProviderManager {
 	return &ProviderManager{
 		providers: make(map[ProviderType]Provider),
+		health:    make(map[ProviderType]*providerHealth),
+		healthCfg: DefaultHealthConfig(),
 	}
 }
 
 // RegisterProvider registriert einen neuen Gesichtserkennungsdienst
 func (m *ProviderManager) RegisterProvider(provider Provider) {
-	m.providers[provider.GetProviderName()] = provider
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	name := provider.GetProviderName()
+	m.providers[name] = provider
+	m.health[name] = newProviderHealth(m.healthCfg.WindowSize)
 }
 
-// SetActiveProvider setzt den aktiven Gesichtserkennungsdienst
+// SetActiveProvider setzt den aktiven (primären) Gesichtserkennungsdienst
 func (m *ProviderManager) SetActiveProvider(providerType ProviderType) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
 	if _, exists := m.providers[providerType]; exists {
 		m.active = providerType
+		m.current = providerType
 		return true
 	}
 	return false
 }
 
-// GetActiveProviderName gibt den Namen des aktuell aktiven Gesichtserkennungsdiensts zurück
+// GetActiveProviderName gibt den Namen des konfigurierten (primären) Gesichtserkennungsdiensts zurück
 func (m *ProviderManager) GetActiveProviderName() ProviderType {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.active
 }
 
 // GetProvider gibt den Gesichtserkennungsdienst mit dem angegebenen Namen zurück
 func (m *ProviderManager) GetProvider(providerType ProviderType) (Provider, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	provider, exists := m.providers[providerType]
 	return provider, exists
 }
 
-// GetActiveProvider gibt den aktuell aktiven Gesichtserkennungsdienst zurück
+// GetActiveProvider gibt den Gesichtserkennungsdienst zurück, der aktuell verwendet werden soll.
+// Das ist der primäre Provider, solange dessen Circuit Breaker Anfragen zulässt; andernfalls
+// wird auf den ersten gesunden weiteren Provider ausgewichen. Läuft für den halboffenen
+// primären Provider bereits eine Probeanfrage und gibt es keine Alternative, wird kein
+// Provider geliefert. Das Ergebnis der Anfrage muss über RecordResult bzw. RecordRequestResult gemeldet werden.
 func (m *ProviderManager) GetActiveProvider() (Provider, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
 	if m.active == "" {
 		return nil, false
 	}
-	return m.GetProvider(m.active)
+	
+	selected := m.selectLocked()
+	if selected == "" {
+		return nil, false
+	}
+	if selected != m.current {
+		if selected == m.active {
+			log.Infof("Provider %s ist wieder verfügbar, wechsle zurück vom Ausweich-Provider %s", selected, m.current)
+		} else {
+			log.Warnf("Failover: Provider %s ist nicht verfügbar, verwende %s", m.current, selected)
+		}
+		m.current = selected
+	}
+	
+	provider, exists := m.providers[selected]
+	return provider, exists
 }
 
 // GetAvailableProviders gibt eine Liste aller verfügbaren Gesichtserkennungsdienste zurück
 func (m *ProviderManager) GetAvailableProviders(ctx context.Context) []ProviderType {
 	var available []ProviderType
-	for name, provider := range m.providers {
+	for _, provider := range m.GetProviders() {
 		if provider.IsAvailable(ctx) {
-			available = append(available, name)
+			available = append(available, provider.GetProviderName())
 		}
 	}
 	return available
 }
+
+// GetProviders gibt alle registrierten Gesichtserkennungsdienste sortiert nach Namen zurück
+func (m *ProviderManager) GetProviders() []Provider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	providers := make([]Provider, 0, len(m.providers))
+	for _, name := range m.sortedNamesLocked() {
+		providers = append(providers, m.providers[name])
+	}
+	return providers
+}
+
+// sortedNamesLocked liefert die Namen aller Provider in stabiler Reihenfolge.
+// Der Aufrufer muss m.mu halten.
+func (m *ProviderManager) sortedNamesLocked() []ProviderType {
+	names := make([]string, 0, len(m.providers))
+	for name := range m.providers {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	
+	result := make([]ProviderType, len(names))
+	for i, name := range names {
+		result[i] = ProviderType(name)
+	}
+	return result
+}
@@ -1,10 +1,14 @@
 package frigate
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -327,22 +331,9 @@ func (c *FrigateClient) DownloadSnapshot(snapshotPath string, savePath string) e
 		return fmt.Errorf("empty snapshot path")
 	}
 
-	// Verwende Host aus der neuen Konfiguration, mit Fallback auf Legacy-Felder
-	hostURL := c.config.Host
-	if hostURL == "" {
-		// Fallback auf alte Konfigurationsfelder
-		if c.config.APIURL != "" {
-			hostURL = c.config.APIURL
-		} else if c.config.URL != "" {
-			hostURL = c.config.URL
-		} else {
-			return fmt.Errorf("no frigate host URL configured")
-		}
-	}
-
-	// Stelle sicher, dass hostURL nicht mit einem Schrägstrich endet
-	if strings.HasSuffix(hostURL, "/") {
-		hostURL = hostURL[:len(hostURL)-1]
+	hostURL, err := c.HostURL()
+	if err != nil {
+		return err
 	}
 
 	// Stelle sicher, dass snapshotPath mit einem Schrägstrich beginnt, wenn es kein vollständiges URL ist
@@ -393,6 +384,244 @@ func (c *FrigateClient) DownloadSnapshot(snapshotPath string, savePath string) e
 	return nil
 }
 
+// HostURL liefert die Basis-URL der Frigate-Instanz ohne abschließenden Schrägstrich
+func (c *FrigateClient) HostURL() (string, error) {
+	// Verwende Host aus der neuen Konfiguration, mit Fallback auf Legacy-Felder
+	hostURL := c.config.Host
+	if hostURL == "" {
+		// Fallback auf alte Konfigurationsfelder
+		if c.config.APIURL != "" {
+			hostURL = c.config.APIURL
+		} else if c.config.URL != "" {
+			hostURL = c.config.URL
+		} else {
+			return "", fmt.Errorf("no frigate host URL configured")
+		}
+	}
+	return strings.TrimSuffix(hostURL, "/"), nil
+}
+
+// eventSubLabelResponse ist der für das Sub-Label relevante Teil von /api/events/<id>.
+// Je nach Frigate-Version ist sub_label ein String oder ein Paar aus Name und Score.
+type eventSubLabelResponse struct {
+	SubLabel json.RawMessage `json:"sub_label"`
+	Data     struct {
+		SubLabelScore float64 `json:"sub_label_score"`
+	} `json:"data"`
+}
+
+// GetEventSubLabel liest das aktuelle Sub-Label eines Events und dessen Score (0, falls unbekannt)
+func (c *FrigateClient) GetEventSubLabel(ctx context.Context, eventID string) (string, float64, error) {
+	if !c.config.Enabled {
+		return "", 0, fmt.Errorf("frigate integration is disabled")
+	}
+	hostURL, err := c.HostURL()
+	if err != nil {
+		return "", 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/events/%s", hostURL, url.PathEscape(eventID)), nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get event %s: %w", eventID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to get event %s, status code: %d", eventID, resp.StatusCode)
+	}
+
+	var event eventSubLabelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&event); err != nil {
+		return "", 0, fmt.Errorf("failed to decode event %s: %w", eventID, err)
+	}
+	if len(event.SubLabel) == 0 || string(event.SubLabel) == "null" {
+		return "", 0, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(event.SubLabel, &name); err == nil {
+		return name, event.Data.SubLabelScore, nil
+	}
+	var pair []interface{}
+	if err := json.Unmarshal(event.SubLabel, &pair); err != nil {
+		return "", 0, fmt.Errorf("unexpected sub_label format for event %s: %s", eventID, string(event.SubLabel))
+	}
+	score := event.Data.SubLabelScore
+	if len(pair) > 0 {
+		name, _ = pair[0].(string)
+	}
+	if len(pair) > 1 {
+		if value, ok := pair[1].(float64); ok {
+			score = value
+		}
+	}
+	return name, score, nil
+}
+
+// SetSubLabel setzt das Sub-Label eines Events über die Frigate-API. Der Score muss
+// zwischen 0 und 1 liegen und wird bei Bedarf begrenzt.
+func (c *FrigateClient) SetSubLabel(ctx context.Context, eventID, subLabel string, score float64) error {
+	if !c.config.Enabled {
+		return fmt.Errorf("frigate integration is disabled")
+	}
+	hostURL, err := c.HostURL()
+	if err != nil {
+		return err
+	}
+
+	// Frigate begrenzt Sub-Labels auf 100 Zeichen
+	if runes := []rune(subLabel); len(runes) > 100 {
+		subLabel = string(runes[:100])
+	}
+	body := map[string]interface{}{"subLabel": subLabel}
+	if score > 0 {
+		body["subLabelScore"] = math.Min(score, 1)
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode sub label: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/events/%s/sub_label", hostURL, url.PathEscape(eventID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set sub label of event %s: %w", eventID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to set sub label of event %s, status code: %d: %s", eventID, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	log.Debugf("Set sub label of Frigate event %s to %q (score %.2f)", eventID, subLabel, score)
+	return nil
+}
+
+// APIEvent ist ein Event, wie es von /api/events geliefert wird. Anders als die
+// MQTT-Nachrichten enthält es keine before/after-Sektionen.
+type APIEvent struct {
+	ID            string   `json:"id"`
+	Camera        string   `json:"camera"`
+	Label         string   `json:"label"`
+	TopScore      float64  `json:"top_score"`
+	FalsePositive bool     `json:"false_positive"`
+	StartTime     float64  `json:"start_time"`
+	EndTime       *float64 `json:"end_time"` // nil, solange das Event läuft
+	Zones         []string `json:"zones"`
+	HasSnapshot   bool     `json:"has_snapshot"`
+	HasClip       bool     `json:"has_clip"`
+	Data          struct {
+		Score    float64 `json:"score"`
+		TopScore float64 `json:"top_score"`
+	} `json:"data"`
+}
+
+// InProgress prüft, ob das Event noch läuft
+func (e *APIEvent) InProgress() bool {
+	return e.EndTime == nil
+}
+
+// EventData wandelt das Event in das Format der MQTT-Nachrichten um, damit es wie
+// ein neues Event verarbeitet werden kann
+func (e *APIEvent) EventData() *FrigateEventData {
+	score := e.TopScore
+	if e.Data.TopScore > 0 {
+		score = e.Data.TopScore
+	}
+	data := &FrigateEventData{
+		ID:            e.ID,
+		Camera:        e.Camera,
+		Label:         e.Label,
+		Score:         score,
+		TopScore:      score,
+		FalsePositive: e.FalsePositive,
+		StartTime:     e.StartTime,
+		FrameTime:     e.StartTime,
+		EnteredZones:  e.Zones,
+		HasClip:       e.HasClip,
+		HasSnapshot:   e.HasSnapshot,
+	}
+	if e.EndTime != nil {
+		data.EndTime = *e.EndTime
+	}
+	return data
+}
+
+// EventQuery enthält die Filter für ListEvents. Zeiten sind Unix-Zeitstempel in
+// Sekunden und beziehen sich auf den Beginn des Events (jeweils exklusiv, 0 = offen).
+type EventQuery struct {
+	After       float64
+	Before      float64
+	Cameras     []string
+	Labels      []string
+	HasSnapshot bool
+	Limit       int
+}
+
+// ListEvents ruft eine Seite von Events über /api/events ab. Frigate liefert die
+// Events absteigend nach Startzeit sortiert.
+func (c *FrigateClient) ListEvents(ctx context.Context, query EventQuery) ([]APIEvent, error) {
+	if !c.config.Enabled {
+		return nil, fmt.Errorf("frigate integration is disabled")
+	}
+	hostURL, err := c.HostURL()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("include_thumbnails", "0")
+	if query.After > 0 {
+		params.Set("after", strconv.FormatFloat(query.After, 'f', -1, 64))
+	}
+	if query.Before > 0 {
+		params.Set("before", strconv.FormatFloat(query.Before, 'f', -1, 64))
+	}
+	if len(query.Cameras) > 0 {
+		params.Set("cameras", strings.Join(query.Cameras, ","))
+	}
+	if len(query.Labels) > 0 {
+		params.Set("labels", strings.Join(query.Labels, ","))
+	}
+	if query.HasSnapshot {
+		params.Set("has_snapshot", "1")
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/events?%s", hostURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list events, status code: %d", resp.StatusCode)
+	}
+
+	var events []APIEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+	return events, nil
+}
+
 // GenerateFilename generiert einen Dateinamen für ein Frigate-Ereignis
 func (c *FrigateClient) GenerateFilename(event *FrigateEventData) string {
 	// Format: frigate_camera_eventID_timestamp.jpg
@@ -0,0 +1,466 @@
+package frigate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// pollerCursorName ist der Name des persistierten Cursors der Event-Abfrage
+const pollerCursorName = "frigate_events"
+
+// Standardwerte für die Event-Abfrage
+const (
+	defaultPollInterval    = 30 * time.Second
+	defaultPollPageSize    = 50
+	defaultInitialLookback = time.Hour
+	// stalledEventAge ist das Alter, ab dem ein Event ohne Ende als abgebrochen gilt
+	// und trotzdem übernommen wird
+	stalledEventAge = time.Hour
+	// maxIngestAttempts ist die Anzahl der Abfragen, in denen die Übernahme eines Events
+	// fehlschlagen darf, bevor der Cursor trotzdem darüber hinweg bewegt wird
+	maxIngestAttempts = 5
+)
+
+// ErrBackfillRunning wird zurückgegeben, wenn bereits ein Backfill läuft
+var ErrBackfillRunning = errors.New("a backfill is already running")
+
+// EventHandler verarbeitet die über die API abgerufenen Events
+type EventHandler interface {
+	// IngestFrigateEvent verarbeitet ein neues Event. backfill kennzeichnet
+	// nachgeholte Events, die nachrangig verarbeitet werden können.
+	IngestFrigateEvent(ctx context.Context, event *FrigateEventData, backfill bool) error
+	// ReprocessFrigateEvent erkennt die bereits gespeicherten Bilder eines Events erneut
+	ReprocessFrigateEvent(ctx context.Context, eventID string) error
+	// ProcessPersonOnly gibt zurück, ob für alle angegebenen Kameras nur Personen
+	// verarbeitet werden (ohne Kameras: für alle Kameras)
+	ProcessPersonOnly(cameras []string) bool
+}
+
+// eventLister ruft Events seitenweise ab, umgesetzt vom FrigateClient
+type eventLister interface {
+	ListEvents(ctx context.Context, query EventQuery) ([]APIEvent, error)
+}
+
+// BackfillRequest beschreibt einen nachträglich zu übernehmenden Zeitraum
+type BackfillRequest struct {
+	After     time.Time
+	Before    time.Time // Leer = bis jetzt
+	Cameras   []string  // Leer = alle Kameras
+	Reprocess bool      // Bereits übernommene Events erneut erkennen statt sie zu überspringen
+}
+
+// BackfillStatus beschreibt den Fortschritt des letzten Backfills
+type BackfillStatus struct {
+	Running     bool       `json:"running"`
+	After       time.Time  `json:"after"`
+	Before      time.Time  `json:"before"`
+	Cameras     []string   `json:"cameras,omitempty"`
+	Reprocess   bool       `json:"reprocess"`
+	Total       int        `json:"total"`
+	Ingested    int        `json:"ingested"`
+	Reprocessed int        `json:"reprocessed"`
+	Skipped     int        `json:"skipped"`
+	Failed      int        `json:"failed"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// ingestResult gibt an, wie ein Event behandelt wurde
+type ingestResult int
+
+const (
+	ingestSkipped ingestResult = iota
+	ingestIngested
+	ingestReprocessed
+)
+
+// EventPoller fragt Events regelmäßig über /api/events ab und übergibt noch nicht
+// bekannte Events an den EventHandler. Der Fortschritt wird in der Datenbank
+// gespeichert, sodass nach einem Neustart keine Events verloren gehen.
+type EventPoller struct {
+	client  eventLister
+	db      *gorm.DB
+	config  config.FrigateConfig
+	handler EventHandler
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	ingestMutex sync.Mutex // Serialisiert Duplikatprüfung und Übernahme eines Events
+
+	statusMutex sync.RWMutex
+	backfill    *BackfillStatus
+}
+
+// NewEventPoller erstellt einen neuen Poller für Frigate-Events
+func NewEventPoller(client *FrigateClient, db *gorm.DB, cfg config.FrigateConfig, handler EventHandler) *EventPoller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventPoller{
+		client:  client,
+		db:      db,
+		config:  cfg,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start startet die regelmäßige Abfrage, sofern sie aktiviert ist
+func (p *EventPoller) Start() {
+	if !p.config.Polling.Enabled {
+		return
+	}
+
+	interval := time.Duration(p.config.Polling.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	log.Infof("Frigate-Event-Abfrage gestartet (Intervall %v)", interval)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.poll(p.ctx); err != nil && p.ctx.Err() == nil {
+				log.Warnf("Frigate-Events konnten nicht abgefragt werden: %v", err)
+			}
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop beendet die Abfrage und einen laufenden Backfill
+func (p *EventPoller) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// poll übernimmt alle Events seit dem gespeicherten Cursor. Der Cursor wird nur bis
+// vor das erste noch laufende oder fehlgeschlagene Event verschoben, damit dieses nach
+// seinem Ende bzw. bei der nächsten Abfrage übernommen wird. Schlägt ein Event
+// wiederholt fehl, wird es nach maxIngestAttempts Versuchen aufgegeben. Die Fehlversuche
+// werden mit dem Cursor gespeichert und zählen so auch über einen Neustart hinweg.
+func (p *EventPoller) poll(ctx context.Context) error {
+	cursor := models.IngestCursor{Name: pollerCursorName}
+	if err := p.db.Where("name = ?", pollerCursorName).FirstOrInit(&cursor).Error; err != nil {
+		return fmt.Errorf("fehler beim Laden des Cursors: %w", err)
+	}
+
+	after := cursor.Position
+	if after == 0 {
+		lookback := time.Duration(p.config.Polling.InitialLookback) * time.Second
+		if lookback <= 0 {
+			lookback = defaultInitialLookback
+		}
+		after = float64(time.Now().Add(-lookback).Unix())
+	}
+
+	events, err := p.fetchRange(ctx, after, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	// Fehlversuche von Events, die nicht mehr nach dem Cursor liegen, verwerfen
+	failures := cursor.FailureCounts()
+	dirty := false
+	current := make(map[string]bool, len(events))
+	for _, event := range events {
+		current[event.ID] = true
+	}
+	for id := range failures {
+		if !current[id] {
+			delete(failures, id)
+			dirty = true
+		}
+	}
+	save := func() error {
+		cursor.SetFailureCounts(failures)
+		if err := p.db.Save(&cursor).Error; err != nil {
+			return fmt.Errorf("fehler beim Speichern des Cursors: %w", err)
+		}
+		dirty = false
+		return nil
+	}
+
+	blocked := false
+	for i := range events {
+		event := &events[i]
+		if event.InProgress() && time.Since(unixTime(event.StartTime)) < stalledEventAge {
+			blocked = true
+			continue
+		}
+
+		result, err := p.ingest(ctx, event, false, false)
+		if ctx.Err() != nil {
+			// Beim Beenden bleibt der Cursor vor dem abgebrochenen Event stehen
+			if dirty {
+				return save()
+			}
+			return nil
+		}
+		if err != nil {
+			failures[event.ID]++
+			dirty = true
+			if attempts := failures[event.ID]; attempts < maxIngestAttempts {
+				log.Warnf("Frigate-Event %s konnte nicht übernommen werden (Versuch %d von %d): %v",
+					event.ID, attempts, maxIngestAttempts, err)
+				blocked = true
+				continue
+			}
+			log.Errorf("Frigate-Event %s nach %d Versuchen aufgegeben: %v", event.ID, maxIngestAttempts, err)
+			delete(failures, event.ID)
+		} else {
+			if _, failed := failures[event.ID]; failed {
+				delete(failures, event.ID)
+				dirty = true
+			}
+			if result == ingestIngested {
+				log.Infof("Frigate-Event %s (%s) über die API übernommen", event.ID, event.Camera)
+			}
+		}
+
+		if !blocked {
+			cursor.Position = event.StartTime
+			cursor.EventID = event.ID
+			if err := save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if dirty {
+		return save()
+	}
+	return nil
+}
+
+// Backfill übernimmt nachträglich alle Events eines Zeitraums im Hintergrund. Es kann
+// immer nur ein Backfill gleichzeitig laufen.
+func (p *EventPoller) Backfill(req BackfillRequest) (*BackfillStatus, error) {
+	if req.Before.IsZero() {
+		req.Before = time.Now()
+	}
+	if req.After.IsZero() || !req.After.Before(req.Before) {
+		return nil, fmt.Errorf("invalid time range")
+	}
+
+	p.statusMutex.Lock()
+	if p.backfill != nil && p.backfill.Running {
+		p.statusMutex.Unlock()
+		return nil, ErrBackfillRunning
+	}
+	p.backfill = &BackfillStatus{
+		Running:   true,
+		After:     req.After,
+		Before:    req.Before,
+		Cameras:   req.Cameras,
+		Reprocess: req.Reprocess,
+		StartedAt: time.Now(),
+	}
+	status := *p.backfill
+	p.statusMutex.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.runBackfill(req)
+	}()
+
+	return &status, nil
+}
+
+// BackfillStatus liefert den Fortschritt des letzten Backfills (nil, falls es keinen gab)
+func (p *EventPoller) BackfillStatus() *BackfillStatus {
+	p.statusMutex.RLock()
+	defer p.statusMutex.RUnlock()
+
+	if p.backfill == nil {
+		return nil
+	}
+	status := *p.backfill
+	return &status
+}
+
+// runBackfill arbeitet einen Backfill ab und aktualisiert dabei dessen Status
+func (p *EventPoller) runBackfill(req BackfillRequest) {
+	log.Infof("Frigate-Backfill gestartet: %s bis %s", req.After.Format(time.RFC3339), req.Before.Format(time.RFC3339))
+
+	events, err := p.fetchRange(p.ctx, float64(req.After.Unix()), float64(req.Before.Unix()), req.Cameras)
+	if err != nil {
+		p.finishBackfill(err)
+		return
+	}
+	p.updateBackfill(func(status *BackfillStatus) { status.Total = len(events) })
+
+	for i := range events {
+		event := &events[i]
+		if event.InProgress() {
+			// Laufende Events werden über MQTT bzw. die regelmäßige Abfrage übernommen
+			p.updateBackfill(func(status *BackfillStatus) { status.Skipped++ })
+			continue
+		}
+
+		result, err := p.ingest(p.ctx, event, true, req.Reprocess)
+		if p.ctx.Err() != nil {
+			p.finishBackfill(p.ctx.Err())
+			return
+		}
+		if err != nil {
+			log.Warnf("Frigate-Event %s konnte beim Backfill nicht übernommen werden: %v", event.ID, err)
+		}
+
+		p.updateBackfill(func(status *BackfillStatus) {
+			switch {
+			case err != nil:
+				status.Failed++
+			case result == ingestIngested:
+				status.Ingested++
+			case result == ingestReprocessed:
+				status.Reprocessed++
+			default:
+				status.Skipped++
+			}
+		})
+	}
+
+	p.finishBackfill(nil)
+}
+
+// updateBackfill ändert den Status des laufenden Backfills
+func (p *EventPoller) updateBackfill(update func(status *BackfillStatus)) {
+	p.statusMutex.Lock()
+	defer p.statusMutex.Unlock()
+	if p.backfill != nil {
+		update(p.backfill)
+	}
+}
+
+// finishBackfill schließt den laufenden Backfill ab
+func (p *EventPoller) finishBackfill(err error) {
+	p.updateBackfill(func(status *BackfillStatus) {
+		now := time.Now()
+		status.Running = false
+		status.FinishedAt = &now
+		if err != nil {
+			status.Error = err.Error()
+			log.Warnf("Frigate-Backfill abgebrochen: %v", err)
+		} else {
+			log.Infof("Frigate-Backfill abgeschlossen: %d Events, %d übernommen, %d erneut erkannt, %d übersprungen, %d fehlgeschlagen",
+				status.Total, status.Ingested, status.Reprocessed, status.Skipped, status.Failed)
+		}
+	})
+}
+
+// ingest übernimmt ein Event, sofern zu dessen ID noch kein Bild gespeichert ist.
+// Bereits bekannte Events werden übersprungen oder mit reprocess erneut erkannt.
+func (p *EventPoller) ingest(ctx context.Context, event *APIEvent, backfill, reprocess bool) (ingestResult, error) {
+	if !event.HasSnapshot || event.FalsePositive {
+		return ingestSkipped, nil
+	}
+	if event.Label != "person" && p.handler.ProcessPersonOnly([]string{event.Camera}) {
+		return ingestSkipped, nil
+	}
+
+	p.ingestMutex.Lock()
+	defer p.ingestMutex.Unlock()
+
+	var count int64
+	if err := p.db.Model(&models.Image{}).
+		Where("source = ? AND event_id = ?", "frigate", event.ID).
+		Count(&count).Error; err != nil {
+		return ingestSkipped, fmt.Errorf("fehler bei der Prüfung auf vorhandene Bilder: %w", err)
+	}
+
+	if count > 0 {
+		if !reprocess {
+			return ingestSkipped, nil
+		}
+		return ingestReprocessed, p.handler.ReprocessFrigateEvent(ctx, event.ID)
+	}
+
+	return ingestIngested, p.handler.IngestFrigateEvent(ctx, event.EventData(), backfill)
+}
+
+// fetchRange ruft alle Events zwischen after und before (0 = bis jetzt) seitenweise ab
+// und liefert sie aufsteigend nach Startzeit sortiert. Frigate filtert nur nach der
+// Startzeit: Jede Seite endet knapp hinter der ältesten Startzeit der vorherigen, doppelte
+// Events werden über ihre ID entfernt. Haben alle Events einer vollen Seite dieselbe
+// Startzeit, wird die Seite mit doppelter Größe erneut abgerufen.
+func (p *EventPoller) fetchRange(ctx context.Context, after, before float64, cameras []string) ([]APIEvent, error) {
+	pageSize := p.config.Polling.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPollPageSize
+	}
+
+	query := EventQuery{
+		After:       after,
+		Before:      before,
+		Cameras:     cameras,
+		HasSnapshot: true,
+		Limit:       pageSize,
+	}
+	if p.handler.ProcessPersonOnly(cameras) {
+		query.Labels = []string{"person"}
+	}
+
+	seen := make(map[string]bool)
+	var events []APIEvent
+	for {
+		page, err := p.client.ListEvents(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range page {
+			if !seen[event.ID] {
+				seen[event.ID] = true
+				events = append(events, event)
+			}
+		}
+		if len(page) < query.Limit {
+			break
+		}
+
+		oldest := page[len(page)-1].StartTime
+		if page[0].StartTime <= oldest {
+			// Ohne ältere Events auf der Seite käme die Abfrage nicht weiter
+			query.Limit *= 2
+			continue
+		}
+
+		// Nächste Seite: Events bis einschließlich der ältesten Startzeit dieser Seite.
+		// Die Grenze liegt vor der jüngsten Startzeit der Seite, die Abfrage kommt also voran.
+		query.Before = math.Nextafter(oldest, math.Inf(1))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime < events[j].StartTime
+	})
+	return events, nil
+}
+
+// unixTime wandelt einen Unix-Zeitstempel mit Nachkommastellen in time.Time um
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,317 @@
+package frigate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeLister liefert Events wie /api/events: gefiltert nach Startzeit und absteigend sortiert
+type fakeLister struct {
+	events []APIEvent
+	calls  int
+}
+
+func (f *fakeLister) ListEvents(ctx context.Context, query EventQuery) ([]APIEvent, error) {
+	f.calls++
+	if f.calls > 100 {
+		return nil, errors.New("too many requests, pagination does not terminate")
+	}
+
+	var page []APIEvent
+	for _, event := range f.events {
+		if query.After > 0 && event.StartTime <= query.After {
+			continue
+		}
+		if query.Before > 0 && event.StartTime >= query.Before {
+			continue
+		}
+		page = append(page, event)
+	}
+	sort.SliceStable(page, func(i, j int) bool {
+		return page[i].StartTime > page[j].StartTime
+	})
+	if query.Limit > 0 && len(page) > query.Limit {
+		page = page[:query.Limit]
+	}
+	return page, nil
+}
+
+// fakeHandler übernimmt Events als Bilder, außer denen in fail
+type fakeHandler struct {
+	db       *gorm.DB
+	fail     map[string]bool
+	ingested []string
+}
+
+func (h *fakeHandler) IngestFrigateEvent(ctx context.Context, event *FrigateEventData, backfill bool) error {
+	if h.fail[event.ID] {
+		return fmt.Errorf("event %s failed", event.ID)
+	}
+	h.ingested = append(h.ingested, event.ID)
+	return h.db.Create(&models.Image{FilePath: event.ID + ".jpg", Source: "frigate", EventID: event.ID}).Error
+}
+
+func (h *fakeHandler) ReprocessFrigateEvent(ctx context.Context, eventID string) error {
+	return nil
+}
+
+func (h *fakeHandler) ProcessPersonOnly(cameras []string) bool {
+	return false
+}
+
+// newTestPoller liefert einen Poller, der Events vom fakeLister abruft
+func newTestPoller(t *testing.T, db *gorm.DB, lister *fakeLister, handler *fakeHandler, pageSize int) *EventPoller {
+	t.Helper()
+	if handler.db == nil {
+		handler.db = db
+	}
+	p := NewEventPoller(nil, db, config.FrigateConfig{
+		Polling: config.FrigatePollingConfig{PageSize: pageSize},
+	}, handler)
+	p.client = lister
+	return p
+}
+
+// newTestDB liefert eine leere SQLite-Datenbank mit Bildern und Cursorn
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Image{}, &models.IngestCursor{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testEvent baut ein Event mit der angegebenen Startzeit, finished = bereits beendet
+func testEvent(id string, start float64, finished bool) APIEvent {
+	event := APIEvent{ID: id, Camera: "door", Label: "person", StartTime: start, HasSnapshot: true}
+	if finished {
+		end := start + 10
+		event.EndTime = &end
+	}
+	return event
+}
+
+func loadCursor(t *testing.T, db *gorm.DB) models.IngestCursor {
+	t.Helper()
+	var cursor models.IngestCursor
+	if err := db.Where("name = ?", pollerCursorName).First(&cursor).Error; err != nil {
+		t.Fatalf("failed to load cursor: %v", err)
+	}
+	return cursor
+}
+
+func TestPollKeepsCursorBeforeFailedAndRunningEvents(t *testing.T) {
+	base := float64(time.Now().Add(-10 * time.Minute).Unix())
+
+	tests := []struct {
+		name         string
+		events       []APIEvent
+		fail         map[string]bool
+		wantCursor   string
+		wantIngested []string
+		wantFailures map[string]int
+	}{
+		{
+			name: "all events ingested",
+			events: []APIEvent{
+				testEvent("a", base+1, true),
+				testEvent("b", base+2, true),
+			},
+			wantCursor:   "b",
+			wantIngested: []string{"a", "b"},
+			wantFailures: map[string]int{},
+		},
+		{
+			name: "failed event blocks the cursor",
+			events: []APIEvent{
+				testEvent("a", base+1, true),
+				testEvent("b", base+2, true),
+				testEvent("c", base+3, true),
+			},
+			fail:         map[string]bool{"b": true},
+			wantCursor:   "a",
+			wantIngested: []string{"a", "c"},
+			wantFailures: map[string]int{"b": 1},
+		},
+		{
+			name: "running event blocks the cursor",
+			events: []APIEvent{
+				testEvent("a", base+1, true),
+				testEvent("b", base+2, false),
+				testEvent("c", base+3, true),
+			},
+			wantCursor:   "a",
+			wantIngested: []string{"a", "c"},
+			wantFailures: map[string]int{},
+		},
+		{
+			name: "stalled event is ingested and does not block the cursor",
+			events: []APIEvent{
+				testEvent("a", base+1, true),
+				testEvent("b", base-2*stalledEventAge.Seconds(), false),
+			},
+			wantCursor:   "a",
+			wantIngested: []string{"b", "a"},
+			wantFailures: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			// Der Cursor beginnt vor allen Events, auch vor dem hängengebliebenen
+			db.Create(&models.IngestCursor{Name: pollerCursorName, Position: base - 3*stalledEventAge.Seconds()})
+
+			handler := &fakeHandler{fail: tt.fail}
+			p := newTestPoller(t, db, &fakeLister{events: tt.events}, handler, 10)
+			if err := p.poll(context.Background()); err != nil {
+				t.Fatalf("poll failed: %v", err)
+			}
+
+			cursor := loadCursor(t, db)
+			if cursor.EventID != tt.wantCursor {
+				t.Fatalf("cursor at %q, want %q", cursor.EventID, tt.wantCursor)
+			}
+			if fmt.Sprint(handler.ingested) != fmt.Sprint(tt.wantIngested) {
+				t.Fatalf("ingested %v, want %v", handler.ingested, tt.wantIngested)
+			}
+			if fmt.Sprint(cursor.FailureCounts()) != fmt.Sprint(tt.wantFailures) {
+				t.Fatalf("failures %v, want %v", cursor.FailureCounts(), tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestPollGivesUpAfterMaxAttemptsAcrossRestarts(t *testing.T) {
+	db := newTestDB(t)
+	base := float64(time.Now().Add(-10 * time.Minute).Unix())
+	lister := &fakeLister{events: []APIEvent{
+		testEvent("a", base+1, true),
+		testEvent("b", base+2, true),
+		testEvent("c", base+3, true),
+	}}
+
+	for attempt := 1; attempt < maxIngestAttempts; attempt++ {
+		// Jede Abfrage mit einem neuen Poller, wie nach einem Neustart
+		p := newTestPoller(t, db, lister, &fakeHandler{fail: map[string]bool{"b": true}}, 10)
+		if err := p.poll(context.Background()); err != nil {
+			t.Fatalf("poll %d failed: %v", attempt, err)
+		}
+		cursor := loadCursor(t, db)
+		if cursor.EventID != "a" || cursor.FailureCounts()["b"] != attempt {
+			t.Fatalf("poll %d: cursor at %q with failures %v", attempt, cursor.EventID, cursor.FailureCounts())
+		}
+	}
+
+	p := newTestPoller(t, db, lister, &fakeHandler{fail: map[string]bool{"b": true}}, 10)
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatalf("last poll failed: %v", err)
+	}
+	cursor := loadCursor(t, db)
+	if cursor.EventID != "c" || len(cursor.FailureCounts()) != 0 {
+		t.Fatalf("event should be given up after %d attempts, cursor at %q with failures %v",
+			maxIngestAttempts, cursor.EventID, cursor.FailureCounts())
+	}
+}
+
+func TestPollForgetsFailuresOfRecoveredEvents(t *testing.T) {
+	db := newTestDB(t)
+	base := float64(time.Now().Add(-10 * time.Minute).Unix())
+	lister := &fakeLister{events: []APIEvent{
+		testEvent("a", base+1, true),
+		testEvent("b", base+2, true),
+	}}
+
+	p := newTestPoller(t, db, lister, &fakeHandler{fail: map[string]bool{"b": true}}, 10)
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p = newTestPoller(t, db, lister, &fakeHandler{}, 10)
+	if err := p.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor := loadCursor(t, db)
+	if cursor.EventID != "b" || len(cursor.FailureCounts()) != 0 {
+		t.Fatalf("cursor at %q with failures %v, want b without failures", cursor.EventID, cursor.FailureCounts())
+	}
+}
+
+func TestFetchRangePagination(t *testing.T) {
+	sameStart := func(n int, start float64) []APIEvent {
+		var events []APIEvent
+		for i := 0; i < n; i++ {
+			events = append(events, testEvent(fmt.Sprintf("same-%d", i), start, true))
+		}
+		return events
+	}
+
+	tests := []struct {
+		name     string
+		events   []APIEvent
+		pageSize int
+	}{
+		{"fewer events than a page", []APIEvent{testEvent("a", 100, true), testEvent("b", 200, true)}, 5},
+		{"exactly one full page", []APIEvent{testEvent("a", 100, true), testEvent("b", 200, true)}, 2},
+		{"distinct start times over several pages", []APIEvent{
+			testEvent("a", 100, true), testEvent("b", 200, true), testEvent("c", 300, true),
+			testEvent("d", 400, true), testEvent("e", 500, true), testEvent("f", 600, true),
+			testEvent("g", 700, true),
+		}, 3},
+		{"full page with one start time", sameStart(7, 100), 3},
+		{"same start time across the page boundary", append(sameStart(4, 100),
+			testEvent("a", 50, true), testEvent("b", 150, true), testEvent("c", 200, true)), 3},
+		{"start times closer than a millisecond", []APIEvent{
+			testEvent("a", 100.0001, true), testEvent("b", 100.0002, true), testEvent("c", 100.0003, true),
+			testEvent("d", 100.0004, true), testEvent("e", 100.0005, true),
+		}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &fakeLister{events: tt.events}
+			p := newTestPoller(t, newTestDB(t), lister, &fakeHandler{}, tt.pageSize)
+
+			events, err := p.fetchRange(context.Background(), 1, 0, nil)
+			if err != nil {
+				t.Fatalf("fetchRange failed: %v", err)
+			}
+			if len(events) != len(tt.events) {
+				t.Fatalf("got %d events, want %d", len(events), len(tt.events))
+			}
+			seen := make(map[string]bool)
+			for i, event := range events {
+				if seen[event.ID] {
+					t.Fatalf("event %s returned twice", event.ID)
+				}
+				seen[event.ID] = true
+				if i > 0 && events[i-1].StartTime > event.StartTime {
+					t.Fatalf("events not sorted by start time: %v", events)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package homeassistant
+
+import (
+	"fmt"
+	"strings"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/integrations/mqtt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Befehle, die über <topic_prefix>/cmd/<befehl> ausgelöst werden
+const (
+	CommandRecognize = "recognize" // Bild einer URL oder aktuellen Schnappschuss einer Kamera erkennen
+	CommandPause     = "pause"     // Verarbeitung einer Kamera anhalten (cmd/pause/<kamera>)
+	CommandResume    = "resume"    // Verarbeitung einer Kamera fortsetzen (cmd/resume/<kamera>)
+	CommandProvider  = "provider"  // Primären Gesichtserkennungsdienst wechseln
+	CommandSync      = "sync"      // Identitäten mit CompreFace abgleichen
+	CommandPurge     = "purge"     // Alte oder alle Bilder löschen
+)
+
+// CommandState liefert den Zustand der über MQTT-Befehle steuerbaren Funktionen, damit
+// Discovery die passenden Schalter und Auswahlen samt aktuellem Zustand veröffentlichen kann
+type CommandState interface {
+	CameraPaused(camera string) bool
+	ProviderNames() []string
+	ActiveProvider() string
+}
+
+// TopicPrefix gibt das konfigurierte Präfix der Double-Take-Topics zurück
+func TopicPrefix(cfg *config.Config) string {
+	if cfg.MQTT.TopicPrefix == "" {
+		return "double-take"
+	}
+	return cfg.MQTT.TopicPrefix
+}
+
+// CommandTopic gibt das Topic eines Befehls zurück, optional mit Argument (z.B. Kamera)
+func CommandTopic(prefix, command string, args ...string) string {
+	return strings.Join(append([]string{prefix, "cmd", command}, args...), "/")
+}
+
+// ResponseTopic gibt das Topic zurück, auf dem das Ergebnis eines Befehls veröffentlicht wird
+func ResponseTopic(prefix, command string) string {
+	return fmt.Sprintf("%s/response/%s", prefix, command)
+}
+
+// CameraPausedTopic gibt das retained Zustands-Topic ("ON" = angehalten) einer Kamera zurück
+func CameraPausedTopic(prefix, camera string) string {
+	return fmt.Sprintf("%s/cameras/%s/paused", prefix, camera)
+}
+
+// ProviderTopic gibt das retained Topic mit dem primären Gesichtserkennungsdienst zurück
+func ProviderTopic(prefix string) string {
+	return prefix + "/provider"
+}
+
+// ButtonConfig repräsentiert die MQTT-Discovery-Konfiguration für einen Taster in Home Assistant
+type ButtonConfig struct {
+	Name                string  `json:"name"`
+	UniqueID            string  `json:"unique_id"`
+	CommandTopic        string  `json:"command_topic"`
+	PayloadPress        string  `json:"payload_press,omitempty"`
+	Icon                string  `json:"icon,omitempty"`
+	AvailabilityTopic   string  `json:"availability_topic,omitempty"`
+	PayloadAvailable    string  `json:"payload_available,omitempty"`
+	PayloadNotAvailable string  `json:"payload_not_available,omitempty"`
+	Device              *Device `json:"device,omitempty"`
+	EntityCategory      string  `json:"entity_category,omitempty"`
+}
+
+// SwitchConfig repräsentiert die MQTT-Discovery-Konfiguration für einen Schalter in Home Assistant
+type SwitchConfig struct {
+	Name                string  `json:"name"`
+	UniqueID            string  `json:"unique_id"`
+	CommandTopic        string  `json:"command_topic"`
+	StateTopic          string  `json:"state_topic"`
+	PayloadOn           string  `json:"payload_on,omitempty"`
+	PayloadOff          string  `json:"payload_off,omitempty"`
+	Icon                string  `json:"icon,omitempty"`
+	AvailabilityTopic   string  `json:"availability_topic,omitempty"`
+	PayloadAvailable    string  `json:"payload_available,omitempty"`
+	PayloadNotAvailable string  `json:"payload_not_available,omitempty"`
+	Device              *Device `json:"device,omitempty"`
+	EntityCategory      string  `json:"entity_category,omitempty"`
+}
+
+// SelectConfig repräsentiert die MQTT-Discovery-Konfiguration für eine Auswahl in Home Assistant
+type SelectConfig struct {
+	Name                string   `json:"name"`
+	UniqueID            string   `json:"unique_id"`
+	CommandTopic        string   `json:"command_topic"`
+	StateTopic          string   `json:"state_topic"`
+	Options             []string `json:"options"`
+	Icon                string   `json:"icon,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic,omitempty"`
+	PayloadAvailable    string   `json:"payload_available,omitempty"`
+	PayloadNotAvailable string   `json:"payload_not_available,omitempty"`
+	Device              *Device  `json:"device,omitempty"`
+	EntityCategory      string   `json:"entity_category,omitempty"`
+}
+
+// SetCommandState aktiviert die Entitäten für MQTT-Befehle (Taster, Schalter, Auswahl)
+func (dm *DiscoveryManager) SetCommandState(state CommandState) {
+	dm.commandState = state
+}
+
+// commandEntities erstellt die Taster für Abgleich und Bereinigung sowie die Auswahl des
+// Gesichtserkennungsdiensts und veröffentlicht dessen aktuellen Zustand
+func (dm *DiscoveryManager) commandEntities(device *Device) []discoveryEntity {
+	if dm.commandState == nil {
+		return nil
+	}
+	prefix := TopicPrefix(dm.cfg)
+	var entities []discoveryEntity
+
+	if dm.cfg.CompreFace.Enabled {
+		entities = append(entities, discoveryEntity{
+			topic: fmt.Sprintf("%s/button/%s/sync/config", dm.discoveryPrefix(), NodeID),
+			config: ButtonConfig{
+				Name:                "CompreFace synchronisieren",
+				UniqueID:            "double_take_sync",
+				CommandTopic:        CommandTopic(prefix, CommandSync),
+				Icon:                "mdi:sync",
+				AvailabilityTopic:   StatusTopic(dm.cfg),
+				PayloadAvailable:    "online",
+				PayloadNotAvailable: "offline",
+				Device:              device,
+				EntityCategory:      "config",
+			},
+		})
+	}
+
+	// Ohne Aufbewahrungsdauer gibt es keine "alten" Bilder, alles löschen nur per Befehl
+	if dm.cfg.Cleanup.RetentionDays > 0 {
+		entities = append(entities, discoveryEntity{
+			topic: fmt.Sprintf("%s/button/%s/purge/config", dm.discoveryPrefix(), NodeID),
+			config: ButtonConfig{
+				Name:                "Alte Bilder löschen",
+				UniqueID:            "double_take_purge",
+				CommandTopic:        CommandTopic(prefix, CommandPurge),
+				PayloadPress:        "retention",
+				Icon:                "mdi:delete-clock",
+				AvailabilityTopic:   StatusTopic(dm.cfg),
+				PayloadAvailable:    "online",
+				PayloadNotAvailable: "offline",
+				Device:              device,
+				EntityCategory:      "config",
+			},
+		})
+	}
+
+	if providers := dm.commandState.ProviderNames(); len(providers) > 1 {
+		stateTopic := ProviderTopic(prefix)
+		if err := dm.mqttClient.PublishAs(mqtt.ClassState, stateTopic, dm.commandState.ActiveProvider()); err != nil {
+			log.Warnf("Failed to publish active provider: %v", err)
+		}
+		entities = append(entities, discoveryEntity{
+			topic: fmt.Sprintf("%s/select/%s/provider/config", dm.discoveryPrefix(), NodeID),
+			config: SelectConfig{
+				Name:                "Gesichtserkennung",
+				UniqueID:            "double_take_provider",
+				CommandTopic:        CommandTopic(prefix, CommandProvider),
+				StateTopic:          stateTopic,
+				Options:             providers,
+				Icon:                "mdi:face-recognition",
+				AvailabilityTopic:   StatusTopic(dm.cfg),
+				PayloadAvailable:    "online",
+				PayloadNotAvailable: "offline",
+				Device:              device,
+				EntityCategory:      "config",
+			},
+			retained: []string{stateTopic},
+		})
+	}
+
+	return entities
+}
+
+// cameraCommandEntities erstellt den Schalter zum Anhalten der Verarbeitung einer Kamera
+// und bei aktivem Frigate einen Taster zum Erkennen des aktuellen Schnappschusses
+func (dm *DiscoveryManager) cameraCommandEntities(camera string, device *Device) []discoveryEntity {
+	if dm.commandState == nil {
+		return nil
+	}
+	prefix := TopicPrefix(dm.cfg)
+	slug := entitySlug(camera)
+	stateTopic := CameraPausedTopic(prefix, camera)
+
+	state := "OFF"
+	if dm.commandState.CameraPaused(camera) {
+		state = "ON"
+	}
+	if err := dm.mqttClient.PublishAs(mqtt.ClassState, stateTopic, state); err != nil {
+		log.Warnf("Failed to publish pause state of camera %s: %v", camera, err)
+	}
+
+	entities := []discoveryEntity{{
+		topic: fmt.Sprintf("%s/switch/%s/camera_%s_paused/config", dm.discoveryPrefix(), NodeID, slug),
+		config: SwitchConfig{
+			Name:                fmt.Sprintf("%s Verarbeitung angehalten", camera),
+			UniqueID:            fmt.Sprintf("double_take_camera_%s_paused", slug),
+			CommandTopic:        CommandTopic(prefix, CommandPause, camera),
+			StateTopic:          stateTopic,
+			PayloadOn:           "ON",
+			PayloadOff:          "OFF",
+			Icon:                "mdi:pause-circle",
+			AvailabilityTopic:   StatusTopic(dm.cfg),
+			PayloadAvailable:    "online",
+			PayloadNotAvailable: "offline",
+			Device:              device,
+			EntityCategory:      "config",
+		},
+		retained: []string{stateTopic},
+	}}
+
+	if dm.cfg.Frigate.Enabled {
+		entities = append(entities, discoveryEntity{
+			topic: fmt.Sprintf("%s/button/%s/camera_%s_recognize/config", dm.discoveryPrefix(), NodeID, slug),
+			config: ButtonConfig{
+				Name:                fmt.Sprintf("%s Jetzt erkennen", camera),
+				UniqueID:            fmt.Sprintf("double_take_camera_%s_recognize", slug),
+				CommandTopic:        CommandTopic(prefix, CommandRecognize),
+				PayloadPress:        camera,
+				Icon:                "mdi:face-recognition",
+				AvailabilityTopic:   StatusTopic(dm.cfg),
+				PayloadAvailable:    "online",
+				PayloadNotAvailable: "offline",
+				Device:              device,
+			},
+		})
+	}
+
+	return entities
+}
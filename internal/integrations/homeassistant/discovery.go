@@ -2,13 +2,14 @@ package homeassistant
 
 import (
 	"fmt"
-	"strings"
+	"sync"
 
 	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/core/models"
 	"double-take-go-reborn/internal/integrations/mqtt"
 
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // Constants for Home Assistant MQTT Discovery
@@ -90,15 +91,27 @@ type CameraConfig struct {
 type DiscoveryManager struct {
 	mqttClient  *mqtt.Client
 	cfg         *config.Config
+	db          *gorm.DB
 	registeredEntities map[string]bool // Speichert bereits registrierte Entitäten um Duplikate zu vermeiden
+	mu          sync.Mutex      // Serialisiert die Veröffentlichung der Entitäten
+	published   map[string]bool // Topics der zuletzt veröffentlichten Identitäts- und Kamera-Entitäten
+	loaded      bool            // published wurde aus dem Manifest geladen
+	cameras     map[string]bool // Bekannte Kameras
+	camerasMu   sync.Mutex
+	refresh     chan struct{}
+	commandState CommandState // Zustand der MQTT-Befehle, nil = keine Befehls-Entitäten
 }
 
 // NewDiscoveryManager erstellt einen neuen Manager für Home Assistant Discovery
-func NewDiscoveryManager(mqttClient *mqtt.Client, cfg *config.Config) *DiscoveryManager {
+func NewDiscoveryManager(mqttClient *mqtt.Client, cfg *config.Config, db *gorm.DB) *DiscoveryManager {
 	return &DiscoveryManager{
 		mqttClient: mqttClient,
 		cfg:        cfg,
+		db:         db,
 		registeredEntities: make(map[string]bool),
+		published:  make(map[string]bool),
+		cameras:    make(map[string]bool),
+		refresh:    make(chan struct{}, 1),
 	}
 }
 
@@ -132,6 +145,12 @@ func (dm *DiscoveryManager) RegisterIdentities(identities []models.Identity) err
 		return err
 	}
 
+	// Je Identität und Kamera eigene Entitäten, entfernte werden gelöscht
+	if err := dm.registerEntities(identities, device); err != nil {
+		log.Errorf("Failed to register identity and camera entities: %v", err)
+		return err
+	}
+
 	log.Infof("Successfully registered Home Assistant entities")
 	return nil
 }
@@ -156,17 +175,17 @@ func (dm *DiscoveryManager) registerSimpleSensors(device *Device) error {
 	// Discovery-Topic für den Sensor - Format: <discovery_prefix>/<component>/<object_id>/config
 	// Für Home Assistant muss object_id eine eindeutige ID sein
 	sensorTopic := fmt.Sprintf("%s/%s/double_take_person/config", 
-		DiscoveryPrefix, 
+		dm.discoveryPrefix(), 
 		ComponentSensor)
 
 	// Konfiguration für Sensor senden
 	log.Info("Registering Home Assistant person sensor entity")
-	if err := dm.mqttClient.PublishRetain(sensorTopic, sensorConfig); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, sensorTopic, sensorConfig); err != nil {
 		return fmt.Errorf("failed to publish person sensor configuration: %w", err)
 	}
 	
 	// Initialisiere den Sensor mit Standardwert "unbekannt"
-	if err := dm.mqttClient.PublishRetain("double-take/person", "unbekannt"); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassState, "double-take/person", "unbekannt"); err != nil {
 		log.Warnf("Failed to set initial value for person sensor: %v", err)
 		// Kein Abbruch, wenn nur der Initialwert nicht gesetzt werden kann
 	}
@@ -185,118 +204,19 @@ func (dm *DiscoveryManager) registerSimpleSensors(device *Device) error {
 
 	// Discovery-Topic für Kamera
 	cameraTopic := fmt.Sprintf("%s/%s/%s/detection_image/config", 
-		DiscoveryPrefix, 
+		dm.discoveryPrefix(), 
 		ComponentCamera, 
 		NodeID)
 
 	// Konfiguration für Kamera senden
 	log.Info("Registering Home Assistant detection camera entity")
-	if err := dm.mqttClient.PublishRetain(cameraTopic, cameraConfig); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, cameraTopic, cameraConfig); err != nil {
 		return fmt.Errorf("failed to publish camera configuration: %w", err)
 	}
 
 	return nil
 }
 
-// registerIdentitySensor erstellt eine Discovery-Konfiguration für eine einzelne Identität
-func (dm *DiscoveryManager) registerIdentitySensor(identity models.Identity, device *Device) error {
-	// Normalisiere den Namen für Topic-Verwendung (nur Kleinbuchstaben, keine Sonderzeichen, Leerzeichen durch Unterstrich ersetzen)
-	normalizedName := strings.ToLower(identity.Name)
-	normalizedName = strings.ReplaceAll(normalizedName, " ", "_")
-	
-	// Prüfen, ob die Entität bereits registriert wurde
-	entityKey := fmt.Sprintf("identity_%s", normalizedName)
-	if _, exists := dm.registeredEntities[entityKey]; exists {
-		log.Debugf("Identity %s is already registered, skipping", identity.Name)
-		return nil
-	}
-	
-	// 1. Anwesenheits-Sensor (binary_sensor) registrieren
-	binarySensorConfig := BinarySensorConfig{
-		Name:              fmt.Sprintf("%s Anwesenheit", identity.Name),
-		UniqueID:          fmt.Sprintf("double_take_%s_presence", normalizedName),
-		StateTopic:        fmt.Sprintf("double-take/presence/%s", normalizedName),
-		JSONAttributesTopic: fmt.Sprintf("double-take/presence/%s/attributes", normalizedName),
-		Icon:              "mdi:account",
-		PayloadOn:         "on",
-		PayloadOff:        "off",
-		ExpireAfter:       PresenceTimeout, // Automatisch ausschalten nach X Sekunden
-		PictureEntityID:   "{{ value_json.image_data }}", // Bildvorlage für erkannte Gesichter
-		AvailabilityTopic: "double-take/status",
-		PayloadAvailable:  "online",
-		PayloadNotAvailable: "offline",
-		Device:            device,
-		EntityCategory:    "diagnostic", // Als diagnostische Entität markieren
-	}
-
-	// Discovery-Topic für Anwesenheits-Sensor
-	binarySensorTopic := fmt.Sprintf("%s/%s/%s/%s_presence/config", 
-		DiscoveryPrefix, 
-		ComponentBinarySensor, 
-		NodeID,
-		normalizedName)
-
-	// Konfiguration für Anwesenheits-Sensor senden
-	log.Debugf("Registering Home Assistant presence sensor for identity: %s", identity.Name)
-	if err := dm.mqttClient.PublishRetain(binarySensorTopic, binarySensorConfig); err != nil {
-		return fmt.Errorf("failed to publish presence sensor configuration: %w", err)
-	}
-	
-	// 2. Informations-Sensor (letzter Standort etc.) registrieren - als versteckte Entität
-	sensorConfig := SensorConfig{
-		Name:              fmt.Sprintf("%s Info", identity.Name),
-		UniqueID:          fmt.Sprintf("double_take_%s_info", normalizedName),
-		StateTopic:        fmt.Sprintf("double-take/presence/%s/location", normalizedName),
-		Icon:              "mdi:information-outline",
-		AvailabilityTopic: "double-take/status",
-		PayloadAvailable:  "online",
-		PayloadNotAvailable: "offline",
-		Device:            device,
-		EntityCategory:    "diagnostic", // Als diagnostische Entität markieren
-	}
-
-	// Discovery-Topic für Info-Sensor
-	infoSensorTopic := fmt.Sprintf("%s/%s/%s/%s_info/config", 
-		DiscoveryPrefix, 
-		ComponentSensor, 
-		NodeID,
-		normalizedName)
-
-	// Konfiguration für Info-Sensor senden
-	log.Debugf("Registering Home Assistant info sensor for identity: %s", identity.Name)
-	if err := dm.mqttClient.PublishRetain(infoSensorTopic, sensorConfig); err != nil {
-		return fmt.Errorf("failed to publish info sensor configuration: %w", err)
-	}
-
-	// 3. Kamera-Element für das Erkennungsbild registrieren - als versteckte Entität
-	cameraConfig := CameraConfig{
-		Name:              fmt.Sprintf("%s Bild", identity.Name),
-		UniqueID:          fmt.Sprintf("double_take_%s_image", normalizedName),
-		Topic:             fmt.Sprintf("double-take/presence/%s/image", normalizedName),
-		AvailabilityTopic: "double-take/status",
-		PayloadAvailable:  "online",
-		PayloadNotAvailable: "offline",
-		Device:            device,
-	}
-
-	// Discovery-Topic für Kamera
-	cameraTopic := fmt.Sprintf("%s/%s/%s/%s_image/config", 
-		DiscoveryPrefix, 
-		ComponentCamera, 
-		NodeID,
-		normalizedName)
-
-	// Konfiguration für Kamera senden
-	log.Debugf("Registering Home Assistant camera for identity: %s", identity.Name)
-	if err := dm.mqttClient.PublishRetain(cameraTopic, cameraConfig); err != nil {
-		return fmt.Errorf("failed to publish camera configuration: %w", err)
-	}
-
-	// Markieren, dass diese Entität registriert wurde
-	dm.registeredEntities[entityKey] = true
-	return nil
-}
-
 // registerUnknownSensor erstellt eine Discovery-Konfiguration für unbekannte Gesichter
 func (dm *DiscoveryManager) registerUnknownSensor(device *Device) error {
 	// Prüfen, ob die Entität bereits registriert wurde
@@ -327,12 +247,12 @@ func (dm *DiscoveryManager) registerUnknownSensor(device *Device) error {
 
 	// Discovery-Topic für Anwesenheits-Sensor - Format: <discovery_prefix>/<component>/<object_id>/config
 	binarySensorTopic := fmt.Sprintf("%s/%s/double_take_unknown_presence/config", 
-		DiscoveryPrefix, 
+		dm.discoveryPrefix(), 
 		ComponentBinarySensor)
 
 	// Konfiguration für Anwesenheits-Sensor senden
 	log.Debug("Registering Home Assistant presence sensor for unknown faces")
-	if err := dm.mqttClient.PublishRetain(binarySensorTopic, binarySensorConfig); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, binarySensorTopic, binarySensorConfig); err != nil {
 		return fmt.Errorf("failed to publish presence sensor configuration: %w", err)
 	}
 	
@@ -351,12 +271,12 @@ func (dm *DiscoveryManager) registerUnknownSensor(device *Device) error {
 
 	// Discovery-Topic für Info-Sensor - Format: <discovery_prefix>/<component>/<object_id>/config
 	infoSensorTopic := fmt.Sprintf("%s/%s/double_take_unknown_info/config", 
-		DiscoveryPrefix, 
+		dm.discoveryPrefix(), 
 		ComponentSensor)
 
 	// Konfiguration für Info-Sensor senden
 	log.Debug("Registering Home Assistant info sensor for unknown faces")
-	if err := dm.mqttClient.PublishRetain(infoSensorTopic, sensorConfig); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, infoSensorTopic, sensorConfig); err != nil {
 		return fmt.Errorf("failed to publish info sensor configuration: %w", err)
 	}
 
@@ -373,12 +293,12 @@ func (dm *DiscoveryManager) registerUnknownSensor(device *Device) error {
 
 	// Discovery-Topic für Kamera - Format: <discovery_prefix>/<component>/<object_id>/config
 	cameraTopic := fmt.Sprintf("%s/%s/double_take_unknown_image/config", 
-		DiscoveryPrefix, 
+		dm.discoveryPrefix(), 
 		ComponentCamera)
 
 	// Konfiguration für Kamera senden
 	log.Debug("Registering Home Assistant camera for unknown faces")
-	if err := dm.mqttClient.PublishRetain(cameraTopic, cameraConfig); err != nil {
+	if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, cameraTopic, cameraConfig); err != nil {
 		return fmt.Errorf("failed to publish camera configuration: %w", err)
 	}
 
@@ -394,6 +314,12 @@ func (dm *DiscoveryManager) PublishAvailability(online bool) error {
 		status = "online"
 	}
 	
-	// Status an MQTT senden
-	return dm.mqttClient.PublishRetain("double-take/status", status)
+	// Status an MQTT senden. Die ursprünglichen Sensoren verwenden weiterhin
+	// double-take/status, alle übrigen Entitäten das Topic mit dem konfigurierten Präfix.
+	if topic := StatusTopic(dm.cfg); topic != "double-take/status" {
+		if err := dm.mqttClient.PublishAs(mqtt.ClassStatus, topic, status); err != nil {
+			return err
+		}
+	}
+	return dm.mqttClient.PublishAs(mqtt.ClassStatus, "double-take/status", status)
 }
@@ -0,0 +1,318 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/mqtt"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// entityManifestTopic gibt das Topic zurück, das die Topics der zuletzt veröffentlichten
+// Identitäts-, Kamera- und Befehls-Entitäten enthält, damit entfernte Entitäten auch nach
+// einem Neustart gelöscht werden
+func entityManifestTopic(cfg *config.Config) string {
+	return TopicPrefix(cfg) + "/discovery/entities"
+}
+
+// StatusTopic gibt das Topic der Verfügbarkeit zurück (siehe mqtt.Client)
+func StatusTopic(cfg *config.Config) string {
+	return TopicPrefix(cfg) + "/status"
+}
+
+// PresenceTopic gibt das Topic des Anwesenheitszustands einer Identität zurück
+func PresenceTopic(cfg *config.Config, identity string) string {
+	return fmt.Sprintf("%s/presence/%s", TopicPrefix(cfg), identity)
+}
+
+// CameraStateTopic gibt das Topic mit der zuletzt erkannten Person einer Kamera zurück
+func CameraStateTopic(cfg *config.Config, camera string) string {
+	return fmt.Sprintf("%s/cameras/%s/state", TopicPrefix(cfg), camera)
+}
+
+// discoveryEntity ist eine Entität mit Discovery-Topic, Konfiguration und den retained
+// Zustands-Topics, die beim Entfernen der Entität ebenfalls gelöscht werden
+type discoveryEntity struct {
+	topic    string
+	config   interface{}
+	retained []string
+}
+
+// discoveryPrefix gibt das konfigurierte Discovery-Präfix zurück
+func (dm *DiscoveryManager) discoveryPrefix() string {
+	if prefix := dm.cfg.MQTT.HomeAssistant.DiscoveryPrefix; prefix != "" {
+		return prefix
+	}
+	return DiscoveryPrefix
+}
+
+// Start hält die Entitäten aktuell: Nach jeder Änderung an einer Identität (anlegen,
+// umbenennen, löschen) und bei neuen Kameras werden sie neu veröffentlicht, zusätzlich
+// regelmäßig als Abgleich für Änderungen außerhalb von GORM.
+func (dm *DiscoveryManager) Start(ctx context.Context) {
+	if err := dm.watchIdentities(); err != nil {
+		log.Errorf("Failed to watch identity changes for Home Assistant discovery: %v", err)
+	}
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dm.refresh:
+			// Mehrere Änderungen kurz hintereinander (z.B. Zusammenführen) zusammenfassen
+			time.Sleep(2 * time.Second)
+			select {
+			case <-dm.refresh:
+			default:
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := dm.Sync(); err != nil {
+			log.Errorf("Failed to update Home Assistant entities: %v", err)
+		}
+	}
+}
+
+// Refresh fordert eine erneute Veröffentlichung aller Entitäten an
+func (dm *DiscoveryManager) Refresh() {
+	select {
+	case dm.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Sync lädt alle Identitäten und veröffentlicht die Discovery-Konfigurationen
+func (dm *DiscoveryManager) Sync() error {
+	var identities []models.Identity
+	if err := dm.db.Order("name").Find(&identities).Error; err != nil {
+		return fmt.Errorf("failed to load identities: %w", err)
+	}
+	return dm.RegisterIdentities(identities)
+}
+
+// EnsureCamera registriert die Entitäten einer bisher unbekannten Kamera
+func (dm *DiscoveryManager) EnsureCamera(camera string) {
+	if camera == "" {
+		return
+	}
+	dm.camerasMu.Lock()
+	known := dm.cameras[camera]
+	dm.cameras[camera] = true
+	dm.camerasMu.Unlock()
+
+	if !known {
+		dm.Refresh()
+	}
+}
+
+// watchIdentities registriert GORM-Callbacks, die bei jeder Änderung an Identitäten
+// eine Aktualisierung anfordern
+func (dm *DiscoveryManager) watchIdentities() error {
+	trigger := func(tx *gorm.DB) {
+		if tx.Error == nil && tx.Statement.Schema != nil && tx.Statement.Schema.Table == "identities" {
+			dm.Refresh()
+		}
+	}
+
+	callbacks := dm.db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("homeassistant:identity_create", trigger); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("homeassistant:identity_update", trigger); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("homeassistant:identity_delete", trigger)
+}
+
+// registerEntities veröffentlicht die Entitäten aller Identitäten und Kameras und löscht
+// die Konfigurationen und Zustände entfernter Entitäten mit leeren retained Nachrichten
+func (dm *DiscoveryManager) registerEntities(identities []models.Identity, device *Device) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if !dm.loaded {
+		dm.loadManifest()
+	}
+
+	var entities []discoveryEntity
+	for _, identity := range identities {
+		entities = append(entities, dm.identityEntities(identity, device)...)
+	}
+	cameras, err := dm.knownCameras()
+	if err != nil {
+		log.Warnf("Failed to load cameras for Home Assistant discovery: %v", err)
+	}
+	for _, camera := range cameras {
+		entities = append(entities, dm.cameraEntities(camera, device)...)
+		entities = append(entities, dm.cameraCommandEntities(camera, device)...)
+	}
+	entities = append(entities, dm.commandEntities(device)...)
+
+	current := make(map[string]bool)
+	for _, entity := range entities {
+		if err := dm.mqttClient.PublishAs(mqtt.ClassDiscovery, entity.topic, entity.config); err != nil {
+			return fmt.Errorf("failed to publish discovery configuration %s: %w", entity.topic, err)
+		}
+		current[entity.topic] = true
+		for _, topic := range entity.retained {
+			current[topic] = true
+		}
+	}
+
+	// Entfernte Entitäten löschen: zuerst die Konfiguration, dann die Zustände
+	var removed []string
+	for topic := range dm.published {
+		if !current[topic] {
+			removed = append(removed, topic)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return strings.HasPrefix(removed[i], dm.discoveryPrefix()+"/") && !strings.HasPrefix(removed[j], dm.discoveryPrefix()+"/")
+	})
+	for _, topic := range removed {
+		if err := dm.mqttClient.PublishRetain(topic, ""); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", topic, err)
+		}
+		log.Infof("Removed Home Assistant entity topic %s", topic)
+	}
+
+	dm.published = current
+	topics := make([]string, 0, len(current))
+	for topic := range current {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	if err := dm.mqttClient.PublishRetain(entityManifestTopic(dm.cfg), topics); err != nil {
+		log.Warnf("Failed to publish Home Assistant entity manifest: %v", err)
+	}
+
+	log.Infof("Registered Home Assistant entities for %d identities and %d cameras", len(identities), len(cameras))
+	return nil
+}
+
+// loadManifest liest die Topics der vor dem Neustart veröffentlichten Entitäten.
+// Muss mit gehaltenem Mutex aufgerufen werden.
+func (dm *DiscoveryManager) loadManifest() {
+	payload, err := dm.mqttClient.GetRetainedPayload(entityManifestTopic(dm.cfg))
+	if err != nil {
+		log.Warnf("Failed to read Home Assistant entity manifest: %v", err)
+		return
+	}
+	dm.loaded = true
+	if payload == "" {
+		return
+	}
+
+	var topics []string
+	if err := json.Unmarshal([]byte(payload), &topics); err != nil {
+		log.Warnf("Invalid Home Assistant entity manifest: %v", err)
+		return
+	}
+	for _, topic := range topics {
+		dm.published[topic] = true
+	}
+}
+
+// knownCameras gibt alle Kameras mit Frigate-Events sowie die zur Laufzeit gemeldeten zurück
+func (dm *DiscoveryManager) knownCameras() ([]string, error) {
+	var cameras []string
+	err := dm.db.Model(&models.EventVerdict{}).
+		Where("camera <> ''").
+		Distinct().
+		Pluck("camera", &cameras).Error
+
+	dm.camerasMu.Lock()
+	for _, camera := range cameras {
+		dm.cameras[CleanCameraName(camera)] = true
+	}
+	result := make([]string, 0, len(dm.cameras))
+	for camera := range dm.cameras {
+		result = append(result, camera)
+	}
+	dm.camerasMu.Unlock()
+
+	sort.Strings(result)
+	return result, err
+}
+
+// identityEntities erstellt den Anwesenheitssensor einer Identität. Die IDs beruhen auf
+// der Datenbank-ID, damit eine umbenannte Identität ihre Entität behält.
+func (dm *DiscoveryManager) identityEntities(identity models.Identity, device *Device) []discoveryEntity {
+	stateTopic := PresenceTopic(dm.cfg, identity.Name)
+	attributesTopic := stateTopic + "/attributes"
+
+	presenceSensor := BinarySensorConfig{
+		Name:                identity.Name,
+		UniqueID:            fmt.Sprintf("double_take_identity_%d", identity.ID),
+		StateTopic:          stateTopic,
+		JSONAttributesTopic: attributesTopic,
+		DeviceClass:         DeviceClassPresence,
+		Icon:                "mdi:account",
+		PayloadOn:           "ON",
+		PayloadOff:          "OFF",
+		AvailabilityTopic:   StatusTopic(dm.cfg),
+		PayloadAvailable:    "online",
+		PayloadNotAvailable: "offline",
+		Device:              device,
+	}
+	// Ohne Anwesenheitserkennung meldet niemand das Verlassen
+	if !dm.cfg.Presence.Enabled {
+		presenceSensor.ExpireAfter = PresenceTimeout
+	}
+
+	return []discoveryEntity{{
+		topic:    fmt.Sprintf("%s/%s/%s/identity_%d/config", dm.discoveryPrefix(), ComponentBinarySensor, NodeID, identity.ID),
+		config:   presenceSensor,
+		retained: []string{stateTopic, attributesTopic},
+	}}
+}
+
+// cameraEntities erstellt den Sensor mit der zuletzt erkannten Person einer Kamera
+func (dm *DiscoveryManager) cameraEntities(camera string, device *Device) []discoveryEntity {
+	slug := entitySlug(camera)
+	stateTopic := CameraStateTopic(dm.cfg, camera)
+
+	lastPerson := SensorConfig{
+		Name:                fmt.Sprintf("%s Erkannte Person", camera),
+		UniqueID:            fmt.Sprintf("double_take_camera_%s", slug),
+		StateTopic:          stateTopic,
+		ValueTemplate:       "{{ value_json.name }}",
+		JSONAttributesTopic: stateTopic,
+		Icon:                "mdi:cctv",
+		AvailabilityTopic:   StatusTopic(dm.cfg),
+		PayloadAvailable:    "online",
+		PayloadNotAvailable: "offline",
+		Device:              device,
+	}
+
+	return []discoveryEntity{{
+		topic:    fmt.Sprintf("%s/%s/%s/camera_%s/config", dm.discoveryPrefix(), ComponentSensor, NodeID, slug),
+		config:   lastPerson,
+		retained: []string{stateTopic},
+	}}
+}
+
+// entitySlug wandelt einen Namen in eine für Discovery-Topics und IDs gültige Form
+func entitySlug(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
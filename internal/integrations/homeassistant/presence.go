@@ -0,0 +1,74 @@
+package homeassistant
+
+import (
+	"fmt"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/mqtt"
+)
+
+// PresenceMessage ist die Nutzlast auf dem Topic <topic_prefix>/presence/events
+type PresenceMessage struct {
+	Type       string  `json:"type"` // "arrived" oder "left"
+	SessionID  uint    `json:"session_id"`
+	IdentityID uint    `json:"identity_id"`
+	Identity   string  `json:"identity"`
+	Camera     string  `json:"camera,omitempty"` // Leer = unabhängig von der Kamera
+	Zone       string  `json:"zone,omitempty"`
+	StartedAt  string  `json:"started_at"`
+	LastSeenAt string  `json:"last_seen_at"`
+	EndedAt    string  `json:"ended_at,omitempty"`
+	Duration   float64 `json:"duration"` // Dauer des Aufenthalts in Sekunden
+	Detections int     `json:"detections"`
+	Confidence float64 `json:"confidence"`
+	ImageID    uint    `json:"image_id"`
+}
+
+// PublishPresence meldet Ankunft und Verlassen einer Identität. Das Ereignis wird auf
+// <topic_prefix>/presence/events veröffentlicht, der Zustand ("ON"/"OFF") retained auf
+// <topic_prefix>/presence/<identität>[/<kamera>[/<zone>]], damit Automationen nur auf
+// Ankünfte statt auf jede einzelne Erkennung reagieren.
+func (p *Publisher) PublishPresence(event models.PresenceEvent) error {
+	session := event.Session
+	camera := CleanCameraName(session.Camera)
+
+	message := PresenceMessage{
+		Type:       event.Type,
+		SessionID:  session.ID,
+		IdentityID: session.IdentityID,
+		Identity:   session.Identity.Name,
+		Camera:     camera,
+		Zone:       session.Zone,
+		StartedAt:  session.StartedAt.Format(time.RFC3339),
+		LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+		Duration:   session.LastSeenAt.Sub(session.StartedAt).Seconds(),
+		Detections: session.Detections,
+		Confidence: session.BestConfidence,
+		ImageID:    session.ImageID,
+	}
+	if session.EndedAt != nil {
+		message.EndedAt = session.EndedAt.Format(time.RFC3339)
+		message.Duration = session.EndedAt.Sub(session.StartedAt).Seconds()
+	}
+
+	stateTopic := PresenceTopic(p.cfg, session.Identity.Name)
+	if camera != "" {
+		stateTopic += "/" + camera
+		if session.Zone != "" {
+			stateTopic += "/" + session.Zone
+		}
+	}
+	state := "ON"
+	if event.Type == models.PresenceLeft {
+		state = "OFF"
+	}
+
+	if err := p.mqttClient.PublishAs(mqtt.ClassState, stateTopic, state); err != nil {
+		return fmt.Errorf("failed to publish presence state: %w", err)
+	}
+	if err := p.mqttClient.PublishAs(mqtt.ClassEvents, TopicPrefix(p.cfg)+"/presence/events", message); err != nil {
+		return fmt.Errorf("failed to publish presence event: %w", err)
+	}
+	return nil
+}
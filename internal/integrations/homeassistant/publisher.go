@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"double-take-go-reborn/config"
@@ -37,10 +38,12 @@ type Publisher struct {
 	personCounters   map[string]int // Zähler für Personen pro Kamera
 	personLastUpdate map[string]time.Time // Zeitpunkt der letzten Aktualisierung
 	lastDetections   map[string]time.Time // Speichert die letzten Erkennungszeitpunkte pro Identität
+	countersMu       sync.Mutex           // Schützt personCounters und personLastUpdate
+	discovery        *DiscoveryManager    // Registriert neue Kameras in Home Assistant
 }
 
-// cleanCameraName bereinigt einen Kameranamen von Präfixen und Suffixen
-func cleanCameraName(camera string) string {
+// CleanCameraName bereinigt einen Kameranamen von Präfixen und Suffixen
+func CleanCameraName(camera string) string {
 	cleanCamera := camera
 	
 	// Entferne "frigate_" oder "frigate/" Präfix
@@ -67,6 +70,8 @@ type MatchEvent struct {
 	Camera    string    `json:"camera"`
 	Zones     []string  `json:"zones"`
 	Match     *Match    `json:"match,omitempty"`
+	Unknown   *Match    `json:"unknown,omitempty"`  // Nur auf dem Topic der Person "unknown"
+	ImageID   uint      `json:"image_id,omitempty"` // Nicht im Kompatibilitätsmodus
 }
 
 // CameraEvent enthält die Daten eines Kamera-Events mit allen Matches
@@ -81,6 +86,7 @@ type CameraEvent struct {
 	Misses    []*Match  `json:"misses"`
 	Unknowns  []*Match  `json:"unknowns"`
 	Counts    Counts    `json:"counts"`
+	ImageID   uint      `json:"image_id,omitempty"` // Nicht im Kompatibilitätsmodus
 }
 
 // Match enthält die Details eines erkannten Gesichts
@@ -93,6 +99,19 @@ type Match struct {
 	Duration   float64    `json:"duration"`
 	Detector   string     `json:"detector"`
 	Filename   string     `json:"filename"`
+	Crop       string     `json:"crop,omitempty"` // Gesichtsausschnitt relativ zum Snapshot-Verzeichnis
+	Checks     []string   `json:"checks,omitempty"` // Gründe, warum ein Gesicht kein Treffer ist
+}
+
+// RecognitionState ist der retained Zustand des Kamera-Sensors und die Attribute des
+// Anwesenheitssensors einer Identität
+type RecognitionState struct {
+	Name       string  `json:"name"`
+	Known      bool    `json:"known"`
+	Camera     string  `json:"camera"`
+	Confidence float64 `json:"confidence"`
+	LastSeen   string  `json:"last_seen"` // ISO 8601 mit Zeitzone
+	ImageID    uint    `json:"image_id"`
 }
 
 // PresenceInfo enthält die Informationen über die Anwesenheit einer Person
@@ -102,7 +121,7 @@ type PresenceInfo struct {
 	LastSeen         time.Time `json:"last_seen"`    // Zeitpunkt der letzten Erkennung
 	ImageID          uint      `json:"image_id"`     // ID des Bildes
 	ImagePath        string    `json:"image_path"`   // Pfad zum Bild
-	ImageData        string    `json:"image_data"`   // Base64-kodiertes Bild für Home Assistant
+	ImageData        string    `json:"image_data"`   // Base64-kodierter Gesichtsausschnitt für Home Assistant
 	DetectionHistory []string  `json:"history"`      // Liste der letzten Erkennungsorte
 	Zones            []string  `json:"zones"`        // Erkannte Zonen (falls vorhanden)
 }
@@ -136,6 +155,11 @@ func NewPublisher(mqttClient *mqtt.Client, cfg *config.Config) *Publisher {
 	}
 }
 
+// SetDiscoveryManager setzt den Discovery-Manager, der neue Kameras in Home Assistant registriert
+func (p *Publisher) SetDiscoveryManager(discovery *DiscoveryManager) {
+	p.discovery = discovery
+}
+
 // StartResetTimers startet die Timer zum Zurücksetzen der Personenzähler
 func (p *Publisher) StartResetTimers() {
 	// Regelmäßig alle 30 Sekunden überprüfen, ob Zähler zurückgesetzt werden müssen
@@ -153,13 +177,15 @@ func (p *Publisher) StartResetTimers() {
 func (p *Publisher) checkAndResetCounters() {
 	now := timezone.Now()
 	
+	p.countersMu.Lock()
+	defer p.countersMu.Unlock()
 	for camera, lastUpdate := range p.personLastUpdate {
 		// Wenn der letzte Update mehr als 30 Sekunden her ist, Zähler zurücksetzen
 		if now.Sub(lastUpdate) > 30*time.Second {
 			p.personCounters[camera] = 0
 			
 			// Zähler auf 0 setzen und veröffentlichen
-			if err := p.mqttClient.Publish(fmt.Sprintf("double-take/cameras/%s/person", camera), "0"); err != nil {
+			if err := p.mqttClient.PublishAs(mqtt.ClassResults, ResultTopic(p.cfg.MQTT.Topics.CameraPerson, p.cfg, "", camera), "0"); err != nil {
 				log.Errorf("Failed to publish person counter reset for camera %s: %v", camera, err)
 			} else {
 				log.Debugf("Reset person counter for camera %s", camera)
@@ -171,243 +197,85 @@ func (p *Publisher) checkAndResetCounters() {
 	}
 }
 
-// PublishMatchResult veröffentlicht ein einzelnes Match-Ergebnis
-func (p *Publisher) PublishMatchResult(face models.Face, match models.Match, image *models.Image, duration float64, attempts int) error {
-	// BoundingBox-Daten extrahieren
-	var boundingBox BoundingBoxData
-	if err := json.Unmarshal([]byte(face.BoundingBox), &boundingBox); err != nil {
-		log.Errorf("Failed to unmarshal bounding box data: %v", err)
-		return fmt.Errorf("failed to unmarshal bounding box data: %w", err)
-	}
-	
-	// Box-Koordinaten erstellen
-	box := Box{
-		Top:    int(boundingBox.YMin),
-		Left:   int(boundingBox.XMin),
-		Width:  int(boundingBox.XMax - boundingBox.XMin),
-		Height: int(boundingBox.YMax - boundingBox.YMin),
-	}
-	
-	// Match-Informationen erstellen
-	matchInfo := &Match{
-		Name:       match.Identity.Name,
-		Confidence: match.Confidence,
-		Match:      true,
-		Box:        box,
-		Type:       "face",
-		Duration:   duration,
-		Detector:   "compreface",
-		Filename:   image.FilePath,
+// PublishEventVerdict meldet das zusammengefasste Ergebnis eines Frigate-Events an die
+// Personen-Sensoren. image ist das Bild mit dem besten Gesicht des Events.
+func (p *Publisher) PublishEventVerdict(verdict *models.EventVerdict, image *models.Image) error {
+	camera := verdict.Camera
+	if camera == "" {
+		camera = image.Source
 	}
 	
-	// Event erstellen
-	// Zeit mit expliziter Zeitzone formatieren (ISO 8601)
-	now := timezone.Now()
-	isoTime := now.Format(time.RFC3339) // Format: 2025-05-18T11:26:42+02:00
-	
-	// Bereinigten Kameranamen verwenden
-	cleanCamera := cleanCameraName(image.Source)
-	
-	event := MatchEvent{
-		ID:        fmt.Sprintf("%d", image.ID),
-		Duration:  duration,
-		Timestamp: isoTime,
-		Attempts:  attempts,
-		Camera:    cleanCamera,
-		Zones:     []string{},
-		Match:     matchInfo,
+	// Den Ausschnitt des besten Gesichts statt des gesamten Schnappschusses senden
+	imagePath := image.FilePath
+	for _, face := range image.Faces {
+		if face.ID == verdict.FaceID {
+			imagePath = cropOrImage(face.CropPath, image)
+			break
+		}
 	}
 	
-	// Match-Topic (pro Person)
-	topic := fmt.Sprintf("double-take/matches/%s", match.Identity.Name)
-	
-	// Veröffentlichen
-	if err := p.mqttClient.Publish(topic, event); err != nil {
-		return fmt.Errorf("failed to publish match result: %w", err)
+	if verdict.Identity == nil {
+		p.publishRecognitionState("unknown", false, camera, 0, image.ID)
+		return p.UpdateUnknownPresenceSensor(camera, image.ID, imagePath, 1)
 	}
+	p.publishRecognitionState(verdict.Identity.Name, true, camera, verdict.Confidence, image.ID)
 	
-	// Personen-Zähler für diese Kamera aktualisieren
-	p.updatePersonCounter(image.Source)
-	
-	return nil
+	log.Infof("Event %s: Person '%s' mit Konfidenz %.2f in Kamera '%s' erkannt",
+		verdict.EventID, verdict.Identity.Name, verdict.Confidence, camera)
+	return p.UpdateRecognizedPerson(verdict.Identity.Name, camera, verdict.Confidence, image.ID, imagePath)
 }
 
-// PublishCameraResult veröffentlicht ein Kamera-Ereignis mit allen Matches
-func (p *Publisher) PublishCameraResult(image *models.Image, matches []models.Match, duration float64, attempts int) error {
-	// Bereinigten Kameranamen verwenden
-	cleanCamera := cleanCameraName(image.Source)
-	
-	// Kamera-Topic mit bereinigtem Namen
-	topic := fmt.Sprintf("double-take/cameras/%s", cleanCamera)
-	
-	// Listen für die verschiedenen Ergebnistypen
-	matchItems := make([]*Match, 0)
-	missItems := make([]*Match, 0)
-	unknownItems := make([]*Match, 0)
-	
-	// Zähler
-	counts := Counts{
-		Person:  len(image.Faces),
-		Match:   0,
-		Miss:    0,
-		Unknown: len(image.Faces), // Standardmäßig alle als unbekannt betrachten
+// publishRecognitionState aktualisiert den Sensor der Kamera und bei bekannten Personen die
+// Attribute ihres Anwesenheitssensors (letzte Kamera, Übereinstimmung, Zeitpunkt)
+func (p *Publisher) publishRecognitionState(identityName string, known bool, camera string, confidence float64, imageID uint) {
+	camera = CleanCameraName(camera)
+	state := RecognitionState{
+		Name:       identityName,
+		Known:      known,
+		Camera:     camera,
+		Confidence: confidence,
+		LastSeen:   timezone.Now().Format(time.RFC3339),
+		ImageID:    imageID,
 	}
-	
-	// Map, um erkannte Gesichter zu markieren
-	processedFaces := make(map[uint]bool)
-	
-	// Matches verarbeiten
-	for _, match := range matches {
-		// Das zugehörige Face für dieses Match finden
-		var matchFace models.Face
-		var foundFace bool
-		for _, face := range image.Faces {
-			if face.ID == match.FaceID {
-				matchFace = face
-				foundFace = true
-				processedFaces[face.ID] = true
-				break
-			}
-		}
-		
-		if !foundFace {
-			log.Warnf("Could not find face for match (ID: %d)", match.FaceID)
-			continue
-		}
-		
-		// BoundingBox-Daten extrahieren
-		var boundingBox BoundingBoxData
-		if err := json.Unmarshal([]byte(matchFace.BoundingBox), &boundingBox); err != nil {
-			log.Errorf("Failed to unmarshal bounding box data: %v", err)
-			continue
-		}
-		
-		// Box-Koordinaten
-		box := Box{
-			Top:    int(boundingBox.YMin),
-			Left:   int(boundingBox.XMin),
-			Width:  int(boundingBox.XMax - boundingBox.XMin),
-			Height: int(boundingBox.YMax - boundingBox.YMin),
-		}
-		
-		// Match-Informationen
-		matchInfo := &Match{
-			Name:       match.Identity.Name,
-			Confidence: match.Confidence,
-			Match:      true,
-			Box:        box,
-			Type:       "face",
-			Duration:   duration,
-			Detector:   "compreface",
-			Filename:   image.FilePath,
-		}
-		
-		matchItems = append(matchItems, matchInfo)
-		counts.Match++
-		counts.Unknown--
-	}
-	
-	// Nicht erkannte Gesichter als "unknown" markieren
-	for _, face := range image.Faces {
-		if !processedFaces[face.ID] {
-			// BoundingBox-Daten extrahieren
-			var boundingBox BoundingBoxData
-			if err := json.Unmarshal([]byte(face.BoundingBox), &boundingBox); err != nil {
-				log.Errorf("Failed to unmarshal bounding box data: %v", err)
-				continue
-			}
-			
-			// Box-Koordinaten
-			box := Box{
-				Top:    int(boundingBox.YMin),
-				Left:   int(boundingBox.XMin),
-				Width:  int(boundingBox.XMax - boundingBox.XMin),
-				Height: int(boundingBox.YMax - boundingBox.YMin),
-			}
-			
-			// Unknown-Face
-			unknownInfo := &Match{
-				Name:       "unknown",
-				Confidence: 0,
-				Match:      false,
-				Box:        box,
-				Type:       "face",
-				Duration:   duration,
-				Detector:   "compreface",
-				Filename:   image.FilePath,
-			}
-			
-			unknownItems = append(unknownItems, unknownInfo)
-		}
+
+	if p.discovery != nil {
+		p.discovery.EnsureCamera(camera)
 	}
-	
-	// Event erstellen
-	// Zeit mit expliziter Zeitzone formatieren (ISO 8601)
-	now := timezone.Now()
-	isoTime := now.Format(time.RFC3339) // Format: 2025-05-18T11:26:42+02:00
-	
-	event := CameraEvent{
-		ID:        fmt.Sprintf("%d", image.ID),
-		Duration:  duration,
-		Timestamp: isoTime,
-		Attempts:  attempts,
-		Camera:    cleanCamera,
-		Zones:     []string{},
-		Matches:   matchItems,
-		Misses:    missItems,
-		Unknowns:  unknownItems,
-		Counts:    counts,
+	if err := p.mqttClient.PublishAs(mqtt.ClassState, CameraStateTopic(p.cfg, camera), state); err != nil {
+		log.Warnf("Failed to publish recognition state for camera %s: %v", camera, err)
 	}
-	
-	// Veröffentlichen des Kamera-Events
-	if err := p.mqttClient.Publish(topic, event); err != nil {
-		return fmt.Errorf("failed to publish camera result: %w", err)
+	if !known {
+		return
 	}
-	
-	// Personen-Zähler für diese Kamera aktualisieren
-	p.updatePersonCounter(image.Source)
-	
-	// Anwesenheitssensoren für erkannte Identitäten aktualisieren
-	publishedIdentities := make(map[string]bool)
-	
-	// Für jedes Match den entsprechenden Anwesenheitssensor aktualisieren
-	for _, match := range matchItems {
-		// Doppelte Erkennungen vermeiden
-		if _, exists := publishedIdentities[match.Name]; exists {
-			continue
-		}
-		
-		// WICHTIG: Debug-Information zur Fehlersuche
-		log.Infof("!!! ERKANNT: Person '%s' mit Konfidenz %.2f in Kamera '%s' !!!", 
-			match.Name, match.Confidence, image.Source)
-		
-		// Anwesenheitssensor aktualisieren - DIREKT die UpdateRecognizedPerson-Methode aufrufen
-		if err := p.UpdateRecognizedPerson(match.Name, image.Source, match.Confidence, 
-			image.ID, image.FilePath); err != nil {
-			log.Warnf("Failed to update person sensor for %s: %v", match.Name, err)
+
+	presenceTopic := PresenceTopic(p.cfg, identityName)
+	if err := p.mqttClient.PublishAs(mqtt.ClassState, presenceTopic+"/attributes", state); err != nil {
+		log.Warnf("Failed to publish presence attributes for %s: %v", identityName, err)
+	}
+	// Ohne Anwesenheitserkennung schaltet jede Erkennung den Sensor ein, expire_after aus
+	if !p.cfg.Presence.Enabled {
+		if err := p.mqttClient.PublishAs(mqtt.ClassState, presenceTopic, "ON"); err != nil {
+			log.Warnf("Failed to publish presence state for %s: %v", identityName, err)
 		}
-		
-		// Identität als verarbeitet markieren
-		publishedIdentities[match.Name] = true
 	}
-	
-	// Falls unbekannte Gesichter vorhanden sind, auch deren Sensor aktualisieren
-	if len(unknownItems) > 0 {
-		if err := p.UpdateUnknownPresenceSensor(image.Source, image.ID, image.FilePath, 
-			len(unknownItems)); err != nil {
-			log.Warnf("Failed to update unknown presence sensor: %v", err)
-		}
+}
+
+// cropOrImage liefert den Pfad des Gesichtsausschnitts oder, falls keiner gespeichert ist,
+// den des gesamten Schnappschusses
+func cropOrImage(cropPath string, image *models.Image) string {
+	if cropPath != "" {
+		return cropPath
 	}
-	
-	return nil
+	return image.FilePath
 }
 
 // PublishError veröffentlicht eine Fehlermeldung
 func (p *Publisher) PublishError(err error) error {
-	return p.mqttClient.Publish("double-take/error", err.Error())
+	return p.mqttClient.PublishAs(mqtt.ClassResults, ResultTopic(p.cfg.MQTT.Topics.Errors, p.cfg, "", ""), err.Error())
 }
 
-// UpdateRecognizedPerson aktualisiert die Entität mit der erkannten Person
+// UpdateRecognizedPerson aktualisiert die Entität mit der erkannten Person. imagePath ist
+// relativ zum Snapshot-Verzeichnis, üblicherweise der Gesichtsausschnitt.
 func (p *Publisher) UpdateRecognizedPerson(identityName string, camera string, confidence float64, imageID uint, imagePath string) error {
 	// 1. Aktualisiere den Wert des Haupt-Sensors mit Namen, Kamera und Zeitstempel
 	personTopic := "double-take/person"
@@ -464,7 +332,7 @@ func (p *Publisher) UpdateRecognizedPerson(identityName string, camera string, c
 	// Debug-Logging vor dem Senden
 	log.Infof("Aktualisiere Person-Sensor mit Wert '%s' auf Topic '%s'", personValue, personTopic)
 	
-	if err := p.mqttClient.PublishRetain(personTopic, personValue); err != nil {
+	if err := p.mqttClient.PublishAs(mqtt.ClassState, personTopic, personValue); err != nil {
 		return fmt.Errorf("failed to publish person info: %w", err)
 	}
 	
@@ -527,7 +395,7 @@ func (p *Publisher) UpdateRecognizedPerson(identityName string, camera string, c
 	if err != nil {
 		return fmt.Errorf("failed to marshal person attributes: %w", err)
 	}
-	if err := p.mqttClient.PublishRetain(attributesTopic, string(attributesJSON)); err != nil {
+	if err := p.mqttClient.PublishAs(mqtt.ClassState, attributesTopic, string(attributesJSON)); err != nil {
 		return fmt.Errorf("failed to publish person attributes: %w", err)
 	}
 
@@ -616,7 +484,7 @@ func (p *Publisher) UpdateRecognizedPerson(identityName string, camera string, c
 			log.Infof("Publishing image data (length: %d) to topics: %s and %s", len(rawImageData), imageTopic, imageTopicWithTimestamp)
 			
 			// Senden an das Standard-Topic (für bestehende Konfigurationen)
-			if err := p.mqttClient.PublishRetain(imageTopic, rawImageData); err != nil {
+			if err := p.mqttClient.PublishAs(mqtt.ClassState, imageTopic, rawImageData); err != nil {
 				log.Warnf("Failed to publish image data to standard topic: %v", err)
 			}
 			
@@ -660,6 +528,9 @@ func (p *Publisher) UpdateUnknownPresenceSensor(camera string, imageID uint, ima
 
 // updatePersonCounter aktualisiert den Personenzähler für eine Kamera
 func (p *Publisher) updatePersonCounter(camera string) {
+	p.countersMu.Lock()
+	defer p.countersMu.Unlock()
+	
 	// Zähler erhöhen
 	counter, exists := p.personCounters[camera]
 	if !exists {
@@ -672,10 +543,8 @@ func (p *Publisher) updatePersonCounter(camera string) {
 	p.personLastUpdate[camera] = timezone.Now()
 	
 	// Zähler veröffentlichen
-	// Bereinigten Kameranamen verwenden
-	cleanCamera := cleanCameraName(camera)
-	topic := fmt.Sprintf("double-take/cameras/%s/person", cleanCamera)
-	if err := p.mqttClient.Publish(topic, fmt.Sprintf("%d", counter)); err != nil {
+	topic := ResultTopic(p.cfg.MQTT.Topics.CameraPerson, p.cfg, "", camera)
+	if err := p.mqttClient.PublishAs(mqtt.ClassResults, topic, fmt.Sprintf("%d", counter)); err != nil {
 		log.Errorf("Failed to publish person counter for camera %s: %v", camera, err)
 	}
 }
@@ -0,0 +1,215 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/mqtt"
+	"double-take-go-reborn/internal/util/timezone"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Result beschreibt ein verarbeitetes Bild für die Ergebnis-Topics
+type Result struct {
+	ID       string        // Frigate-Event-ID oder Bild-ID
+	Camera   string        // Kamera oder Quelle des Bildes
+	Zones    []string      // Frigate-Zonen (optional)
+	Type     string        // Art des Bildes, z.B. "snapshot", "thumbnail", "webhook"
+	Image    *models.Image // Verarbeitetes Bild
+	Faces    []models.Face // Gesichter des Bildes samt Treffern und Identitäten
+	Duration float64       // Verarbeitungsdauer in Sekunden
+	Attempts int
+}
+
+// topicReplacer ersetzt Zeichen, die in einem Topic-Abschnitt eine Bedeutung haben
+var topicReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// ResultTopic setzt Präfix, Name und Kamera in eine Topic-Vorlage aus mqtt.topics ein
+func ResultTopic(template string, cfg *config.Config, name, camera string) string {
+	return strings.NewReplacer(
+		"{prefix}", TopicPrefix(cfg),
+		"{name}", topicReplacer.Replace(name),
+		"{camera}", topicReplacer.Replace(camera),
+	).Replace(template)
+}
+
+// PublishResults veröffentlicht die Gesichter eines Bildes wie das ursprüngliche Double
+// Take: jeden Treffer und den ersten Unbekannten auf dem Topic der Person, alle Ergebnisse
+// auf dem Topic der Kamera. Die Einteilung in Treffer, Fehltreffer und Unbekannte folgt
+// den Schwellwerten unter mqtt.results.
+func (p *Publisher) PublishResults(result Result) error {
+	if len(result.Faces) == 0 {
+		return nil
+	}
+
+	settings := p.cfg.MQTT.Results
+	camera := CleanCameraName(result.Camera)
+	zones := result.Zones
+	if zones == nil {
+		zones = []string{}
+	}
+
+	timestamp := timezone.Now().Format(time.RFC3339)
+	imageID := result.Image.ID
+	if settings.Compatibility {
+		// Das ursprüngliche Double Take sendet UTC mit Millisekunden (Date.toISOString)
+		timestamp = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		imageID = 0
+	}
+
+	event := CameraEvent{
+		ID:        result.ID,
+		Duration:  roundTo(result.Duration, 2),
+		Timestamp: timestamp,
+		Attempts:  result.Attempts,
+		Camera:    camera,
+		Zones:     zones,
+		Matches:   make([]*Match, 0),
+		Misses:    make([]*Match, 0),
+		Unknowns:  make([]*Match, 0),
+		Counts:    Counts{Person: len(result.Faces)},
+		ImageID:   imageID,
+	}
+
+	for _, face := range result.Faces {
+		item, err := p.resultItem(result, face)
+		if err != nil {
+			log.Warnf("Skipping face %d in MQTT result: %v", face.ID, err)
+			continue
+		}
+		switch {
+		case item.Match:
+			event.Matches = append(event.Matches, item)
+			event.Counts.Match++
+		case item.Name == "unknown":
+			event.Unknowns = append(event.Unknowns, item)
+			event.Counts.Unknown++
+		default:
+			event.Misses = append(event.Misses, item)
+			event.Counts.Miss++
+		}
+	}
+
+	matchEvent := func(match, unknown *Match) MatchEvent {
+		return MatchEvent{
+			ID:        event.ID,
+			Duration:  event.Duration,
+			Timestamp: event.Timestamp,
+			Attempts:  event.Attempts,
+			Camera:    event.Camera,
+			Zones:     event.Zones,
+			Match:     match,
+			Unknown:   unknown,
+			ImageID:   event.ImageID,
+		}
+	}
+
+	// Je Person nur den besten Treffer melden
+	best := make(map[string]*Match)
+	var names []string
+	for _, match := range event.Matches {
+		if current, ok := best[match.Name]; !ok || match.Confidence > current.Confidence {
+			if !ok {
+				names = append(names, match.Name)
+			}
+			best[match.Name] = match
+		}
+	}
+	for _, name := range names {
+		topic := ResultTopic(p.cfg.MQTT.Topics.Matches, p.cfg, name, camera)
+		if err := p.mqttClient.PublishAs(mqtt.ClassResults, topic, matchEvent(best[name], nil)); err != nil {
+			return fmt.Errorf("failed to publish match result: %w", err)
+		}
+	}
+	if len(event.Unknowns) > 0 {
+		topic := ResultTopic(p.cfg.MQTT.Topics.Matches, p.cfg, "unknown", camera)
+		if err := p.mqttClient.PublishAs(mqtt.ClassResults, topic, matchEvent(nil, event.Unknowns[0])); err != nil {
+			return fmt.Errorf("failed to publish unknown result: %w", err)
+		}
+	}
+
+	topic := ResultTopic(p.cfg.MQTT.Topics.Cameras, p.cfg, "", camera)
+	if err := p.mqttClient.PublishAs(mqtt.ClassResults, topic, event); err != nil {
+		return fmt.Errorf("failed to publish camera result: %w", err)
+	}
+
+	p.updatePersonCounter(camera)
+	return nil
+}
+
+// resultItem ordnet ein Gesicht anhand seines besten Treffers als Treffer, Fehltreffer
+// oder Unbekannten ein
+func (p *Publisher) resultItem(result Result, face models.Face) (*Match, error) {
+	var boundingBox BoundingBoxData
+	if err := json.Unmarshal([]byte(face.BoundingBox), &boundingBox); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bounding box data: %w", err)
+	}
+
+	settings := p.cfg.MQTT.Results
+	item := &Match{
+		Name: "unknown",
+		Box: Box{
+			Top:    int(boundingBox.YMin),
+			Left:   int(boundingBox.XMin),
+			Width:  int(boundingBox.XMax - boundingBox.XMin),
+			Height: int(boundingBox.YMax - boundingBox.YMin),
+		},
+		Type:     result.Type,
+		Duration: roundTo(result.Duration, 2),
+		Detector: face.Detector,
+		Filename: result.Image.FilePath,
+		Crop:     face.CropPath,
+	}
+	if settings.Compatibility {
+		item.Filename = filepath.Base(result.Image.FilePath)
+		item.Crop = ""
+	}
+
+	var best *models.Match
+	for i := range face.Matches {
+		if best == nil || face.Matches[i].Confidence > best.Confidence {
+			best = &face.Matches[i]
+		}
+	}
+	if best != nil {
+		item.Confidence = best.Confidence
+	}
+	if best == nil || best.Identity.Name == "" || best.Confidence < settings.UnknownConfidence {
+		item.Confidence = p.resultConfidence(item.Confidence)
+		return item, nil
+	}
+
+	item.Name = best.Identity.Name
+	if best.Confidence < settings.MatchConfidence {
+		item.Checks = append(item.Checks, fmt.Sprintf("confidence too low: %v < %v",
+			p.resultConfidence(best.Confidence), p.resultConfidence(settings.MatchConfidence)))
+	}
+	if area := item.Box.Width * item.Box.Height; area < settings.MatchMinArea {
+		item.Checks = append(item.Checks, fmt.Sprintf("box area too low: %d < %d", area, settings.MatchMinArea))
+	}
+	item.Match = len(item.Checks) == 0
+	item.Confidence = p.resultConfidence(best.Confidence)
+	return item, nil
+}
+
+// resultConfidence gibt die Übereinstimmung im Format der Ergebnisse zurück: 0-1, im
+// Kompatibilitätsmodus wie im ursprünglichen Double Take in Prozent
+func (p *Publisher) resultConfidence(confidence float64) float64 {
+	if p.cfg.MQTT.Results.Compatibility {
+		return roundTo(confidence*100, 2)
+	}
+	return roundTo(confidence, 4)
+}
+
+// roundTo rundet auf die angegebene Anzahl Nachkommastellen
+func roundTo(value float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(value*factor) / factor
+}
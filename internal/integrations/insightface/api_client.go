@@ -41,10 +41,11 @@ type apiDetectResponse struct {
 	Status     string `json:"status"`
 	FacesCount int    `json:"faces_count"`
 	Faces      []struct {
-		BoundingBox []int     `json:"bbox"`
-		Confidence  float64   `json:"confidence"`
-		Embedding   []float32 `json:"embedding,omitempty"`
-		FaceData    string    `json:"face_data,omitempty"`
+		BoundingBox []int       `json:"bbox"`
+		Confidence  float64     `json:"confidence"`
+		Embedding   []float32   `json:"embedding,omitempty"`
+		FaceData    string      `json:"face_data,omitempty"`
+		Landmarks   [][]float64 `json:"landmarks,omitempty"`
 	} `json:"faces"`
 	ProcessTime float64 `json:"process_time"`
 }
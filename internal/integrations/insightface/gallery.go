@@ -0,0 +1,227 @@
+package insightface
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/integrations/facerecognition"
+
+	"gorm.io/gorm"
+)
+
+// galleryProvider ist der Providername, unter dem die Vektoren gespeichert werden
+const galleryProvider = string(facerecognition.ProviderInsightFace)
+
+// Gallery verwaltet die lokal in SQLite gespeicherten Gesichtsvektoren
+type Gallery struct {
+	db *gorm.DB
+}
+
+// NewGallery erstellt eine neue Galerie auf Basis der Projektdatenbank
+func NewGallery(db *gorm.DB) *Gallery {
+	return &Gallery{db: db}
+}
+
+// subjectID liefert die Subjekt-ID einer Identität (ExternalID, sonst Name)
+func subjectID(identity models.Identity) string {
+	if identity.ExternalID != "" {
+		return identity.ExternalID
+	}
+	return identity.Name
+}
+
+// findOrCreateIdentity sucht die Identität zu einer Subjekt-ID oder legt sie an
+func (g *Gallery) findOrCreateIdentity(subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := g.db.Where("external_id = ? OR name = ?", subject, subject).First(&identity).Error
+	if err == nil {
+		return &identity, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("fehler beim Suchen der Identität: %w", err)
+	}
+
+	identity = models.Identity{
+		Name:       subject,
+		ExternalID: subject,
+	}
+	if err := g.db.Create(&identity).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Anlegen der Identität: %w", err)
+	}
+	return &identity, nil
+}
+
+// Add speichert einen Gesichtsvektor für das angegebene Subjekt
+func (g *Gallery) Add(subject string, vec []float32) (*models.FaceEmbedding, error) {
+	if len(vec) == 0 {
+		return nil, fmt.Errorf("leerer Gesichtsvektor")
+	}
+
+	identity, err := g.findOrCreateIdentity(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	embedding := models.FaceEmbedding{
+		IdentityID: identity.ID,
+		Provider:   galleryProvider,
+	}
+	embedding.SetVector(vec)
+
+	if err := g.db.Create(&embedding).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Speichern des Gesichtsvektors: %w", err)
+	}
+	return &embedding, nil
+}
+
+// load lädt alle Vektoren der Galerie inklusive der zugehörigen Identitäten
+func (g *Gallery) load() ([]models.FaceEmbedding, error) {
+	var embeddings []models.FaceEmbedding
+	err := g.db.Joins("Identity").
+		Where("face_embeddings.provider = ?", galleryProvider).
+		Find(&embeddings).Error
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Galerie: %w", err)
+	}
+	return embeddings, nil
+}
+
+// Search vergleicht die übergebenen Vektoren per Kosinus-Ähnlichkeit mit der Galerie.
+// Pro Gesicht wird je Subjekt der beste Treffer oberhalb des Schwellwerts geliefert,
+// absteigend sortiert und optional auf limit Einträge begrenzt.
+func (g *Gallery) Search(vectors [][]float32, threshold float64, limit int) ([][]facerecognition.Match, error) {
+	results := make([][]facerecognition.Match, len(vectors))
+
+	embeddings, err := g.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 {
+		return results, nil
+	}
+
+	// Vektoren nur einmal dekodieren
+	decoded := make([][]float32, len(embeddings))
+	for i := range embeddings {
+		decoded[i] = embeddings[i].GetVector()
+	}
+
+	for faceIndex, vec := range vectors {
+		if len(vec) == 0 {
+			continue
+		}
+		query := normalize(vec)
+
+		best := make(map[string]float64)
+		for i, candidate := range decoded {
+			// Vektoren gelöschter Identitäten oder anderer Modelle ignorieren
+			if embeddings[i].Identity.ID == 0 || len(candidate) != len(query) {
+				continue
+			}
+			similarity := dot(query, candidate)
+			subject := subjectID(embeddings[i].Identity)
+			if similarity > best[subject] {
+				best[subject] = similarity
+			}
+		}
+
+		matches := make([]facerecognition.Match, 0, len(best))
+		for subject, similarity := range best {
+			if similarity >= threshold {
+				matches = append(matches, facerecognition.Match{
+					SubjectID:  subject,
+					Similarity: similarity,
+				})
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].Similarity > matches[j].Similarity
+		})
+		if limit > 0 && len(matches) > limit {
+			matches = matches[:limit]
+		}
+		results[faceIndex] = matches
+	}
+
+	return results, nil
+}
+
+// Subjects liefert alle Subjekte der Galerie mit der Anzahl gespeicherter Vektoren
+func (g *Gallery) Subjects() ([]facerecognition.SubjectInfo, error) {
+	var rows []struct {
+		IdentityID uint
+		FaceCount  int
+	}
+	err := g.db.Model(&models.FaceEmbedding{}).
+		Select("identity_id, COUNT(*) AS face_count").
+		Where("provider = ?", galleryProvider).
+		Group("identity_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Subjekte: %w", err)
+	}
+
+	subjects := make([]facerecognition.SubjectInfo, 0, len(rows))
+	for _, row := range rows {
+		var identity models.Identity
+		if err := g.db.First(&identity, row.IdentityID).Error; err != nil {
+			// Verwaiste Vektoren (z.B. nach Löschen der Identität) überspringen
+			continue
+		}
+		subjects = append(subjects, facerecognition.SubjectInfo{
+			ID:        subjectID(identity),
+			Name:      identity.Name,
+			FaceCount: row.FaceCount,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	return subjects, nil
+}
+
+// Delete entfernt alle Vektoren eines Subjekts aus der Galerie
+func (g *Gallery) Delete(subject string) (int64, error) {
+	var identity models.Identity
+	err := g.db.Unscoped().Where("external_id = ? OR name = ?", subject, subject).First(&identity).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fehler beim Suchen der Identität: %w", err)
+	}
+
+	result := g.db.Where("identity_id = ? AND provider = ?", identity.ID, galleryProvider).
+		Delete(&models.FaceEmbedding{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("fehler beim Löschen der Gesichtsvektoren: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// normalize skaliert einen Vektor auf Länge 1
+func normalize(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float32, len(vec))
+	for i, v := range vec {
+		if norm > 0 {
+			out[i] = float32(float64(v) / norm)
+		}
+	}
+	return out
+}
+
+// dot berechnet das Skalarprodukt zweier gleich langer Vektoren.
+// Für normalisierte Vektoren entspricht es der Kosinus-Ähnlichkeit.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -4,25 +4,32 @@ import (
 	"context"
 	"fmt"
 	"image"
+	"strconv"
 	"time"
 
 	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/integrations/facerecognition"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // Service implementiert das facerecognition.Provider-Interface für InsightFace
 type Service struct {
 	client     *APIClient
 	config     config.InsightFaceConfig
+	gallery    *Gallery
 	subjectCache []facerecognition.SubjectInfo
 	cacheTime    time.Time
 }
 
-// NewService erstellt einen neuen InsightFace-Service
-func NewService(cfg config.InsightFaceConfig) *Service {
+// NewService erstellt einen neuen InsightFace-Service.
+// Die Gesichtsvektoren bekannter Personen werden in der übergebenen Datenbank gespeichert.
+func NewService(cfg config.InsightFaceConfig, db *gorm.DB) *Service {
 	return &Service{
-		client: NewAPIClient(cfg),
-		config: cfg,
+		client:  NewAPIClient(cfg),
+		config:  cfg,
+		gallery: NewGallery(db),
 	}
 }
 
@@ -69,54 +76,134 @@ func (s *Service) DetectFaces(ctx context.Context, img image.Image, opts facerec
 			Confidence:  face.Confidence,
 			Embedding:   face.Embedding,
 			FaceImage:   face.FaceData,
+			Landmarks:   face.Landmarks,
+		}
+		if len(face.Embedding) > 0 {
+			result.Faces[i].EmbeddingProvider = facerecognition.ProviderInsightFace
 		}
 	}
 	
 	return result, nil
 }
 
-// RecognizeFaces erkennt Gesichter und vergleicht sie mit bekannten Gesichtern
-// Hinweis: InsightFace hat im Standard keinen eigenen Gesichtserkennung/Abgleich,
-// daher ist dies eine Implementierung, die nur die Gesichtserkennung durchführt.
-// In einer vollständigen Implementierung würde man hier die Erkennung mit einer Datenbank abgleichen.
+// RecognizeFaces erkennt Gesichter und vergleicht ihre Vektoren mit der lokalen Galerie
 func (s *Service) RecognizeFaces(ctx context.Context, img image.Image, opts facerecognition.RecognitionRequest) (*facerecognition.RecognitionResponse, error) {
-	// Gesichter erkennen
-	detectResp, err := s.DetectFaces(ctx, img, opts.DetectionRequest)
+	// Für den Abgleich werden immer Gesichtsvektoren benötigt
+	detectOpts := opts.DetectionRequest
+	detectOpts.ExtractEmbedding = true
+	
+	detectResp, err := s.DetectFaces(ctx, img, detectOpts)
 	if err != nil {
 		return nil, err
 	}
 	
-	// Da InsightFace-API keine direkte Gesichtserkennung bietet,
-	// geben wir nur die erkannten Gesichter zurück, ohne Übereinstimmungen
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = s.config.RecognitionThreshold
+	}
+	
+	vectors := make([][]float32, len(detectResp.Faces))
+	for i, face := range detectResp.Faces {
+		vectors[i] = face.Embedding
+		if len(face.Embedding) == 0 {
+			log.WithFields(logFields).Warnf("Kein Gesichtsvektor für Gesicht #%d erhalten, Abgleich übersprungen", i+1)
+		}
+	}
+	
+	matches, err := s.gallery.Search(vectors, threshold, opts.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Abgleich mit der Galerie: %w", err)
+	}
+	
 	result := &facerecognition.RecognitionResponse{
 		Faces:         detectResp.Faces,
-		Matches:       make([][]facerecognition.Match, len(detectResp.Faces)),
+		Matches:       matches,
 		ExecutionTime: detectResp.ExecutionTime,
 	}
 	
 	return result, nil
 }
 
-// AddFace ist eine Stub-Implementierung für das Hinzufügen eines Gesichts
-// Da InsightFace in der Basis-Implementierung keine Gesichtsdatenbank hat,
-// würde dies eine eigene Implementierung erfordern
+// AddFace erkennt das Gesicht im Bild und speichert dessen Vektor für das Subjekt in der Galerie.
+// Enthält das Bild mehrere Gesichter, wird das größte verwendet.
 func (s *Service) AddFace(ctx context.Context, img image.Image, opts facerecognition.AddFaceRequest) (*facerecognition.AddFaceResponse, error) {
+	if opts.SubjectID == "" {
+		return &facerecognition.AddFaceResponse{
+			Success:      false,
+			ErrorMessage: "keine Subjekt-ID angegeben",
+		}, nil
+	}
+	
+	detectOpts := opts.DetectionRequest
+	detectOpts.ExtractEmbedding = true
+	
+	detectResp, err := s.DetectFaces(ctx, img, detectOpts)
+	if err != nil {
+		return nil, err
+	}
+	
+	if len(detectResp.Faces) == 0 {
+		return &facerecognition.AddFaceResponse{
+			Success:      false,
+			ErrorMessage: "kein Gesicht im Bild gefunden",
+		}, nil
+	}
+	
+	if len(detectResp.Faces) > 1 {
+		log.WithFields(logFields).Warnf("%d Gesichter im Trainingsbild für '%s' gefunden, verwende das größte", len(detectResp.Faces), opts.SubjectID)
+	}
+	
+	face := largestFace(detectResp.Faces)
+	if len(face.Embedding) == 0 {
+		return &facerecognition.AddFaceResponse{
+			Success:      false,
+			ErrorMessage: "InsightFace hat keinen Gesichtsvektor geliefert",
+		}, nil
+	}
+	
+	embedding, err := s.gallery.Add(opts.SubjectID, face.Embedding)
+	if err != nil {
+		return nil, err
+	}
+	
+	log.WithFields(logFields).Infof("Gesichtsvektor %d für '%s' gespeichert", embedding.ID, opts.SubjectID)
+	
 	return &facerecognition.AddFaceResponse{
-		Success:      false,
-		ErrorMessage: "Funktion nicht implementiert: InsightFace unterstützt in der Basisversion keine Gesichtsregistrierung",
+		FaceID:  strconv.FormatUint(uint64(embedding.ID), 10),
+		Success: true,
 	}, nil
 }
 
-// GetSubjects ist eine Stub-Implementierung für das Abrufen von Subjekten
-// Da InsightFace in der Basis-Implementierung keine Gesichtsdatenbank hat,
-// würde dies eine eigene Implementierung erfordern
+// GetSubjects gibt alle Subjekte der lokalen Galerie zurück
 func (s *Service) GetSubjects(ctx context.Context) ([]facerecognition.SubjectInfo, error) {
-	return []facerecognition.SubjectInfo{}, nil
+	return s.gallery.Subjects()
 }
 
-// DeleteSubject ist eine Stub-Implementierung für das Löschen eines Subjekts
-// Da InsightFace in der Basis-Implementierung keine Gesichtsdatenbank hat,
-// würde dies eine eigene Implementierung erfordern
+// DeleteSubject entfernt alle gespeicherten Gesichtsvektoren eines Subjekts.
+// Die Identität selbst bleibt in der Datenbank erhalten.
 func (s *Service) DeleteSubject(ctx context.Context, subjectID string) error {
-	return fmt.Errorf("funktion nicht implementiert: InsightFace unterstützt in der Basisversion keine Gesichtsregistrierung")
+	deleted, err := s.gallery.Delete(subjectID)
+	if err != nil {
+		return err
+	}
+	
+	log.WithFields(logFields).Infof("%d Gesichtsvektoren von '%s' gelöscht", deleted, subjectID)
+	return nil
+}
+
+// largestFace liefert das Gesicht mit der größten Bounding Box
+func largestFace(faces []facerecognition.Face) facerecognition.Face {
+	best := faces[0]
+	bestArea := -1
+	for _, face := range faces {
+		if len(face.BoundingBox) < 4 {
+			continue
+		}
+		area := (face.BoundingBox[2] - face.BoundingBox[0]) * (face.BoundingBox[3] - face.BoundingBox[1])
+		if area > bestArea {
+			best = face
+			bestArea = area
+		}
+	}
+	return best
 }
@@ -5,22 +5,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"double-take-go-reborn/config"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	log "github.com/sirupsen/logrus"
 )
 
 // Client ist der MQTT-Client für die Kommunikation mit Frigate und anderen Quellen
 type Client struct {
 	config      config.MQTTConfig
-	client      mqtt.Client
+	conn        connection
 	isConnected bool
 	handlers    []MessageHandler
+	subscriptions []string // Zusätzliche Topics, die bei jeder Verbindung abonniert werden
+	retainedMu  sync.Mutex
+	retained    map[string][]chan string // Wartende Abfragen von GetRetainedPayload je Topic
 }
 
+// PublishClass ist die Art einer Veröffentlichung. QoS und Retain-Flag jeder Art stehen
+// unter mqtt.publish.
+type PublishClass string
+
+// Arten von Veröffentlichungen
+const (
+	ClassResults   PublishClass = "results"   // Erkennungsergebnisse, Personenzähler und Fehler
+	ClassState     PublishClass = "state"     // Zustände und Attribute von Sensoren und Schaltern
+	ClassDiscovery PublishClass = "discovery" // Home-Assistant-Discovery
+	ClassEvents    PublishClass = "events"    // Ereignisse wie Ankunft und Verlassen
+	ClassResponses PublishClass = "responses" // Antworten auf MQTT-Befehle
+	ClassStatus    PublishClass = "status"    // Verfügbarkeit (online/offline)
+)
+
 // MessageHandler ist ein Interface für Handler, die MQTT-Nachrichten verarbeiten
 type MessageHandler interface {
 	HandleMessage(topic string, payload []byte)
@@ -69,6 +86,7 @@ func NewClient(cfg config.MQTTConfig) *Client {
 	return &Client{
 		config:   cfg,
 		handlers: make([]MessageHandler, 0),
+		retained: make(map[string][]chan string),
 	}
 }
 
@@ -78,6 +96,28 @@ func (c *Client) RegisterHandler(handler MessageHandler) {
 	log.Debug("Registered new MQTT message handler")
 }
 
+// Subscribe abonniert ein zusätzliches Topic. Nachrichten werden wie die von Frigate an
+// alle Handler weitergeleitet. Das Abonnement wird nach jeder Wiederverbindung erneuert.
+func (c *Client) Subscribe(topic string) error {
+	c.subscriptions = append(c.subscriptions, topic)
+	if !c.IsConnected() {
+		return nil
+	}
+	if err := c.conn.Subscribe(topic, 1); err != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+	}
+	log.Infof("Successfully subscribed to topic: %s", topic)
+	return nil
+}
+
+// TopicPrefix gibt das Präfix der von Double-Take veröffentlichten Topics zurück
+func (c *Client) TopicPrefix() string {
+	if c.config.TopicPrefix == "" {
+		return "double-take"
+	}
+	return c.config.TopicPrefix
+}
+
 // Start startet den MQTT-Client und verbindet ihn mit dem Broker
 func (c *Client) Start() error {
 	if !c.config.Enabled {
@@ -85,82 +125,77 @@ func (c *Client) Start() error {
 		return nil
 	}
 
-	// MQTT-Client-Optionen konfigurieren
-	opts := mqtt.NewClientOptions()
-	
-	// Broker-URL erstellen - Hier wird das tcp:// protokoll hinzugefügt
-	// So kann in der config.yaml einfach die IP-Adresse ohne Protokoll verwendet werden
-	brokerURL := fmt.Sprintf("tcp://%s:%d", c.config.Broker, c.config.Port)
+	// Broker-URL erstellen, ohne Schema wird tcp:// bzw. ssl:// ergänzt
+	brokerURL, err := c.brokerURL()
+	if err != nil {
+		return err
+	}
+	tlsCfg, err := c.tlsConfig(brokerURL)
+	if err != nil {
+		return err
+	}
 	
-	log.Debugf("Verbinde mit MQTT-Broker: %s", brokerURL)
-	opts.AddBroker(brokerURL)
+	log.Debugf("Verbinde mit MQTT-Broker: %s", brokerURL.Redacted())
 	
-	// Client-ID mit Zeitstempel für Einzigartigkeit
 	clientID := c.config.ClientID
 	if clientID == "" {
 		clientID = "double_take" 
-	} else if !strings.HasPrefix(clientID, "dt_") {
+	} else if !c.config.StableClientID && !strings.HasPrefix(clientID, "dt_") {
 		clientID = "dt_" + clientID
 	}
-	// Timestamp anhängen, um bei Neustarts eine eindeutige Client-ID zu haben
-	clientID = fmt.Sprintf("%s_%d", clientID, timezone.Now().Unix())
-	opts.SetClientID(clientID)
-	
-	// Optionale Authentifizierung
-	if c.config.Username != "" {
-		opts.SetUsername(c.config.Username)
-		opts.SetPassword(c.config.Password)
+	// Ohne feste Client-ID einen Timestamp anhängen, um bei Neustarts eine eindeutige
+	// Client-ID zu haben. Eine beständige Sitzung setzt dagegen eine feste Client-ID voraus.
+	if !c.config.StableClientID {
+		clientID = fmt.Sprintf("%s_%d", clientID, timezone.Now().Unix())
+	} else if !c.config.CleanSession {
+		log.Infof("Using persistent MQTT session with client ID %s", clientID)
 	}
 	
 	// Last Will Testament für Home Assistant einrichten
 	// Das ermöglicht, dass Home Assistant automatisch erkennt, wenn die Verbindung abbricht
-	topicPrefix := c.config.TopicPrefix
-	if topicPrefix == "" {
-		topicPrefix = "double-take"
+	status := c.publishSettings(ClassStatus)
+	options := connectionOptions{
+		brokerURL:     brokerURL,
+		tlsConfig:     tlsCfg,
+		clientID:      clientID,
+		username:      c.config.Username,
+		password:      c.config.Password,
+		cleanSession:  c.config.CleanSession,
+		sessionExpiry: uint32(c.config.SessionExpiry),
+		will: willMessage{
+			topic:   c.statusTopic(),
+			payload: "offline",
+			qos:     byte(status.QoS),
+			retain:  status.Retain,
+		},
+		onConnect:        c.onConnectHandler,
+		onConnectionLost: c.connectionLostHandler,
+		onMessage:        c.messageHandler,
 	}
-	statusTopic := fmt.Sprintf("%s/status", topicPrefix)
-	opts.SetWill(statusTopic, "offline", 1, true) // QoS 1, retained
-	
-	// Connection-Callbacks konfigurieren
-	opts.SetOnConnectHandler(c.onConnectHandler)
-	opts.SetConnectionLostHandler(c.connectionLostHandler)
-	
-	// Verbindungsstabilität und automatische Wiederverbindung
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(30 * time.Second) // Maximal 30 Sekunden zwischen Verbindungsversuchen
-	opts.SetKeepAlive(60 * time.Second)            // 60 Sekunden Keep-Alive
-	opts.SetPingTimeout(10 * time.Second)          // 10 Sekunden für Ping-Timeout
-	opts.SetConnectTimeout(30 * time.Second)       // 30 Sekunden für Verbindungsaufbau
-	opts.SetCleanSession(false)                    // Session beibehalten für zuverlässige Subscriptions
-	
-	// Mehr Server-Puffer-Einstellungen
-	opts.SetWriteTimeout(5 * time.Second)
-	
-	// Will-Nachricht (Last Will and Testament) einrichten
-	willTopic := fmt.Sprintf("double-take/status/%s", clientID)
-	willPayload := []byte("{\"status\": \"offline\", \"timestamp\": \"" + timezone.Now().Format(time.RFC3339) + "\"}")
-	opts.SetWill(willTopic, string(willPayload), 0, false) // QoS 0 und nicht retained für weniger Overhead
 	
 	// Client erstellen
-	c.client = mqtt.NewClient(opts)
+	c.conn, err = newConnection(c.config.ProtocolVersion, options)
+	if err != nil {
+		return err
+	}
 	
 	// Verbindung herstellen und Wiederverbindungslogik im Fehlerfall
-	log.Infof("Connecting to MQTT broker at %s", brokerURL)
+	log.Infof("Connecting to MQTT broker at %s", brokerURL.Redacted())
 	retry := 0
 	maxRetries := 3
 	connectBackoff := time.Second
 	
 	for retry < maxRetries {
-		if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		if err := c.conn.Connect(); err != nil {
 			retry++
-			log.Warnf("MQTT connect attempt %d/%d failed: %v", retry, maxRetries, token.Error())
+			log.Warnf("MQTT connect attempt %d/%d failed: %v", retry, maxRetries, err)
 			if retry < maxRetries {
 				log.Infof("Retrying in %v...", connectBackoff)
 				time.Sleep(connectBackoff)
 				connectBackoff *= 2 // Exponentielles Backoff
 			} else {
 				log.Errorf("Failed to connect to MQTT broker after %d attempts", maxRetries)
-				return token.Error()
+				return err
 			}
 		} else {
 			// Verbindung erfolgreich
@@ -181,20 +216,12 @@ func (c *Client) monitorConnection() {
 	ticker := time.NewTicker(30 * time.Second) // Alle 30 Sekunden überprüfen
 	defer ticker.Stop()
 	
-	// Topic für Status-Updates
-	topicPrefix := c.config.TopicPrefix
-	if topicPrefix == "" {
-		topicPrefix = "double-take"
-	}
-	statusTopic := fmt.Sprintf("%s/status", topicPrefix)
-	
 	for range ticker.C {
-		if c.client != nil && c.config.Enabled {
-			if c.client.IsConnected() {
+		if c.conn != nil && c.config.Enabled {
+			if c.conn.IsConnected() {
 				// Online-Status veröffentlichen
-				token := c.client.Publish(statusTopic, 1, true, "online")
-				if token.Wait() && token.Error() != nil {
-					log.Warnf("Failed to publish online status: %v", token.Error())
+				if err := c.PublishAs(ClassStatus, c.statusTopic(), "online"); err != nil {
+					log.Warnf("Failed to publish online status: %v", err)
 				}
 				c.isConnected = true
 			} else {
@@ -204,8 +231,8 @@ func (c *Client) monitorConnection() {
 					timezone.Now().Format(time.RFC3339), c.config.ClientID)
 				
 				heartbeatTopic := fmt.Sprintf("%s/heartbeat", c.config.TopicPrefix)
-				if token := c.client.Publish(heartbeatTopic, 0, false, payload); token.Wait() && token.Error() != nil {
-					log.Warnf("Failed to publish heartbeat: %v", token.Error())
+				if err := c.conn.Publish(heartbeatTopic, 0, false, []byte(payload)); err != nil {
+					log.Warnf("Failed to publish heartbeat: %v", err)
 				} else {
 					log.Debug("MQTT heartbeat sent successfully")
 				}
@@ -216,9 +243,9 @@ func (c *Client) monitorConnection() {
 
 // Stop beendet den MQTT-Client
 func (c *Client) Stop() {
-	if c.client != nil && c.client.IsConnected() {
+	if c.conn != nil && c.conn.IsConnected() {
 		log.Info("Disconnecting MQTT client...")
-		c.client.Disconnect(250) // 250ms Wartezeit
+		c.conn.Disconnect()
 		c.isConnected = false
 		log.Info("MQTT client disconnected")
 	}
@@ -226,38 +253,45 @@ func (c *Client) Stop() {
 
 // IsConnected prüft, ob der Client verbunden ist
 func (c *Client) IsConnected() bool {
-	return c.client != nil && c.client.IsConnected()
+	return c.conn != nil && c.conn.IsConnected()
+}
+
+// statusTopic gibt das Topic der Verfügbarkeit zurück, das auch Home Assistant nutzt
+func (c *Client) statusTopic() string {
+	return fmt.Sprintf("%s/status", c.TopicPrefix())
 }
 
 // onConnectHandler wird aufgerufen, wenn die Verbindung hergestellt wurde
-func (c *Client) onConnectHandler(client mqtt.Client) {
+func (c *Client) onConnectHandler() {
 	log.Infof("Connected to MQTT broker at %s:%d", c.config.Broker, c.config.Port)
 	c.isConnected = true
 	
 	// Online-Status sofort veröffentlichen für Home Assistant
-	topicPrefix := c.config.TopicPrefix
-	if topicPrefix == "" {
-		topicPrefix = "double-take"
-	}
-	statusTopic := fmt.Sprintf("%s/status", topicPrefix)
-	
-	if token := client.Publish(statusTopic, 1, true, "online"); token.Wait() && token.Error() != nil {
-		log.Errorf("Failed to publish online status: %v", token.Error())
+	if err := c.PublishAs(ClassStatus, c.statusTopic(), "online"); err != nil {
+		log.Errorf("Failed to publish online status: %v", err)
 	} else {
 		log.Info("Published online status to Home Assistant")
 	}
 	
 	// Thema abonnieren
 	log.Infof("Subscribing to MQTT topic: %s", c.config.Topic)
-	if token := client.Subscribe(c.config.Topic, 1, c.messageHandler); token.Wait() && token.Error() != nil {
-		log.Errorf("Failed to subscribe to topic %s: %v", c.config.Topic, token.Error())
+	if err := c.conn.Subscribe(c.config.Topic, 1); err != nil {
+		log.Errorf("Failed to subscribe to topic %s: %v", c.config.Topic, err)
 	} else {
 		log.Infof("Successfully subscribed to topic: %s", c.config.Topic)
 	}
+	
+	for _, topic := range c.subscriptions {
+		if err := c.conn.Subscribe(topic, 1); err != nil {
+			log.Errorf("Failed to subscribe to topic %s: %v", topic, err)
+		} else {
+			log.Infof("Successfully subscribed to topic: %s", topic)
+		}
+	}
 }
 
 // connectionLostHandler wird aufgerufen, wenn die Verbindung verloren geht
-func (c *Client) connectionLostHandler(client mqtt.Client, err error) {
+func (c *Client) connectionLostHandler(err error) {
 	c.isConnected = false
 	
 	// Erweiterte Fehlerdiagnose
@@ -279,12 +313,14 @@ func (c *Client) connectionLostHandler(client mqtt.Client, err error) {
 }
 
 // messageHandler verarbeitet eingehende MQTT-Nachrichten
-func (c *Client) messageHandler(client mqtt.Client, msg mqtt.Message) {
-	topic := msg.Topic()
-	payload := msg.Payload()
-	
+func (c *Client) messageHandler(topic string, payload []byte) {
 	log.Debugf("Received MQTT message on topic: %s", topic)
 	
+	// Antworten auf GetRetainedPayload gehen nur an die wartende Abfrage
+	if c.deliverRetained(topic, payload) {
+		return
+	}
+	
 	// Wenn es sich um ein Frigate-Ereignis handelt, das Ereignis parsen
 	if topic == c.config.Topic {
 		var event FrigateEvent
@@ -314,8 +350,40 @@ func (c *Client) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	}
 }
 
-// PublishMessage veröffentlicht eine Nachricht an ein MQTT-Topic
+// PublishMessage veröffentlicht eine Nachricht an ein MQTT-Topic (QoS 1)
 func (c *Client) PublishMessage(topic string, payload interface{}, retain bool) error {
+	return c.publish(topic, payload, 1, retain)
+}
+
+// PublishAs veröffentlicht eine Nachricht mit QoS und Retain-Flag der Art aus mqtt.publish
+func (c *Client) PublishAs(class PublishClass, topic string, payload interface{}) error {
+	settings := c.publishSettings(class)
+	return c.publish(topic, payload, byte(settings.QoS), settings.Retain)
+}
+
+// publishSettings gibt QoS und Retain-Flag einer Art von Veröffentlichung zurück
+func (c *Client) publishSettings(class PublishClass) config.MQTTPublishClassConfig {
+	publish := c.config.Publish
+	switch class {
+	case ClassResults:
+		return publish.Results
+	case ClassState:
+		return publish.State
+	case ClassDiscovery:
+		return publish.Discovery
+	case ClassEvents:
+		return publish.Events
+	case ClassResponses:
+		return publish.Responses
+	case ClassStatus:
+		return publish.Status
+	default:
+		return config.MQTTPublishClassConfig{QoS: 1}
+	}
+}
+
+// publish wandelt die Nutzlast um und veröffentlicht sie
+func (c *Client) publish(topic string, payload interface{}, qos byte, retain bool) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("MQTT client is not connected")
 	}
@@ -339,9 +407,8 @@ func (c *Client) PublishMessage(topic string, payload interface{}, retain bool)
 		}
 	}
 
-	token := c.client.Publish(topic, 1, retain, payloadBytes)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish message to topic %s: %w", topic, token.Error())
+	if err := c.conn.Publish(topic, qos, retain, payloadBytes); err != nil {
+		return fmt.Errorf("failed to publish message to topic %s: %w", topic, err)
 	}
 
 	log.Debugf("Published message to topic: %s", topic)
@@ -364,27 +431,67 @@ func (c *Client) GetRetainedPayload(topic string) (string, error) {
 		return "", fmt.Errorf("MQTT client is not connected")
 	}
 	
-	// Channel für die Antwort erstellen
+	// Channel für die Antwort erstellen und vor dem Abonnieren registrieren, da die
+	// retained Nachricht direkt nach dem Abonnement zugestellt wird
 	respChan := make(chan string, 1)
+	c.retainedMu.Lock()
+	c.retained[topic] = append(c.retained[topic], respChan)
+	c.retainedMu.Unlock()
 	
-	// Temporären Handler für das angegebene Topic registrieren
-	token := c.client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
-		// Nachricht in den Channel schreiben und Subscription beenden
-		respChan <- string(msg.Payload())
-		c.client.Unsubscribe(topic)
-	})
-	
-	if token.Wait() && token.Error() != nil {
-		return "", fmt.Errorf("failed to subscribe to topic %s: %w", topic, token.Error())
+	if err := c.conn.Subscribe(topic, 1); err != nil {
+		c.removeRetainedWaiter(topic, respChan)
+		return "", fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
 	}
+	// Subscription nach der Antwort oder dem Timeout beenden, sofern keine weitere
+	// Abfrage auf das Topic wartet
+	defer func() {
+		if c.removeRetainedWaiter(topic, respChan) {
+			c.conn.Unsubscribe(topic)
+		}
+	}()
 	
 	// Timeout für die Antwort setzen (2 Sekunden)
 	select {
 	case payload := <-respChan:
 		return payload, nil
 	case <-time.After(2 * time.Second):
-		// Subscription beenden, falls sie noch aktiv ist
-		c.client.Unsubscribe(topic)
 		return "", nil // Keine retained Nachricht gefunden ist kein Fehler
 	}
 }
+
+// deliverRetained gibt eine Nachricht an die Abfragen weiter, die auf das Topic warten
+func (c *Client) deliverRetained(topic string, payload []byte) bool {
+	c.retainedMu.Lock()
+	defer c.retainedMu.Unlock()
+	waiters := c.retained[topic]
+	if len(waiters) == 0 {
+		return false
+	}
+	for _, waiter := range waiters {
+		select {
+		case waiter <- string(payload):
+		default: // Abfrage hat bereits eine Nachricht erhalten
+		}
+	}
+	return true
+}
+
+// removeRetainedWaiter entfernt eine beendete Abfrage von GetRetainedPayload und meldet,
+// ob es die letzte für das Topic war
+func (c *Client) removeRetainedWaiter(topic string, waiter chan string) bool {
+	c.retainedMu.Lock()
+	defer c.retainedMu.Unlock()
+	waiters := c.retained[topic]
+	for i, w := range waiters {
+		if w == waiter {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(c.retained, topic)
+		return true
+	}
+	c.retained[topic] = waiters
+	return false
+}
@@ -0,0 +1,142 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// connection kapselt die Verbindung zum Broker, damit MQTT 3.1.1 und MQTT 5 dieselbe
+// Schnittstelle bieten. Alle eingehenden Nachrichten gehen an connectionOptions.onMessage.
+type connection interface {
+	Connect() error
+	IsConnected() bool
+	Publish(topic string, qos byte, retain bool, payload []byte) error
+	Subscribe(topic string, qos byte) error
+	Unsubscribe(topic string) error
+	Disconnect()
+}
+
+// willMessage ist die Nachricht, die der Broker bei einem Verbindungsabbruch veröffentlicht
+type willMessage struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+}
+
+// connectionOptions enthält die Einstellungen, die beide Protokollversionen gemeinsam haben
+type connectionOptions struct {
+	brokerURL        *url.URL
+	tlsConfig        *tls.Config // nil = ohne TLS
+	clientID         string
+	username         string
+	password         string
+	cleanSession     bool
+	sessionExpiry    uint32 // Sekunden, nur MQTT 5
+	protocolVersion  uint   // 3 oder 4, 0 = 3.1.1 mit Rückfall auf 3.1
+	will             willMessage
+	onConnect        func()
+	onConnectionLost func(err error)
+	onMessage        func(topic string, payload []byte)
+}
+
+// pahoConnection ist die Verbindung über MQTT 3.1/3.1.1
+type pahoConnection struct {
+	client mqtt.Client
+}
+
+// newPahoConnection erstellt eine Verbindung über MQTT 3.1/3.1.1
+func newPahoConnection(options connectionOptions) *pahoConnection {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(options.brokerURL.String())
+	opts.SetClientID(options.clientID)
+	if options.tlsConfig != nil {
+		opts.SetTLSConfig(options.tlsConfig)
+	}
+	if options.username != "" {
+		opts.SetUsername(options.username)
+		opts.SetPassword(options.password)
+	}
+	if options.protocolVersion != 0 {
+		opts.SetProtocolVersion(options.protocolVersion)
+	}
+	opts.SetWill(options.will.topic, options.will.payload, options.will.qos, options.will.retain)
+
+	opts.SetOnConnectHandler(func(mqtt.Client) { options.onConnect() })
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) { options.onConnectionLost(err) })
+	// Abonnements werden ohne eigenen Callback angelegt, alle Nachrichten landen hier. So
+	// werden auch Nachrichten einer fortgesetzten Sitzung vor dem erneuten Abonnieren zugestellt.
+	opts.SetDefaultPublishHandler(func(_ mqtt.Client, msg mqtt.Message) {
+		options.onMessage(msg.Topic(), msg.Payload())
+	})
+
+	// Verbindungsstabilität und automatische Wiederverbindung
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(30 * time.Second) // Maximal 30 Sekunden zwischen Verbindungsversuchen
+	opts.SetKeepAlive(60 * time.Second)            // 60 Sekunden Keep-Alive
+	opts.SetPingTimeout(10 * time.Second)          // 10 Sekunden für Ping-Timeout
+	opts.SetConnectTimeout(30 * time.Second)       // 30 Sekunden für Verbindungsaufbau
+	opts.SetCleanSession(options.cleanSession)
+	opts.SetWriteTimeout(5 * time.Second)
+
+	return &pahoConnection{client: mqtt.NewClient(opts)}
+}
+
+// Connect stellt die Verbindung her
+func (c *pahoConnection) Connect() error {
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// IsConnected prüft, ob die Verbindung besteht
+func (c *pahoConnection) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+// Publish veröffentlicht eine Nachricht
+func (c *pahoConnection) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	if token := c.client.Publish(topic, qos, retain, payload); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Subscribe abonniert ein Topic
+func (c *pahoConnection) Subscribe(topic string, qos byte) error {
+	if token := c.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Unsubscribe beendet ein Abonnement
+func (c *pahoConnection) Unsubscribe(topic string) error {
+	if token := c.client.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Disconnect trennt die Verbindung
+func (c *pahoConnection) Disconnect() {
+	c.client.Disconnect(250) // 250ms Wartezeit
+}
+
+// newConnection erstellt die Verbindung für die konfigurierte Protokollversion
+func newConnection(version int, options connectionOptions) (connection, error) {
+	switch version {
+	case 0, 3, 4:
+		options.protocolVersion = uint(version)
+		return newPahoConnection(options), nil
+	case 5:
+		return newAutopahoConnection(options), nil
+	default:
+		return nil, fmt.Errorf("unsupported MQTT protocol version %d", version)
+	}
+}
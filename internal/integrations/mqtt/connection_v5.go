@@ -0,0 +1,183 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	log "github.com/sirupsen/logrus"
+)
+
+// autopahoConnection ist die Verbindung über MQTT 5. Die Wiederverbindung übernimmt autopaho.
+type autopahoConnection struct {
+	options   connectionOptions
+	manager   *autopaho.ConnectionManager
+	cancel    context.CancelFunc
+	connected atomic.Bool
+	mu        sync.Mutex // Schützt manager und lastError
+	lastError error      // Letzter Fehler beim Verbindungsaufbau
+}
+
+// newAutopahoConnection erstellt eine Verbindung über MQTT 5
+func newAutopahoConnection(options connectionOptions) *autopahoConnection {
+	return &autopahoConnection{options: options}
+}
+
+// Connect stellt die Verbindung her und wartet höchstens 30 Sekunden auf den Broker
+func (c *autopahoConnection) Connect() error {
+	options := c.options
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{options.brokerURL},
+		TlsCfg:                        options.tlsConfig,
+		KeepAlive:                     60,
+		CleanStartOnInitialConnection: options.cleanSession,
+		ConnectTimeout:                30 * time.Second,
+		ConnectUsername:               options.username,
+		WillMessage: &paho.WillMessage{
+			Topic:   options.will.topic,
+			Payload: []byte(options.will.payload),
+			QoS:     options.will.qos,
+			Retain:  options.will.retain,
+		},
+		OnConnectionUp: func(manager *autopaho.ConnectionManager, _ *paho.Connack) {
+			c.mu.Lock()
+			c.manager = manager
+			c.mu.Unlock()
+			c.connected.Store(true)
+			// Darf nicht blockieren, Abonnements und Status werden daher nebenläufig gesendet
+			go options.onConnect()
+		},
+		OnConnectionDown: func() bool {
+			c.connected.Store(false)
+			return true // Weiter versuchen, die Verbindung wiederherzustellen
+		},
+		OnConnectError: func(err error) {
+			c.mu.Lock()
+			c.lastError = err
+			c.mu.Unlock()
+			log.Warnf("MQTT connect attempt failed: %v", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: options.clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(received paho.PublishReceived) (bool, error) {
+					options.onMessage(received.Packet.Topic, received.Packet.Payload)
+					return true, nil
+				},
+			},
+			OnClientError: options.onConnectionLost,
+			OnServerDisconnect: func(disconnect *paho.Disconnect) {
+				options.onConnectionLost(fmt.Errorf("disconnected by broker (reason code %d)", disconnect.ReasonCode))
+			},
+		},
+	}
+	if options.password != "" {
+		cfg.ConnectPassword = []byte(options.password)
+	}
+	// Ohne Ablaufzeit endet die Sitzung mit der Verbindung
+	if !options.cleanSession {
+		cfg.SessionExpiryInterval = options.sessionExpiry
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	manager, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer waitCancel()
+	if err := manager.AwaitConnection(waitCtx); err != nil {
+		cancel()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.manager = nil
+		if c.lastError != nil {
+			return c.lastError
+		}
+		return err
+	}
+
+	c.cancel = cancel
+	return nil
+}
+
+// connectionManager gibt den Verbindungsmanager zurück oder einen Fehler, solange noch
+// keine Verbindung bestand
+func (c *autopahoConnection) connectionManager() (*autopaho.ConnectionManager, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.manager == nil {
+		return nil, autopaho.ConnectionDownError
+	}
+	return c.manager, nil
+}
+
+// IsConnected prüft, ob die Verbindung besteht
+func (c *autopahoConnection) IsConnected() bool {
+	return c.connected.Load()
+}
+
+// Publish veröffentlicht eine Nachricht
+func (c *autopahoConnection) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	manager, err := c.connectionManager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = manager.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retain,
+		Payload: payload,
+	})
+	return err
+}
+
+// Subscribe abonniert ein Topic
+func (c *autopahoConnection) Subscribe(topic string, qos byte) error {
+	manager, err := c.connectionManager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = manager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+	return err
+}
+
+// Unsubscribe beendet ein Abonnement
+func (c *autopahoConnection) Unsubscribe(topic string) error {
+	manager, err := c.connectionManager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = manager.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}})
+	return err
+}
+
+// Disconnect trennt die Verbindung
+func (c *autopahoConnection) Disconnect() {
+	manager, err := c.connectionManager()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := manager.Disconnect(ctx); err != nil {
+		log.Warnf("Failed to disconnect MQTT client cleanly: %v", err)
+	}
+	c.cancel()
+	c.connected.Store(false)
+}
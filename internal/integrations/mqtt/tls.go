@@ -0,0 +1,111 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// brokerURL erstellt die URL des Brokers. Enthält mqtt.broker ein Schema (z.B. ssl:// oder
+// wss://), wird es übernommen, sonst wird tcp:// bzw. mit tls.enabled ssl:// ergänzt. So kann
+// in der config.yaml weiterhin einfach die IP-Adresse ohne Protokoll verwendet werden.
+// Aliase wie mqtts:// oder tcps:// werden auf ssl:// abgebildet. Mit tls.enabled werden
+// auch ausdrücklich angegebene tcp:// und ws:// verschlüsselt (ssl:// bzw. wss://).
+func (c *Client) brokerURL() (*url.URL, error) {
+	broker := c.config.Broker
+	if !strings.Contains(broker, "://") {
+		scheme := "tcp"
+		if c.config.TLS.Enabled {
+			scheme = "ssl"
+		}
+		broker = scheme + "://" + broker
+	}
+
+	parsed, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker %q: %w", c.config.Broker, err)
+	}
+	// Gleichwertige Schemata vereinheitlichen, damit beide Protokollversionen sie verstehen
+	switch strings.ToLower(parsed.Scheme) {
+	case "tcp", "mqtt":
+		parsed.Scheme = "tcp"
+	case "ssl", "tls", "tcps", "mqtts", "mqtt+ssl":
+		parsed.Scheme = "ssl"
+	case "ws", "wss":
+		parsed.Scheme = strings.ToLower(parsed.Scheme)
+	default:
+		return nil, fmt.Errorf("invalid MQTT broker %q: unsupported scheme %q, use tcp, ssl, ws or wss", c.config.Broker, parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid MQTT broker %q: missing host", c.config.Broker)
+	}
+	// tls.enabled darf nicht unbemerkt unverschlüsselt verbinden
+	if c.config.TLS.Enabled && (parsed.Scheme == "tcp" || parsed.Scheme == "ws") {
+		unencrypted := parsed.Scheme
+		if unencrypted == "tcp" {
+			parsed.Scheme = "ssl"
+		} else {
+			parsed.Scheme = "wss"
+		}
+		log.Warnf("MQTT broker %q uses %s:// but mqtt.tls.enabled is set, connecting with %s:// instead",
+			c.config.Broker, unencrypted, parsed.Scheme)
+	}
+	// WebSockets nutzen ohne Port in der URL die Standardports 80/443 statt mqtt.port
+	if parsed.Port() == "" && c.config.Port > 0 && parsed.Scheme != "ws" && parsed.Scheme != "wss" {
+		parsed.Host = parsed.Host + ":" + strconv.Itoa(c.config.Port)
+	}
+	return parsed, nil
+}
+
+// usesTLS prüft, ob die Verbindung zum Broker verschlüsselt wird
+func (c *Client) usesTLS(broker *url.URL) bool {
+	return broker.Scheme == "ssl" || broker.Scheme == "wss"
+}
+
+// tlsConfig erstellt die TLS-Konfiguration aus mqtt.tls oder gibt nil zurück, wenn die
+// Verbindung unverschlüsselt ist. Die CA-Datei ergänzt die Zertifikate des Systems.
+func (c *Client) tlsConfig(broker *url.URL) (*tls.Config, error) {
+	if !c.usesTLS(broker) {
+		return nil, nil
+	}
+
+	settings := c.config.TLS
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+
+	if settings.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in MQTT CA file %s", settings.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if settings.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.InsecureSkipVerify {
+		log.Warn("MQTT broker certificate verification is disabled (mqtt.tls.insecure_skip_verify)")
+	}
+	return tlsCfg, nil
+}
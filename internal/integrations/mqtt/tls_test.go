@@ -0,0 +1,65 @@
+package mqtt
+
+import (
+	"fmt"
+	"testing"
+
+	"double-take-go-reborn/config"
+)
+
+func TestBrokerURL(t *testing.T) {
+	tests := []struct {
+		broker  string
+		tls     bool
+		want    string
+		wantTLS bool
+		wantErr bool
+	}{
+		{broker: "192.168.1.10", want: "tcp://192.168.1.10:1883"},
+		{broker: "192.168.1.10", tls: true, want: "ssl://192.168.1.10:1883", wantTLS: true},
+		{broker: "mqtt://broker:1884", want: "tcp://broker:1884"},
+		{broker: "ssl://broker", want: "ssl://broker:1883", wantTLS: true},
+		{broker: "tls://broker", want: "ssl://broker:1883", wantTLS: true},
+		{broker: "mqtts://broker:8883", want: "ssl://broker:8883", wantTLS: true},
+		{broker: "tcps://broker:8883", want: "ssl://broker:8883", wantTLS: true},
+		{broker: "mqtt+ssl://broker:8883", want: "ssl://broker:8883", wantTLS: true},
+		{broker: "SSL://broker:8883", want: "ssl://broker:8883", wantTLS: true},
+		{broker: "ws://broker/mqtt", want: "ws://broker/mqtt"},
+		{broker: "tcp://broker:8883", want: "tcp://broker:8883"},
+		{broker: "tcp://broker:8883", tls: true, want: "ssl://broker:8883", wantTLS: true},
+		{broker: "mqtt://broker", tls: true, want: "ssl://broker:1883", wantTLS: true},
+		{broker: "ws://broker/mqtt", tls: true, want: "wss://broker/mqtt", wantTLS: true},
+		{broker: "ssl://broker:8883", tls: true, want: "ssl://broker:8883", wantTLS: true},
+		{broker: "wss://broker/mqtt", want: "wss://broker/mqtt", wantTLS: true},
+		{broker: "http://broker", wantErr: true},
+		{broker: "unix:///run/mosquitto.sock", wantErr: true},
+		{broker: "tcp://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s tls=%v", tt.broker, tt.tls), func(t *testing.T) {
+			c := &Client{config: config.MQTTConfig{
+				Broker: tt.broker,
+				Port:   1883,
+				TLS:    config.MQTTTLSConfig{Enabled: tt.tls},
+			}}
+
+			got, err := c.brokerURL()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			if c.usesTLS(got) != tt.wantTLS {
+				t.Fatalf("usesTLS(%s) = %v, want %v", got, !tt.wantTLS, tt.wantTLS)
+			}
+		})
+	}
+}
@@ -1,20 +1,31 @@
 package provider
 
 import (
+	"time"
+
 	"double-take-go-reborn/config"
 	"double-take-go-reborn/internal/integrations/compreface"
 	"double-take-go-reborn/internal/integrations/facerecognition"
 	"double-take-go-reborn/internal/integrations/insightface"
 
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // Log-Felder für die Gesichtserkennungsanbieter
 
 // CreateManager erstellt einen neuen ProviderManager für Gesichtserkennungsdienste
-// basierend auf der Konfiguration
-func CreateManager(cfg *config.Config) (*facerecognition.ProviderManager, error) {
+// basierend auf der Konfiguration. Die Datenbank dient Providern ohne eigene
+// Gesichtsdatenbank (InsightFace) als Speicher für Gesichtsvektoren.
+func CreateManager(cfg *config.Config, db *gorm.DB) (*facerecognition.ProviderManager, error) {
 	manager := facerecognition.NewProviderManager()
+	manager.SetHealthConfig(facerecognition.HealthConfig{
+		FailureThreshold:   cfg.ProviderHealth.FailureThreshold,
+		ErrorRateThreshold: cfg.ProviderHealth.ErrorRateThreshold,
+		WindowSize:         cfg.ProviderHealth.WindowSize,
+		OpenTimeout:        time.Duration(cfg.ProviderHealth.OpenTimeout) * time.Second,
+		CheckInterval:      time.Duration(cfg.ProviderHealth.CheckInterval) * time.Second,
+	})
 	
 	// CompreFace-Provider registrieren, falls konfiguriert
 	if cfg.CompreFace.Enabled {
@@ -26,7 +37,7 @@ func CreateManager(cfg *config.Config) (*facerecognition.ProviderManager, error)
 	// InsightFace-Provider registrieren, falls konfiguriert
 	if cfg.InsightFace.Enabled {
 		log.Info("Registriere InsightFace als Gesichtserkennungsanbieter")
-		insightFaceService := insightface.NewService(cfg.InsightFace)
+		insightFaceService := insightface.NewService(cfg.InsightFace, db)
 		manager.RegisterProvider(insightFaceService)
 	}
 	
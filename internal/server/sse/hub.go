@@ -44,6 +44,9 @@ const (
 	EventUpdateImage SseEventType = "update_image"  // Aktualisierung eines Bildes
 	EventNewGroup    SseEventType = "new_group"     // Neue Bildgruppe
 	EventDeleteImage SseEventType = "delete_image"  // Bild wurde gelöscht
+	EventVerdict     SseEventType = "event_verdict" // Zusammengefasstes Ergebnis eines Events
+	EventArrived     SseEventType = "presence_arrived" // Identität ist angekommen
+	EventLeft        SseEventType = "presence_left"    // Identität hat den Bereich verlassen
 )
 
 // SseEvent ist die Basisstruktur für alle SSE-Ereignisse
@@ -83,6 +86,34 @@ type NewGroupData struct {
 	ThumbnailURL string  `json:"thumbnail_url"`
 }
 
+// VerdictData enthält das zusammengefasste Erkennungsergebnis eines Events
+type VerdictData struct {
+	EventID     string  `json:"event_id"`
+	Camera      string  `json:"camera,omitempty"`
+	Identity    string  `json:"identity,omitempty"` // Leer, wenn die Person unbekannt ist
+	Confidence  float64 `json:"confidence"`
+	Quality     float64 `json:"quality"`
+	ImageID     uint    `json:"image_id"`
+	FaceID      uint    `json:"face_id"`
+	FaceCount   int     `json:"face_count"`
+	SnapshotURL string  `json:"snapshot_url"`
+}
+
+// PresenceData beschreibt einen Aufenthalt bei Ankunft oder Verlassen
+type PresenceData struct {
+	SessionID  uint       `json:"session_id"`
+	IdentityID uint       `json:"identity_id"`
+	Identity   string     `json:"identity"`
+	Camera     string     `json:"camera,omitempty"` // Leer = unabhängig von der Kamera
+	Zone       string     `json:"zone,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Detections int        `json:"detections"`
+	Confidence float64    `json:"confidence"`
+	ImageID    uint       `json:"image_id"`
+}
+
 // MatchData enthält vereinfachte Informationen über Matches für die SSE-Nachricht
 type MatchData struct {
 	Identity   string  `json:"identity"`
@@ -331,3 +362,71 @@ func (h *Hub) BroadcastNewGroup(eventID, source, camera, label, zone string, ima
 	// Daten broadcasten
 	h.Broadcast(jsonData)
 }
+
+// BroadcastEventVerdict sendet das aktuelle Gesamtergebnis eines Events an alle Clients
+func (h *Hub) BroadcastEventVerdict(verdict models.EventVerdict, snapshotURL string) {
+	verdictData := VerdictData{
+		EventID:     verdict.EventID,
+		Camera:      verdict.Camera,
+		Confidence:  verdict.Confidence,
+		Quality:     verdict.Quality,
+		ImageID:     verdict.ImageID,
+		FaceID:      verdict.FaceID,
+		FaceCount:   verdict.FaceCount,
+		SnapshotURL: snapshotURL,
+	}
+	if verdict.Identity != nil {
+		verdictData.Identity = verdict.Identity.Name
+	}
+	
+	log.Infof("Broadcasting verdict for event %s (identity: %q) to SSE clients", verdict.EventID, verdictData.Identity)
+	
+	sseEvent := SseEvent{
+		Type:      EventVerdict,
+		Timestamp: timezone.Now(),
+		Data:      verdictData,
+	}
+	
+	jsonData, err := json.Marshal(sseEvent)
+	if err != nil {
+		log.Errorf("Failed to marshal event verdict for SSE: %v", err)
+		return
+	}
+	
+	h.Broadcast(jsonData)
+}
+
+// BroadcastPresence meldet die Ankunft oder das Verlassen einer Identität an alle Clients
+func (h *Hub) BroadcastPresence(event models.PresenceEvent) {
+	session := event.Session
+	eventType := EventArrived
+	if event.Type == models.PresenceLeft {
+		eventType = EventLeft
+	}
+
+	sseEvent := SseEvent{
+		Type:      eventType,
+		Timestamp: timezone.Now(),
+		Data: PresenceData{
+			SessionID:  session.ID,
+			IdentityID: session.IdentityID,
+			Identity:   session.Identity.Name,
+			Camera:     session.Camera,
+			Zone:       session.Zone,
+			StartedAt:  session.StartedAt,
+			LastSeenAt: session.LastSeenAt,
+			EndedAt:    session.EndedAt,
+			Detections: session.Detections,
+			Confidence: session.BestConfidence,
+			ImageID:    session.ImageID,
+		},
+	}
+
+	jsonData, err := json.Marshal(sseEvent)
+	if err != nil {
+		log.Errorf("Failed to marshal presence event for SSE: %v", err)
+		return
+	}
+
+	h.Broadcast(jsonData)
+}
@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+
+	"gorm.io/gorm"
+)
+
+// Aktionen im Audit-Log
+const (
+	ActionMatchUpdate       = "match.update"
+	ActionIdentityRename    = "identity.rename"
+	ActionIdentityDelete    = "identity.delete"
+	ActionTrainingAddFace   = "training.add_face"
+	ActionTrainingDeleteAll = "training.delete_all"
+	ActionMatchRevert       = "match.revert"
+	ActionClusterName       = "cluster.name"
+)
+
+// Betroffene Objekttypen
+const (
+	EntityMatch    = "match"
+	EntityIdentity = "identity"
+	EntityFace     = "face"
+	EntityTraining = "training"
+	EntityCluster  = "cluster"
+)
+
+// AnonymousActor wird eingetragen, wenn die Anmeldung deaktiviert ist
+const AnonymousActor = "anonymous"
+
+// Actor beschreibt, wer eine Änderung ausgelöst hat
+type Actor struct {
+	UserID    *uint
+	Username  string
+	TokenID   *uint
+	TokenName string
+	ClientIP  string
+}
+
+// Record schreibt einen Eintrag ins Audit-Log. Er wird mit der übergebenen Transaktion
+// geschrieben, damit Änderung und Eintrag nur gemeinsam gespeichert werden.
+func Record(tx *gorm.DB, actor Actor, action, entityType string, entityID uint, before, after interface{}) (*models.AuditEntry, error) {
+	entry := models.AuditEntry{
+		UserID:     actor.UserID,
+		Actor:      actor.Username,
+		TokenID:    actor.TokenID,
+		TokenName:  actor.TokenName,
+		ClientIP:   actor.ClientIP,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	if entry.Actor == "" {
+		entry.Actor = AnonymousActor
+	}
+
+	var err error
+	if entry.Before, err = marshalState(before); err != nil {
+		return nil, err
+	}
+	if entry.After, err = marshalState(after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Schreiben des Audit-Eintrags: %w", err)
+	}
+	return &entry, nil
+}
+
+// MarkReverted vermerkt an einem Eintrag, dass seine Änderung durch den Eintrag
+// revertedBy rückgängig gemacht wurde
+func MarkReverted(tx *gorm.DB, entry *models.AuditEntry, revertedBy *models.AuditEntry) error {
+	now := time.Now()
+	entry.RevertedAt = &now
+	entry.RevertedByID = &revertedBy.ID
+	if err := tx.Model(entry).Updates(map[string]interface{}{
+		"reverted_at":    now,
+		"reverted_by_id": revertedBy.ID,
+	}).Error; err != nil {
+		return fmt.Errorf("fehler beim Markieren des Audit-Eintrags: %w", err)
+	}
+	return nil
+}
+
+// Revertible prüft, ob sich die Änderung eines Eintrags rückgängig machen lässt
+func Revertible(entry *models.AuditEntry) bool {
+	if entry.RevertedAt != nil {
+		return false
+	}
+	return entry.Action == ActionMatchUpdate || entry.Action == ActionTrainingAddFace
+}
+
+// Filter schränkt die Abfrage des Audit-Logs ein
+type Filter struct {
+	Action     string
+	EntityType string
+	EntityID   uint
+	UserID     uint
+	Actor      string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// Service stellt das Audit-Log zur Abfrage bereit
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService erstellt einen neuen Audit-Service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// List liefert die neuesten passenden Einträge und die Gesamtzahl der Treffer
+func (s *Service) List(filter Filter) ([]models.AuditEntry, int64, error) {
+	query := s.db.Model(&models.AuditEntry{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID > 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var entries []models.AuditEntry
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Get liefert einen einzelnen Eintrag
+func (s *Service) Get(id uint) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	if err := s.db.First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// MatchState liefert den protokollierten Zustand eines Treffers
+func MatchState(match models.Match, identityName string) map[string]interface{} {
+	return map[string]interface{}{
+		"match_id":      match.ID,
+		"face_id":       match.FaceID,
+		"image_id":      match.Face.ImageID,
+		"identity_id":   match.IdentityID,
+		"identity_name": identityName,
+		"confidence":    match.Confidence,
+	}
+}
+
+// MatchSnapshot ist der mit MatchState protokollierte Zustand eines Treffers
+type MatchSnapshot struct {
+	MatchID      uint    `json:"match_id"`
+	FaceID       uint    `json:"face_id"`
+	ImageID      uint    `json:"image_id"`
+	IdentityID   uint    `json:"identity_id"`
+	IdentityName string  `json:"identity_name"`
+	Confidence   float64 `json:"confidence"`
+}
+
+// ParseMatchState liest einen mit MatchState protokollierten Zustand (nil, wenn leer)
+func ParseMatchState(data []byte) (*MatchSnapshot, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var snapshot MatchSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen des Audit-Zustands: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// IdentityState liefert den protokollierten Zustand einer Identität
+func IdentityState(identity models.Identity) map[string]interface{} {
+	return map[string]interface{}{
+		"identity_id": identity.ID,
+		"name":        identity.Name,
+		"external_id": identity.ExternalID,
+	}
+}
+
+// marshalState serialisiert einen Zustand, nil bleibt leer
+func marshalState(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Serialisieren des Audit-Zustands: %w", err)
+	}
+	return data, nil
+}
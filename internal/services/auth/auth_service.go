@@ -0,0 +1,522 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	minPasswordLength = 8
+	tokenPrefix       = "dt_"
+	tokenPrefixLength = 10 // Angezeigter Anfang eines Tokens
+	sessionKeyFile    = "session.key"
+	lastUsedInterval  = time.Minute // Mindestabstand für das Speichern der letzten Nutzung
+)
+
+var (
+	// ErrInvalidCredentials wird bei falschem Benutzernamen oder Passwort zurückgegeben
+	ErrInvalidCredentials = errors.New("ungültiger Benutzername oder ungültiges Passwort")
+	// ErrInvalidToken wird bei einem unbekannten API-Token zurückgegeben
+	ErrInvalidToken = errors.New("ungültiger API-Token")
+	// ErrTokenExpired wird bei einem abgelaufenen API-Token zurückgegeben
+	ErrTokenExpired = errors.New("api-token ist abgelaufen")
+	// ErrLastAdmin verhindert, dass der letzte Administrator entfernt oder herabgestuft wird
+	ErrLastAdmin = errors.New("der letzte Administrator kann nicht entfernt werden")
+)
+
+// dummyHash wird bei unbekannten Benutzern verglichen, damit die Antwortzeit nicht
+// verrät, ob ein Benutzername existiert
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("double-take"), bcrypt.DefaultCost)
+
+// Service verwaltet lokale Benutzer und API-Tokens
+type Service struct {
+	db  *gorm.DB
+	cfg config.AuthConfig
+}
+
+// NewService erstellt einen neuen Auth-Service
+func NewService(db *gorm.DB, cfg config.AuthConfig) *Service {
+	return &Service{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// ValidRole prüft, ob eine Rolle bekannt ist
+func ValidRole(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleViewer
+}
+
+// ValidScope prüft, ob eine Berechtigung bekannt ist
+func ValidScope(scope string) bool {
+	switch scope {
+	case models.ScopeIngest, models.ScopeRead, models.ScopeTraining, models.ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// NormalizeScopes prüft Berechtigungen und entfernt Duplikate
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !ValidScope(scope) {
+			return nil, fmt.Errorf("unbekannte Berechtigung: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("mindestens eine Berechtigung erforderlich")
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// RoleScopes liefert die Berechtigungen einer Benutzerrolle
+func RoleScopes(role string) []string {
+	if role == models.RoleAdmin {
+		return []string{models.ScopeAdmin}
+	}
+	return []string{models.ScopeRead}
+}
+
+// HasScope prüft, ob die gewährten Berechtigungen die geforderte umfassen. Die
+// Berechtigung admin umfasst alle anderen.
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == models.ScopeAdmin || scope == required {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopesRole bildet Berechtigungen auf die entsprechende Rolle ab
+func ScopesRole(scopes []string) string {
+	if HasScope(scopes, models.ScopeAdmin) {
+		return models.RoleAdmin
+	}
+	return models.RoleViewer
+}
+
+// EnsureAdmin legt den initialen Administrator an, falls noch kein Benutzer existiert
+func (s *Service) EnsureAdmin() error {
+	var count int64
+	if err := s.db.Model(&models.User{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("fehler beim Zählen der Benutzer: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	username := s.cfg.AdminUsername
+	if username == "" {
+		username = "admin"
+	}
+	password := s.cfg.AdminPassword
+	generated := password == ""
+	if generated {
+		random, err := randomString(12)
+		if err != nil {
+			return err
+		}
+		password = random
+	}
+
+	if _, err := s.CreateUser(username, password, models.RoleAdmin); err != nil {
+		return fmt.Errorf("fehler beim Anlegen des Administrators: %w", err)
+	}
+	if generated {
+		log.Warnf("Administrator %q mit dem Passwort %q angelegt - bitte nach der ersten Anmeldung ändern", username, password)
+	} else {
+		log.Infof("Administrator %q angelegt", username)
+	}
+	return nil
+}
+
+// SessionSecret liefert den Schlüssel für Session-Cookies. Ist keiner konfiguriert,
+// wird ein zufälliger Schlüssel erzeugt und im Datenverzeichnis gespeichert, damit
+// Sessions einen Neustart überstehen.
+func (s *Service) SessionSecret(dataDir string) ([]byte, error) {
+	if s.cfg.SessionSecret != "" {
+		return []byte(s.cfg.SessionSecret), nil
+	}
+
+	path := filepath.Join(dataDir, sessionKeyFile)
+	if key, err := os.ReadFile(path); err == nil && len(key) >= 32 {
+		return key, nil
+	}
+
+	key := make([]byte, 64)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("fehler beim Erzeugen des Session-Schlüssels: %w", err)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("fehler beim Erstellen des Datenverzeichnisses: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("fehler beim Speichern des Session-Schlüssels: %w", err)
+	}
+	return key, nil
+}
+
+// SessionMaxAge liefert die Gültigkeitsdauer einer Session in Sekunden
+func (s *Service) SessionMaxAge() int {
+	if s.cfg.SessionMaxAge <= 0 {
+		return 168 * 3600
+	}
+	return s.cfg.SessionMaxAge * 3600
+}
+
+// SecureCookie gibt an, ob das Session-Cookie nur über HTTPS gesendet wird
+func (s *Service) SecureCookie() bool {
+	return s.cfg.SecureCookie
+}
+
+// Authenticate prüft Benutzername und Passwort und vermerkt die Anmeldung
+func (s *Service) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	if err := s.db.Model(&user).Update("last_login_at", now).Error; err != nil {
+		log.Warnf("Fehler beim Speichern der Anmeldung von %s: %v", username, err)
+	}
+	return &user, nil
+}
+
+// GetUser lädt einen Benutzer
+func (s *Service) GetUser(id uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers liefert alle Benutzer
+func (s *Service) ListUsers() ([]models.User, error) {
+	var users []models.User
+	if err := s.db.Order("username ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser legt einen neuen Benutzer an
+func (s *Service) CreateUser(username, password, role string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("benutzername darf nicht leer sein")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unbekannte Rolle: %s", role)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+	}
+	if err := s.db.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Anlegen des Benutzers: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdateUser ändert Passwort und/oder Rolle eines Benutzers (leere Werte bleiben unverändert)
+func (s *Service) UpdateUser(id uint, password, role string) (*models.User, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		updates["password_hash"] = hash
+	}
+	if role != "" && role != user.Role {
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("unbekannte Rolle: %s", role)
+		}
+		if user.Role == models.RoleAdmin {
+			if err := s.ensureOtherAdmin(user.ID); err != nil {
+				return nil, err
+			}
+		}
+		updates["role"] = role
+	}
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	if err := s.db.Model(user).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Aktualisieren des Benutzers: %w", err)
+	}
+	return s.GetUser(id)
+}
+
+// DeleteUser löscht einen Benutzer samt seiner API-Tokens
+func (s *Service) DeleteUser(id uint) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin {
+		if err := s.ensureOtherAdmin(user.ID); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIToken{}).Error; err != nil {
+			return fmt.Errorf("fehler beim Löschen der API-Tokens: %w", err)
+		}
+		if err := tx.Unscoped().Delete(user).Error; err != nil {
+			return fmt.Errorf("fehler beim Löschen des Benutzers: %w", err)
+		}
+		return nil
+	})
+}
+
+// CreateToken erzeugt einen API-Token mit den angegebenen Berechtigungen für einen
+// Benutzer. Ohne Berechtigungen erhält der Token die der Benutzerrolle, expiresAt nil
+// bedeutet unbegrenzte Gültigkeit. Der Klartext wird nur hier zurückgegeben.
+func (s *Service) CreateToken(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(scopes) == 0 {
+		scopes = RoleScopes(user.Role)
+	}
+	scopes, err = NormalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, scope := range scopes {
+		if !HasScope(RoleScopes(user.Role), scope) {
+			return "", nil, fmt.Errorf("die Berechtigung %s übersteigt die Rechte des Benutzers", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("das Ablaufdatum muss in der Zukunft liegen")
+	}
+
+	random, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	plain := tokenPrefix + random
+
+	token := models.APIToken{
+		Name:      strings.TrimSpace(name),
+		TokenHash: hashToken(plain),
+		Prefix:    plain[:tokenPrefixLength],
+		UserID:    user.ID,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if token.Name == "" {
+		token.Name = "token"
+	}
+	if err := s.db.Create(&token).Error; err != nil {
+		return "", nil, fmt.Errorf("fehler beim Anlegen des API-Tokens: %w", err)
+	}
+	return plain, &token, nil
+}
+
+// ListTokens liefert die API-Tokens eines Benutzers (0 = aller Benutzer)
+func (s *Service) ListTokens(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	query := s.db.Order("created_at DESC")
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteToken widerruft einen API-Token. Protokolleinträge bleiben mit Name und
+// Präfix des Tokens erhalten.
+func (s *Service) DeleteToken(id uint) error {
+	result := s.db.Delete(&models.APIToken{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AuthenticateToken prüft einen API-Token und liefert ihn samt Benutzer. Abgelaufene
+// Tokens werden abgelehnt, der Zeitpunkt der letzten Nutzung wird aktualisiert.
+func (s *Service) AuthenticateToken(plain, clientIP string) (*models.APIToken, error) {
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	var token models.APIToken
+	if err := s.db.Preload("User").Where("token_hash = ?", hashToken(plain)).First(&token).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	if token.User.ID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, ErrTokenExpired
+	}
+
+	// Die letzte Nutzung nur gedrosselt schreiben, um nicht bei jeder Anfrage die
+	// Datenbank zu belasten
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedInterval || token.LastUsedIP != clientIP {
+		token.LastUsedAt = &now
+		token.LastUsedIP = clientIP
+		if err := s.db.Model(&models.APIToken{}).Where("id = ?", token.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP}).Error; err != nil {
+			log.Warnf("Fehler beim Aktualisieren der letzten Nutzung von Token %s: %v", token.Prefix, err)
+		}
+	}
+	return &token, nil
+}
+
+// TokenScopes liefert die wirksamen Berechtigungen eines Tokens. Sie sind durch die
+// Rolle des Benutzers begrenzt, falls diese nachträglich herabgestuft wurde.
+func TokenScopes(token *models.APIToken) []string {
+	userScopes := RoleScopes(token.User.Role)
+	var scopes []string
+	for _, scope := range token.ScopeList() {
+		if HasScope(userScopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// LogRequest speichert einen Eintrag im Anfrageprotokoll
+func (s *Service) LogRequest(entry *models.APIRequestLog) error {
+	if err := s.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("fehler beim Speichern des Anfrageprotokolls: %w", err)
+	}
+	return nil
+}
+
+// RequestLogFilter schränkt die Abfrage des Anfrageprotokolls ein
+type RequestLogFilter struct {
+	TokenID uint
+	UserID  uint
+	Since   time.Time
+	Limit   int
+	Offset  int
+}
+
+// ListRequestLogs liefert die neuesten Einträge des Anfrageprotokolls und die
+// Gesamtzahl der passenden Einträge
+func (s *Service) ListRequestLogs(filter RequestLogFilter) ([]models.APIRequestLog, int64, error) {
+	query := s.db.Model(&models.APIRequestLog{})
+	if filter.TokenID > 0 {
+		query = query.Where("token_id = ?", filter.TokenID)
+	}
+	if filter.UserID > 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var entries []models.APIRequestLog
+	if err := query.Order("created_at DESC").Limit(limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ensureOtherAdmin stellt sicher, dass es neben dem angegebenen Benutzer noch einen
+// weiteren Administrator gibt
+func (s *Service) ensureOtherAdmin(userID uint) error {
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("role = ? AND id <> ?", models.RoleAdmin, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// hashPassword prüft die Mindestlänge und erzeugt den bcrypt-Hash eines Passworts
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("das Passwort muss mindestens %d Zeichen lang sein", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("fehler beim Hashen des Passworts: %w", err)
+	}
+	return string(hash), nil
+}
+
+// hashToken berechnet den gespeicherten Hash eines API-Tokens
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString erzeugt eine zufällige, URL-sichere Zeichenkette aus n Bytes
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("fehler beim Erzeugen von Zufallsdaten: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
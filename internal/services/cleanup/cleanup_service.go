@@ -70,10 +70,35 @@ func (s *CleanupService) RunCleanup(ctx context.Context) error {
 	cutoffDate := time.Now().AddDate(0, 0, -s.config.RetentionDays)
 	log.Infof("Cleaning up data older than %s", cutoffDate.Format("2006-01-02"))
 	
+	if _, err := s.PurgeImages(ctx, cutoffDate); err != nil {
+		return err
+	}
+	
+	// Leere Identitäten ohne Matches bereinigen
+	result := s.db.Exec(`
+		DELETE FROM identities 
+		WHERE id NOT IN (
+			SELECT DISTINCT identity_id FROM matches
+		)
+	`)
+	
+	if result.Error != nil {
+		log.Errorf("Failed to clean up unused identities: %v", result.Error)
+	} else {
+		log.Infof("Removed %d unused identities", result.RowsAffected)
+	}
+	
+	return nil
+}
+
+// PurgeImages löscht alle Bilder, die vor dem angegebenen Zeitpunkt gespeichert wurden,
+// samt Dateien, Gesichtsausschnitten, Gesichtern und Treffern. Gibt die Anzahl der
+// gelöschten Bilder zurück.
+func (s *CleanupService) PurgeImages(ctx context.Context, before time.Time) (int, error) {
 	// 1. Alte Bilder in der Datenbank finden
 	var oldImages []models.Image
-	if err := s.db.Where("created_at < ?", cutoffDate).Find(&oldImages).Error; err != nil {
-		return fmt.Errorf("failed to find old images: %w", err)
+	if err := s.db.Where("created_at < ?", before).Find(&oldImages).Error; err != nil {
+		return 0, fmt.Errorf("failed to find old images: %w", err)
 	}
 	
 	log.Infof("Found %d images to clean up", len(oldImages))
@@ -83,6 +108,10 @@ func (s *CleanupService) RunCleanup(ctx context.Context) error {
 	var errorCount int
 	
 	for _, image := range oldImages {
+		if err := ctx.Err(); err != nil {
+			return deleteCount, err
+		}
+		
 		// Physische Datei löschen
 		if image.FilePath != "" {
 			filePath := filepath.Join(s.snapshotDir, image.FilePath)
@@ -94,6 +123,11 @@ func (s *CleanupService) RunCleanup(ctx context.Context) error {
 			}
 		}
 		
+		// Gesichtsausschnitte des Bildes löschen
+		if err := os.RemoveAll(filepath.Join(s.snapshotDir, image.FaceCropDir())); err != nil {
+			log.Warnf("Failed to delete face crops of image %d: %v", image.ID, err)
+		}
+		
 		// Datenbankeintrag löschen (cascaded zu Faces und Matches durch DB-Constraints)
 		if err := s.db.Delete(&image).Error; err != nil {
 			log.Errorf("Failed to delete image record ID %d: %v", image.ID, err)
@@ -105,20 +139,5 @@ func (s *CleanupService) RunCleanup(ctx context.Context) error {
 	}
 	
 	log.Infof("Cleanup completed: deleted %d images, encountered %d errors", deleteCount, errorCount)
-	
-	// 3. Leere Identitäten ohne Matches bereinigen
-	result := s.db.Exec(`
-		DELETE FROM identities 
-		WHERE id NOT IN (
-			SELECT DISTINCT identity_id FROM matches
-		)
-	`)
-	
-	if result.Error != nil {
-		log.Errorf("Failed to clean up unused identities: %v", result.Error)
-	} else {
-		log.Infof("Removed %d unused identities", result.RowsAffected)
-	}
-	
-	return nil
+	return deleteCount, nil
 }
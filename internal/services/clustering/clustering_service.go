@@ -0,0 +1,515 @@
+package clustering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// unknownFaceCondition wählt Gesichter ohne (nicht gelöschten) Treffer aus
+const unknownFaceCondition = "NOT EXISTS (SELECT 1 FROM matches WHERE matches.face_id = faces.id AND matches.deleted_at IS NULL)"
+
+// ErrClusterNamed wird zurückgegeben, wenn ein Cluster bereits einer Identität zugeordnet ist
+var ErrClusterNamed = errors.New("cluster has already been named")
+
+// Service gruppiert unbekannte Gesichter inkrementell per DBSCAN auf der Kosinus-Distanz
+// ihrer Embeddings. Neue Gesichter werden beim Speichern eingeordnet; ein regelmäßiger
+// Neuaufbau korrigiert Abweichungen der inkrementellen Zuordnung.
+type Service struct {
+	db              *gorm.DB
+	config          config.ClusteringConfig
+	rebuildInterval time.Duration
+	mu              sync.Mutex // Serialisiert Änderungen an den Clustern
+}
+
+// Summary fasst einen Cluster für Listen zusammen
+type Summary struct {
+	ID         uint      `json:"id"`
+	Provider   string    `json:"provider"`
+	Size       int       `json:"size"`
+	BestFaceID uint      `json:"best_face_id"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Cameras    []string  `json:"cameras"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// point ist ein Gesicht mit dekodiertem Embedding
+type point struct {
+	faceID    uint
+	vector    []float32
+	clusterID *uint
+}
+
+// NewService erstellt einen neuen Clustering-Service
+func NewService(db *gorm.DB, cfg config.ClusteringConfig) *Service {
+	return &Service{
+		db:              db,
+		config:          cfg,
+		rebuildInterval: 24 * time.Hour,
+	}
+}
+
+// Enabled gibt zurück, ob das Clustering aktiviert ist
+func (s *Service) Enabled() bool {
+	return s.config.Enabled
+}
+
+// TrainFaces gibt die Anzahl der Ausschnitte zurück, mit denen beim Benennen trainiert wird
+func (s *Service) TrainFaces() int {
+	if s.config.TrainFaces <= 0 {
+		return 1
+	}
+	return s.config.TrainFaces
+}
+
+// Start baut die Cluster beim Start und danach regelmäßig neu auf
+func (s *Service) Start(ctx context.Context) {
+	if !s.config.Enabled {
+		log.Info("Clustering unbekannter Gesichter ist deaktiviert")
+		return
+	}
+
+	if _, err := s.Rebuild(); err != nil {
+		log.Errorf("Fehler beim Aufbau der Gesichtscluster: %v", err)
+	}
+
+	ticker := time.NewTicker(s.rebuildInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Rebuild(); err != nil {
+				log.Errorf("Fehler beim Neuaufbau der Gesichtscluster: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// AddFace ordnet ein unbekanntes Gesicht inkrementell ein. Ist es ein Kernpunkt, werden
+// die Cluster seiner Kern-Nachbarn vereinigt und unzugeordnete Nachbarn aufgenommen.
+// Andernfalls tritt es dem Cluster des nächsten Kern-Nachbarn bei oder bleibt Rauschen.
+func (s *Service) AddFace(face *models.Face) error {
+	if !s.config.Enabled || len(face.Embedding) == 0 || face.EmbeddingProvider == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points, err := s.loadPoints(face.EmbeddingProvider)
+	if err != nil {
+		return err
+	}
+
+	// Das neue Gesicht ist bereits gespeichert und daher in der Liste enthalten
+	self := -1
+	for i := range points {
+		if points[i].faceID == face.ID {
+			self = i
+			break
+		}
+	}
+	if self < 0 {
+		points = append(points, point{faceID: face.ID, vector: face.EmbeddingVector()})
+		self = len(points) - 1
+	}
+
+	neighborhoods := map[int][]int{self: s.neighbors(points, self)}
+	for _, q := range neighborhoods[self] {
+		neighborhoods[q] = s.neighbors(points, q)
+	}
+	isCore := func(i int) bool {
+		return len(neighborhoods[i])+1 >= s.minSamples()
+	}
+
+	var cores []int
+	if isCore(self) {
+		cores = append(cores, self)
+		for _, q := range neighborhoods[self] {
+			if isCore(q) {
+				cores = append(cores, q)
+			}
+		}
+	} else {
+		// Randpunkt: dem nächsten Kern-Nachbarn zuordnen
+		nearest, best := -1, -1.0
+		for _, q := range neighborhoods[self] {
+			if similarity := models.CosineSimilarity(points[self].vector, points[q].vector); isCore(q) && similarity > best {
+				nearest, best = q, similarity
+			}
+		}
+		if nearest < 0 {
+			return nil
+		}
+		cores = []int{nearest}
+	}
+
+	members := make(map[int]bool)
+	for _, c := range cores {
+		members[c] = true
+		for _, q := range neighborhoods[c] {
+			if points[q].clusterID == nil {
+				members[q] = true
+			}
+		}
+	}
+	clusterIDs := clusterIDsOf(points, cores)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		target, err := s.mergeClusters(tx, face.EmbeddingProvider, clusterIDs)
+		if err != nil {
+			return err
+		}
+		faceIDs := make([]uint, 0, len(members))
+		for i := range members {
+			faceIDs = append(faceIDs, points[i].faceID)
+		}
+		if err := tx.Model(&models.Face{}).Where("id IN ?", faceIDs).Update("cluster_id", target).Error; err != nil {
+			return fmt.Errorf("fehler beim Zuordnen der Gesichter zu Cluster %d: %w", target, err)
+		}
+		face.ClusterID = &target
+		log.Debugf("Gesicht %d dem Cluster %d zugeordnet (%d Gesichter aktualisiert)", face.ID, target, len(faceIDs))
+		return nil
+	})
+}
+
+// Rebuild verwirft alle unbenannten Cluster und gruppiert die unbekannten Gesichter
+// jedes Providers neu. Zurückgegeben wird die Anzahl der gebildeten Cluster.
+func (s *Service) Rebuild() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var providers []string
+	if err := s.unknownFaces(s.db).Where("faces.embedding_provider <> ''").
+		Distinct("faces.embedding_provider").Pluck("faces.embedding_provider", &providers).Error; err != nil {
+		return 0, fmt.Errorf("fehler beim Laden der Embedding-Provider: %w", err)
+	}
+
+	// Gruppen vor der Transaktion berechnen; bestehende Zuordnungen spielen dafür keine Rolle
+	groups := make(map[string][][]uint, len(providers))
+	for _, provider := range providers {
+		points, err := s.loadPoints(provider)
+		if err != nil {
+			return 0, err
+		}
+		for _, group := range s.dbscan(points) {
+			faceIDs := make([]uint, len(group))
+			for i, p := range group {
+				faceIDs[i] = points[p].faceID
+			}
+			groups[provider] = append(groups[provider], faceIDs)
+		}
+	}
+
+	total := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		unnamed := tx.Model(&models.FaceCluster{}).Select("id").Where("identity_id IS NULL")
+		if err := tx.Model(&models.Face{}).Where("cluster_id IN (?)", unnamed).Update("cluster_id", nil).Error; err != nil {
+			return fmt.Errorf("fehler beim Zurücksetzen der Cluster: %w", err)
+		}
+		if err := tx.Where("identity_id IS NULL").Delete(&models.FaceCluster{}).Error; err != nil {
+			return fmt.Errorf("fehler beim Löschen der Cluster: %w", err)
+		}
+
+		for provider, providerGroups := range groups {
+			for _, faceIDs := range providerGroups {
+				cluster := models.FaceCluster{Provider: provider}
+				if err := tx.Create(&cluster).Error; err != nil {
+					return fmt.Errorf("fehler beim Anlegen eines Clusters: %w", err)
+				}
+				if err := tx.Model(&models.Face{}).Where("id IN ?", faceIDs).Update("cluster_id", cluster.ID).Error; err != nil {
+					return fmt.Errorf("fehler beim Zuordnen der Gesichter zu Cluster %d: %w", cluster.ID, err)
+				}
+				total++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Infof("Gesichtscluster neu aufgebaut: %d Cluster", total)
+	return total, nil
+}
+
+// List gibt die unbenannten Cluster mit ihren unbekannten Gesichtern zurück, größte zuerst
+func (s *Service) List() ([]Summary, error) {
+	var rows []struct {
+		FaceID    uint
+		ClusterID uint
+		Quality   float64
+		Timestamp time.Time
+		Source    string
+	}
+	err := s.unknownFaces(s.db).
+		Joins("JOIN face_clusters ON face_clusters.id = faces.cluster_id").
+		Where("face_clusters.identity_id IS NULL").
+		Order("faces.quality DESC").
+		Select("faces.id AS face_id, faces.cluster_id, faces.quality, images.timestamp, images.source").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Cluster: %w", err)
+	}
+
+	var clusters []models.FaceCluster
+	if err := s.db.Where("identity_id IS NULL").Find(&clusters).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Cluster: %w", err)
+	}
+	byID := make(map[uint]*Summary, len(clusters))
+	for _, cluster := range clusters {
+		byID[cluster.ID] = &Summary{ID: cluster.ID, Provider: cluster.Provider, CreatedAt: cluster.CreatedAt, Cameras: []string{}}
+	}
+
+	for _, row := range rows {
+		summary, ok := byID[row.ClusterID]
+		if !ok {
+			continue
+		}
+		// Zeilen sind nach Qualität sortiert, das erste Gesicht ist das beste
+		if summary.Size == 0 {
+			summary.BestFaceID = row.FaceID
+			summary.FirstSeen, summary.LastSeen = row.Timestamp, row.Timestamp
+		}
+		summary.Size++
+		if row.Timestamp.Before(summary.FirstSeen) {
+			summary.FirstSeen = row.Timestamp
+		}
+		if row.Timestamp.After(summary.LastSeen) {
+			summary.LastSeen = row.Timestamp
+		}
+		if row.Source != "" && !contains(summary.Cameras, row.Source) {
+			summary.Cameras = append(summary.Cameras, row.Source)
+		}
+	}
+
+	summaries := make([]Summary, 0, len(byID))
+	for _, summary := range byID {
+		if summary.Size > 0 {
+			summaries = append(summaries, *summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Size != summaries[j].Size {
+			return summaries[i].Size > summaries[j].Size
+		}
+		return summaries[i].LastSeen.After(summaries[j].LastSeen)
+	})
+	return summaries, nil
+}
+
+// Get lädt einen Cluster
+func (s *Service) Get(id uint) (*models.FaceCluster, error) {
+	var cluster models.FaceCluster
+	if err := s.db.First(&cluster, id).Error; err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// Members gibt die unbekannten Gesichter eines Clusters samt Bild zurück, beste zuerst
+func (s *Service) Members(clusterID uint) ([]models.Face, error) {
+	var faces []models.Face
+	err := s.unknownFaces(s.db).
+		Preload("Image").
+		Where("faces.cluster_id = ?", clusterID).
+		Order("faces.quality DESC").
+		Find(&faces).Error
+	if err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der Gesichter von Cluster %d: %w", clusterID, err)
+	}
+	return faces, nil
+}
+
+// Assign ordnet alle Gesichter eines Clusters der Identität zu und markiert den Cluster
+// als benannt. Es wird die übergebene Transaktion verwendet.
+func (s *Service) Assign(tx *gorm.DB, cluster *models.FaceCluster, identity models.Identity, faces []models.Face) ([]models.Match, error) {
+	if cluster.IdentityID != nil {
+		return nil, ErrClusterNamed
+	}
+
+	matches := make([]models.Match, 0, len(faces))
+	for _, face := range faces {
+		match := models.Match{FaceID: face.ID, IdentityID: identity.ID, Confidence: 1.0}
+		if err := tx.Omit("Face", "Identity").Create(&match).Error; err != nil {
+			return nil, fmt.Errorf("fehler beim Anlegen des Treffers für Gesicht %d: %w", face.ID, err)
+		}
+		matches = append(matches, match)
+	}
+
+	now := time.Now()
+	cluster.IdentityID = &identity.ID
+	cluster.NamedAt = &now
+	if err := tx.Model(cluster).Updates(map[string]interface{}{
+		"identity_id": identity.ID,
+		"named_at":    now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Aktualisieren von Cluster %d: %w", cluster.ID, err)
+	}
+	return matches, nil
+}
+
+// unknownFaces gibt eine Abfrage auf die Gesichter ohne Treffer zurück. Gesichter
+// gelöschter Bilder bleiben beim Löschen erhalten und werden hier ausgeschlossen.
+func (s *Service) unknownFaces(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Face{}).
+		Joins("JOIN images ON images.id = faces.image_id AND images.deleted_at IS NULL").
+		Where(unknownFaceCondition)
+}
+
+// loadPoints lädt die unbekannten Gesichter eines Providers im Zeitfenster. Gesichter
+// benannter Cluster gelten dabei als nicht zugeordnet.
+func (s *Service) loadPoints(provider string) ([]point, error) {
+	query := s.unknownFaces(s.db).
+		Where("faces.embedding_provider = ? AND faces.embedding IS NOT NULL", provider)
+	if s.config.WindowDays > 0 {
+		query = query.Where("faces.created_at >= ?", time.Now().AddDate(0, 0, -s.config.WindowDays))
+	}
+
+	var faces []models.Face
+	if err := query.Select("faces.id", "faces.embedding", "faces.cluster_id").Find(&faces).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der unbekannten Gesichter: %w", err)
+	}
+
+	var named []uint
+	if err := s.db.Model(&models.FaceCluster{}).Where("identity_id IS NOT NULL").Pluck("id", &named).Error; err != nil {
+		return nil, fmt.Errorf("fehler beim Laden der benannten Cluster: %w", err)
+	}
+	namedSet := make(map[uint]bool, len(named))
+	for _, id := range named {
+		namedSet[id] = true
+	}
+
+	points := make([]point, 0, len(faces))
+	for _, face := range faces {
+		if len(face.Embedding) == 0 {
+			continue
+		}
+		p := point{faceID: face.ID, vector: face.EmbeddingVector(), clusterID: face.ClusterID}
+		if p.clusterID != nil && namedSet[*p.clusterID] {
+			p.clusterID = nil
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// mergeClusters vereinigt die Cluster in den mit der kleinsten ID oder legt einen neuen an
+func (s *Service) mergeClusters(tx *gorm.DB, provider string, clusterIDs []uint) (uint, error) {
+	if len(clusterIDs) == 0 {
+		cluster := models.FaceCluster{Provider: provider}
+		if err := tx.Create(&cluster).Error; err != nil {
+			return 0, fmt.Errorf("fehler beim Anlegen eines Clusters: %w", err)
+		}
+		return cluster.ID, nil
+	}
+
+	target, others := clusterIDs[0], clusterIDs[1:]
+	if len(others) > 0 {
+		if err := tx.Model(&models.Face{}).Where("cluster_id IN ?", others).Update("cluster_id", target).Error; err != nil {
+			return 0, fmt.Errorf("fehler beim Zusammenführen der Cluster: %w", err)
+		}
+		if err := tx.Where("id IN ?", others).Delete(&models.FaceCluster{}).Error; err != nil {
+			return 0, fmt.Errorf("fehler beim Löschen zusammengeführter Cluster: %w", err)
+		}
+		log.Debugf("Cluster %v in Cluster %d zusammengeführt", others, target)
+	}
+	return target, nil
+}
+
+// dbscan gruppiert die Punkte und gibt die Indizes je Cluster zurück; Rauschen fehlt
+func (s *Service) dbscan(points []point) [][]int {
+	const unvisited, noise = 0, -1
+	labels := make([]int, len(points))
+	var clusters [][]int
+
+	for i := range points {
+		if labels[i] != unvisited {
+			continue
+		}
+		neighbors := s.neighbors(points, i)
+		if len(neighbors)+1 < s.minSamples() {
+			labels[i] = noise
+			continue
+		}
+
+		label := len(clusters) + 1
+		labels[i] = label
+		group := []int{i}
+		queue := append([]int(nil), neighbors...)
+		for len(queue) > 0 {
+			q := queue[0]
+			queue = queue[1:]
+			if labels[q] == noise {
+				labels[q] = label
+				group = append(group, q)
+			}
+			if labels[q] != unvisited {
+				continue
+			}
+			labels[q] = label
+			group = append(group, q)
+			if next := s.neighbors(points, q); len(next)+1 >= s.minSamples() {
+				queue = append(queue, next...)
+			}
+		}
+		clusters = append(clusters, group)
+	}
+	return clusters
+}
+
+// neighbors gibt die Indizes aller Punkte innerhalb von eps zurück (ohne den Punkt selbst)
+func (s *Service) neighbors(points []point, i int) []int {
+	var result []int
+	for j := range points {
+		if j != i && 1-models.CosineSimilarity(points[i].vector, points[j].vector) <= s.config.Eps {
+			result = append(result, j)
+		}
+	}
+	return result
+}
+
+// minSamples gibt die Mindestgröße der Nachbarschaft eines Kernpunkts zurück
+func (s *Service) minSamples() int {
+	if s.config.MinSamples < 1 {
+		return 1
+	}
+	return s.config.MinSamples
+}
+
+// clusterIDsOf gibt die aufsteigend sortierten, eindeutigen Cluster der Punkte zurück
+func clusterIDsOf(points []point, indices []int) []uint {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, i := range indices {
+		if id := points[i].clusterID; id != nil && !seen[*id] {
+			seen[*id] = true
+			ids = append(ids, *id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// contains prüft, ob ein Wert in der Liste enthalten ist
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"double-take-go-reborn/config"
+	"double-take-go-reborn/internal/core/models"
+	"double-take-go-reborn/internal/util/timezone"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Listener wird bei jeder Ankunft und jedem Verlassen aufgerufen
+type Listener func(event models.PresenceEvent)
+
+// Filter schränkt die Abfrage gespeicherter Aufenthalte ein
+type Filter struct {
+	IdentityID uint      // Nur Aufenthalte dieser Identität (optional)
+	Camera     string    // Nur Aufenthalte dieser Kamera (optional)
+	Since      time.Time // Nur Aufenthalte, die ab diesem Zeitpunkt begonnen haben (optional)
+	Until      time.Time // Nur Aufenthalte, die bis zu diesem Zeitpunkt begonnen haben (optional)
+	OpenOnly   bool      // Nur laufende Aufenthalte
+	Limit      int
+	Offset     int
+}
+
+// sessionKey identifiziert einen Aufenthalt einer Identität insgesamt, an einer Kamera
+// oder in einer Zone
+type sessionKey struct {
+	identityID uint
+	camera     string
+	zone       string
+}
+
+// level gibt an, wie spezifisch ein Aufenthalt ist (0 = insgesamt, 1 = Kamera, 2 = Zone)
+func (k sessionKey) level() int {
+	switch {
+	case k.zone != "":
+		return 2
+	case k.camera != "":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// contains prüft, ob ein spezifischerer Aufenthalt zu diesem gehört
+func (k sessionKey) contains(other sessionKey) bool {
+	if k.identityID != other.identityID || other.level() <= k.level() {
+		return false
+	}
+	return k.camera == "" || k.camera == other.camera
+}
+
+// Service fasst die Erkennungen einer Identität zu Aufenthalten zusammen: insgesamt, je
+// Kamera und optional je Zone. Ein Aufenthalt beginnt mit der ersten Erkennung und endet,
+// wenn die Identität für die Dauer des Timeouts nicht mehr erkannt wurde. Aufenthalte
+// werden in der Datenbank gespeichert und nach einem Neustart fortgesetzt.
+type Service struct {
+	db            *gorm.DB
+	config        config.PresenceConfig
+	checkInterval time.Duration
+	mu            sync.Mutex // Schützt open und loaded
+	open          map[sessionKey]*models.PresenceSession
+	loaded        bool
+	listeners     []Listener
+}
+
+// NewService erstellt einen neuen Anwesenheits-Service
+func NewService(db *gorm.DB, cfg config.PresenceConfig) *Service {
+	return &Service{
+		db:            db,
+		config:        cfg,
+		checkInterval: 5 * time.Second,
+		open:          make(map[sessionKey]*models.PresenceSession),
+	}
+}
+
+// Enabled gibt zurück, ob die Anwesenheitserkennung aktiviert ist
+func (s *Service) Enabled() bool {
+	return s.config.Enabled
+}
+
+// AddListener registriert einen Empfänger für Ankunft und Verlassen. Listener müssen vor
+// Start registriert werden.
+func (s *Service) AddListener(listener Listener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// Start lädt die offenen Aufenthalte und beendet danach regelmäßig alle, deren Timeout
+// abgelaufen ist. Aufenthalte, die während eines Neustarts abgelaufen sind, werden
+// dabei ebenfalls beendet und gemeldet.
+func (s *Service) Start(ctx context.Context) {
+	if !s.config.Enabled {
+		log.Info("Anwesenheitserkennung ist deaktiviert")
+		return
+	}
+
+	s.mu.Lock()
+	err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		log.Errorf("Fehler beim Laden der offenen Aufenthalte: %v", err)
+	}
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		s.expire(timezone.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Observe meldet die Erkennung einer Identität an einer Kamera und in ihren Zonen.
+// Erkennungen, die älter als der Timeout sind (z.B. aus einem Backfill), werden
+// ignoriert, damit sie keine bereits vergangenen Aufenthalte melden.
+func (s *Service) Observe(identity models.Identity, camera string, zones []string, confidence float64, imageID uint, at time.Time) {
+	if !s.config.Enabled || identity.ID == 0 {
+		return
+	}
+	if timezone.Now().Sub(at) > s.timeout(sessionKey{}) {
+		log.Debugf("Ignoriere veraltete Erkennung von '%s' an Kamera %s für die Anwesenheit", identity.Name, camera)
+		return
+	}
+
+	keys := []sessionKey{{identityID: identity.ID}}
+	if camera != "" {
+		keys = append(keys, sessionKey{identityID: identity.ID, camera: camera})
+		if s.config.Zones {
+			for _, zone := range zones {
+				if zone = strings.TrimSpace(zone); zone != "" {
+					keys = append(keys, sessionKey{identityID: identity.ID, camera: camera, zone: zone})
+				}
+			}
+		}
+	}
+
+	var events []models.PresenceEvent
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		log.Errorf("Fehler beim Laden der offenen Aufenthalte: %v", err)
+	}
+	for _, key := range keys {
+		session, ok := s.open[key]
+		if !ok {
+			session = &models.PresenceSession{
+				IdentityID:     identity.ID,
+				Camera:         key.camera,
+				Zone:           key.zone,
+				StartedAt:      at,
+				LastSeenAt:     at,
+				Detections:     1,
+				BestConfidence: confidence,
+				ImageID:        imageID,
+			}
+			if err := s.db.Create(session).Error; err != nil {
+				log.Errorf("Fehler beim Speichern des Aufenthalts von '%s': %v", identity.Name, err)
+				continue
+			}
+			session.Identity = identity
+			s.open[key] = session
+			events = append(events, models.PresenceEvent{Type: models.PresenceArrived, Session: *session})
+			continue
+		}
+
+		session.Identity = identity
+		session.Detections++
+		if at.After(session.LastSeenAt) {
+			session.LastSeenAt = at
+		}
+		if confidence > session.BestConfidence {
+			session.BestConfidence = confidence
+			session.ImageID = imageID
+		}
+		if err := s.db.Model(session).Select("LastSeenAt", "Detections", "BestConfidence", "ImageID").Updates(session).Error; err != nil {
+			log.Errorf("Fehler beim Aktualisieren des Aufenthalts %d: %v", session.ID, err)
+		}
+	}
+	s.mu.Unlock()
+
+	s.notify(events)
+}
+
+// Current gibt alle laufenden Aufenthalte zurück, zuletzt gesehene zuerst
+func (s *Service) Current() []models.PresenceSession {
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		log.Errorf("Fehler beim Laden der offenen Aufenthalte: %v", err)
+	}
+	sessions := make([]models.PresenceSession, 0, len(s.open))
+	for _, session := range s.open {
+		sessions = append(sessions, *session)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions
+}
+
+// Sessions gibt gespeicherte Aufenthalte zurück, neueste zuerst, samt Gesamtanzahl
+func (s *Service) Sessions(filter Filter) ([]models.PresenceSession, int64, error) {
+	query := s.db.Model(&models.PresenceSession{})
+	if filter.IdentityID != 0 {
+		query = query.Where("identity_id = ?", filter.IdentityID)
+	}
+	if filter.Camera != "" {
+		query = query.Where("camera = ?", filter.Camera)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("started_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("started_at <= ?", filter.Until)
+	}
+	if filter.OpenOnly {
+		query = query.Where("ended_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("fehler beim Zählen der Aufenthalte: %w", err)
+	}
+
+	var sessions []models.PresenceSession
+	err := query.Preload("Identity").
+		Order("started_at DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("fehler beim Laden der Aufenthalte: %w", err)
+	}
+	return sessions, total, nil
+}
+
+// expire beendet alle Aufenthalte, deren Timeout abgelaufen ist. Ein Aufenthalt endet
+// erst, wenn auch alle spezifischeren Aufenthalte derselben Identität beendet sind, damit
+// z.B. die Gesamt-Anwesenheit nicht vor der an einer Kamera mit längerem Timeout endet.
+func (s *Service) expire(now time.Time) {
+	s.mu.Lock()
+	keys := make([]sessionKey, 0, len(s.open))
+	for key := range s.open {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].level() > keys[j].level() })
+
+	var events []models.PresenceEvent
+	for _, key := range keys {
+		session := s.open[key]
+		if now.Sub(session.LastSeenAt) <= s.timeout(key) || s.hasOpenChild(key) {
+			continue
+		}
+
+		endedAt := session.LastSeenAt
+		session.EndedAt = &endedAt
+		if err := s.db.Model(session).Update("ended_at", endedAt).Error; err != nil {
+			log.Errorf("Fehler beim Beenden des Aufenthalts %d: %v", session.ID, err)
+			session.EndedAt = nil
+			continue
+		}
+		delete(s.open, key)
+		events = append(events, models.PresenceEvent{Type: models.PresenceLeft, Session: *session})
+	}
+	s.mu.Unlock()
+
+	s.notify(events)
+}
+
+// hasOpenChild prüft, ob zu einem Aufenthalt noch ein spezifischerer offen ist.
+// Muss mit gehaltenem Mutex aufgerufen werden.
+func (s *Service) hasOpenChild(key sessionKey) bool {
+	if key.level() == 2 {
+		return false
+	}
+	for other := range s.open {
+		if key.contains(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// load lädt die offenen Aufenthalte einmalig aus der Datenbank. Muss mit gehaltenem
+// Mutex aufgerufen werden.
+func (s *Service) load() error {
+	if s.loaded {
+		return nil
+	}
+
+	var sessions []models.PresenceSession
+	if err := s.db.Preload("Identity").Where("ended_at IS NULL").Find(&sessions).Error; err != nil {
+		return err
+	}
+	for i := range sessions {
+		session := &sessions[i]
+		key := sessionKey{identityID: session.IdentityID, camera: session.Camera, zone: session.Zone}
+		s.open[key] = session
+	}
+	s.loaded = true
+
+	if len(sessions) > 0 {
+		log.Infof("%d offene Aufenthalte wiederhergestellt", len(sessions))
+	}
+	return nil
+}
+
+// timeout gibt die Zeit ohne Erkennung zurück, nach der ein Aufenthalt endet. Zonen
+// verwenden ohne eigenen Wert den Timeout ihrer Kamera.
+func (s *Service) timeout(key sessionKey) time.Duration {
+	seconds := s.config.Timeout
+	if key.camera != "" {
+		if value, ok := s.config.CameraTimeouts[strings.ToLower(key.camera)]; ok {
+			seconds = value
+		}
+	}
+	if key.zone != "" {
+		if value, ok := s.config.ZoneTimeouts[strings.ToLower(key.zone)]; ok {
+			seconds = value
+		}
+	}
+	if seconds <= 0 {
+		seconds = 300
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// notify meldet die Ereignisse an alle Listener
+func (s *Service) notify(events []models.PresenceEvent) {
+	for _, event := range events {
+		session := event.Session
+		log.Infof("Anwesenheit: '%s' %s (Kamera: %q, Zone: %q)", session.Identity.Name, event.Type, session.Camera, session.Zone)
+		for _, listener := range s.listeners {
+			listener(event)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package similarity
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"double-take-go-reborn/internal/core/models"
+
+	"gorm.io/gorm"
+)
+
+// Standardwerte für die Suche
+const (
+	DefaultLimit         = 50
+	MaxLimit             = 500
+	DefaultMinSimilarity = 0.5
+	batchSize            = 1000
+)
+
+// Query beschreibt eine Ähnlichkeitssuche über alle gespeicherten Gesichter
+type Query struct {
+	Vector        []float32 // Normalisierter Suchvektor (siehe models.EncodeVector)
+	Provider      string    // Nur Vektoren dieses Providers sind vergleichbar
+	Since         time.Time // Nur Aufnahmen ab diesem Zeitpunkt (optional)
+	Until         time.Time // Nur Aufnahmen bis zu diesem Zeitpunkt (optional)
+	Cameras       []string  // Nur Aufnahmen dieser Kameras (optional)
+	MinSimilarity float64   // Minimale Kosinus-Ähnlichkeit
+	Limit         int       // Maximale Anzahl Ergebnisse
+	ExcludeFaceID uint      // Gesicht, nach dem gesucht wird, nicht mit ausgeben
+}
+
+// Result ist ein ähnliches Gesicht mit den Angaben zu seiner Aufnahme
+type Result struct {
+	FaceID     uint      `json:"face_id"`
+	ImageID    uint      `json:"image_id"`
+	Similarity float64   `json:"similarity"`
+	Quality    float64   `json:"quality"`
+	Timestamp  time.Time `json:"timestamp"`
+	Camera     string    `json:"camera"`
+	Zone       string    `json:"zone,omitempty"`
+	EventID    string    `json:"event_id,omitempty"`
+	Identity   string    `json:"identity,omitempty"`
+	CropURL    string    `json:"crop_url"`
+	ImageURL   string    `json:"image_url"`
+}
+
+// Service durchsucht die gespeicherten Embeddings aller Gesichter
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService erstellt einen neuen Suchdienst
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// candidate ist eine Zeile der Suche samt Embedding
+type candidate struct {
+	FaceID    uint
+	ImageID   uint
+	Embedding []byte
+	Quality   float64
+	Timestamp time.Time
+	Source    string
+	Zone      string
+	EventID   string
+	FilePath  string
+}
+
+// Search vergleicht den Suchvektor mit allen passenden Gesichtern und gibt die
+// ähnlichsten absteigend sortiert zurück. Die Gesichter werden in Blöcken geladen,
+// damit auch eine lange Historie nicht vollständig im Speicher liegt.
+func (s *Service) Search(query Query) ([]Result, error) {
+	if len(query.Vector) == 0 {
+		return nil, fmt.Errorf("empty search vector")
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit > MaxLimit {
+		query.Limit = MaxLimit
+	}
+
+	base := s.db.Table("faces").
+		Joins("JOIN images ON images.id = faces.image_id AND images.deleted_at IS NULL").
+		Where("faces.deleted_at IS NULL AND faces.embedding IS NOT NULL AND faces.embedding_provider = ?", query.Provider)
+	if !query.Since.IsZero() {
+		base = base.Where("images.timestamp >= ?", query.Since)
+	}
+	if !query.Until.IsZero() {
+		base = base.Where("images.timestamp <= ?", query.Until)
+	}
+	if len(query.Cameras) > 0 {
+		base = base.Where("images.source IN ?", query.Cameras)
+	}
+	if query.ExcludeFaceID != 0 {
+		base = base.Where("faces.id <> ?", query.ExcludeFaceID)
+	}
+
+	best := &resultHeap{}
+	var lastID uint
+	for {
+		var batch []candidate
+		err := base.Session(&gorm.Session{}).
+			Select("faces.id AS face_id, faces.image_id, faces.embedding, faces.quality, images.timestamp, images.source, images.zone, images.event_id, images.file_path").
+			Where("faces.id > ?", lastID).
+			Order("faces.id").
+			Limit(batchSize).
+			Scan(&batch).Error
+		if err != nil {
+			return nil, fmt.Errorf("fehler beim Laden der Gesichter: %w", err)
+		}
+
+		for _, row := range batch {
+			similarity := models.CosineSimilarity(query.Vector, models.DecodeVector(row.Embedding))
+			if similarity < query.MinSimilarity {
+				continue
+			}
+			if best.Len() < query.Limit {
+				heap.Push(best, result(row, similarity))
+			} else if similarity > (*best)[0].Similarity {
+				(*best)[0] = result(row, similarity)
+				heap.Fix(best, 0)
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+		lastID = batch[len(batch)-1].FaceID
+	}
+
+	// Heap in absteigender Reihenfolge leeren
+	results := make([]Result, best.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(best).(Result)
+	}
+
+	if err := s.resolveIdentities(results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// resolveIdentities trägt zu jedem Ergebnis die Identität des besten Treffers ein
+func (s *Service) resolveIdentities(results []Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+	faceIDs := make([]uint, len(results))
+	for i, r := range results {
+		faceIDs[i] = r.FaceID
+	}
+
+	var rows []struct {
+		FaceID uint
+		Name   string
+	}
+	err := s.db.Model(&models.Match{}).
+		Select("matches.face_id, identities.name").
+		Joins("JOIN identities ON identities.id = matches.identity_id AND identities.deleted_at IS NULL").
+		Where("matches.face_id IN ?", faceIDs).
+		Order("matches.confidence ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("fehler beim Laden der Treffer: %w", err)
+	}
+
+	// Aufsteigend sortiert, der letzte (sicherste) Treffer je Gesicht gewinnt
+	names := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		names[row.FaceID] = row.Name
+	}
+	for i := range results {
+		results[i].Identity = names[results[i].FaceID]
+	}
+	return nil
+}
+
+// result baut ein Suchergebnis aus einer Zeile
+func result(row candidate, similarity float64) Result {
+	return Result{
+		FaceID:     row.FaceID,
+		ImageID:    row.ImageID,
+		Similarity: similarity,
+		Quality:    row.Quality,
+		Timestamp:  row.Timestamp,
+		Camera:     row.Source,
+		Zone:       row.Zone,
+		EventID:    row.EventID,
+		CropURL:    fmt.Sprintf("/api/faces/%d/crop", row.FaceID),
+		ImageURL:   "/snapshots/" + row.FilePath,
+	}
+}
+
+// resultHeap ist ein Min-Heap nach Ähnlichkeit; die Wurzel ist das schwächste der
+// bisher besten Ergebnisse
+type resultHeap []Result
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].Similarity < h[j].Similarity }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(Result)) }
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -15,11 +15,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// ImageReprocessor verarbeitet gespeicherte Bilder erneut (implementiert durch den ImageProcessor)
+type ImageReprocessor interface {
+	// ReprocessImage führt die Gesichtserkennung für ein vorhandenes Bild erneut aus
+	ReprocessImage(ctx context.Context, imageID uint) error
+
+	// CanReprocess gibt an, ob derzeit ein Gesichtserkennungsanbieter verfügbar ist
+	CanReprocess() bool
+}
+
 // Service ist verantwortlich für die Verarbeitung ausstehender Operationen mit externen Diensten
 type Service struct {
 	db         *gorm.DB
 	cfg        *config.Config
 	compreface *compreface.APIClient
+	reprocessor ImageReprocessor
 	stopCh     chan struct{}
 	wg         sync.WaitGroup
 	running    bool
@@ -36,6 +46,11 @@ func NewService(db *gorm.DB, cfg *config.Config, compreface *compreface.APIClien
 	}
 }
 
+// SetImageReprocessor setzt den Dienst, mit dem fehlgeschlagene Bilder erneut verarbeitet werden
+func (s *Service) SetImageReprocessor(reprocessor ImageReprocessor) {
+	s.reprocessor = reprocessor
+}
+
 // Start startet den SyncService
 func (s *Service) Start() {
 	s.mutex.Lock()
@@ -129,6 +144,17 @@ func (s *Service) processPendingOperations() {
 		case models.POTypeAddExample:
 			err = s.processAddExample(op)
 			success = (err == nil)
+		case models.POTypeDeleteExample:
+			err = s.processDeleteExample(op)
+			success = (err == nil)
+		case models.POTypeReprocessImage:
+			// Solange kein Provider verfügbar ist, warten ohne Versuche zu verbrauchen
+			if s.reprocessor != nil && !s.reprocessor.CanReprocess() {
+				log.Debugf("Kein Gesichtserkennungsanbieter verfügbar, Neuverarbeitung von Bild ID %d zurückgestellt", op.ResourceID)
+				continue
+			}
+			err = s.processReprocessImage(op)
+			success = (err == nil)
 		default:
 			log.Warnf("Unbekannter Operationstyp: %s, markiere als fehlgeschlagen", op.OperationType)
 			op.Status = models.POStatusFailed
@@ -277,3 +303,36 @@ func (s *Service) processAddExample(op *models.PendingOperation) error {
 
 	return fmt.Errorf("Hinzufügen von Beispielen aus ausstehenden Operationen noch nicht implementiert")
 }
+
+// processDeleteExample entfernt ein Trainingsbeispiel in CompreFace, dessen Löschung
+// fehlgeschlagen war. ResourceName ist die ID des Beispiels.
+func (s *Service) processDeleteExample(op *models.PendingOperation) error {
+	if !s.cfg.CompreFace.Enabled || s.compreface == nil {
+		return fmt.Errorf("CompreFace ist nicht aktiviert")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.compreface.DeleteSubjectExample(ctx, op.ResourceName); err != nil {
+		return fmt.Errorf("Fehler beim Löschen des Beispiels in CompreFace: %w", err)
+	}
+
+	return nil
+}
+
+// processReprocessImage verarbeitet ein Bild erneut, dessen Gesichtserkennung fehlgeschlagen war
+func (s *Service) processReprocessImage(op *models.PendingOperation) error {
+	if s.reprocessor == nil {
+		return fmt.Errorf("Keine Bildverarbeitung für die Neuverarbeitung registriert")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if err := s.reprocessor.ReprocessImage(ctx, op.ResourceID); err != nil {
+		return fmt.Errorf("Fehler bei der Neuverarbeitung von Bild ID %d: %w", op.ResourceID, err)
+	}
+
+	return nil
+}
@@ -43,6 +43,14 @@ func Now() time.Time {
 	return time.Now().In(currentLocation)
 }
 
+// Location gibt die konfigurierte Zeitzone zurück
+func Location() *time.Location {
+	if currentLocation == nil {
+		Initialize()
+	}
+	return currentLocation
+}
+
 // Format formatiert ein time.Time-Objekt mit der konfigurierten Zeitzone
 func Format(t time.Time, layout string) string {
 	if currentLocation == nil {
@@ -33,7 +33,14 @@ type SystemStats struct {
 	// Worker-Pool-Statistiken
 	WorkerCount   int `json:"worker_count"`
 	ActiveJobs    int `json:"active_jobs"`
-	QueueCapacity int `json:"queue_capacity"`
+	
+	// Statistiken der Verarbeitungs-Queue (Zeiten in Sekunden)
+	QueueDepth        int64   `json:"queue_depth"`
+	QueueFailed       int64   `json:"queue_failed"`
+	QueueOldestWait   float64 `json:"queue_oldest_wait"`
+	QueueAvgWait      float64 `json:"queue_avg_wait"`
+	AvgProcessingTime float64 `json:"avg_processing_time"`
+	ProcessedJobs     int64   `json:"processed_jobs"`
 	
 	// Zeitstempel
 	Timestamp time.Time `json:"timestamp"`
@@ -107,7 +114,14 @@ func GetSystemStats(workerPool *processor.WorkerPool) *SystemStats {
 	if workerPool != nil {
 		stats.WorkerCount = workerPool.GetWorkerCount()
 		stats.ActiveJobs = workerPool.ActiveJobCount()
-		stats.QueueCapacity = workerPool.GetQueueCapacity()
+		
+		queueStats := workerPool.GetQueueStats()
+		stats.QueueDepth = queueStats.Depth
+		stats.QueueFailed = queueStats.Failed
+		stats.QueueOldestWait = queueStats.OldestWait.Seconds()
+		stats.QueueAvgWait = queueStats.AvgWaitTime.Seconds()
+		stats.AvgProcessingTime = queueStats.AvgProcessingTime.Seconds()
+		stats.ProcessedJobs = queueStats.ProcessedJobs
 	}
 	
 	return stats